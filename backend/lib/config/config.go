@@ -1,17 +1,19 @@
-// Package config is the Lumium config wrapper
+// Package config is the Lumium config wrapper. Settings come from the environment, from a file
+// named by KEY_FILE (Docker secrets), or from the optional CONFIG_FILE, in that order. Load fills
+// a struct from its `env` tags; the May* and Must* helpers read one key at a time
 package config
 
 import (
 	"lumium/lib/logger"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // MustString expects an environment variable, and panics if it doesn't exist
 func MustString(key string) string {
 	l := logger.Get()
-	v := os.Getenv(key)
+	v := lookupOrWarn(key)
 	if v == "" {
 		l.Panic().Str("key", key).Msg("Unknown key")
 	}
@@ -42,7 +44,7 @@ func MustPort(key string) string {
 
 // MayString returns the env value or def if unset/empty (trimmed).
 func MayString(key, def string) string {
-	v := strings.TrimSpace(os.Getenv(key))
+	v := lookupOrWarn(key)
 	if v == "" {
 		return def
 	}
@@ -51,7 +53,7 @@ func MayString(key, def string) string {
 
 // MayInt returns the int value of the env var, or def if unset/invalid.
 func MayInt(key string, def int) int {
-	s := strings.TrimSpace(os.Getenv(key))
+	s := lookupOrWarn(key)
 	if s == "" {
 		return def
 	}
@@ -67,7 +69,7 @@ func MayInt(key string, def int) int {
 // MayBool returns the bool value of the env var, or def if unset/invalid.
 // Accepts: 1/0, t/true/f/false (case-insensitive)
 func MayBool(key string, def bool) bool {
-	s := strings.TrimSpace(os.Getenv(key))
+	s := lookupOrWarn(key)
 	if s == "" {
 		return def
 	}
@@ -78,4 +80,31 @@ func MayBool(key string, def bool) bool {
 		return def
 	}
 	return v
-}
\ No newline at end of file
+}
+
+// MayDuration returns the duration value of the env var, or def if unset/invalid.
+// Accepts Go durations ("500ms", "30m") or a bare integer number of seconds
+func MayDuration(key string, def time.Duration) time.Duration {
+	s := lookupOrWarn(key)
+	if s == "" {
+		return def
+	}
+	v, err := parseDuration(s)
+	if err != nil {
+		l := logger.Get()
+		l.Warn().Str("key", key).Str("value", s).Dur("default", def).Msg("Invalid duration; using default")
+		return def
+	}
+	return v
+}
+
+// MayList returns the comma-separated env value as trimmed, non-empty items, or nil if unset
+func MayList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(lookupOrWarn(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
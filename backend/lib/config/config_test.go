@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -85,3 +86,48 @@ func TestMustPort(t *testing.T) {
 		So(func() { MustPort(key) }, ShouldPanic)
 	})
 }
+
+// TestMayDuration tests durations in both accepted forms
+func TestMayDuration(t *testing.T) {
+	Convey("MayDuration parses Go durations", t, func() {
+		key := "TEST_KEY_DURATION"
+		os.Setenv(key, "1m30s")
+		defer os.Unsetenv(key)
+
+		So(MayDuration(key, time.Second), ShouldEqual, 90*time.Second)
+	})
+
+	Convey("MayDuration treats a bare integer as seconds", t, func() {
+		key := "TEST_KEY_DURATION_SECONDS"
+		os.Setenv(key, "45")
+		defer os.Unsetenv(key)
+
+		So(MayDuration(key, time.Second), ShouldEqual, 45*time.Second)
+	})
+
+	Convey("MayDuration falls back to the default when unset or invalid", t, func() {
+		key := "BAD_KEY_DURATION"
+		os.Unsetenv(key)
+		So(MayDuration(key, time.Minute), ShouldEqual, time.Minute)
+
+		os.Setenv(key, "soon")
+		defer os.Unsetenv(key)
+		So(MayDuration(key, time.Minute), ShouldEqual, time.Minute)
+	})
+}
+
+// TestMayList tests comma-separated values
+func TestMayList(t *testing.T) {
+	Convey("MayList splits, trims and drops empty items", t, func() {
+		key := "TEST_KEY_LIST"
+		os.Setenv(key, " a, b ,,c ")
+		defer os.Unsetenv(key)
+
+		So(MayList(key), ShouldResemble, []string{"a", "b", "c"})
+	})
+
+	Convey("MayList is nil when unset", t, func() {
+		os.Unsetenv("MISSING_KEY_LIST")
+		So(MayList("MISSING_KEY_LIST"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"lumium/lib/logger"
+)
+
+// Redacted stands in for a secret in Dump
+const Redacted = "[redacted]"
+
+// Problem is one setting that couldn't be loaded
+type Problem struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// LoadError lists every setting that couldn't be loaded, so a misconfigured service reports them
+// all at once instead of one per restart
+type LoadError struct {
+	Problems []Problem
+}
+
+func (e *LoadError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.Key + ": " + p.Message
+		if p.Key == "" {
+			parts[i] = p.Message
+		}
+	}
+	return "config: " + strings.Join(parts, "; ")
+}
+
+// Validator is implemented by config structs that check their settings together once loaded
+type Validator interface {
+	Validate() error
+}
+
+// Load fills the struct dst points to from its fields' tags:
+//
+//	type Config struct {
+//		Secret []byte        `env:"JWT_SECRET,required,secret"`
+//		TTL    time.Duration `env:"AUTH_ACCESS_TTL" default:"10m"`
+//		Hosts  []string      `env:"SERVICE_PGSQL_REPLICA_URLS"`
+//	}
+//
+// A value comes from the environment, KEY_FILE or CONFIG_FILE, else from the default tag; a
+// required one must be set by one of them. Durations are Go durations or bare seconds, lists
+// are comma-separated, and an encoding.TextUnmarshaler parses itself. Untagged struct fields are
+// loaded in turn. Every problem is returned in one *LoadError, after dst's Validate if it has one
+func Load(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load wants a pointer to a struct, got %T", dst)
+	}
+	var problems []Problem
+	load(v.Elem(), &problems)
+	if len(problems) == 0 {
+		if val, ok := dst.(Validator); ok {
+			if err := val.Validate(); err != nil {
+				var le *LoadError
+				if !errors.As(err, &le) {
+					le = &LoadError{Problems: []Problem{{Message: err.Error()}}}
+				}
+				problems = append(problems, le.Problems...)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &LoadError{Problems: problems}
+	}
+	return nil
+}
+
+// MustLoad is Load for startup: it panics listing every problem
+func MustLoad(dst any) {
+	if err := Load(dst); err != nil {
+		l := logger.Get()
+		l.Panic().Err(err).Msg("Invalid configuration")
+	}
+}
+
+// envTag is a field's parsed `env` tag
+type envTag struct {
+	key      string
+	required bool
+	secret   bool
+}
+
+func parseTag(f reflect.StructField) (envTag, bool) {
+	raw, ok := f.Tag.Lookup("env")
+	if !ok || raw == "-" {
+		return envTag{}, false
+	}
+	parts := strings.Split(raw, ",")
+	t := envTag{key: parts[0]}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "required":
+			t.required = true
+		case "secret":
+			t.secret = true
+		}
+	}
+	return t, true
+}
+
+func load(v reflect.Value, problems *[]Problem) {
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := parseTag(f)
+		if !ok {
+			if fv.Kind() == reflect.Struct && !isLeaf(fv) {
+				load(fv, problems)
+			}
+			continue
+		}
+		raw, set, err := lookup(tag.key)
+		switch {
+		case err != nil:
+			*problems = append(*problems, Problem{Key: tag.key, Message: err.Error()})
+			continue
+		case !set && tag.required:
+			*problems = append(*problems, Problem{Key: tag.key, Message: "is required"})
+			continue
+		case !set:
+			if raw, set = f.Tag.Lookup("default"); !set {
+				continue
+			}
+		}
+		if err := setValue(fv, raw); err != nil {
+			msg := err.Error()
+			if !tag.secret {
+				msg = fmt.Sprintf("%q: %s", raw, msg)
+			}
+			*problems = append(*problems, Problem{Key: tag.key, Message: msg})
+		}
+	}
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isLeaf reports whether a struct value is a setting of its own, e.g. a time.Time or a type that
+// parses itself, rather than a group of settings
+func isLeaf(v reflect.Value) bool {
+	return v.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// setValue parses raw into v according to v's type
+func setValue(v reflect.Value, raw string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if v.Type() == durationType {
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not an integer of %d bits", v.Type().Bits())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not an unsigned integer of %d bits", v.Type().Bits())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return errors.New("not a number")
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		switch v.Type().Elem().Kind() {
+		case reflect.Uint8:
+			v.SetBytes([]byte(raw))
+		case reflect.String:
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(v.Type()))
+		default:
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseDuration accepts Go durations ("500ms", "30m") or a bare integer number of seconds,
+// like MayDuration
+func parseDuration(raw string) (time.Duration, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, errors.New("not a duration")
+	}
+	return d, nil
+}
+
+// Dump returns src's settings by key, for diagnostics. Fields tagged secret, and keys that look
+// like one (…SECRET…, …PASSWORD…, …TOKEN…, …_KEY), show as Redacted when set, and passwords in
+// URLs are masked
+func Dump(src any) map[string]any {
+	out := map[string]any{}
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		dump(v, out)
+	}
+	return out
+}
+
+func dump(v reflect.Value, out map[string]any) {
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := parseTag(f)
+		if !ok {
+			if fv.Kind() == reflect.Struct {
+				dump(fv, out)
+			}
+			continue
+		}
+		switch {
+		case tag.secret || looksSecret(tag.key):
+			out[tag.key] = ""
+			if !fv.IsZero() {
+				out[tag.key] = Redacted
+			}
+		default:
+			out[tag.key] = dumpValue(fv)
+		}
+	}
+}
+
+// dumpValue is v as it reads in a config file
+func dumpValue(v reflect.Value) any {
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		return x.String()
+	case string:
+		return redactURL(x)
+	case []string:
+		items := make([]string, len(x))
+		for i, s := range x {
+			items[i] = redactURL(s)
+		}
+		return items
+	case []byte:
+		return string(x)
+	case fmt.Stringer:
+		return x.String()
+	case encoding.TextMarshaler:
+		if b, err := x.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return v.Interface()
+}
+
+// looksSecret reports whether a key names a credential, for fields not tagged secret
+func looksSecret(key string) bool {
+	k := strings.ToUpper(key)
+	return strings.Contains(k, "SECRET") || strings.Contains(k, "PASSWORD") ||
+		strings.Contains(k, "TOKEN") || strings.HasSuffix(k, "_KEY")
+}
+
+// redactURL masks the password of a URL such as a DSN; other strings are returned as they are
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	return u.Redacted()
+}
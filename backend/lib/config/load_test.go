@@ -0,0 +1,222 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// level parses itself, as lumnet.Rate does
+type level int
+
+func (l *level) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("want low or high")
+	}
+	return nil
+}
+
+func (l level) String() string { return [...]string{"", "low", "high"}[l] }
+
+type dbSettings struct {
+	URL      string   `env:"T_DB_URL,required"`
+	Replicas []string `env:"T_DB_REPLICAS"`
+	MaxConns int32    `env:"T_DB_MAX_CONNS" default:"10"`
+}
+
+type settings struct {
+	Secret  []byte        `env:"T_SECRET,required,secret"`
+	Issuer  string        `env:"T_ISSUER" default:"lumium"`
+	TTL     time.Duration `env:"T_TTL" default:"600"`
+	Enabled bool          `env:"T_ENABLED"`
+	Ratio   float64       `env:"T_RATIO" default:"0.5"`
+	Level   level         `env:"T_LEVEL" default:"low"`
+	Token   string        `env:"T_GATEWAY_TOKEN"`
+	DB      dbSettings
+	ignored string
+}
+
+type checked struct {
+	Min int `env:"T_MIN" default:"1"`
+	Max int `env:"T_MAX" default:"5"`
+}
+
+func (c checked) Validate() error {
+	if c.Min > c.Max {
+		return &LoadError{Problems: []Problem{{Key: "T_MIN", Message: "must not exceed T_MAX"}}}
+	}
+	return nil
+}
+
+// setenv sets each key until the end of the current Convey
+func setenv(kv ...string) {
+	for i := 0; i < len(kv); i += 2 {
+		key := kv[i]
+		os.Setenv(key, kv[i+1])
+		Reset(func() { os.Unsetenv(key) })
+	}
+}
+
+func writeFile(t *testing.T, name, body string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Tags fill a struct from the environment, with defaults for what's unset", t, func() {
+		setenv("T_SECRET", "s3cret", "T_TTL", "1m30s", "T_ENABLED", "true", "T_LEVEL", "high",
+			"T_DB_URL", "postgres://app:pw@db/lumium", "T_DB_REPLICAS", " r1, ,r2 ")
+		var c settings
+		So(Load(&c), ShouldBeNil)
+		So(string(c.Secret), ShouldEqual, "s3cret")
+		So(c.Issuer, ShouldEqual, "lumium")
+		So(c.TTL, ShouldEqual, 90*time.Second)
+		So(c.Enabled, ShouldBeTrue)
+		So(c.Ratio, ShouldEqual, 0.5)
+		So(c.Level, ShouldEqual, level(2))
+		So(c.DB.Replicas, ShouldResemble, []string{"r1", "r2"})
+		So(c.DB.MaxConns, ShouldEqual, 10)
+	})
+
+	Convey("Durations also take bare seconds", t, func() {
+		setenv("T_SECRET", "x", "T_DB_URL", "u")
+		var c settings
+		So(Load(&c), ShouldBeNil)
+		So(c.TTL, ShouldEqual, 10*time.Minute)
+	})
+
+	Convey("Every problem is reported at once, without echoing secrets", t, func() {
+		setenv("T_TTL", "soon", "T_DB_MAX_CONNS", "99999999999", "T_LEVEL", "max", "T_SECRET", "")
+		var c settings
+		err := Load(&c)
+		var le *LoadError
+		So(errors.As(err, &le), ShouldBeTrue)
+		keys := []string{}
+		for _, p := range le.Problems {
+			keys = append(keys, p.Key)
+		}
+		So(keys, ShouldResemble, []string{"T_SECRET", "T_TTL", "T_LEVEL", "T_DB_URL", "T_DB_MAX_CONNS"})
+		So(err.Error(), ShouldContainSubstring, `T_TTL: "soon": not a duration`)
+		So(err.Error(), ShouldContainSubstring, "T_SECRET: is required")
+		So(err.Error(), ShouldContainSubstring, `T_LEVEL: "max": want low or high`)
+	})
+
+	Convey("Validate runs once the settings parse", t, func() {
+		setenv("T_MIN", "9")
+		err := Load(&checked{})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "config: T_MIN: must not exceed T_MAX")
+		So(func() { MustLoad(&checked{}) }, ShouldPanic)
+	})
+
+	Convey("Load wants a pointer to a struct", t, func() {
+		So(Load(settings{}), ShouldNotBeNil)
+	})
+}
+
+func TestSources(t *testing.T) {
+	Convey("A KEY_FILE is read when KEY is unset, without its trailing newline", t, func() {
+		setenv("T_SECRET_FILE", writeFile(t, "secret", "from-file\n"), "T_DB_URL", "u")
+		var c settings
+		So(Load(&c), ShouldBeNil)
+		So(string(c.Secret), ShouldEqual, "from-file")
+		So(MayString("T_SECRET", ""), ShouldEqual, "from-file")
+
+		setenv("T_SECRET", "from-env")
+		So(MayString("T_SECRET", ""), ShouldEqual, "from-env")
+	})
+
+	Convey("A missing KEY_FILE is a problem, not an empty setting", t, func() {
+		setenv("T_SECRET_FILE", "/nonexistent/secret", "T_DB_URL", "u")
+		err := Load(&settings{})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "T_SECRET: T_SECRET_FILE:")
+	})
+
+	Convey("A YAML CONFIG_FILE sits under the environment, nested keys named like env vars", t, func() {
+		setenv(FileEnv, writeFile(t, "lumium.yaml", strings.Join([]string{
+			"t_secret: yaml-secret",
+			"t_issuer: yaml-issuer",
+			"t:",
+			"  db:",
+			"    url: postgres://db/lumium",
+			"    replicas: [r1, r2]",
+		}, "\n")), "T_ISSUER", "env-issuer")
+		var c settings
+		So(Load(&c), ShouldBeNil)
+		So(string(c.Secret), ShouldEqual, "yaml-secret")
+		So(c.Issuer, ShouldEqual, "env-issuer")
+		So(c.DB.URL, ShouldEqual, "postgres://db/lumium")
+		So(c.DB.Replicas, ShouldResemble, []string{"r1", "r2"})
+		So(MayInt("T_DB_MAX_CONNS", 3), ShouldEqual, 3)
+	})
+
+	Convey("A TOML CONFIG_FILE works the same way", t, func() {
+		setenv(FileEnv, writeFile(t, "lumium.toml", strings.Join([]string{
+			`T_SECRET = "toml # not a comment"  # a comment`,
+			`T_ISSUER = """`,
+			`toml-issuer"""`,
+			`[t.db]`,
+			`url = 'postgres://db/lumium'`,
+			`replicas = [`,
+			`  "r1",`,
+			`  "r2", # a comment`,
+			`]`,
+			`max_conns = 20`,
+		}, "\n")))
+		var c settings
+		So(Load(&c), ShouldBeNil)
+		So(string(c.Secret), ShouldEqual, "toml # not a comment")
+		So(c.Issuer, ShouldEqual, "toml-issuer")
+		So(c.DB.URL, ShouldEqual, "postgres://db/lumium")
+		So(c.DB.Replicas, ShouldResemble, []string{"r1", "r2"})
+		So(c.DB.MaxConns, ShouldEqual, 20)
+	})
+
+	Convey("An unreadable CONFIG_FILE fails the load", t, func() {
+		setenv(FileEnv, writeFile(t, "lumium.ini", "x=1"))
+		So(Load(&settings{}), ShouldNotBeNil)
+		setenv(FileEnv, writeFile(t, "bad.toml", `url = "unterminated`))
+		So(Load(&settings{}), ShouldNotBeNil)
+	})
+}
+
+func TestDump(t *testing.T) {
+	Convey("Dump shows settings by key with secrets and URL passwords masked", t, func() {
+		c := settings{
+			Secret: []byte("s3cret"),
+			Issuer: "lumium",
+			TTL:    time.Minute,
+			Level:  2,
+			Token:  "tok",
+			DB:     dbSettings{URL: "postgres://app:pw@db/lumium", Replicas: []string{"postgres://u:p@r1/x"}},
+		}
+		d := Dump(&c)
+		So(d["T_SECRET"], ShouldEqual, Redacted)
+		So(d["T_GATEWAY_TOKEN"], ShouldEqual, Redacted)
+		So(d["T_ISSUER"], ShouldEqual, "lumium")
+		So(d["T_TTL"], ShouldEqual, "1m0s")
+		So(d["T_LEVEL"], ShouldEqual, "high")
+		So(d["T_DB_URL"], ShouldEqual, "postgres://app:xxxxx@db/lumium")
+		So(d["T_DB_REPLICAS"], ShouldResemble, []string{"postgres://u:xxxxx@r1/x"})
+		So(d["T_DB_MAX_CONNS"], ShouldEqual, int32(0))
+		So(d, ShouldNotContainKey, "ignored")
+	})
+
+	Convey("An unset secret shows as empty, so its absence is visible", t, func() {
+		So(Dump(settings{})["T_SECRET"], ShouldEqual, "")
+	})
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"lumium/lib/logger"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// FileEnv names the optional YAML or TOML file of settings layered under the environment
+const FileEnv = "CONFIG_FILE"
+
+// file caches the parsed CONFIG_FILE, reread when the variable changes
+var file struct {
+	sync.Mutex
+	path   string
+	values map[string]string
+	err    error
+}
+
+// lookup finds key's value, in order: the environment; the file named by KEY_FILE, as Docker and
+// Kubernetes mount secrets; CONFIG_FILE. ok is false when none sets it, and err when a file
+// can't be read
+func lookup(key string) (v string, ok bool, err error) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v, true, nil
+	}
+	if path := strings.TrimSpace(os.Getenv(key + "_FILE")); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", key, err)
+		}
+		// secret files usually end in a newline that isn't part of the secret
+		if v := strings.TrimRight(string(b), "\r\n"); v != "" {
+			return v, true, nil
+		}
+	}
+	values, err := fileValues()
+	if err != nil {
+		return "", false, err
+	}
+	v, ok = values[key]
+	return v, ok && v != "", nil
+}
+
+// lookupOrWarn is lookup for the May* and Must* helpers, which log an unreadable file and
+// carry on as if the key were unset
+func lookupOrWarn(key string) string {
+	v, _, err := lookup(key)
+	if err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Str("key", key).Msg("Unreadable config source; treating the key as unset")
+	}
+	return v
+}
+
+// fileValues returns CONFIG_FILE's settings by environment name, parsing the file on first use
+func fileValues() (map[string]string, error) {
+	path := strings.TrimSpace(os.Getenv(FileEnv))
+	file.Lock()
+	defer file.Unlock()
+	if path == file.path && (file.values != nil || file.err != nil) {
+		return file.values, file.err
+	}
+	file.path, file.values, file.err = path, map[string]string{}, nil
+	if path == "" {
+		return file.values, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		file.err = fmt.Errorf("%s: %w", FileEnv, err)
+		return nil, file.err
+	}
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &tree)
+	case ".toml":
+		err = toml.Unmarshal(b, &tree)
+	default:
+		err = fmt.Errorf("want a .yaml, .yml or .toml file")
+	}
+	if err != nil {
+		file.err = fmt.Errorf("%s %s: %w", FileEnv, path, err)
+		return nil, file.err
+	}
+	flatten("", tree, file.values)
+	return file.values, nil
+}
+
+// flatten names each setting in tree like its environment variable: nested keys are joined
+// with "_" and upper-cased, so `auth: {jwt_issuer: x}` and `AUTH_JWT_ISSUER: x` are the same.
+// Lists become comma-separated
+func flatten(prefix string, tree map[string]any, out map[string]string) {
+	for k, v := range tree {
+		key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, out)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
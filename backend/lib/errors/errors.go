@@ -12,19 +12,29 @@ import (
 // Error represents an error that could be wrapping another error,
 // it includes a code for determining what triggered the error
 type Error struct {
-	orig  error
-	msg   string
-	code  ErrorCode
-	field string
+	orig   error
+	msg    string
+	public string
+	code   ErrorCode
+	field  string
+	fields []FieldError
+}
+
+// FieldError is one offending field of a validation error
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 // Wire is the JSON-serializable form of an Error used in API responses.
-// It includes the machine-readable code, a human message, and an
-// optional field name for validation errors
+// It includes the machine-readable code, its stable name, a message safe
+// for clients, and an optional field name for validation errors
 type Wire struct {
-	Code    ErrorCode `json:"code"`
-	Message string    `json:"message"`
-	Field   string    `json:"field,omitempty"`
+	Code      ErrorCode `json:"code"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	Field     string    `json:"field,omitempty"`
+	Retryable bool      `json:"retryable,omitempty"`
 }
 
 // ErrorCode defines supported error codes (iota)
@@ -54,12 +64,107 @@ const (
 
 	// ErrorCodePanic is the general error code for panics
 	ErrorCodePanic
+
+	// ErrorCodeForeignKey is a write that references a missing row, or deletes a referenced one
+	ErrorCodeForeignKey
+
+	// ErrorCodeCheckViolation is a value rejected by a CHECK constraint
+	ErrorCodeCheckViolation
+
+	// ErrorCodeNotNull is a required column left empty
+	ErrorCodeNotNull
+
+	// ErrorCodeSerialization is a transaction that lost a serialization conflict or deadlock and
+	// ran out of retries; the client may try again
+	ErrorCodeSerialization
+
+	// ErrorCodeRateLimited is a request over its rate limit; the client may retry later
+	ErrorCodeRateLimited
+
+	// ErrorCodeUnauthenticated is a request without valid credentials
+	ErrorCodeUnauthenticated
+
+	// ErrorCodePermissionDenied is an authenticated caller that may not do this
+	ErrorCodePermissionDenied
+
+	// ErrorCodeConflict is a request that conflicts with the resource's current state
+	ErrorCodeConflict
+
+	// ErrorCodePreconditionFailed is a conditional request whose condition doesn't hold
+	ErrorCodePreconditionFailed
+
+	// ErrorCodeGone is a resource that existed and was removed, or a token that expired
+	ErrorCodeGone
+
+	// ErrorCodePayloadTooLarge is a request body over the endpoint's limit
+	ErrorCodePayloadTooLarge
+
+	// ErrorCodeUnavailable is a dependency that is down or overloaded; the client may retry
+	ErrorCodeUnavailable
+
+	// ErrorCodeTimeout is an operation that ran out of time; the client may retry
+	ErrorCodeTimeout
 )
 
-// example of how I would handle specific error codes
-// such as foreign_key_violation
+// codeNames are the stable names of the codes, used in problem type URIs
+var codeNames = map[ErrorCode]string{
+	ErrorCodeUnknown:         "unknown",
+	ErrorCodeNotFound:        "not-found",
+	ErrorCodeInvalidArgument: "invalid-argument",
+	ErrorCodeDuplicateKey:    "duplicate-key",
+	ErrorCodeDB:              "database",
+	ErrorCodeValidation:      "validation",
+	ErrorCodeJSON:            "invalid-json",
+	ErrorCodePanic:           "internal",
+	ErrorCodeForeignKey:      "foreign-key",
+	ErrorCodeCheckViolation:  "check-violation",
+	ErrorCodeNotNull:         "not-null",
+	ErrorCodeSerialization:   "serialization",
+	ErrorCodeRateLimited:     "rate-limited",
+
+	ErrorCodeUnauthenticated:    "unauthenticated",
+	ErrorCodePermissionDenied:   "permission-denied",
+	ErrorCodeConflict:           "conflict",
+	ErrorCodePreconditionFailed: "precondition-failed",
+	ErrorCodeGone:               "gone",
+	ErrorCodePayloadTooLarge:    "payload-too-large",
+	ErrorCodeUnavailable:        "unavailable",
+	ErrorCodeTimeout:            "timeout",
+}
+
+// internalMessages replace the messages of failures on our side, which often carry SQL or
+// driver detail, when shown to clients
+var internalMessages = map[ErrorCode]string{
+	ErrorCodeUnknown: "internal server error",
+	ErrorCodeDB:      "internal server error",
+	ErrorCodePanic:   "internal server error",
+}
+
+// String is the code's stable name, e.g. "not-found"
+func (c ErrorCode) String() string {
+	if n, ok := codeNames[c]; ok {
+		return n
+	}
+	return codeNames[ErrorCodeUnknown]
+}
+
+// Retryable reports whether a request failing with c may succeed if sent again unchanged
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case ErrorCodeSerialization, ErrorCodeRateLimited, ErrorCodeUnavailable, ErrorCodeTimeout:
+		return true
+	}
+	return false
+}
+
+// Postgres SQLSTATEs mapped by DBErrorCode
 const (
-	errDuplicateKey = "23505"
+	errDuplicateKey   = "23505"
+	errForeignKey     = "23503"
+	errNotNull        = "23502"
+	errCheckViolation = "23514"
+	errSerialization  = "40001"
+	errDeadlock       = "40P01"
 )
 
 // HTTPStatusCode turns an ErrorCode to an http status code
@@ -69,10 +174,28 @@ func HTTPStatusCode(s ErrorCode) int {
 		return http.StatusNotFound
 	case ErrorCodeInvalidArgument:
 		return http.StatusUnprocessableEntity
-	case ErrorCodeDuplicateKey:
+	case ErrorCodeDuplicateKey, ErrorCodeForeignKey, ErrorCodeSerialization, ErrorCodeConflict:
 		return http.StatusConflict
-	case ErrorCodeValidation:
+	case ErrorCodeCheckViolation:
+		return http.StatusUnprocessableEntity
+	case ErrorCodeValidation, ErrorCodeNotNull:
 		return http.StatusBadRequest
+	case ErrorCodeRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorCodeUnauthenticated:
+		return http.StatusUnauthorized
+	case ErrorCodePermissionDenied:
+		return http.StatusForbidden
+	case ErrorCodePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case ErrorCodeGone:
+		return http.StatusGone
+	case ErrorCodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrorCodeTimeout:
+		return http.StatusGatewayTimeout
 	case ErrorCodeDB, ErrorCodeJSON, ErrorCodePanic, ErrorCodeUnknown:
 		return http.StatusInternalServerError
 	default:
@@ -105,6 +228,51 @@ func JSONErrf(format string, a ...interface{}) error {
 	return NewErrorf(ErrorCodeJSON, format, a...)
 }
 
+// RateLimitedf is a convenience method for a request over its rate limit
+func RateLimitedf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeRateLimited, format, a...)
+}
+
+// Unauthenticatedf is a convenience method for missing or invalid credentials
+func Unauthenticatedf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeUnauthenticated, format, a...)
+}
+
+// PermissionDeniedf is a convenience method for a caller without the permission
+func PermissionDeniedf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodePermissionDenied, format, a...)
+}
+
+// Conflictf is a convenience method for a request conflicting with the current state
+func Conflictf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeConflict, format, a...)
+}
+
+// PreconditionFailedf is a convenience method for a failed conditional request
+func PreconditionFailedf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodePreconditionFailed, format, a...)
+}
+
+// Gonef is a convenience method for a removed resource or an expired token
+func Gonef(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeGone, format, a...)
+}
+
+// PayloadTooLargef is a convenience method for a body over the limit
+func PayloadTooLargef(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodePayloadTooLarge, format, a...)
+}
+
+// Unavailablef is a convenience method for a dependency that is down
+func Unavailablef(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeUnavailable, format, a...)
+}
+
+// Timeoutf is a convenience method for an operation that ran out of time
+func Timeoutf(format string, a ...interface{}) error {
+	return NewErrorf(ErrorCodeTimeout, format, a...)
+}
+
 // PanicErrf is a convenience method for a panic
 func PanicErrf(format string, a ...interface{}) error {
 	return NewErrorf(ErrorCodePanic, format, a...)
@@ -119,9 +287,36 @@ func (e *Error) WithCode(code ErrorCode) *Error { e.code = code; return e }
 // WithCause chains an error and sets the cause (original error)
 func (e *Error) WithCause(orig error) *Error { e.orig = orig; return e }
 
+// WithPublic chains an error and sets the message shown to clients in place of its own
+func (e *Error) WithPublic(msg string) *Error { e.public = msg; return e }
+
+// Message is the message safe to show clients. It never includes the wrapped cause, and for
+// failures on our side (unknown, database, panic) it is generic unless set with WithPublic, so
+// DBf("create user: %v", err) doesn't leak SQL. Error() keeps the full text for logs
+func (e *Error) Message() string {
+	if e.public != "" {
+		return e.public
+	}
+	if m, ok := internalMessages[e.code]; ok {
+		return m
+	}
+	return e.msg
+}
+
+// Retryable reports whether the request may succeed if sent again unchanged
+func (e *Error) Retryable() bool {
+	return e.code.Retryable()
+}
+
 // ToWire returns a new wired error code
 func (e *Error) ToWire() Wire {
-	return Wire{Code: e.code, Message: e.msg, Field: e.field}
+	return Wire{
+		Code:      e.code,
+		Name:      e.code.String(),
+		Message:   e.Message(),
+		Field:     e.field,
+		Retryable: e.code.Retryable(),
+	}
 }
 
 // WrapErrorf returns a wrapped error
@@ -148,6 +343,16 @@ func NewValidationError(code ErrorCode, msg string, field string) error {
 	}
 }
 
+// NewValidationErrors instantiates a validation error for several offending fields. Its message
+// and field are the first one's, so clients reading a single field keep working
+func NewValidationErrors(fields []FieldError) error {
+	e := &Error{code: ErrorCodeValidation, msg: "validation failed", fields: fields}
+	if len(fields) > 0 {
+		e.msg, e.field = fields[0].Message, fields[0].Field
+	}
+	return e
+}
+
 // Error returns the message, when wrapping errors the wrapped error is returned.
 func (e *Error) Error() string {
 	if e.orig != nil {
@@ -157,6 +362,22 @@ func (e *Error) Error() string {
 	return e.msg
 }
 
+// SafeMessage is the client-safe message of err: Message for an *Error, and a generic one
+// for any other error, whose text is unknown
+func SafeMessage(err error) string {
+	var e *Error
+	if sterrors.As(err, &e) {
+		return e.Message()
+	}
+	return internalMessages[ErrorCodeUnknown]
+}
+
+// IsRetryable reports whether err is an *Error whose request may succeed if sent again
+func IsRetryable(err error) bool {
+	var e *Error
+	return sterrors.As(err, &e) && e.Retryable()
+}
+
 // IsErrorCode is a helper for allowing us to compare error states
 func IsErrorCode(err error, code ErrorCode) bool {
 	var e *Error
@@ -181,18 +402,62 @@ func (e *Error) Field() string {
 	return e.field
 }
 
-// DBErrorCode accepts an int code and then tries to convert it to an error code
+// Fields returns every offending field; a single-field error returns just that one
+func (e *Error) Fields() []FieldError {
+	if len(e.fields) > 0 {
+		return e.fields
+	}
+	if e.field != "" {
+		return []FieldError{{Field: e.field, Message: e.msg}}
+	}
+	return nil
+}
+
+// DBErrorCode maps the Postgres error wrapped in err to an error code.
 // Returns nil if not found to allow for edge case handling
 func DBErrorCode(err error) *ErrorCode {
+	var pgErr *pgconn.PgError
+	if !sterrors.As(err, &pgErr) {
+		return nil
+	}
+	var c ErrorCode
+	switch pgErr.Code {
+	case errDuplicateKey:
+		c = ErrorCodeDuplicateKey
+	case errForeignKey:
+		c = ErrorCodeForeignKey
+	case errCheckViolation:
+		c = ErrorCodeCheckViolation
+	case errNotNull:
+		c = ErrorCodeNotNull
+	case errSerialization, errDeadlock:
+		c = ErrorCodeSerialization
+	default:
+		return nil
+	}
+	return &c
+}
+
+// DBConstraintErrorf wraps a Postgres constraint violation with its mapped code, naming the
+// offending column as the field when Postgres reports one. Other errors become ErrorCodeDB
+func DBConstraintErrorf(err error, format string, a ...interface{}) error {
+	c := DBErrorCode(err)
+	if c == nil {
+		return WrapErrorf(err, ErrorCodeDB, format, a...)
+	}
+	e := &Error{orig: err, code: *c, msg: fmt.Sprintf(format, a...)}
 	var pgErr *pgconn.PgError
 	if sterrors.As(err, &pgErr) {
-		switch pgErr.Code {
-		case errDuplicateKey:
-			c := ErrorCodeDuplicateKey
-			return &c
-		}
+		e.field = pgErr.ColumnName
 	}
-	return nil
+	return e
+}
+
+// IsRetryableDB reports whether err wraps a serialization failure or deadlock, after which the
+// whole transaction can be retried
+func IsRetryableDB(err error) bool {
+	var pgErr *pgconn.PgError
+	return sterrors.As(err, &pgErr) && (pgErr.Code == errSerialization || pgErr.Code == errDeadlock)
 }
 
 // WithField attaches a field to an *Error; if err isn't *Error, it's returned unchanged.
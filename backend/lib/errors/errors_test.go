@@ -23,6 +23,15 @@ func TestHTTPStatusCode(t *testing.T) {
 		{ErrorCodeValidation, http.StatusBadRequest},
 		{ErrorCodeJSON, http.StatusInternalServerError},
 		{ErrorCodePanic, http.StatusInternalServerError},
+		{ErrorCodeRateLimited, http.StatusTooManyRequests},
+		{ErrorCodeUnauthenticated, http.StatusUnauthorized},
+		{ErrorCodePermissionDenied, http.StatusForbidden},
+		{ErrorCodeConflict, http.StatusConflict},
+		{ErrorCodePreconditionFailed, http.StatusPreconditionFailed},
+		{ErrorCodeGone, http.StatusGone},
+		{ErrorCodePayloadTooLarge, http.StatusRequestEntityTooLarge},
+		{ErrorCodeUnavailable, http.StatusServiceUnavailable},
+		{ErrorCodeTimeout, http.StatusGatewayTimeout},
 	}
 	for _, c := range cases {
 		if got := HTTPStatusCode(c.code); got != c.want {
@@ -55,9 +64,9 @@ func TestWrapNewAndErrorFormatting(t *testing.T) {
 		t.Fatalf("Unwrap() mismatch, got %#v", e.Unwrap())
 	}
 
-	// ToWire code/message/field
+	// ToWire code/name/field, with the database detail kept out of the message
 	w := e.ToWire()
-	if w.Code != ErrorCodeDB || !contains(w.Message, "while saving") || w.Field != "" {
+	if w.Code != ErrorCodeDB || w.Name != "database" || w.Message != "internal server error" || w.Field != "" {
 		t.Fatalf("ToWire() mismatch: %+v", w)
 	}
 }
@@ -124,10 +133,10 @@ func TestWithHelpers(t *testing.T) {
 	}
 }
 
-// TestDBErrorCode tests currently implemented foreign_key_violation
+// TestDBErrorCode tests the mapped SQLSTATEs
 func TestDBErrorCode(t *testing.T) {
 	dupe := &pgconn.PgError{Code: errDuplicateKey}
-	other := &pgconn.PgError{Code: "23503"}
+	other := &pgconn.PgError{Code: "22P02"}
 
 	// Wrapped duplicate key
 	wrappedDupe := fmt.Errorf("wrap: %w", dupe)
@@ -169,3 +178,121 @@ func deref(c *ErrorCode) ErrorCode {
 	}
 	return *c
 }
+
+// TestDBErrorCodeConstraints covers the constraint and concurrency SQLSTATEs
+func TestDBErrorCodeConstraints(t *testing.T) {
+	cases := map[string]ErrorCode{
+		"23503": ErrorCodeForeignKey,
+		"23514": ErrorCodeCheckViolation,
+		"23502": ErrorCodeNotNull,
+		"40001": ErrorCodeSerialization,
+		"40P01": ErrorCodeSerialization,
+	}
+	for sqlstate, want := range cases {
+		err := fmt.Errorf("wrap: %w", &pgconn.PgError{Code: sqlstate})
+		if c := DBErrorCode(err); c == nil || *c != want {
+			t.Fatalf("DBErrorCode(%s) = %v, want %v", sqlstate, deref(c), want)
+		}
+	}
+
+	if HTTPStatusCode(ErrorCodeForeignKey) != http.StatusConflict ||
+		HTTPStatusCode(ErrorCodeNotNull) != http.StatusBadRequest {
+		t.Fatalf("unexpected status mapping")
+	}
+
+	if !IsRetryableDB(fmt.Errorf("wrap: %w", &pgconn.PgError{Code: "40P01"})) {
+		t.Fatalf("deadlock should be retryable")
+	}
+	if IsRetryableDB(&pgconn.PgError{Code: "23505"}) {
+		t.Fatalf("duplicate key should not be retryable")
+	}
+	if !IsRetryableDB(WrapErrorf(&pgconn.PgError{Code: "40001"}, ErrorCodeDB, "record photo")) {
+		t.Fatalf("a wrapped serialization failure should stay retryable")
+	}
+	if IsRetryableDB(DBf("record photo")) {
+		t.Fatalf("DBf carries no cause to retry on")
+	}
+}
+
+// TestDBConstraintErrorf checks the mapped code and the column as field
+func TestDBConstraintErrorf(t *testing.T) {
+	err := DBConstraintErrorf(&pgconn.PgError{Code: "23502", ColumnName: "title"}, "create album")
+	var e *Error
+	if !errors.As(err, &e) || e.Code() != ErrorCodeNotNull || e.Field() != "title" {
+		t.Fatalf("DBConstraintErrorf(not null) = %v", err)
+	}
+
+	err = DBConstraintErrorf(fmt.Errorf("conn reset"), "create album")
+	if !IsErrorCode(err, ErrorCodeDB) {
+		t.Fatalf("DBConstraintErrorf(other) = %v, want ErrorCodeDB", err)
+	}
+}
+
+// TestNewValidationErrors keeps every field and the first as the error's own
+func TestNewValidationErrors(t *testing.T) {
+	err := NewValidationErrors([]FieldError{
+		{Field: "title", Message: "title is required"},
+		{Field: "limit", Message: "limit must be ≤ 200"},
+	})
+	var e *Error
+	if !errors.As(err, &e) || e.Code() != ErrorCodeValidation || e.Field() != "title" ||
+		e.Error() != "title is required" || len(e.Fields()) != 2 {
+		t.Fatalf("NewValidationErrors = %+v", err)
+	}
+
+	single := NewValidationError(ErrorCodeValidation, "is required", "name")
+	if fs := single.(*Error).Fields(); len(fs) != 1 || fs[0].Field != "name" {
+		t.Fatalf("Fields() of a single-field error = %v", fs)
+	}
+	if fs := NotFoundf("album").(*Error).Fields(); fs != nil {
+		t.Fatalf("Fields() without a field = %v", fs)
+	}
+}
+
+// TestErrorCodeString names every code, and unknown ones as unknown
+func TestErrorCodeString(t *testing.T) {
+	for c := ErrorCodeUnknown; c <= ErrorCodeTimeout; c++ {
+		if c.String() == "" || (c != ErrorCodeUnknown && c.String() == "unknown") {
+			t.Fatalf("ErrorCode(%d) has no name", c)
+		}
+	}
+	if ErrorCode(999).String() != "unknown" || ErrorCodeNotFound.String() != "not-found" {
+		t.Fatalf("unexpected names")
+	}
+}
+
+// TestMessage keeps causes and internal detail out of client messages
+func TestMessage(t *testing.T) {
+	cause := &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	if m := DBConstraintErrorf(cause, "create album").(*Error).Message(); m != "create album" {
+		t.Fatalf("Message() of a constraint error = %q", m)
+	}
+	if m := DBf("create user: %v", cause).(*Error).Message(); m != "internal server error" {
+		t.Fatalf("Message() of a database error = %q", m)
+	}
+	if m := DBf("create user").(*Error).WithPublic("try again shortly").Message(); m != "try again shortly" {
+		t.Fatalf("Message() with WithPublic = %q", m)
+	}
+	if SafeMessage(fmt.Errorf("pq: secret detail")) != "internal server error" {
+		t.Fatalf("SafeMessage() of a plain error leaks it")
+	}
+	if SafeMessage(NotFoundf("album not found")) != "album not found" {
+		t.Fatalf("SafeMessage() of a not found error should keep it")
+	}
+}
+
+// TestRetryable marks the codes a client may retry
+func TestRetryable(t *testing.T) {
+	for _, err := range []error{Unavailablef("x"), Timeoutf("x"), RateLimitedf("x"),
+		NewErrorf(ErrorCodeSerialization, "x")} {
+		if !IsRetryable(err) || !err.(*Error).ToWire().Retryable {
+			t.Fatalf("%v should be retryable", err)
+		}
+	}
+	for _, err := range []error{Unauthenticatedf("x"), PermissionDeniedf("x"), Conflictf("x"),
+		PreconditionFailedf("x"), Gonef("x"), PayloadTooLargef("x"), DBf("x"), fmt.Errorf("x")} {
+		if IsRetryable(err) {
+			t.Fatalf("%v should not be retryable", err)
+		}
+	}
+}
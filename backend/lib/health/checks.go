@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Pinger is anything that can ping its server, such as *pgxpool.Pool
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks a Postgres pool, or anything else with a Ping
+func Ping(p Pinger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if p == nil {
+			return errors.New("not initialized")
+		}
+		return p.Ping(ctx)
+	}
+}
+
+// NATS checks that the connection is up and the server answers a round trip
+func NATS(nc *nats.Conn) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if nc == nil {
+			return errors.New("not initialized")
+		}
+		if s := nc.Status(); s != nats.CONNECTED {
+			return fmt.Errorf("connection is %s", s)
+		}
+		return nc.FlushWithContext(ctx)
+	}
+}
+
+// MinIO checks the liveness endpoint of the S3 server at endpoint (SERVICE_S3_ENDPOINT)
+func MinIO(endpoint string) func(context.Context) error {
+	return HTTP(strings.TrimRight(endpoint, "/") + "/minio/health/live")
+}
+
+// ClickHouse checks the /ping endpoint of the ClickHouse HTTP interface. dsn may carry
+// credentials and a database (SERVICE_CLICKHOUSE_DBURL); only its scheme and host are used
+func ClickHouse(dsn string) func(context.Context) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Host == "" {
+		return func(context.Context) error { return errors.New("invalid ClickHouse URL") }
+	}
+	return HTTP((&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/ping"}).String())
+}
+
+// httpClient is a seam for tests; checks bound their requests with the context instead of
+// a client timeout
+var httpClient = http.DefaultClient
+
+// HTTP checks that a GET of target answers 2xx
+func HTTP(target string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("%s answered %d", req.URL.Redacted(), res.StatusCode)
+		}
+		return nil
+	}
+}
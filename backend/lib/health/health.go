@@ -0,0 +1,228 @@
+// Package health is the registry behind every service's /health, /ready and /whoami. Components
+// register a check when they are wired up:
+//
+//	reg := health.NewRegistry("lumium_exifd")
+//	reg.Register(health.Check{Name: "postgres", Fn: health.Ping(pool)})
+//	reg.Register(health.Check{Name: "clickhouse", Fn: health.ClickHouse(url), Optional: true})
+//
+// /health is liveness and never touches a dependency, so an outage of one doesn't get every
+// replica restarted. /ready runs the checks: a failed critical check answers 503 so the instance
+// is taken out of rotation, a failed optional one only marks it degraded
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a check that doesn't set its own
+const DefaultTimeout = 2 * time.Second
+
+// Status of a check or of the whole service
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // an optional check failed; still serving
+	StatusDown     Status = "down"     // a critical check failed, or the service is draining
+)
+
+// Check is one dependency probe
+type Check struct {
+	Name     string
+	Fn       func(ctx context.Context) error
+	Timeout  time.Duration // DefaultTimeout when unset
+	Optional bool          // a failure degrades the service instead of taking it out of rotation
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status     Status  `json:"status"`
+	Critical   bool    `json:"critical"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the readiness body
+type Report struct {
+	Status  Status            `json:"status"`
+	Service string            `json:"service"`
+	Checks  map[string]Result `json:"checks"`
+}
+
+// Registry holds a service's checks
+type Registry struct {
+	service string
+
+	mu       sync.RWMutex
+	checks   []Check
+	draining bool
+	config   map[string]map[string]any
+}
+
+// NewRegistry returns an empty registry for service
+func NewRegistry(service string) *Registry {
+	return &Registry{service: service}
+}
+
+// Register adds a check, replacing any check of the same name
+func (r *Registry) Register(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].Name == c.Name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+// Names lists the registered checks, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, len(r.checks))
+	for i, c := range r.checks {
+		out[i] = c.Name
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ShowConfig adds a section of settings to /whoami, e.g. a redacted config.Dump. Only call it
+// where the instance's settings may be seen by whoever can reach /whoami
+func (r *Registry) ShowConfig(section string, settings map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.config == nil {
+		r.config = map[string]map[string]any{}
+	}
+	r.config[section] = settings
+}
+
+// Drain makes the service report down from now on, so the load balancer stops routing to it
+// while in-flight work finishes. Call it first thing on shutdown
+func (r *Registry) Drain() {
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+}
+
+// Run runs every check concurrently, each under its own timeout
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]Check(nil), r.checks...)
+	draining := r.draining
+	r.mu.RUnlock()
+
+	rep := Report{Status: StatusOK, Service: r.service, Checks: make(map[string]Result, len(checks))}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Go(func() { results[i] = run(ctx, c) })
+	}
+	wg.Wait()
+
+	for i, c := range checks {
+		res := results[i]
+		rep.Checks[c.Name] = res
+		switch {
+		case res.Status == StatusOK:
+		case res.Critical:
+			rep.Status = StatusDown
+		case rep.Status == StatusOK:
+			rep.Status = StatusDegraded
+		}
+	}
+	if draining {
+		rep.Status = StatusDown
+	}
+	return rep
+}
+
+// run runs one check. A check that ignores its context still can't hold the probe past its
+// timeout: the result is taken as a failure and the goroutine is left to finish on its own
+func run(ctx context.Context, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.Fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{Status: StatusOK, Critical: !c.Optional, DurationMS: ms(time.Since(start))}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// LiveHandler answers liveness: the process is up and serving HTTP
+func (r *Registry) LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": StatusOK, "service": r.service})
+	}
+}
+
+// ReadyHandler runs the checks and answers 503 when the service is down
+func (r *Registry) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rep := r.Run(req.Context())
+		code := http.StatusOK
+		if rep.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, rep)
+	}
+}
+
+// WhoAmI identifies the instance that answered
+type WhoAmI struct {
+	Service  string `json:"service"`
+	Hostname string `json:"hostname"`
+	PID      int    `json:"pid"`
+
+	// Config holds the sections given to ShowConfig, when there are any
+	Config map[string]map[string]any `json:"config,omitempty"`
+}
+
+// WhoAmIHandler reports which instance answered, handy to check load balancing:
+//
+//	for i in {1..10}; do curl -s http://localhost:9001/whoami; echo; done
+func (r *Registry) WhoAmIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		hostname, _ := os.Hostname()
+		r.mu.RLock()
+		who := WhoAmI{Service: r.service, Hostname: hostname, PID: os.Getpid(), Config: r.config}
+		r.mu.RUnlock()
+		writeJSON(w, http.StatusOK, who)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
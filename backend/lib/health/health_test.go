@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func ok(context.Context) error   { return nil }
+func fail(context.Context) error { return errors.New("connection refused") }
+
+func ready(reg *Registry) (int, Report) {
+	rec := httptest.NewRecorder()
+	reg.ReadyHandler()(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var rep Report
+	_ = json.Unmarshal(rec.Body.Bytes(), &rep)
+	return rec.Code, rep
+}
+
+func TestRegistry(t *testing.T) {
+	Convey("With every check passing the service is ready", t, func() {
+		reg := NewRegistry("svc")
+		reg.Register(Check{Name: "postgres", Fn: ok})
+		reg.Register(Check{Name: "clickhouse", Fn: ok, Optional: true})
+
+		code, rep := ready(reg)
+		So(code, ShouldEqual, http.StatusOK)
+		So(rep.Status, ShouldEqual, StatusOK)
+		So(rep.Service, ShouldEqual, "svc")
+		So(rep.Checks["postgres"].Critical, ShouldBeTrue)
+		So(rep.Checks["clickhouse"].Critical, ShouldBeFalse)
+		So(reg.Names(), ShouldResemble, []string{"clickhouse", "postgres"})
+	})
+
+	Convey("A failed optional check degrades but stays ready", t, func() {
+		reg := NewRegistry("svc")
+		reg.Register(Check{Name: "postgres", Fn: ok})
+		reg.Register(Check{Name: "clickhouse", Fn: fail, Optional: true})
+
+		code, rep := ready(reg)
+		So(code, ShouldEqual, http.StatusOK)
+		So(rep.Status, ShouldEqual, StatusDegraded)
+		So(rep.Checks["clickhouse"].Error, ShouldEqual, "connection refused")
+	})
+
+	Convey("A failed critical check takes the service down", t, func() {
+		reg := NewRegistry("svc")
+		reg.Register(Check{Name: "postgres", Fn: fail})
+		reg.Register(Check{Name: "clickhouse", Fn: fail, Optional: true})
+
+		code, rep := ready(reg)
+		So(code, ShouldEqual, http.StatusServiceUnavailable)
+		So(rep.Status, ShouldEqual, StatusDown)
+	})
+
+	Convey("A check that hangs is cut off at its timeout", t, func() {
+		reg := NewRegistry("svc")
+		block := make(chan struct{})
+		defer close(block)
+		reg.Register(Check{Name: "stuck", Timeout: 20 * time.Millisecond,
+			Fn: func(context.Context) error { <-block; return nil }})
+
+		start := time.Now()
+		rep := reg.Run(context.Background())
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(rep.Status, ShouldEqual, StatusDown)
+		So(rep.Checks["stuck"].Error, ShouldEqual, context.DeadlineExceeded.Error())
+	})
+
+	Convey("Registering a name twice replaces the check", t, func() {
+		reg := NewRegistry("svc")
+		reg.Register(Check{Name: "postgres", Fn: fail})
+		reg.Register(Check{Name: "postgres", Fn: ok})
+		So(reg.Run(context.Background()).Status, ShouldEqual, StatusOK)
+	})
+
+	Convey("A draining service reports down while liveness stays up", t, func() {
+		reg := NewRegistry("svc")
+		reg.Register(Check{Name: "postgres", Fn: ok})
+		reg.Drain()
+
+		code, _ := ready(reg)
+		So(code, ShouldEqual, http.StatusServiceUnavailable)
+
+		rec := httptest.NewRecorder()
+		reg.LiveHandler()(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		So(rec.Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("WhoAmI names the instance", t, func() {
+		rec := httptest.NewRecorder()
+		NewRegistry("svc").WhoAmIHandler()(rec, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+		var who WhoAmI
+		So(json.Unmarshal(rec.Body.Bytes(), &who), ShouldBeNil)
+		So(who.Service, ShouldEqual, "svc")
+		So(who.PID, ShouldBeGreaterThan, 0)
+		So(who.Config, ShouldBeNil)
+	})
+
+	Convey("WhoAmI carries the config sections it is shown", t, func() {
+		reg := NewRegistry("svc")
+		reg.ShowConfig("auth", map[string]any{"JWT_ISSUER": "lumium", "JWT_SECRET": "[redacted]"})
+		rec := httptest.NewRecorder()
+		reg.WhoAmIHandler()(rec, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+		var who WhoAmI
+		So(json.Unmarshal(rec.Body.Bytes(), &who), ShouldBeNil)
+		So(who.Config["auth"]["JWT_ISSUER"], ShouldEqual, "lumium")
+		So(who.Config["auth"]["JWT_SECRET"], ShouldEqual, "[redacted]")
+	})
+}
+
+func TestChecks(t *testing.T) {
+	Convey("Ping fails when there is nothing to ping", t, func() {
+		So(Ping(nil)(context.Background()), ShouldNotBeNil)
+		So(NATS(nil)(context.Background()), ShouldNotBeNil)
+	})
+
+	Convey("HTTP checks want a 2xx", t, func() {
+		var path string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			if r.URL.Path == "/ping" || r.URL.Path == "/minio/health/live" {
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		So(MinIO(srv.URL+"/")(context.Background()), ShouldBeNil)
+		So(path, ShouldEqual, "/minio/health/live")
+
+		dsn := "http://user:secret@" + srv.Listener.Addr().String() + "/default"
+		So(ClickHouse(dsn)(context.Background()), ShouldBeNil)
+		So(path, ShouldEqual, "/ping")
+
+		err := HTTP(srv.URL + "/other")(context.Background())
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "503")
+
+		So(ClickHouse("::bad")(context.Background()), ShouldNotBeNil)
+	})
+}
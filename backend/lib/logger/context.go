@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// ctxKey carries the request logger
+type ctxKey struct{}
+
+// WithContext returns ctx carrying l, which Ctx returns further down the request
+func WithContext(ctx context.Context, l *zerolog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger ctx carries, if any
+func FromContext(ctx context.Context) (*zerolog.Logger, bool) {
+	l, ok := ctx.Value(ctxKey{}).(*zerolog.Logger)
+	return l, ok && l != nil
+}
+
+// Ctx returns the request logger ctx carries, so lines carry the request id, user and tenant,
+// or the service logger outside a request
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if l, ok := FromContext(ctx); ok {
+		return l
+	}
+	l := Get()
+	return &l
+}
+
+// Update adds fields to the request logger ctx carries, for every line logged with it from
+// then on, the request's own summary included. It does nothing outside a request. Call it
+// before the request starts goroutines that log
+func Update(ctx context.Context, fn func(c zerolog.Context) zerolog.Context) {
+	if l, ok := FromContext(ctx); ok {
+		l.UpdateContext(fn)
+	}
+}
+
+// DebugSampler keeps one in LOG_DEBUG_SAMPLE debug and trace lines, for hot paths such as the
+// query log; warnings and errors are always kept. It is nil, keeping everything, when unset or 1.
+// Build it once per call site: the count lives in the sampler
+func DebugSampler() zerolog.Sampler {
+	n, err := strconv.ParseUint(strings.TrimSpace(os.Getenv("LOG_DEBUG_SAMPLE")), 10, 32)
+	if err != nil || n <= 1 {
+		return nil
+	}
+	s := &zerolog.BasicSampler{N: uint32(n)}
+	return zerolog.LevelSampler{TraceSampler: s, DebugSampler: s}
+}
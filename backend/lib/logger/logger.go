@@ -29,11 +29,15 @@ func Get() zerolog.Logger {
 		// Determine log level from env (names or numbers), default to DEBUG
 		level := levelFromEnvDefaultDebug()
 
-		// Console writer to stdout (human-friendly for dev)
+		// Console writer to stdout (human-friendly for dev), or one JSON object per line for
+		// log shippers with LOG_FORMAT=json
 		var output io.Writer = zerolog.ConsoleWriter{
 			Out:        os.Stdout,
 			TimeFormat: time.RFC3339,
 		}
+		if jsonFormat() {
+			output = os.Stdout
+		}
 
 		// Safe build info
 		buildInfo, ok := debug.ReadBuildInfo()
@@ -53,6 +57,11 @@ func Get() zerolog.Logger {
 	return log
 }
 
+// jsonFormat reports whether LOG_FORMAT asks for JSON; anything else keeps the console format
+func jsonFormat() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("LOG_FORMAT")), "json")
+}
+
 // levelFromEnvDefaultDebug parses LOG_LEVEL from the environment
 // Supports named levels ("debug", "info", "warn", "error", "trace", etc.) and numeric levels
 // Falls back to DEBUG if missing/invalid/out-of-range
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"sync"
 	"testing"
 
@@ -77,3 +80,61 @@ func TestLogger_Singleton(t *testing.T) {
 		So(l1, ShouldResemble, l2)
 	})
 }
+
+// TestLogger_Format tests LOG_FORMAT
+func TestLogger_Format(t *testing.T) {
+	Convey("LOG_FORMAT=json switches off the console writer, in any case", t, func() {
+		t.Setenv("LOG_FORMAT", "JSON")
+		So(jsonFormat(), ShouldBeTrue)
+		t.Setenv("LOG_FORMAT", "console")
+		So(jsonFormat(), ShouldBeFalse)
+		t.Setenv("LOG_FORMAT", "")
+		So(jsonFormat(), ShouldBeFalse)
+	})
+}
+
+// TestLogger_Context tests the request logger carried in a context
+func TestLogger_Context(t *testing.T) {
+	Convey("Ctx returns the request logger, which Update extends in place", t, func() {
+		var buf bytes.Buffer
+		l := zerolog.New(&buf).With().Str("request_id", "r1").Logger()
+		ctx := WithContext(context.Background(), &l)
+
+		Update(ctx, func(c zerolog.Context) zerolog.Context { return c.Str("user_id", "u1") })
+		Ctx(ctx).Info().Msg("hello")
+		So(buf.String(), ShouldContainSubstring, `"request_id":"r1"`)
+		So(buf.String(), ShouldContainSubstring, `"user_id":"u1"`)
+	})
+
+	Convey("Outside a request Ctx is the service logger and Update does nothing", t, func() {
+		resetLoggerForTest()
+		_, ok := FromContext(context.Background())
+		So(ok, ShouldBeFalse)
+		So(Ctx(context.Background()), ShouldNotBeNil)
+		So(func() {
+			Update(context.Background(), func(c zerolog.Context) zerolog.Context { return c })
+		}, ShouldNotPanic)
+	})
+}
+
+// TestLogger_DebugSampler tests LOG_DEBUG_SAMPLE
+func TestLogger_DebugSampler(t *testing.T) {
+	Convey("LOG_DEBUG_SAMPLE=3 keeps one debug line in three, and every warning", t, func() {
+		t.Setenv("LOG_DEBUG_SAMPLE", "3")
+		var buf bytes.Buffer
+		l := zerolog.New(&buf).Sample(DebugSampler())
+		for i := 0; i < 6; i++ {
+			l.Debug().Msg("hot")
+			l.Warn().Msg("rare")
+		}
+		So(strings.Count(buf.String(), "hot"), ShouldEqual, 2)
+		So(strings.Count(buf.String(), "rare"), ShouldEqual, 6)
+	})
+
+	Convey("Unset or 1 keeps everything", t, func() {
+		t.Setenv("LOG_DEBUG_SAMPLE", "")
+		So(DebugSampler(), ShouldBeNil)
+		t.Setenv("LOG_DEBUG_SAMPLE", "1")
+		So(DebugSampler(), ShouldBeNil)
+	})
+}
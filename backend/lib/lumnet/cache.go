@@ -0,0 +1,213 @@
+package lumnet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	commonErrors "lumium/lib/errors"
+)
+
+// Conditional requests (RFC 9110 §13): reads carry an ETag and Last-Modified so clients can
+// revalidate with If-None-Match / If-Modified-Since and get a bodiless 304, and writes can be
+// made optimistic with If-Match, failing with 412 when someone else changed the resource first
+
+// Cache-Control policies for routes, see CacheControl
+const (
+	// CacheNoStore is for responses that must never be kept, e.g. tokens
+	CacheNoStore = "no-store"
+	// CachePrivate lets the browser keep a response but revalidate it on every use; with an
+	// ETag that is a 304 when nothing changed
+	CachePrivate = "private, no-cache"
+	// CacheImmutable is for content-addressed responses that never change, e.g. thumbnails
+	CacheImmutable = "public, max-age=31536000, immutable"
+)
+
+// maxETagBody is the largest response ETags buffers to hash
+const maxETagBody = 1 << 20
+
+// ETagOf is a strong ETag hashing the exact bytes of a representation
+func ETagOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// VersionETag is a strong ETag for a row, from its id and updated_at. It changes on every write,
+// so it can guard an update with If-Match
+func VersionETag(id string, updatedAt time.Time) string {
+	return ETagOf([]byte(id + "@" + strconv.FormatInt(updatedAt.UnixNano(), 36)))
+}
+
+// WeakETag marks tag weak: good for revalidating reads, never for If-Match
+func WeakETag(tag string) string {
+	if strings.HasPrefix(tag, "W/") {
+		return tag
+	}
+	return "W/" + tag
+}
+
+// CacheControl sets the Cache-Control policy of the routes it is mounted on. A handler can still
+// override it for one response
+func CacheControl(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", policy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NotModified sets the ETag and Last-Modified of a GET or HEAD response (either may be empty or
+// zero) and reports whether the client's copy is current, in which case it has written the 304
+// and the handler is done. If-None-Match wins over If-Modified-Since, as RFC 9110 orders them.
+// Without a route policy the response is CachePrivate, so browsers revalidate instead of
+// guessing a freshness lifetime from Last-Modified
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", CachePrivate)
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	fresh := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		fresh = etag != "" && matchETag(inm, etag, false)
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		fresh = !modified.Truncate(time.Second).After(ims)
+	}
+	if fresh {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return fresh
+}
+
+// CheckPreconditions evaluates If-Match, or failing that If-Unmodified-Since, against the
+// resource's current ETag and modification time before a write. A failed precondition is a 412:
+// the client's copy is stale and it should fetch the resource again. Requests without either
+// header pass
+func CheckPreconditions(r *http.Request, etag string, modified time.Time) error {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if etag == "" || !matchETag(im, etag, true) {
+			return commonErrors.WithField(commonErrors.PreconditionFailedf(
+				"the resource has changed since it was fetched"), "If-Match")
+		}
+		return nil
+	}
+	ius, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	if err == nil && !modified.IsZero() && modified.Truncate(time.Second).After(ius) {
+		return commonErrors.WithField(commonErrors.PreconditionFailedf(
+			"the resource has changed since it was fetched"), "If-Unmodified-Since")
+	}
+	return nil
+}
+
+// matchETag reports whether the If-Match or If-None-Match list header matches etag. "*" matches
+// any current representation. Strong comparison (If-Match) never matches weak tags; weak
+// comparison (If-None-Match) ignores the W/ prefix
+func matchETag(header, etag string, strong bool) bool {
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if strong {
+			if t == etag {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ETags tags successful GET responses with a strong ETag hashing their body, and answers a
+// matching If-None-Match with 304, so an unchanged list isn't sent again. It suits JSON reads
+// that have no cheaper version to compare; responses the handler tagged itself, and bodies
+// over 1 MiB, pass through untouched
+func ETags(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ew := &etagWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		ew.finish(r)
+	})
+}
+
+// etagWriter holds back a 200 response until it is complete, so its ETag can be set before the
+// headers go out
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	wroteHeader bool
+	passthrough bool
+}
+
+func (e *etagWriter) WriteHeader(code int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+	e.status = code
+	if code != http.StatusOK || e.Header().Get("ETag") != "" {
+		e.passthrough = true
+		e.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (e *etagWriter) Write(b []byte) (int, error) {
+	if !e.wroteHeader {
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.passthrough {
+		return e.ResponseWriter.Write(b)
+	}
+	if e.buf.Len()+len(b) > maxETagBody {
+		// too big to hold: send what we have and stream the rest untagged
+		e.passthrough = true
+		e.ResponseWriter.WriteHeader(e.status)
+		if _, err := e.ResponseWriter.Write(e.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		e.buf.Reset()
+		return e.ResponseWriter.Write(b)
+	}
+	return e.buf.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (e *etagWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+func (e *etagWriter) finish(r *http.Request) {
+	if e.passthrough {
+		return
+	}
+	if NotModified(e.ResponseWriter, r, ETagOf(e.buf.Bytes()), time.Time{}) {
+		return
+	}
+	e.ResponseWriter.WriteHeader(e.status)
+	_, _ = e.ResponseWriter.Write(e.buf.Bytes())
+}
@@ -0,0 +1,211 @@
+package lumnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestETagOf(t *testing.T) {
+	Convey("ETags are strong, stable and change with the content", t, func() {
+		a := ETagOf([]byte(`{"id":1}`))
+		So(a, ShouldStartWith, `"`)
+		So(a, ShouldEndWith, `"`)
+		So(a, ShouldEqual, ETagOf([]byte(`{"id":1}`)))
+		So(a, ShouldNotEqual, ETagOf([]byte(`{"id":2}`)))
+		So(WeakETag(a), ShouldEqual, "W/"+a)
+		So(WeakETag(WeakETag(a)), ShouldEqual, "W/"+a)
+	})
+
+	Convey("Version ETags change with updated_at", t, func() {
+		now := time.Now()
+		So(VersionETag("r1", now), ShouldEqual, VersionETag("r1", now))
+		So(VersionETag("r1", now), ShouldNotEqual, VersionETag("r1", now.Add(time.Microsecond)))
+		So(VersionETag("r1", now), ShouldNotEqual, VersionETag("r2", now))
+	})
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500, time.UTC)
+	etag := ETagOf([]byte("v1"))
+
+	check := func(method string, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+		req := httptest.NewRequest(method, "/albums/1", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		return rec, NotModified(rec, req, etag, modified)
+	}
+
+	Convey("A request without validators gets the headers and the full response", t, func() {
+		rec, fresh := check(http.MethodGet, nil)
+		So(fresh, ShouldBeFalse)
+		So(rec.Header().Get("ETag"), ShouldEqual, etag)
+		So(rec.Header().Get("Last-Modified"), ShouldEqual, "Sun, 01 Mar 2026 12:00:00 GMT")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, CachePrivate)
+	})
+
+	Convey("A matching If-None-Match is a 304, weak or strong", t, func() {
+		for _, inm := range []string{etag, WeakETag(etag), `"other", ` + etag, "*"} {
+			rec, fresh := check(http.MethodGet, map[string]string{"If-None-Match": inm})
+			So(fresh, ShouldBeTrue)
+			So(rec.Code, ShouldEqual, http.StatusNotModified)
+		}
+	})
+
+	Convey("A stale If-None-Match wins over a current If-Modified-Since", t, func() {
+		_, fresh := check(http.MethodGet, map[string]string{
+			"If-None-Match":     `"stale"`,
+			"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+		})
+		So(fresh, ShouldBeFalse)
+	})
+
+	Convey("If-Modified-Since compares at second precision", t, func() {
+		_, fresh := check(http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)})
+		So(fresh, ShouldBeTrue)
+		_, fresh = check(http.MethodGet, map[string]string{
+			"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat),
+		})
+		So(fresh, ShouldBeFalse)
+	})
+
+	Convey("Writes are never answered with a 304", t, func() {
+		_, fresh := check(http.MethodPut, map[string]string{"If-None-Match": etag})
+		So(fresh, ShouldBeFalse)
+	})
+
+	Convey("A route policy is kept", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", CacheImmutable)
+		NotModified(rec, req, etag, time.Time{})
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, CacheImmutable)
+		So(rec.Header().Get("Last-Modified"), ShouldBeBlank)
+	})
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	etag := VersionETag("r1", modified)
+
+	check := func(headers map[string]string) error {
+		req := httptest.NewRequest(http.MethodPut, "/roles/r1", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return CheckPreconditions(req, etag, modified)
+	}
+
+	Convey("Requests without preconditions pass", t, func() {
+		So(check(nil), ShouldBeNil)
+	})
+
+	Convey("If-Match passes on the current ETag or *", t, func() {
+		So(check(map[string]string{"If-Match": etag}), ShouldBeNil)
+		So(check(map[string]string{"If-Match": `"old", ` + etag}), ShouldBeNil)
+		So(check(map[string]string{"If-Match": "*"}), ShouldBeNil)
+	})
+
+	Convey("A stale or weak If-Match is a 412 naming the header", t, func() {
+		for _, im := range []string{`"old"`, WeakETag(etag)} {
+			err := check(map[string]string{"If-Match": im})
+			So(err, ShouldNotBeNil)
+			var lerr *lumErrors.Error
+			So(As(err, &lerr), ShouldBeTrue)
+			So(lerr.Code(), ShouldEqual, lumErrors.ErrorCodePreconditionFailed)
+			So(lumErrors.HTTPStatusCode(lerr.Code()), ShouldEqual, http.StatusPreconditionFailed)
+			So(lerr.Field(), ShouldEqual, "If-Match")
+		}
+	})
+
+	Convey("If-Unmodified-Since fails once the resource changed after it", t, func() {
+		So(check(map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}), ShouldBeNil)
+		err := check(map[string]string{"If-Unmodified-Since": modified.Add(-time.Minute).Format(http.TimeFormat)})
+		var lerr *lumErrors.Error
+		So(As(err, &lerr), ShouldBeTrue)
+		So(lerr.Code(), ShouldEqual, lumErrors.ErrorCodePreconditionFailed)
+		So(lerr.Field(), ShouldEqual, "If-Unmodified-Since")
+	})
+}
+
+func TestETags(t *testing.T) {
+	serve := func(h http.HandlerFunc, method string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/albums", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		ETags(h).ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}
+
+	Convey("A 200 GET is tagged with the hash of its body", t, func() {
+		rec := serve(list, http.MethodGet, nil)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, `{"items":[]}`)
+		So(rec.Header().Get("ETag"), ShouldEqual, ETagOf([]byte(`{"items":[]}`)))
+	})
+
+	Convey("A matching If-None-Match gets a bodiless 304", t, func() {
+		rec := serve(list, http.MethodGet, map[string]string{"If-None-Match": ETagOf([]byte(`{"items":[]}`))})
+		So(rec.Code, ShouldEqual, http.StatusNotModified)
+		So(rec.Body.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Errors, writes and handler-tagged responses pass through", t, func() {
+		rec := serve(func(w http.ResponseWriter, r *http.Request) {
+			RenderError(w, r, lumErrors.NotFoundf("album not found"))
+		}, http.MethodGet, nil)
+		So(rec.Code, ShouldEqual, http.StatusNotFound)
+		So(rec.Header().Get("ETag"), ShouldBeBlank)
+
+		rec = serve(list, http.MethodPost, nil)
+		So(rec.Header().Get("ETag"), ShouldBeBlank)
+
+		rec = serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"own"`)
+			_, _ = w.Write([]byte("x"))
+		}, http.MethodGet, nil)
+		So(rec.Header().Get("ETag"), ShouldEqual, `"own"`)
+		So(rec.Body.String(), ShouldEqual, "x")
+	})
+
+	Convey("Bodies over 1 MiB are streamed untagged", t, func() {
+		chunk := strings.Repeat("a", 64<<10)
+		rec := serve(func(w http.ResponseWriter, r *http.Request) {
+			for range 20 {
+				_, _ = w.Write([]byte(chunk))
+			}
+		}, http.MethodGet, nil)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.Len(), ShouldEqual, 20*len(chunk))
+		So(rec.Header().Get("ETag"), ShouldBeBlank)
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	Convey("The route policy is set, and a handler can override it", t, func() {
+		rec := httptest.NewRecorder()
+		CacheControl(CacheNoStore)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, CacheNoStore)
+
+		rec = httptest.NewRecorder()
+		CacheControl(CachePrivate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", CacheImmutable)
+		})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, CacheImmutable)
+	})
+}
@@ -0,0 +1,322 @@
+package lumnet
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"lumium/lib/config"
+	commonErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Idempotency keys (draft-ietf-httpapi-idempotency-key-header) let a client retry a POST without
+// doing it twice: the first request with a key runs and its response is stored; a retry with the
+// same key and body gets that response back, marked with Idempotent-Replayed
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	replayedHeader    = "Idempotent-Replayed"
+	maxIdempotencyKey = 255
+)
+
+// StoredResponse is a response kept for replay
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyClaim is the outcome of claiming a key
+type IdempotencyClaim struct {
+	Claimed     bool            // the caller runs the request and must Complete or Release the key
+	Fingerprint string          // the fingerprint stored with the key, when not claimed
+	Response    *StoredResponse // the stored response; nil while the first request still runs
+}
+
+// IdempotencyStore keeps keys and their responses. Claim must be atomic per key, so two
+// concurrent requests with one key never both run
+type IdempotencyStore interface {
+	// Claim takes key for a request with fingerprint, unless an unexpired record holds it.
+	// An unfinished claim older than lock is taken over: its request died with its replica
+	Claim(ctx context.Context, key, fingerprint string, ttl, lock time.Duration) (IdempotencyClaim, error)
+	// Complete stores the response of a claimed key
+	Complete(ctx context.Context, key string, res StoredResponse) error
+	// Release drops a claimed key, so a retry runs the request again
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configure Idempotency
+type IdempotencyOptions struct {
+	Store IdempotencyStore           // DefaultIdempotencyStore when nil
+	Scope func(*http.Request) string // whose keys these are, e.g. auth.RateKeyUser; KeyByIP when nil
+	TTL   time.Duration              // how long a response is replayed; IDEMPOTENCY_TTL (24h) when unset
+	Lock  time.Duration              // how long a running request holds its key; 1m when unset
+
+	// MaxBody is the largest body a keyed request may have (1 MiB when unset). The whole body is
+	// fingerprinted, so a larger one is rejected with 413 rather than replayed on a partial match
+	MaxBody int64
+}
+
+// Idempotency honors the Idempotency-Key header on POST and PATCH. Requests without one pass
+// through. A retry with the same key replays the stored response; with the same key but a
+// different request it is rejected with 422, and while the first request still runs, with 409.
+// 5xx responses aren't stored, so a retry after a server error runs again
+func Idempotency(o IdempotencyOptions) func(http.Handler) http.Handler {
+	if o.Store == nil {
+		o.Store = DefaultIdempotencyStore()
+	}
+	if o.Scope == nil {
+		o.Scope = KeyByIP
+	}
+	if o.TTL <= 0 {
+		o.TTL = config.MayDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	}
+	if o.Lock <= 0 {
+		o.Lock = time.Minute
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := r.Header.Get(idempotencyHeader)
+			if raw == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, ok := parseIdempotencyKey(raw)
+			if !ok {
+				RenderError(w, r, commonErrors.NewValidationError(commonErrors.ErrorCodeValidation,
+					"Idempotency-Key must be 1 to 255 printable characters", idempotencyHeader))
+				return
+			}
+
+			fp, err := fingerprint(r, o.MaxBody)
+			if errors.Is(err, errBodyTooLarge) {
+				RenderError(w, r, commonErrors.WithField(commonErrors.PayloadTooLargef(
+					"requests with an Idempotency-Key can't have a body over %d bytes", o.MaxBody), idempotencyHeader))
+				return
+			}
+			if err != nil {
+				RenderError(w, r, commonErrors.InvalidArgf("read request body"))
+				return
+			}
+
+			scope := o.Scope(r)
+			if scope == "" {
+				scope = KeyByIP(r)
+			}
+			key = scope + ":" + key
+
+			claim, err := o.Store.Claim(r.Context(), key, fp, o.TTL, o.Lock)
+			if err != nil {
+				RenderError(w, r, commonErrors.WrapErrorf(err, commonErrors.ErrorCodeDB, "idempotency key"))
+				return
+			}
+			if !claim.Claimed {
+				switch {
+				case claim.Fingerprint != fp:
+					RenderError(w, r, commonErrors.WithField(commonErrors.InvalidArgf(
+						"Idempotency-Key was already used for a different request"), idempotencyHeader))
+				case claim.Response == nil:
+					RenderError(w, r, commonErrors.WithField(commonErrors.Conflictf(
+						"a request with this Idempotency-Key is still being processed"), idempotencyHeader))
+				default:
+					replay(w, claim.Response)
+				}
+				return
+			}
+
+			rec := &bytes.Buffer{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(rec)
+			completed := false
+			defer func() {
+				// a panic, or a 5xx, leaves nothing worth replaying
+				if !completed {
+					releaseKey(o.Store, key)
+				}
+			}()
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				return
+			}
+			res := StoredResponse{Status: status, Header: replayHeaders(w.Header()), Body: rec.Bytes()}
+			if err := o.Store.Complete(context.WithoutCancel(r.Context()), key, res); err != nil {
+				l := logger.Ctx(r.Context())
+				l.Error().Err(err).Msg("idempotency: store response")
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// parseIdempotencyKey accepts the key as a bare token or, as the draft specifies it, an RFC 8941
+// quoted string
+func parseIdempotencyKey(raw string) (string, bool) {
+	k := strings.TrimSpace(raw)
+	if len(k) >= 2 && k[0] == '"' && k[len(k)-1] == '"' {
+		k = k[1 : len(k)-1]
+	}
+	if k == "" || len(k) > maxIdempotencyKey {
+		return "", false
+	}
+	for _, c := range k {
+		if c < 0x20 || c > 0x7e {
+			return "", false
+		}
+	}
+	return k, true
+}
+
+// errBodyTooLarge is returned by fingerprint for a body over the limit
+var errBodyTooLarge = errors.New("body too large to fingerprint")
+
+// fingerprint hashes what makes two requests the same request: method, path, type and the whole
+// body. The body is read and put back; one over maxBody can't be hashed without buffering it,
+// and is refused with errBodyTooLarge
+func fingerprint(r *http.Request, maxBody int64) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n"+r.Header.Get("Content-Type")+"\n")
+	if r.Body == nil || r.Body == http.NoBody {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if r.ContentLength > maxBody {
+		return "", errBodyTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > maxBody {
+		return "", errBodyTooLarge
+	}
+	h.Write(body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// skipReplayHeaders belong to the original exchange, not to the response being replayed
+var skipReplayHeaders = map[string]bool{
+	"Set-Cookie": true, "Date": true, "X-Request-Id": true, "Retry-After": true,
+	"Ratelimit-Limit": true, "Ratelimit-Remaining": true, "Ratelimit-Reset": true, "Ratelimit-Policy": true,
+}
+
+func replayHeaders(h http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range h {
+		if !skipReplayHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = append([]string(nil), v...)
+		}
+	}
+	return out
+}
+
+func replay(w http.ResponseWriter, res *StoredResponse) {
+	for k, v := range res.Header {
+		if w.Header().Get(k) == "" {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(res.Status)
+	_, _ = w.Write(res.Body)
+}
+
+func releaseKey(s IdempotencyStore, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Release(ctx, key); err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Msg("idempotency: release key")
+	}
+}
+
+// MemoryIdempotencyStore keeps keys in process, for tests and single-replica setups
+type MemoryIdempotencyStore struct {
+	mu     sync.Mutex
+	recs   map[string]*memIdempotency
+	claims int
+	now    func() time.Time
+}
+
+type memIdempotency struct {
+	fingerprint string
+	res         *StoredResponse
+	expires     time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty in-process store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{recs: map[string]*memIdempotency{}, now: time.Now}
+}
+
+// Claim implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Claim(
+	_ context.Context, key, fp string, ttl, lock time.Duration,
+) (IdempotencyClaim, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if rec, ok := m.recs[key]; ok && now.Before(rec.expires) && (rec.res != nil || now.Before(rec.lockedUntil)) {
+		return IdempotencyClaim{Fingerprint: rec.fingerprint, Response: rec.res}, nil
+	}
+	m.recs[key] = &memIdempotency{fingerprint: fp, expires: now.Add(ttl), lockedUntil: now.Add(lock)}
+
+	if m.claims++; m.claims%1024 == 0 {
+		for k, rec := range m.recs {
+			if !now.Before(rec.expires) {
+				delete(m.recs, k)
+			}
+		}
+	}
+	return IdempotencyClaim{Claimed: true}, nil
+}
+
+// Complete implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Complete(_ context.Context, key string, res StoredResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec, ok := m.recs[key]; ok {
+		rec.res = &res
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.recs, key)
+	return nil
+}
+
+var (
+	defaultIdempotencyOnce  sync.Once
+	defaultIdempotencyStore IdempotencyStore
+)
+
+// DefaultIdempotencyStore is the process-wide memory store used when no Store is given
+func DefaultIdempotencyStore() IdempotencyStore {
+	defaultIdempotencyOnce.Do(func() { defaultIdempotencyStore = NewMemoryIdempotencyStore() })
+	return defaultIdempotencyStore
+}
@@ -0,0 +1,113 @@
+package lumnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"lumium/lib/logger"
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PGIdempotencyStore keeps keys and responses in the idempotency_keys table, shared by every
+// replica
+type PGIdempotencyStore struct {
+	db     store.Queryer
+	claims atomic.Uint64
+}
+
+// NewPGIdempotencyStore returns a store over db
+func NewPGIdempotencyStore(db store.Queryer) *PGIdempotencyStore {
+	return &PGIdempotencyStore{db: db}
+}
+
+// idempotencyClaimSQL inserts the key, or takes over a record that expired or whose request
+// died holding it; a live record returns no row. $3 and $4 are the TTL and lock in seconds
+const idempotencyClaimSQL = `
+INSERT INTO idempotency_keys AS k (key, fingerprint, expires_at, locked_until)
+VALUES ($1, $2, NOW() + make_interval(secs => $3), NOW() + make_interval(secs => $4))
+ON CONFLICT (key) DO UPDATE
+  SET fingerprint = EXCLUDED.fingerprint,
+      expires_at = EXCLUDED.expires_at,
+      locked_until = EXCLUDED.locked_until,
+      status = NULL, headers = NULL, body = NULL, completed_at = NULL
+  WHERE k.expires_at <= NOW() OR (k.completed_at IS NULL AND k.locked_until <= NOW())
+RETURNING key`
+
+// Claim implements IdempotencyStore
+func (s *PGIdempotencyStore) Claim(
+	ctx context.Context, key, fp string, ttl, lock time.Duration,
+) (IdempotencyClaim, error) {
+	if s.claims.Add(1)%1024 == 0 {
+		go s.prune()
+	}
+
+	var k string
+	err := s.db.QueryRow(ctx, idempotencyClaimSQL, key, fp, ttl.Seconds(), lock.Seconds()).Scan(&k)
+	if err == nil {
+		return IdempotencyClaim{Claimed: true}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return IdempotencyClaim{}, err
+	}
+
+	var (
+		c       IdempotencyClaim
+		status  *int
+		headers []byte
+		body    []byte
+	)
+	err = s.db.QueryRow(ctx,
+		`SELECT fingerprint, status, headers, body FROM idempotency_keys WHERE key = $1`, key,
+	).Scan(&c.Fingerprint, &status, &headers, &body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.Claim(ctx, key, fp, ttl, lock) // released in between
+	}
+	if err != nil {
+		return IdempotencyClaim{}, err
+	}
+	if status != nil {
+		res := &StoredResponse{Status: *status, Body: body}
+		if err := json.Unmarshal(headers, &res.Header); err != nil {
+			return IdempotencyClaim{}, err
+		}
+		c.Response = res
+	}
+	return c, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *PGIdempotencyStore) Complete(ctx context.Context, key string, res StoredResponse) error {
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	headers, err := json.Marshal(res.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, `
+		UPDATE idempotency_keys SET status = $2, headers = $3, body = $4, completed_at = NOW()
+		WHERE key = $1`, key, res.Status, headers, res.Body)
+	return err
+}
+
+// Release implements IdempotencyStore
+func (s *PGIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND completed_at IS NULL`, key)
+	return err
+}
+
+// prune deletes expired records
+func (s *PGIdempotencyStore) prune() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`); err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Msg("idempotency_keys: prune")
+	}
+}
@@ -0,0 +1,255 @@
+package lumnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotency(t *testing.T) {
+	var runs atomic.Int32
+	var status atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := runs.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if s := status.Load(); s != 0 {
+			w.WriteHeader(int(s))
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/albums/%d", n))
+		w.Header().Set("Set-Cookie", "session=secret")
+		Created(w, r, map[string]any{"n": n, "echo": string(body)}, "")
+	})
+
+	post := func(h http.Handler, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:1234"
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	Convey("Given the Idempotency middleware", t, func() {
+		runs.Store(0)
+		status.Store(0)
+		h := Idempotency(IdempotencyOptions{Store: NewMemoryIdempotencyStore()})(handler)
+
+		Convey("a retry with the same key and body replays the first response", func() {
+			first := post(h, "k1", `{"title":"x"}`)
+			So(first.Code, ShouldEqual, http.StatusCreated)
+
+			again := post(h, `"k1"`, `{"title":"x"}`)
+			So(runs.Load(), ShouldEqual, 1)
+			So(again.Code, ShouldEqual, http.StatusCreated)
+			So(again.Body.String(), ShouldEqual, first.Body.String())
+			So(again.Header().Get("Location"), ShouldEqual, "/albums/1")
+			So(again.Header().Get("Idempotent-Replayed"), ShouldEqual, "true")
+			So(again.Header().Get("Set-Cookie"), ShouldBeBlank)
+		})
+
+		Convey("reusing a key for a different body is a 422", func() {
+			post(h, "k1", `{"title":"x"}`)
+			rec := post(h, "k1", `{"title":"y"}`)
+			So(rec.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			So(rec.Body.String(), ShouldContainSubstring, "different request")
+			So(runs.Load(), ShouldEqual, 1)
+		})
+
+		Convey("requests without a key, or with another key, run every time", func() {
+			post(h, "", `{}`)
+			post(h, "", `{}`)
+			post(h, "k2", `{}`)
+			So(runs.Load(), ShouldEqual, 3)
+		})
+
+		Convey("a 5xx isn't stored, so the retry runs again", func() {
+			status.Store(http.StatusBadGateway)
+			So(post(h, "k3", `{}`).Code, ShouldEqual, http.StatusBadGateway)
+			status.Store(0)
+			So(post(h, "k3", `{}`).Code, ShouldEqual, http.StatusCreated)
+			So(runs.Load(), ShouldEqual, 2)
+		})
+
+		Convey("an invalid key is rejected", func() {
+			So(post(h, strings.Repeat("k", 256), `{}`).Code, ShouldEqual, http.StatusBadRequest)
+			So(runs.Load(), ShouldEqual, 0)
+		})
+
+		Convey("the handler still sees the whole body", func() {
+			rec := post(h, "k4", `{"title":"kept"}`)
+			So(rec.Body.String(), ShouldContainSubstring, `{\"title\":\"kept\"}`)
+		})
+
+		Convey("a body too large to fingerprint is refused rather than matched on its length", func() {
+			small := Idempotency(IdempotencyOptions{Store: NewMemoryIdempotencyStore(), MaxBody: 8})(handler)
+			So(post(small, "k5", `{"title":"aaaa"}`).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+			req := httptest.NewRequest(http.MethodPost, "/albums", io.MultiReader(strings.NewReader(`{"title":"bbbb"}`)))
+			req.Header.Set("Idempotency-Key", "k5")
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+			small.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(runs.Load(), ShouldEqual, 0)
+
+			So(post(small, "k5", `{}`).Code, ShouldEqual, http.StatusCreated)
+		})
+	})
+
+	Convey("A retry while the first request runs is a 409", t, func() {
+		store := NewMemoryIdempotencyStore()
+		release := make(chan struct{})
+		started := make(chan struct{})
+		slow := Idempotency(IdempotencyOptions{Store: store})(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+				NoContent(w, r)
+			}))
+
+		done := make(chan int)
+		go func() { done <- post(slow, "k", `{}`).Code }()
+		<-started
+		So(post(slow, "k", `{}`).Code, ShouldEqual, http.StatusConflict)
+		close(release)
+		So(<-done, ShouldEqual, http.StatusNoContent)
+		So(post(slow, "k", `{}`).Code, ShouldEqual, http.StatusNoContent)
+	})
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	Convey("Records expire, and a dead request's lock can be taken over", t, func() {
+		now := time.Unix(1_700_000_000, 0)
+		m := NewMemoryIdempotencyStore()
+		m.now = func() time.Time { return now }
+		ctx := context.Background()
+
+		c, _ := m.Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(c.Claimed, ShouldBeTrue)
+		c, _ = m.Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(c.Claimed, ShouldBeFalse)
+
+		now = now.Add(2 * time.Minute) // the first request never completed
+		c, _ = m.Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(c.Claimed, ShouldBeTrue)
+		So(m.Complete(ctx, "k", StoredResponse{Status: 201}), ShouldBeNil)
+
+		now = now.Add(30 * time.Minute)
+		c, _ = m.Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(c.Claimed, ShouldBeFalse)
+		So(c.Response.Status, ShouldEqual, 201)
+
+		now = now.Add(time.Hour)
+		c, _ = m.Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(c.Claimed, ShouldBeTrue)
+	})
+}
+
+type failingIdempotencyStore struct{ *MemoryIdempotencyStore }
+
+func (failingIdempotencyStore) Claim(
+	context.Context, string, string, time.Duration, time.Duration,
+) (IdempotencyClaim, error) {
+	return IdempotencyClaim{}, errors.New("db down")
+}
+
+func TestIdempotencyStoreFailure(t *testing.T) {
+	Convey("A failing store answers 500 rather than risk running the request twice", t, func() {
+		h := Idempotency(IdempotencyOptions{Store: failingIdempotencyStore{NewMemoryIdempotencyStore()}})(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) { NoContent(w, r) }))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", "k")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+}
+
+// scanRow scans by calling fn, or fails with err
+type scanRow struct {
+	fn  func(dest ...any)
+	err error
+}
+
+func (r scanRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.fn(dest...)
+	return nil
+}
+
+// idemQueryer answers QueryRow from a queue of rows and records Exec statements
+type idemQueryer struct {
+	rows []scanRow
+	exec []string
+}
+
+func (q *idemQueryer) Query(context.Context, string, ...any) (pgx.Rows, error) { return nil, nil }
+func (q *idemQueryer) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	q.exec = append(q.exec, sql)
+	return pgconn.CommandTag{}, nil
+}
+func (q *idemQueryer) QueryRow(context.Context, string, ...any) pgx.Row {
+	r := q.rows[0]
+	q.rows = q.rows[1:]
+	return r
+}
+
+func TestPGIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	claimed := scanRow{fn: func(dest ...any) { *dest[0].(*string) = "k" }}
+	held := scanRow{err: pgx.ErrNoRows}
+
+	Convey("A returned key is a claim", t, func() {
+		c, err := NewPGIdempotencyStore(&idemQueryer{rows: []scanRow{claimed}}).
+			Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(err, ShouldBeNil)
+		So(c.Claimed, ShouldBeTrue)
+	})
+
+	Convey("A held key returns its fingerprint and, once completed, its response", t, func() {
+		stored := scanRow{fn: func(dest ...any) {
+			*dest[0].(*string) = "fp"
+			status := 201
+			*dest[1].(**int) = &status
+			*dest[2].(*[]byte) = []byte(`{"Location":["/albums/1"]}`)
+			*dest[3].(*[]byte) = []byte(`{"id":1}`)
+		}}
+		c, err := NewPGIdempotencyStore(&idemQueryer{rows: []scanRow{held, stored}}).
+			Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(err, ShouldBeNil)
+		So(c.Claimed, ShouldBeFalse)
+		So(c.Fingerprint, ShouldEqual, "fp")
+		So(c.Response.Status, ShouldEqual, 201)
+		So(c.Response.Header.Get("Location"), ShouldEqual, "/albums/1")
+		So(string(c.Response.Body), ShouldEqual, `{"id":1}`)
+	})
+
+	Convey("A key released between the two queries is claimed again", t, func() {
+		q := &idemQueryer{rows: []scanRow{held, held, claimed}}
+		c, err := NewPGIdempotencyStore(q).Claim(ctx, "k", "fp", time.Hour, time.Minute)
+		So(err, ShouldBeNil)
+		So(c.Claimed, ShouldBeTrue)
+	})
+
+	Convey("Release only drops unfinished claims", t, func() {
+		q := &idemQueryer{}
+		So(NewPGIdempotencyStore(q).Release(ctx, "k"), ShouldBeNil)
+		So(q.exec[0], ShouldContainSubstring, "completed_at IS NULL")
+	})
+}
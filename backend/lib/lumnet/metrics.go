@@ -0,0 +1,49 @@
+package lumnet
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"lumium/lib/metrics"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing random paths can't blow
+// up the label cardinality
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"HTTP requests by route pattern, method and status code", "route", "method", "code")
+	httpDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by route pattern and method", nil, "route", "method")
+	httpInFlight = metrics.NewGaugeVec("http_requests_in_flight",
+		"HTTP requests being served").WithLabelValues()
+)
+
+// Metrics records rate, errors and duration per chi route pattern ("/api/v1/albums/{id}", not
+// the raw path)
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			route = rc.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
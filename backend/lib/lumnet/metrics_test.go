@@ -0,0 +1,43 @@
+package lumnet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	r := NewRouter(RouterOptions{WithMetrics: true, WithRecovery: true})
+	r.Get("/things/{id}", func(w http.ResponseWriter, r *http.Request) { NoContent(w, r) })
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		b, _ := io.ReadAll(rec.Body)
+		return string(b)
+	}
+
+	Convey("Requests are counted by route pattern, not raw path", t, func() {
+		for _, p := range []string{"/things/1", "/things/2", "/nope/3"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+		}
+
+		out := scrape()
+		So(out, ShouldContainSubstring,
+			`lumium_http_requests_total{code="204",method="GET",route="/things/{id}"} 2`)
+		So(out, ShouldContainSubstring,
+			`lumium_http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+		So(out, ShouldContainSubstring, `lumium_http_request_duration_seconds_bucket{method="GET",route="/things/{id}"`)
+		So(out, ShouldNotContainSubstring, `route="/things/1"`)
+	})
+
+	Convey("The runtime collectors are exposed too", t, func() {
+		out := scrape()
+		So(out, ShouldContainSubstring, "go_goroutines")
+		So(out, ShouldContainSubstring, "lumium_http_requests_in_flight")
+	})
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 // sendRequestID sets the request ID into the header
@@ -23,14 +26,43 @@ func sendRequestID(next http.Handler) http.Handler {
 	})
 }
 
+// RequestLogger gives each request a logger carrying its request id, method and path, which
+// logger.Ctx returns to everything below (auth adds the user and tenant), and logs the outcome
+// with it when the request ends. Only the path is logged: a query may hold an access_token
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		l := logger.Get().With().
+			Str("request_id", GetRequestID(r)).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Logger()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(logger.WithContext(r.Context(), &l)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ev := l.Info()
+		if status >= http.StatusInternalServerError {
+			ev = l.Warn() // the failure itself is logged as an error where it happened
+		}
+		ev.Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("elapsed", time.Since(start)).
+			Str("remote", r.RemoteAddr).
+			Msg("Request finished")
+	})
+}
+
 // Recovery catches panics, logs a stack, and emits a standardized 500 JSON error.
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rvr := recover(); rvr != nil {
-				l := logger.Get()
-				lp := &l
-				lp.Error().
+				l := logger.Ctx(r.Context())
+				l.Error().
 					Str("stack", string(debug.Stack())).
 					Msg(fmt.Sprintf("%v", rvr))
 				RenderError(w, r, commonErrors.PanicErrf("internal server error"))
@@ -1,12 +1,14 @@
 package lumnet
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
 
 	"github.com/go-chi/chi/v5/middleware"
 	. "github.com/smartystreets/goconvey/convey"
@@ -105,3 +107,27 @@ func TestRecovery_NoPanic(t *testing.T) {
 		So(rec.Code, ShouldEqual, http.StatusTeapot)
 	})
 }
+
+// TestRequestLogger tests the per-request logger
+func TestRequestLogger(t *testing.T) {
+	Convey("RequestLogger hands the request a logger carrying its id, method and path", t, func() {
+		var buf bytes.Buffer
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := logger.FromContext(r.Context())
+			So(ok, ShouldBeTrue)
+			l := logger.Ctx(r.Context()).Output(&buf)
+			l.Info().Msg("inside")
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/albums?access_token=secret", nil)
+		middleware.RequestID(RequestLogger(h)).ServeHTTP(rec, req)
+
+		So(rec.Code, ShouldEqual, http.StatusAccepted)
+		So(buf.String(), ShouldContainSubstring, `"request_id":"`)
+		So(buf.String(), ShouldContainSubstring, `"method":"POST"`)
+		So(buf.String(), ShouldContainSubstring, `"path":"/albums"`)
+		So(buf.String(), ShouldNotContainSubstring, "secret")
+	})
+}
@@ -0,0 +1,181 @@
+package lumnet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"lumium/lib/config"
+	commonErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+)
+
+// PageQuery holds the pagination params of a list endpoint; embed it in the endpoint's query DTO
+type PageQuery struct {
+	Cursor string `query:"cursor" validate:"omitempty,max=2048"`
+	Limit  int    `query:"limit"  validate:"omitempty,min=1,max=200"`
+	Sort   string `query:"sort"   validate:"omitempty,max=200"`
+}
+
+// PageSpec describes how an endpoint sorts: the whitelisted fields, the default sort and the
+// unique tiebreak field appended to every sort
+type PageSpec struct {
+	Fields       store.SortFields
+	DefaultSort  string
+	Tiebreak     string
+	DefaultLimit int // 50 when unset
+}
+
+// Page turns the params into a keyset page, verifying the cursor. A cursor is only valid with the
+// sort it was issued for, so changing the sort restarts from the first page
+func (s PageSpec) Page(q PageQuery, c *CursorCodec) (store.Page, error) {
+	cols, err := s.Fields.ParseSort(q.Sort, s.DefaultSort, s.Tiebreak)
+	if err != nil {
+		return store.Page{}, err
+	}
+	p := store.Page{Sort: cols, Limit: q.Limit}
+	if p.Limit <= 0 {
+		p.Limit = s.DefaultLimit
+	}
+	if p.Limit <= 0 {
+		p.Limit = 50
+	}
+	if q.Cursor == "" {
+		return p, nil
+	}
+
+	var cur cursor
+	if err := c.Decode(q.Cursor, &cur); err != nil {
+		return store.Page{}, err
+	}
+	if cur.Sort != store.SortSpec(cols) || len(cur.After) != len(cols) {
+		return store.Page{}, commonErrors.NewValidationError(commonErrors.ErrorCodeValidation,
+			"cursor does not match the sort", "cursor")
+	}
+	p.After = cur.After
+	return p, nil
+}
+
+// cursor is the payload of a keyset cursor
+type cursor struct {
+	Sort  string   `json:"s"`
+	After []string `json:"a"`
+}
+
+// NextCursor encodes the cursor for the page after p, or "" when after is nil
+func NextCursor(c *CursorCodec, p store.Page, after []string) string {
+	if after == nil {
+		return ""
+	}
+	return c.Encode(cursor{Sort: store.SortSpec(p.Sort), After: after})
+}
+
+// CursorCodec signs cursors so clients can't forge one that reaches rows a query would never
+// return, or that breaks the SQL with a mistyped value. Cursors are opaque: base64url(JSON) plus
+// an HMAC-SHA256 over it
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec returns a codec signing with secret
+func NewCursorCodec(secret []byte) *CursorCodec {
+	return &CursorCodec{secret: secret}
+}
+
+var (
+	cursorsOnce sync.Once
+	cursors     *CursorCodec
+)
+
+// Cursors returns the shared codec, keyed by PAGINATION_CURSOR_SECRET. Without it a random key
+// is used, so cursors don't survive a restart or cross instances
+func Cursors() *CursorCodec {
+	cursorsOnce.Do(func() {
+		secret := []byte(config.MayString("PAGINATION_CURSOR_SECRET", ""))
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			_, _ = rand.Read(secret)
+			l := logger.Get()
+			l.Warn().Msg("PAGINATION_CURSOR_SECRET is not set; cursors are only valid on this instance")
+		}
+		cursors = NewCursorCodec(secret)
+	})
+	return cursors
+}
+
+// Encode returns the signed cursor for v
+func (c *CursorCodec) Encode(v any) string {
+	b, _ := json.Marshal(v)
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+// Decode verifies s and unmarshals it into v
+func (c *CursorCodec) Decode(s string, v any) error {
+	invalid := commonErrors.NewValidationError(commonErrors.ErrorCodeValidation, "cursor is invalid", "cursor")
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return invalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, c.sign(payload)) {
+		return invalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(b, v) != nil {
+		return invalid
+	}
+	return nil
+}
+
+func (c *CursorCodec) sign(payload string) []byte {
+	m := hmac.New(sha256.New, c.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// SetLinks sets an RFC 8288 Link header with rel="next" (when next is set) and rel="first", built
+// from the request URL so filters and sort carry over
+func SetLinks(w http.ResponseWriter, r *http.Request, next string) {
+	link := func(cur, rel string) string {
+		u := *r.URL
+		q := u.Query()
+		q.Del("cursor")
+		if cur != "" {
+			q.Set("cursor", cur)
+		}
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+	links := []string{link("", "first")}
+	if next != "" {
+		links = append(links, link(next, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// ListPage writes a keyset page: the List envelope with meta.next_cursor and meta.limit, plus
+// Link headers. Pass total -1 when counting the matches would be too costly
+func ListPage[T any](w http.ResponseWriter, r *http.Request, items []T, total int64, p store.Page, next string) {
+	if items == nil {
+		items = []T{}
+	}
+	SetLinks(w, r, next)
+	meta := map[string]any{"limit": p.Limit, "sort": store.SortSpec(p.Sort)}
+	if next != "" {
+		meta["next_cursor"] = next
+	}
+	List(w, r, items, total, meta)
+}
+
+// ListPageR is the Reply form of ListPage
+func ListPageR[T any](items []T, total int64, p store.Page, next string) Reply {
+	return func(w http.ResponseWriter, r *http.Request) { ListPage(w, r, items, total, p, next) }
+}
@@ -0,0 +1,75 @@
+package lumnet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lumium/lib/store"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPages(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	spec := PageSpec{
+		Fields:      store.SortFields{"taken_at": "p.taken_at", "id": "p.id"},
+		DefaultSort: "-taken_at",
+		Tiebreak:    "id",
+	}
+
+	Convey("A first page uses the default sort and limit", t, func() {
+		p, err := spec.Page(PageQuery{}, codec)
+		So(err, ShouldBeNil)
+		So(p.Limit, ShouldEqual, 50)
+		So(store.SortSpec(p.Sort), ShouldEqual, "-taken_at,-id")
+		So(p.After, ShouldBeNil)
+	})
+
+	Convey("A next cursor round-trips into the following page", t, func() {
+		p, _ := spec.Page(PageQuery{Limit: 10}, codec)
+		next := NextCursor(codec, p, []string{"2026-01-01T00:00:00Z", "p9"})
+		So(next, ShouldNotBeBlank)
+
+		p2, err := spec.Page(PageQuery{Limit: 10, Cursor: next}, codec)
+		So(err, ShouldBeNil)
+		So(p2.After, ShouldResemble, []string{"2026-01-01T00:00:00Z", "p9"})
+
+		Convey("but not with another sort", func() {
+			_, err := spec.Page(PageQuery{Cursor: next, Sort: "taken_at"}, codec)
+			So(err.Error(), ShouldEqual, "cursor does not match the sort")
+		})
+
+		Convey("nor when tampered with or signed with another key", func() {
+			payload, sig, _ := strings.Cut(next, ".")
+			_, err := spec.Page(PageQuery{Cursor: payload + "x." + sig}, codec)
+			So(err.Error(), ShouldEqual, "cursor is invalid")
+
+			_, err = spec.Page(PageQuery{Cursor: next}, NewCursorCodec([]byte("other")))
+			So(err.Error(), ShouldEqual, "cursor is invalid")
+		})
+	})
+
+	Convey("ListPage writes the envelope and Link header", t, func() {
+		p, _ := spec.Page(PageQuery{Limit: 2}, codec)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/photos?limit=2&camera=Q3&cursor=old", nil)
+		ListPage(rec, req, []string{"a", "b"}, -1, p, "NEXT")
+
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Header().Get("Link"), ShouldEqual,
+			`</photos?camera=Q3&limit=2>; rel="first", </photos?camera=Q3&cursor=NEXT&limit=2>; rel="next"`)
+
+		var body struct {
+			Items []string       `json:"items"`
+			Total int64          `json:"total"`
+			Meta  map[string]any `json:"meta"`
+		}
+		So(json.Unmarshal(rec.Body.Bytes(), &body), ShouldBeNil)
+		So(body.Items, ShouldResemble, []string{"a", "b"})
+		So(body.Meta["next_cursor"], ShouldEqual, "NEXT")
+		So(body.Meta["sort"], ShouldEqual, "-taken_at,-id")
+	})
+}
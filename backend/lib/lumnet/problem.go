@@ -0,0 +1,190 @@
+package lumnet
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"lumium/lib/config"
+	commonErrors "lumium/lib/errors"
+)
+
+// Errors can be rendered as RFC 9457 problem details. It is opt-in: a client that sends
+// Accept: application/problem+json gets one, everyone else keeps the ErrResponse envelope
+
+// ProblemContentType is the media type of a problem details response
+const ProblemContentType = "application/problem+json"
+
+// problemTitles are the short, fixed summaries of each problem type
+var problemTitles = map[commonErrors.ErrorCode]string{
+	commonErrors.ErrorCodeUnknown:         "Internal error",
+	commonErrors.ErrorCodeNotFound:        "Not found",
+	commonErrors.ErrorCodeInvalidArgument: "Invalid argument",
+	commonErrors.ErrorCodeDuplicateKey:    "Already exists",
+	commonErrors.ErrorCodeDB:              "Database error",
+	commonErrors.ErrorCodeValidation:      "Validation failed",
+	commonErrors.ErrorCodeJSON:            "Malformed JSON",
+	commonErrors.ErrorCodePanic:           "Internal error",
+	commonErrors.ErrorCodeForeignKey:      "Referenced resource conflict",
+	commonErrors.ErrorCodeCheckViolation:  "Constraint violated",
+	commonErrors.ErrorCodeNotNull:         "Missing required value",
+	commonErrors.ErrorCodeSerialization:   "Concurrent update conflict",
+	commonErrors.ErrorCodeRateLimited:     "Too many requests",
+
+	commonErrors.ErrorCodeUnauthenticated:    "Authentication required",
+	commonErrors.ErrorCodePermissionDenied:   "Permission denied",
+	commonErrors.ErrorCodeConflict:           "Conflict",
+	commonErrors.ErrorCodePreconditionFailed: "Precondition failed",
+	commonErrors.ErrorCodeGone:               "Gone",
+	commonErrors.ErrorCodePayloadTooLarge:    "Payload too large",
+	commonErrors.ErrorCodeUnavailable:        "Service unavailable",
+	commonErrors.ErrorCodeTimeout:            "Timed out",
+}
+
+// Problem is an RFC 9457 problem details object. It is also an error, for responses whose
+// status has no ErrorCode: return it through RenderError like any other error
+type Problem struct {
+	Type     string                    `json:"type"`
+	Title    string                    `json:"title"`
+	Status   int                       `json:"status"`
+	Detail   string                    `json:"detail,omitempty"`
+	Instance string                    `json:"instance,omitempty"` // the request id
+	Code     string                    `json:"code,omitempty"`     // the type's stable name
+	Errors   []commonErrors.FieldError `json:"errors,omitempty"`   // every invalid field
+
+	// Retryable tells clients the same request may succeed later
+	Retryable bool `json:"retryable,omitempty"`
+
+	// Extensions are extra members, e.g. the challenge of an MFA prompt
+	Extensions map[string]any `json:"-"`
+
+	// Legacy is the body sent to clients that didn't ask for problem details, for endpoints
+	// whose error shape predates ErrResponse. Nil means an ErrResponse
+	Legacy map[string]any `json:"-"`
+}
+
+// Error returns the detail, or the title
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON writes the extensions alongside the standard members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	b, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	members := map[string]json.RawMessage{}
+	for k, v := range p.Extensions {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		members[k] = raw
+	}
+	var std map[string]json.RawMessage
+	if err := json.Unmarshal(b, &std); err != nil {
+		return nil, err
+	}
+	for k, v := range std {
+		members[k] = v // the standard members win over an extension of the same name
+	}
+	return json.Marshal(members)
+}
+
+var (
+	problemBaseOnce sync.Once
+	problemBase     string
+)
+
+// ProblemType is the type URI for a problem named name. The base comes from PROBLEM_TYPE_BASE;
+// point it at the error documentation to make the URIs resolvable
+func ProblemType(name string) string {
+	problemBaseOnce.Do(func() {
+		problemBase = config.MayString("PROBLEM_TYPE_BASE", "urn:lumium:problem:")
+	})
+	return problemBase + name
+}
+
+// ProblemFor describes err as a problem for the request r
+func ProblemFor(r *http.Request, err error) *Problem {
+	var p Problem
+	var perr *Problem
+	var ierr *commonErrors.Error
+	switch {
+	case As(err, &perr):
+		p = *perr
+	case As(err, &ierr):
+		p = Problem{
+			Code:      ierr.Code().String(),
+			Title:     problemTitles[ierr.Code()],
+			Status:    commonErrors.HTTPStatusCode(ierr.Code()),
+			Detail:    ierr.Message(),
+			Errors:    ierr.Fields(),
+			Retryable: ierr.Retryable(),
+		}
+	default:
+		p = Problem{
+			Code:   commonErrors.ErrorCodeUnknown.String(),
+			Title:  problemTitles[commonErrors.ErrorCodeUnknown],
+			Detail: commonErrors.SafeMessage(err),
+		}
+	}
+
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+		if p.Code != "" {
+			p.Type = ProblemType(p.Code)
+		}
+	}
+	if p.Instance == "" {
+		p.Instance = GetRequestID(r)
+	}
+	return &p
+}
+
+// WantsProblem reports whether the request accepts problem details. Only an explicit
+// application/problem+json counts: */* keeps the envelope existing clients expect
+func WantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), ProblemContentType) {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// WriteProblem writes p as application/problem+json
+func WriteProblem(w http.ResponseWriter, p *Problem) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		b, _ = json.Marshal(Problem{Type: "about:blank", Title: "Internal Server Error",
+			Status: http.StatusInternalServerError, Instance: p.Instance})
+		p.Status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(append(b, '\n'))
+}
@@ -0,0 +1,118 @@
+package lumnet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lumErrors "lumium/lib/errors"
+
+	"github.com/go-chi/chi/v5/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// renderWith renders err for a request sending accept
+func renderWith(accept string, err error) *httptest.ResponseRecorder {
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderError(w, r, err)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/albums", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWantsProblem(t *testing.T) {
+	Convey("Only an explicit, acceptable application/problem+json opts in", t, func() {
+		for _, c := range []struct {
+			accept string
+			want   bool
+		}{
+			{"", false},
+			{"*/*", false},
+			{"application/json", false},
+			{"application/problem+json", true},
+			{"application/json, application/problem+json;q=0.9", true},
+			{"Application/Problem+JSON", true},
+			{"application/problem+json;q=0", false},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", c.accept)
+			So(WantsProblem(req), ShouldEqual, c.want)
+		}
+	})
+}
+
+func TestRenderError_Problem(t *testing.T) {
+	Convey("A client asking for problem details gets RFC 9457 with every invalid field", t, func() {
+		err := lumErrors.NewValidationErrors([]lumErrors.FieldError{
+			{Field: "title", Message: "title is required"},
+			{Field: "limit", Message: "limit must be ≤ 200"},
+		})
+		rec := renderWith(ProblemContentType, err)
+
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(rec.Header().Get("Content-Type"), ShouldEqual, ProblemContentType)
+		So(rec.Header().Get("Vary"), ShouldEqual, "Accept")
+
+		var p Problem
+		So(json.Unmarshal(rec.Body.Bytes(), &p), ShouldBeNil)
+		So(p.Type, ShouldEqual, "urn:lumium:problem:validation")
+		So(p.Title, ShouldEqual, "Validation failed")
+		So(p.Status, ShouldEqual, http.StatusBadRequest)
+		So(p.Detail, ShouldEqual, "title is required")
+		So(p.Instance, ShouldNotBeBlank)
+		So(p.Code, ShouldEqual, "validation")
+		So(p.Errors, ShouldResemble, []lumErrors.FieldError{
+			{Field: "title", Message: "title is required"},
+			{Field: "limit", Message: "limit must be ≤ 200"},
+		})
+	})
+
+	Convey("Other clients keep the ErrResponse envelope, with the first field", t, func() {
+		err := lumErrors.NewValidationErrors([]lumErrors.FieldError{{Field: "title", Message: "title is required"}})
+		rec := renderWith("application/json", err)
+
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(rec.Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		var body ErrResponse
+		So(json.Unmarshal(rec.Body.Bytes(), &body), ShouldBeNil)
+		So(body.ValidationErrorField, ShouldEqual, "title")
+		So(body.AppCode, ShouldEqual, int64(lumErrors.ErrorCodeValidation))
+	})
+
+	Convey("Plain errors are an internal problem", t, func() {
+		rec := renderWith(ProblemContentType, assertErr("boom"))
+		var p Problem
+		So(json.Unmarshal(rec.Body.Bytes(), &p), ShouldBeNil)
+		So(p.Status, ShouldEqual, http.StatusInternalServerError)
+		So(p.Type, ShouldEqual, "urn:lumium:problem:unknown")
+		So(p.Title, ShouldEqual, "Internal error")
+	})
+
+	Convey("A Problem error renders with its extensions, or its legacy body", t, func() {
+		err := &Problem{
+			Status:     http.StatusLocked,
+			Code:       "mfa-required",
+			Title:      "Additional verification required",
+			Extensions: map[string]any{"challenge_id": "c1", "status": "ignored"},
+			Legacy:     map[string]any{"code": "mfa_required"},
+		}
+
+		rec := renderWith(ProblemContentType, err)
+		So(rec.Code, ShouldEqual, http.StatusLocked)
+		var body map[string]any
+		So(json.Unmarshal(rec.Body.Bytes(), &body), ShouldBeNil)
+		So(body["type"], ShouldEqual, "urn:lumium:problem:mfa-required")
+		So(body["challenge_id"], ShouldEqual, "c1")
+		So(body["status"], ShouldEqual, float64(http.StatusLocked))
+
+		rec = renderWith("", err)
+		So(rec.Code, ShouldEqual, http.StatusLocked)
+		So(rec.Body.String(), ShouldEqual, `{"code":"mfa_required"}`+"\n")
+	})
+}
@@ -0,0 +1,246 @@
+package lumnet
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	commonErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// defaultMaxFormMemory is how much of a multipart form ParseForm keeps in memory; larger file
+// parts spill to temporary files
+const defaultMaxFormMemory = 32 << 20
+
+// ParseQuery binds the URL query into T and validates it like ParseJSON. Fields bind by their
+// `query:"name"` tag; untagged fields are skipped, except embedded structs, whose fields are bound
+// as if declared inline (so a DTO can embed PageQuery). Supported field types: strings (including
+// named string types, which with a oneof validation make enums), bools, ints, uints, floats,
+// time.Time (RFC 3339 or YYYY-MM-DD), time.Duration, encoding.TextUnmarshaler implementations
+// such as uuid.UUID, pointers to those (nil when absent) and slices of them, given as repeated
+// or comma-separated values. A `default:"..."` tag fills absent params
+func ParseQuery[T any](r *http.Request) (T, error) {
+	q := r.URL.Query()
+	return parseValues[T]("query", func(name string) []string { return q[name] })
+}
+
+// ParsePath binds the route's URL params into T by their `path:"name"` tags, converting and
+// validating like ParseQuery
+func ParsePath[T any](r *http.Request) (T, error) {
+	rctx := chi.RouteContext(r.Context())
+	return parseValues[T]("path", func(name string) []string {
+		if rctx == nil {
+			return nil
+		}
+		if v := rctx.URLParam(name); v != "" {
+			return []string{v}
+		}
+		return nil
+	})
+}
+
+// ParseForm binds a URL-encoded or multipart form body into T by its `form:"name"` tags,
+// converting and validating like ParseQuery. File parts are left in r.MultipartForm
+func ParseForm[T any](r *http.Request) (T, error) {
+	var zero T
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(defaultMaxFormMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return zero, commonErrors.PayloadTooLargef("form body is over %d bytes", tooLarge.Limit)
+		}
+		return zero, commonErrors.InvalidArgf("invalid form body: %v", err)
+	}
+	return parseValues[T]("form", func(name string) []string { return r.PostForm[name] })
+}
+
+// ParseHeader binds request headers into T by their `header:"Name"` tags, converting and
+// validating like ParseQuery
+func ParseHeader[T any](r *http.Request) (T, error) {
+	return parseValues[T]("header", r.Header.Values)
+}
+
+// parseValues binds the fields tagged tag from get into a new T, then validates it
+func parseValues[T any](tag string, get func(name string) []string) (T, error) {
+	var dst T
+	rv := reflect.ValueOf(&dst).Elem()
+	if rv.Kind() != reflect.Struct {
+		return dst, commonErrors.InvalidArgf("Parse: %T is not a struct", dst)
+	}
+	if err := bindValues(rv, tag, get); err != nil {
+		return dst, err
+	}
+
+	if err := GetValidator().Validator.Struct(dst); err != nil {
+		var zero T
+		if inv, ok := err.(*validator.InvalidValidationError); ok {
+			l := logger.Get()
+			l.Error().Err(inv).Msg("validator internal error")
+			return zero, commonErrors.InvalidArgf("validation error")
+		}
+		return zero, ValidationError(err)
+	}
+	return dst, nil
+}
+
+// bindValues sets the fields of the struct rv tagged tag from get
+func bindValues(rv reflect.Value, tag string, get func(name string) []string) error {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+		name := sf.Tag.Get(tag)
+		if name == "" || name == "-" {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := bindValues(fv, tag, get); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		var vals []string
+		for _, v := range get(name) {
+			if fv.Kind() == reflect.Slice {
+				for _, p := range strings.Split(v, ",") {
+					if p = strings.TrimSpace(p); p != "" {
+						vals = append(vals, p)
+					}
+				}
+			} else if v = strings.TrimSpace(v); v != "" {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 0 {
+			def, ok := sf.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			vals = []string{def}
+			if fv.Kind() == reflect.Slice {
+				vals = strings.Split(def, ",")
+			}
+		}
+
+		if err := setQueryField(fv, vals); err != nil {
+			return commonErrors.NewValidationError(commonErrors.ErrorCodeValidation,
+				fmt.Sprintf("%s %s", name, err.Error()), name)
+		}
+	}
+	return nil
+}
+
+// setQueryField converts vals into fv
+func setQueryField(fv reflect.Value, vals []string) error {
+	switch {
+	case fv.Kind() == reflect.Slice && !isText(fv):
+		out := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, v := range vals {
+			if err := setScalar(out.Index(i), v); err != nil {
+				return err
+			}
+		}
+		fv.Set(out)
+		return nil
+	case fv.Kind() == reflect.Pointer:
+		p := reflect.New(fv.Type().Elem())
+		if err := setScalar(p.Elem(), vals[len(vals)-1]); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if len(vals) > 1 {
+		return fmt.Errorf("must be given once")
+	}
+	return setScalar(fv, vals[0])
+}
+
+// isText reports whether fv parses itself from text, other than time.Time, which is parsed here
+// so dates work too
+func isText(fv reflect.Value) bool {
+	return fv.Type() != timeType && fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// setScalar parses s into the non-container value fv
+func setScalar(fv reflect.Value, s string) error {
+	if isText(fv) {
+		if err := fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("must be a valid %s", fv.Type().Name())
+		}
+		return nil
+	}
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 90s or 1h30m")
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, s); err != nil {
+				return fmt.Errorf("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			}
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("has an unsupported type %s", fv.Type())
+	}
+	return nil
+}
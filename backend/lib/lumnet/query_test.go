@@ -0,0 +1,179 @@
+package lumnet
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type photoQuery struct {
+	PageQuery
+	TakenAfter *time.Time `query:"taken_after"`
+	Camera     []string   `query:"camera"`
+	Favorite   bool       `query:"favorite"`
+	MinRating  int        `query:"min_rating" validate:"omitempty,min=1,max=5"`
+	Kind       string     `query:"kind"       default:"photo" validate:"oneof=photo video"`
+	ignored    string
+}
+
+func TestParseQuery(t *testing.T) {
+	Convey("ParseQuery binds tagged and embedded fields", t, func() {
+		r := httptest.NewRequest("GET",
+			"/photos?taken_after=2026-03-01&camera=X100V,Q3&camera=GR&favorite=true&limit=20&sort=-taken_at", nil)
+		q, err := ParseQuery[photoQuery](r)
+		So(err, ShouldBeNil)
+		So(*q.TakenAfter, ShouldEqual, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+		So(q.Camera, ShouldResemble, []string{"X100V", "Q3", "GR"})
+		So(q.Favorite, ShouldBeTrue)
+		So(q.Limit, ShouldEqual, 20)
+		So(q.Sort, ShouldEqual, "-taken_at")
+		So(q.Kind, ShouldEqual, "photo")
+		So(q.ignored, ShouldBeEmpty)
+	})
+
+	Convey("Absent optional params stay zero", t, func() {
+		q, err := ParseQuery[photoQuery](httptest.NewRequest("GET", "/photos", nil))
+		So(err, ShouldBeNil)
+		So(q.TakenAfter, ShouldBeNil)
+		So(q.Camera, ShouldBeNil)
+	})
+
+	Convey("Conversion failures name the param", t, func() {
+		_, err := ParseQuery[photoQuery](httptest.NewRequest("GET", "/photos?min_rating=lots", nil))
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Code(), ShouldEqual, lumErrors.ErrorCodeValidation)
+		So(e.Field(), ShouldEqual, "min_rating")
+		So(e.Error(), ShouldEqual, "min_rating must be an integer")
+
+		_, err = ParseQuery[photoQuery](httptest.NewRequest("GET", "/photos?limit=1&limit=2", nil))
+		So(err.Error(), ShouldEqual, "limit must be given once")
+	})
+
+	Convey("Validation runs after binding, using query names", t, func() {
+		_, err := ParseQuery[photoQuery](httptest.NewRequest("GET", "/photos?limit=500", nil))
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Field(), ShouldEqual, "limit")
+
+		_, err = ParseQuery[photoQuery](httptest.NewRequest("GET", "/photos?kind=gif", nil))
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Field(), ShouldEqual, "kind")
+	})
+}
+
+type photoKind string
+
+type photoPath struct {
+	AlbumID uuid.UUID `path:"album_id"`
+	PhotoID uuid.UUID `path:"photo_id" validate:"required"`
+}
+
+func TestParsePath(t *testing.T) {
+	serve := func(target string) (photoPath, error) {
+		var got photoPath
+		var err error
+		r := chi.NewRouter()
+		r.Get("/albums/{album_id}/photos/{photo_id}", func(w http.ResponseWriter, req *http.Request) {
+			got, err = ParsePath[photoPath](req)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+		return got, err
+	}
+
+	Convey("ParsePath binds route params, converting UUIDs", t, func() {
+		a, p := uuid.New(), uuid.New()
+		got, err := serve("/albums/" + a.String() + "/photos/" + p.String())
+		So(err, ShouldBeNil)
+		So(got.AlbumID, ShouldEqual, a)
+		So(got.PhotoID, ShouldEqual, p)
+	})
+
+	Convey("A malformed UUID names the param", t, func() {
+		_, err := serve("/albums/nope/photos/" + uuid.NewString())
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Code(), ShouldEqual, lumErrors.ErrorCodeValidation)
+		So(e.Field(), ShouldEqual, "album_id")
+		So(e.Error(), ShouldEqual, "album_id must be a valid UUID")
+	})
+}
+
+type uploadForm struct {
+	Title string        `form:"title"  validate:"required,max=10"`
+	Kind  photoKind     `form:"kind"   default:"photo" validate:"oneof=photo video"`
+	Tags  []string      `form:"tags"`
+	Delay time.Duration `form:"delay"`
+}
+
+func TestParseForm(t *testing.T) {
+	Convey("ParseForm binds a URL-encoded body, ignoring the query", t, func() {
+		body := url.Values{"title": {"Beach"}, "tags": {"sea,sand"}, "delay": {"1m30s"}}.Encode()
+		r := httptest.NewRequest(http.MethodPost, "/photos?title=query", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		f, err := ParseForm[uploadForm](r)
+		So(err, ShouldBeNil)
+		So(f.Title, ShouldEqual, "Beach")
+		So(f.Kind, ShouldEqual, photoKind("photo"))
+		So(f.Tags, ShouldResemble, []string{"sea", "sand"})
+		So(f.Delay, ShouldEqual, 90*time.Second)
+	})
+
+	Convey("ParseForm binds multipart fields and validates with form names", t, func() {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		_ = mw.WriteField("title", "Beach")
+		_ = mw.WriteField("kind", "gif")
+		_ = mw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/photos", &buf)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+
+		_, err := ParseForm[uploadForm](r)
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Code(), ShouldEqual, lumErrors.ErrorCodeValidation)
+		So(e.Field(), ShouldEqual, "kind")
+	})
+
+	Convey("An oversized body is a 413", t, func() {
+		body := url.Values{"title": {strings.Repeat("x", 100)}}.Encode()
+		r := httptest.NewRequest(http.MethodPost, "/photos", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, 10)
+		_, err := ParseForm[uploadForm](r)
+		So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePayloadTooLarge), ShouldBeTrue)
+	})
+}
+
+type uploadHeaders struct {
+	Length int64    `header:"Upload-Length"  validate:"required,min=1"`
+	Meta   []string `header:"Upload-Metadata"`
+}
+
+func TestParseHeader(t *testing.T) {
+	Convey("ParseHeader binds headers by canonical name", t, func() {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("upload-length", "42")
+		r.Header.Add("Upload-Metadata", "a 1,b 2")
+		h, err := ParseHeader[uploadHeaders](r)
+		So(err, ShouldBeNil)
+		So(h.Length, ShouldEqual, 42)
+		So(h.Meta, ShouldResemble, []string{"a 1", "b 2"})
+
+		_, err = ParseHeader[uploadHeaders](httptest.NewRequest(http.MethodPost, "/", nil))
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(e.Field(), ShouldEqual, "Upload-Length")
+	})
+}
@@ -0,0 +1,287 @@
+package lumnet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lumium/lib/config"
+	commonErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/metrics"
+)
+
+// Rate limiting is a token bucket kept as GCRA (the generic cell rate algorithm): a bucket is
+// one timestamp, the theoretical arrival time (TAT) of the request after the last one allowed.
+// That makes a take a single compare-and-set, cheap in memory and one upsert in Postgres
+
+var rateLimited = metrics.NewCounterVec("http_rate_limited_total",
+	"Requests rejected with 429, by rate limit policy", "policy")
+
+// Rate is a token bucket: Limit requests per Period on average, in bursts of up to Burst
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int // bucket size; Limit when unset
+}
+
+// ParseRate parses "limit/period[/burst]", e.g. "10/1m" or "100/1h/20". The period is a Go
+// duration, or a bare unit (s, m, h) meaning one of it
+func ParseRate(s string) (Rate, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Rate{}, fmt.Errorf("rate %q: want limit/period[/burst]", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 1 {
+		return Rate{}, fmt.Errorf("rate %q: limit must be a positive integer", s)
+	}
+	unit := parts[1]
+	if unit == "s" || unit == "m" || unit == "h" {
+		unit = "1" + unit
+	}
+	period, err := time.ParseDuration(unit)
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: period must be a positive duration", s)
+	}
+	r := Rate{Limit: limit, Period: period}
+	if len(parts) == 3 {
+		if r.Burst, err = strconv.Atoi(parts[2]); err != nil || r.Burst < 1 {
+			return Rate{}, fmt.Errorf("rate %q: burst must be a positive integer", s)
+		}
+	}
+	return r, nil
+}
+
+// UnmarshalText parses a rate in ParseRate's form, so config.Load can fill Rate fields
+func (r *Rate) UnmarshalText(b []byte) error {
+	parsed, err := ParseRate(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// LoadRate reads a rate from the environment, falling back to def when unset or invalid
+func LoadRate(key, def string) Rate {
+	raw := config.MayString(key, def)
+	r, err := ParseRate(raw)
+	if err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Str("key", key).Str("default", def).Msg("Invalid rate; using the default")
+		r, _ = ParseRate(def)
+	}
+	return r
+}
+
+// String is the rate in ParseRate's form
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s/%d", r.Limit, r.Period, r.burst())
+}
+
+// interval is how long one token takes to refill
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// tolerance is the time a full bucket holds
+func (r Rate) tolerance() time.Duration {
+	return r.interval() * time.Duration(r.burst())
+}
+
+// RateDecision is a store's answer for one request
+type RateDecision struct {
+	Allowed    bool
+	Remaining  int           // requests left right now
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request would be allowed, when denied
+}
+
+// RateStore keeps the buckets. Take must be atomic per key, so replicas sharing a store share
+// the limit
+type RateStore interface {
+	Take(ctx context.Context, key string, r Rate) (RateDecision, error)
+}
+
+// gcra takes a token from the bucket whose TAT is tat. It returns the bucket's new TAT, which is
+// unchanged when the request is denied
+func gcra(now, tat time.Time, r Rate) (time.Time, RateDecision) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(r.interval())
+	if next.Add(-r.tolerance()).After(now) {
+		return tat, decide(now, tat, r, false)
+	}
+	return next, decide(now, next, r, true)
+}
+
+// decide describes the bucket with TAT tat after a take that was allowed or not
+func decide(now, tat time.Time, r Rate, allowed bool) RateDecision {
+	d := RateDecision{Allowed: allowed, Reset: max(tat.Sub(now), 0)}
+	if allowed {
+		d.Remaining = int(now.Sub(tat.Add(-r.tolerance())) / r.interval())
+	} else {
+		d.RetryAfter = max(tat.Add(r.interval()-r.tolerance()).Sub(now), 0)
+	}
+	return d
+}
+
+// MemoryRateStore keeps buckets in process; each replica limits on its own
+type MemoryRateStore struct {
+	mu    sync.Mutex
+	tats  map[string]time.Time
+	takes int
+	now   func() time.Time
+}
+
+// NewMemoryRateStore returns an empty in-process store
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{tats: map[string]time.Time{}, now: time.Now}
+}
+
+// Take implements RateStore
+func (m *MemoryRateStore) Take(_ context.Context, key string, r Rate) (RateDecision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	tat, d := gcra(now, m.tats[key], r)
+	if d.Allowed {
+		m.tats[key] = tat
+	}
+
+	// a bucket whose TAT has passed is full, the same as no bucket, so it can go
+	if m.takes++; m.takes%1024 == 0 {
+		for k, t := range m.tats {
+			if t.Before(now) {
+				delete(m.tats, k)
+			}
+		}
+	}
+	return d, nil
+}
+
+var (
+	defaultRateStoreOnce sync.Once
+	defaultRateStore     RateStore
+)
+
+// DefaultRateStore is the process-wide memory store used by policies without a Store
+func DefaultRateStore() RateStore {
+	defaultRateStoreOnce.Do(func() { defaultRateStore = NewMemoryRateStore() })
+	return defaultRateStore
+}
+
+// RateKeyFunc picks the bucket a request counts against; "" means it doesn't apply, e.g. a
+// user key on an anonymous request
+type RateKeyFunc func(r *http.Request) string
+
+// KeyByIP keys on the client address. Behind a proxy, mount RealIP first so
+// RemoteAddr is the client's and not the proxy's
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByHeader keys on a credential header such as an API key. The value is hashed so the store
+// never holds the secret
+func KeyByHeader(name string) RateKeyFunc {
+	return func(r *http.Request) string {
+		v := strings.TrimSpace(r.Header.Get(name))
+		if v == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(v))
+		return "key:" + hex.EncodeToString(sum[:12])
+	}
+}
+
+// FirstKey uses the first key that applies, e.g. FirstKey(byUser, KeyByIP)
+func FirstKey(fns ...RateKeyFunc) RateKeyFunc {
+	return func(r *http.Request) string {
+		for _, fn := range fns {
+			if k := fn(r); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
+
+// RatePolicy limits the routes it is mounted on
+type RatePolicy struct {
+	Name  string // bucket namespace and RateLimit-Policy name, e.g. "login"
+	Rate  Rate
+	Key   RateKeyFunc // KeyByIP when nil, or when it doesn't apply
+	Store RateStore   // DefaultRateStore when nil
+}
+
+// RateLimit enforces p, answering 429 with Retry-After once a bucket is empty. Every response
+// carries RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// (draft-ietf-httpapi-ratelimit-headers). When the store fails the request is let through:
+// an outage of the limiter must not become an outage of the API
+func RateLimit(p RatePolicy) func(http.Handler) http.Handler {
+	if p.Key == nil {
+		p.Key = KeyByIP
+	}
+	if p.Store == nil {
+		p.Store = DefaultRateStore()
+	}
+	policy := fmt.Sprintf("%d;w=%d;burst=%d;policy=%q",
+		p.Rate.Limit, int(p.Rate.Period.Seconds()), p.Rate.burst(), p.Name)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := p.Key(r)
+			if key == "" {
+				key = KeyByIP(r)
+			}
+			d, err := p.Store.Take(r.Context(), p.Name+":"+key, p.Rate)
+			if err != nil {
+				l := logger.Ctx(r.Context())
+				l.Warn().Err(err).Str("policy", p.Name).Msg("Rate limit store failed; allowing request")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(p.Rate.burst()))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+			h.Set("RateLimit-Policy", policy)
+			if !d.Allowed {
+				rateLimited.WithLabelValues(p.Name).Inc()
+				retry := seconds(d.RetryAfter)
+				h.Set("Retry-After", strconv.Itoa(retry))
+				RenderError(w, r, commonErrors.RateLimitedf("too many requests; retry in %ds", retry))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, so a client waiting that long is never early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,84 @@
+package lumnet
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PGRateStore keeps buckets in the rate_limits table, so every replica shares them. The clock
+// is Postgres's, so replicas with skewed clocks still agree
+type PGRateStore struct {
+	db    store.Queryer
+	takes atomic.Uint64
+}
+
+// NewPGRateStore returns a store over db
+func NewPGRateStore(db store.Queryer) *PGRateStore {
+	return &PGRateStore{db: db}
+}
+
+// RateStoreFromEnv returns the store named by RATE_LIMIT_STORE: "memory" (the default) or
+// "postgres", which shares limits across replicas at the cost of a write per limited request
+func RateStoreFromEnv(db store.Queryer) RateStore {
+	if config.MayString("RATE_LIMIT_STORE", "memory") == "postgres" && db != nil {
+		return NewPGRateStore(db)
+	}
+	return DefaultRateStore()
+}
+
+// rateTakeSQL takes a token in one statement: a new bucket is inserted full minus one, and an
+// existing one is advanced only when the request fits, so a denied request returns no row.
+// $2 is the refill interval and $3 the bucket's tolerance, in seconds
+const rateTakeSQL = `
+INSERT INTO rate_limits AS r (key, tat)
+VALUES ($1, statement_timestamp() + make_interval(secs => $2))
+ON CONFLICT (key) DO UPDATE
+  SET tat = GREATEST(r.tat, statement_timestamp()) + make_interval(secs => $2)
+  WHERE GREATEST(r.tat, statement_timestamp()) + make_interval(secs => $2) - make_interval(secs => $3)
+    <= statement_timestamp()
+RETURNING r.tat, statement_timestamp()`
+
+// Take implements RateStore
+func (s *PGRateStore) Take(ctx context.Context, key string, r Rate) (RateDecision, error) {
+	if s.takes.Add(1)%1024 == 0 {
+		go s.prune()
+	}
+
+	var tat, now time.Time
+	err := s.db.QueryRow(ctx, rateTakeSQL, key, r.interval().Seconds(), r.tolerance().Seconds()).Scan(&tat, &now)
+	if err == nil {
+		return decide(now, tat, r, true), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return RateDecision{}, err
+	}
+
+	err = s.db.QueryRow(ctx, `SELECT tat, statement_timestamp() FROM rate_limits WHERE key = $1`, key).
+		Scan(&tat, &now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// pruned between the statements, so the bucket is full again; count this one as the first take
+		return s.Take(ctx, key, r)
+	}
+	if err != nil {
+		return RateDecision{}, err
+	}
+	return decide(now, tat, r, false), nil
+}
+
+// prune deletes full buckets, which are the same as no bucket
+func (s *PGRateStore) prune() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.db.Exec(ctx, `DELETE FROM rate_limits WHERE tat < statement_timestamp()`); err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Msg("rate_limits: prune")
+	}
+}
@@ -0,0 +1,206 @@
+package lumnet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRate(t *testing.T) {
+	Convey("ParseRate reads limit/period[/burst]", t, func() {
+		r, err := ParseRate("10/1m")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, Rate{Limit: 10, Period: time.Minute})
+
+		r, err = ParseRate("100/h/20")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, Rate{Limit: 100, Period: time.Hour, Burst: 20})
+
+		for _, bad := range []string{"", "10", "0/1m", "x/1m", "10/soon", "10/1m/0", "1/2/3/4"} {
+			_, err := ParseRate(bad)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("A Rate unmarshals from text, as config.Load fills it", t, func() {
+		var r Rate
+		So(r.UnmarshalText([]byte("5/15m")), ShouldBeNil)
+		So(r, ShouldResemble, Rate{Limit: 5, Period: 15 * time.Minute})
+		So(r.UnmarshalText([]byte("often")), ShouldNotBeNil)
+	})
+}
+
+func TestMemoryRateStore(t *testing.T) {
+	Convey("Given a bucket of 3 refilling one token per second", t, func() {
+		now := time.Unix(1_700_000_000, 0)
+		m := NewMemoryRateStore()
+		m.now = func() time.Time { return now }
+		rate := Rate{Limit: 3, Period: 3 * time.Second}
+		take := func() RateDecision {
+			d, err := m.Take(context.Background(), "k", rate)
+			So(err, ShouldBeNil)
+			return d
+		}
+
+		Convey("a burst drains it and the next request waits for one refill", func() {
+			So(take().Remaining, ShouldEqual, 2)
+			So(take().Remaining, ShouldEqual, 1)
+			d := take()
+			So(d.Allowed, ShouldBeTrue)
+			So(d.Remaining, ShouldEqual, 0)
+			So(d.Reset, ShouldEqual, 3*time.Second)
+
+			d = take()
+			So(d.Allowed, ShouldBeFalse)
+			So(d.RetryAfter, ShouldEqual, time.Second)
+
+			now = now.Add(time.Second)
+			So(take().Allowed, ShouldBeTrue)
+			So(take().Allowed, ShouldBeFalse)
+		})
+
+		Convey("a denied request doesn't eat into the bucket", func() {
+			for range 3 {
+				take()
+			}
+			for range 10 {
+				So(take().Allowed, ShouldBeFalse)
+			}
+			now = now.Add(3 * time.Second)
+			So(take().Remaining, ShouldEqual, 2)
+		})
+
+		Convey("keys have their own buckets", func() {
+			for range 3 {
+				take()
+			}
+			d, _ := m.Take(context.Background(), "other", rate)
+			So(d.Allowed, ShouldBeTrue)
+		})
+	})
+}
+
+type failingRateStore struct{}
+
+func (failingRateStore) Take(context.Context, string, Rate) (RateDecision, error) {
+	return RateDecision{}, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	serve := func(h http.Handler, remote, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remote
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { NoContent(w, r) })
+
+	Convey("RateLimit answers 429 with Retry-After once the client's bucket is empty", t, func() {
+		h := RateLimit(RatePolicy{Name: "login", Rate: Rate{Limit: 2, Period: time.Minute},
+			Store: NewMemoryRateStore()})(ok)
+
+		rec := serve(h, "10.0.0.1:1234", "")
+		So(rec.Code, ShouldEqual, http.StatusNoContent)
+		So(rec.Header().Get("RateLimit-Limit"), ShouldEqual, "2")
+		So(rec.Header().Get("RateLimit-Remaining"), ShouldEqual, "1")
+		So(rec.Header().Get("RateLimit-Policy"), ShouldEqual, `2;w=60;burst=2;policy="login"`)
+
+		So(serve(h, "10.0.0.1:5678", "").Code, ShouldEqual, http.StatusNoContent)
+		rec = serve(h, "10.0.0.1:1234", "")
+		So(rec.Code, ShouldEqual, http.StatusTooManyRequests)
+		So(rec.Header().Get("Retry-After"), ShouldEqual, "30")
+		So(rec.Body.String(), ShouldContainSubstring, "too many requests")
+
+		So(serve(h, "10.0.0.2:1234", "").Code, ShouldEqual, http.StatusNoContent)
+	})
+
+	Convey("Keys fall back to the client IP when they don't apply", t, func() {
+		h := RateLimit(RatePolicy{Name: "api", Rate: Rate{Limit: 1, Period: time.Minute},
+			Key: FirstKey(KeyByHeader("X-Api-Key")), Store: NewMemoryRateStore()})(ok)
+
+		So(serve(h, "10.0.0.1:1", "secret-a").Code, ShouldEqual, http.StatusNoContent)
+		So(serve(h, "10.0.0.1:1", "secret-b").Code, ShouldEqual, http.StatusNoContent)
+		So(serve(h, "10.0.0.1:1", "secret-a").Code, ShouldEqual, http.StatusTooManyRequests)
+		So(serve(h, "10.0.0.1:1", "").Code, ShouldEqual, http.StatusNoContent)
+		So(serve(h, "10.0.0.1:1", "").Code, ShouldEqual, http.StatusTooManyRequests)
+	})
+
+	Convey("A failing store lets requests through", t, func() {
+		h := RateLimit(RatePolicy{Name: "x", Rate: Rate{Limit: 1, Period: time.Minute},
+			Store: failingRateStore{}})(ok)
+		So(serve(h, "10.0.0.1:1", "").Code, ShouldEqual, http.StatusNoContent)
+		So(serve(h, "10.0.0.1:1", "").Code, ShouldEqual, http.StatusNoContent)
+	})
+}
+
+// rateRow scans a canned (tat, now) pair, or fails with err
+type rateRow struct {
+	tat, now time.Time
+	err      error
+}
+
+func (r rateRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*time.Time) = r.tat
+	*dest[1].(*time.Time) = r.now
+	return nil
+}
+
+// rateQueryer answers QueryRow from a queue of rows
+type rateQueryer struct {
+	rows []rateRow
+	sql  []string
+}
+
+func (q *rateQueryer) Query(context.Context, string, ...any) (pgx.Rows, error) { return nil, nil }
+func (q *rateQueryer) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+func (q *rateQueryer) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	q.sql = append(q.sql, sql)
+	r := q.rows[0]
+	q.rows = q.rows[1:]
+	return r
+}
+
+func TestPGRateStore(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rate := Rate{Limit: 3, Period: 3 * time.Second}
+
+	Convey("A returned row is an allowed take", t, func() {
+		q := &rateQueryer{rows: []rateRow{{tat: now.Add(2 * time.Second), now: now}}}
+		d, err := NewPGRateStore(q).Take(context.Background(), "k", rate)
+		So(err, ShouldBeNil)
+		So(d.Allowed, ShouldBeTrue)
+		So(d.Remaining, ShouldEqual, 1)
+		So(d.Reset, ShouldEqual, 2*time.Second)
+	})
+
+	Convey("No row is a denial, timed from the stored bucket", t, func() {
+		q := &rateQueryer{rows: []rateRow{{err: pgx.ErrNoRows}, {tat: now.Add(3 * time.Second), now: now}}}
+		d, err := NewPGRateStore(q).Take(context.Background(), "k", rate)
+		So(err, ShouldBeNil)
+		So(d.Allowed, ShouldBeFalse)
+		So(d.RetryAfter, ShouldEqual, time.Second)
+		So(q.sql[1], ShouldContainSubstring, "FROM rate_limits WHERE key = $1")
+	})
+
+	Convey("Database errors are returned", t, func() {
+		q := &rateQueryer{rows: []rateRow{{err: errors.New("conn reset")}}}
+		_, err := NewPGRateStore(q).Take(context.Background(), "k", rate)
+		So(err, ShouldNotBeNil)
+	})
+}
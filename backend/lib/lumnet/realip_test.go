@@ -0,0 +1,60 @@
+package lumnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRealIP(t *testing.T) {
+	Convey("ParseTrustedProxies takes addresses and CIDRs", t, func() {
+		ps, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.7 ", "fd00::/8"})
+		So(err, ShouldBeNil)
+		So(ps, ShouldHaveLength, 3)
+		So(ps[1].String(), ShouldEqual, "192.168.1.7/32")
+
+		_, err = ParseTrustedProxies([]string{"proxy.internal"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given RealIP trusting the load balancer's network", t, func() {
+		trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+		So(err, ShouldBeNil)
+		var seen string
+		h := RealIP(trusted)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			seen = r.RemoteAddr
+		}))
+		call := func(remote string, headers map[string]string) string {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = remote
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			return seen
+		}
+
+		Convey("a proxied request gets the client's address", func() {
+			So(call("10.1.2.3:5000", map[string]string{"X-Forwarded-For": "203.0.113.9"}),
+				ShouldEqual, "203.0.113.9:0")
+			So(call("10.1.2.3:5000", map[string]string{"X-Real-IP": "2001:db8::1"}),
+				ShouldEqual, "[2001:db8::1]:0")
+		})
+
+		Convey("addresses a client prepends itself are skipped", func() {
+			So(call("10.1.2.3:5000", map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.9, 10.4.4.4"}),
+				ShouldEqual, "203.0.113.9:0")
+		})
+
+		Convey("a direct request can't claim another address", func() {
+			So(call("198.51.100.7:4000", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-IP": "1.1.1.1"}),
+				ShouldEqual, "198.51.100.7:4000")
+		})
+
+		Convey("garbage in the header leaves the proxy's address", func() {
+			So(call("10.1.2.3:5000", map[string]string{"X-Forwarded-For": "not-an-ip"}), ShouldEqual, "10.1.2.3:5000")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package lumnet
 
 import (
 	commonErrors "lumium/lib/errors"
+	"lumium/lib/logger"
 
 	"net/http"
 
@@ -12,14 +13,41 @@ import (
 // These conveniece methods assume we're dealing with JSON, and we want to keep our handlers as
 // lean as possible. They could be improved by extending them for different response types
 
-// RenderError converts any error to a normalized JSON error and writes the proper status
+// RenderError converts any error to a normalized JSON error and writes the proper status. Clients
+// accepting application/problem+json get an RFC 9457 problem instead, see WantsProblem. Clients
+// only see an error's safe message (see commonErrors.SafeMessage); server errors are logged whole
 func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	logServerError(r, err)
+	w.Header().Add("Vary", "Accept")
+	if WantsProblem(r) {
+		WriteProblem(w, ProblemFor(r, err))
+		return
+	}
+
+	var perr *Problem
+	if As(err, &perr) {
+		p := ProblemFor(r, perr)
+		if p.Legacy != nil {
+			JSONStatus(w, r, p.Legacy, p.Status)
+			return
+		}
+		render.Status(r, p.Status)
+		render.JSON(w, r, &ErrResponse{
+			HTTPStatusCode: p.Status,
+			StatusText:     http.StatusText(p.Status),
+			AppCode:        int64(commonErrors.ErrorCodeUnknown),
+			ErrorText:      p.Error(),
+			RequestID:      p.Instance,
+		})
+		return
+	}
+
 	status := http.StatusInternalServerError
 	resp := ErrResponse{
 		HTTPStatusCode: status,
 		StatusText:     http.StatusText(status),
 		AppCode:        int64(commonErrors.ErrorCodeUnknown),
-		ErrorText:      err.Error(),
+		ErrorText:      commonErrors.SafeMessage(err),
 		RequestID:      middleware.GetReqID(r.Context()),
 	}
 
@@ -29,7 +57,7 @@ func RenderError(w http.ResponseWriter, r *http.Request, err error) {
 		resp.HTTPStatusCode = status
 		resp.StatusText = http.StatusText(status)
 		resp.AppCode = int64(ierr.Code())
-		resp.ErrorText = ierr.Error()
+		resp.ErrorText = ierr.Message()
 		if ierr.Code() == commonErrors.ErrorCodeValidation {
 			resp.ValidationErrorField = ierr.Field()
 		}
@@ -40,6 +68,25 @@ func RenderError(w http.ResponseWriter, r *http.Request, err error) {
 	render.JSON(w, r, &resp)
 }
 
+// logServerError logs the full text of an error answered with a 5xx, which clients don't see
+func logServerError(r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	var ierr *commonErrors.Error
+	var perr *Problem
+	switch {
+	case As(err, &perr):
+		status = perr.Status
+	case As(err, &ierr):
+		status = commonErrors.HTTPStatusCode(ierr.Code())
+	}
+	if status < http.StatusInternalServerError {
+		return
+	}
+	// the request logger carries the request id, method and path
+	l := logger.Ctx(r.Context())
+	l.Error().Err(err).Int("status", status).Msg("request failed")
+}
+
 // OK writes 200 with any JSON marshaled payload
 func OK(w http.ResponseWriter, r *http.Request, v any) {
 	render.Status(r, http.StatusOK)
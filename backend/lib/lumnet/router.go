@@ -2,12 +2,15 @@ package lumnet
 
 import (
 	lumErrors "lumium/lib/errors"
+	"lumium/lib/health"
 	"lumium/lib/logger"
+	"lumium/lib/metrics"
 
 	"context"
 	"errors"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"strings"
@@ -23,6 +26,9 @@ import (
 // requestIDHeader is our header
 const requestIDHeader = "X-Request-Id"
 
+// ShutdownTimeout is how long a stopping server waits for in-flight requests
+var ShutdownTimeout = 10 * time.Second
+
 // ErrResponse is the JSON error envelope used by RenderError
 type ErrResponse struct {
 	HTTPStatusCode       int             `json:"status_code"`
@@ -40,7 +46,15 @@ type RouterOptions struct {
 	WithRequestID bool
 	WithRecovery  bool
 	WithCORS      bool
+	WithTracing   bool // OpenTelemetry server spans; see Tracing
+	WithMetrics   bool // RED metrics per route, and GET /metrics serving the metrics registry
 	CORS          *cors.Options
+
+	// TrustedProxies, when set, mounts RealIP so requests through them carry the client's address
+	TrustedProxies []netip.Prefix
+
+	// Health, when set, mounts GET /health, /ready and /whoami backed by the registry
+	Health *health.Registry
 }
 
 // NewRouter builds a chi router with defaults and JSON content type
@@ -48,6 +62,10 @@ func NewRouter(opts RouterOptions) *chi.Mux {
 	r := chi.NewRouter()
 	InitValidator()
 
+	// first, so logs, rate limits and handlers all see the client's address
+	if len(opts.TrustedProxies) > 0 {
+		r.Use(RealIP(opts.TrustedProxies))
+	}
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
 	if opts.WithCORS {
@@ -58,16 +76,32 @@ func NewRouter(opts RouterOptions) *chi.Mux {
 		r.Use(cors.Handler(*co))
 	}
 
-	if opts.WithLogger {
-		r.Use(middleware.Logger)
-	}
 	if opts.WithRequestID {
 		r.Use(middleware.RequestID)
 		r.Use(sendRequestID)
 	}
+	if opts.WithLogger {
+		r.Use(RequestLogger) // after RequestID, so its lines carry the id
+	}
+	if opts.WithTracing {
+		r.Use(Tracing)
+	}
+	if opts.WithMetrics {
+		r.Use(Metrics)
+	}
 	if opts.WithRecovery {
 		r.Use(Recovery)
 	}
+
+	// routes last: chi wants every middleware defined first
+	if opts.WithMetrics {
+		r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	}
+	if opts.Health != nil {
+		r.Get("/health", opts.Health.LiveHandler())
+		r.Get("/ready", opts.Health.ReadyHandler())
+		r.Get("/whoami", opts.Health.WhoAmIHandler())
+	}
 	return r
 }
 
@@ -88,47 +122,71 @@ func defaultCORS() *cors.Options {
 	}
 
 	return &cors.Options{
-		AllowedOrigins:   origins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link", "X-Request-Id"},
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Traceparent", "Tracestate",
+			"Idempotency-Key", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum", "Last-Event-ID"},
+		ExposedHeaders: []string{"Link", "X-Request-Id", "Retry-After", "ETag", "Last-Modified", "Location",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Idempotent-Replayed",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+			"Upload-Offset", "Upload-Length", "Upload-Metadata", "Photo-Id"},
 		AllowCredentials: true, // flip to false if you don’t need cookies/auth
 		MaxAge:           300,  // seconds
 	}
 }
 
+// SignalContext returns a context canceled on SIGINT or SIGTERM. It is every service's shutdown
+// trigger, so the API and the workers stop on the same signals
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, syscall.SIGINT, syscall.SIGTERM)
+}
+
 // Serve runs the HTTP server on the given listener with graceful shutdown
 // The graceful shutdown is important when clustering
 func Serve(listener net.Listener, mux http.Handler, serviceName string) {
+	ctx, stop := SignalContext(context.Background())
+	defer stop()
+	_ = ServeContext(ctx, listener, mux, serviceName)
+}
+
+// ServeContext serves until ctx ends, then shuts down gracefully, giving in-flight requests
+// ShutdownTimeout to finish. It returns the server's error when the listener fails first
+func ServeContext(ctx context.Context, listener net.Listener, mux http.Handler, serviceName string) error {
 	l := logger.Get()
 
+	draining := make(chan struct{})
 	srv := &http.Server{
 		Handler:           mux,
 		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), drainingKey{}, draining)
+		},
 	}
+	srv.RegisterOnShutdown(func() { close(draining) })
 
 	l.Info().Str("addr", listener.Addr().String()).Msgf("Starting %s service", serviceName)
 
 	errCh := make(chan error, 1)
 	go func() { errCh <- srv.Serve(listener) }()
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
+	var serveErr error
 	select {
-	case sig := <-sigCh:
-		l.Info().Str("signal", sig.String()).Msg("Shutdown requested")
+	case <-ctx.Done():
+		l.Info().Str("cause", context.Cause(ctx).Error()).Msg("Shutdown requested")
 	case err := <-errCh:
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			l.Error().Err(err).Msg("HTTP server error")
+			serveErr = err
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	sctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(sctx); err != nil {
 		l.Error().Err(err).Msg("Graceful shutdown timed out; forcing close")
 		_ = srv.Close()
 	}
 	l.Info().Msg("Server offline")
+	return serveErr
 }
@@ -1,6 +1,7 @@
 package lumnet
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"lumium/lib/health"
+
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -69,6 +72,24 @@ func TestNewRouter_RequestIDDisabled(t *testing.T) {
 	})
 }
 
+// TestNewRouter_Health tests that a health registry mounts the probe endpoints
+func TestNewRouter_Health(t *testing.T) {
+	Convey("NewRouter mounts /health, /ready and /whoami when given a registry", t, func() {
+		reg := health.NewRegistry("svc")
+		reg.Register(health.Check{Name: "postgres", Fn: func(context.Context) error { return errors.New("down") }})
+		r := NewRouter(RouterOptions{Health: reg})
+
+		code := func(path string) int {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			return rec.Code
+		}
+		So(code("/health"), ShouldEqual, http.StatusOK)
+		So(code("/ready"), ShouldEqual, http.StatusServiceUnavailable)
+		So(code("/whoami"), ShouldEqual, http.StatusOK)
+	})
+}
+
 // testListener forces http Serve to exit immediately by returning an Accept error
 type testListener struct{}
 
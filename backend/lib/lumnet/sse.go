@@ -0,0 +1,124 @@
+package lumnet
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment, well inside the idle
+// timeouts of common proxies and load balancers
+const DefaultHeartbeat = 15 * time.Second
+
+// SSEEvent is one Server-Sent Events message
+type SSEEvent struct {
+	ID    string        // the browser echoes the last one in Last-Event-ID when it reconnects
+	Event string        // the event type; "" is "message"
+	Data  []byte        // sent as one data: line per line
+	Retry time.Duration // how long the client waits before reconnecting; 0 leaves its default
+}
+
+// SSE writes a text/event-stream response
+type SSE struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewSSE starts an event stream on w: it sends the headers, lifts the server's write deadline,
+// which would cut a long-lived stream short, and flushes. It fails when w can't be flushed, by
+// which time the status has been sent
+func NewSSE(w http.ResponseWriter) (*SSE, error) {
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", CacheNoStore)
+	h.Set("X-Accel-Buffering", "no") // nginx would otherwise hold events back
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	return &SSE{w: w, rc: rc}, nil
+}
+
+// Send writes ev and flushes it to the client
+func (s *SSE) Send(ev SSEEvent) error {
+	var b bytes.Buffer
+	if ev.ID != "" {
+		b.WriteString("id: " + sseField(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + sseField(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	if ev.Data != nil {
+		data := strings.ReplaceAll(string(ev.Data), "\r\n", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			b.WriteString("data: " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+	return s.write(b.Bytes())
+}
+
+// Comment writes a comment line, which clients ignore; it keeps an idle connection open
+func (s *SSE) Comment(text string) error {
+	return s.write([]byte(": " + sseField(text) + "\n\n"))
+}
+
+// Stream sends events until the channel is closed, the client goes away or the server shuts
+// down, with a comment every heartbeat (DefaultHeartbeat when 0) while nothing else is sent.
+// It returns nil when the stream ended on the server's side, so the client reconnects
+func (s *SSE) Stream(ctx context.Context, events <-chan SSEEvent, heartbeat time.Duration) error {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	tick := time.NewTicker(heartbeat)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-Draining(ctx):
+			return nil
+		case <-tick.C:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(ev); err != nil {
+				return err
+			}
+			tick.Reset(heartbeat)
+		}
+	}
+}
+
+func (s *SSE) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// sseField keeps a value on one line, as a newline would start another field
+func sseField(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+type drainingKey struct{}
+
+// Draining returns a channel closed once the server serving ctx starts shutting down, or nil
+// outside ServeContext. Long-lived responses end on it, as Shutdown waits for every request
+func Draining(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(drainingKey{}).(chan struct{})
+	return ch
+}
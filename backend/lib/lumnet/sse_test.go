@@ -0,0 +1,90 @@
+package lumnet
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSSE(t *testing.T) {
+	Convey("Events are framed as text/event-stream", t, func() {
+		rec := httptest.NewRecorder()
+		s, err := NewSSE(rec)
+		So(err, ShouldBeNil)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Header().Get("Content-Type"), ShouldEqual, "text/event-stream")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, CacheNoStore)
+		So(rec.Flushed, ShouldBeTrue)
+
+		So(s.Send(SSEEvent{ID: "7", Event: "photo.ingested", Data: []byte("{\"a\":1}\r\n{\"b\":2}")}), ShouldBeNil)
+		So(s.Send(SSEEvent{Retry: 3 * time.Second}), ShouldBeNil)
+		So(s.Comment("hi"), ShouldBeNil)
+		So(rec.Body.String(), ShouldEqual,
+			"id: 7\nevent: photo.ingested\ndata: {\"a\":1}\ndata: {\"b\":2}\n\nretry: 3000\n\n: hi\n\n")
+	})
+
+	Convey("Newlines can't smuggle fields into ids, event types or comments", t, func() {
+		rec := httptest.NewRecorder()
+		s, _ := NewSSE(rec)
+		So(s.Send(SSEEvent{ID: "1\nevent: evil", Event: "x\r\ny", Data: []byte{}}), ShouldBeNil)
+		So(s.Comment("a\nb"), ShouldBeNil)
+		So(rec.Body.String(), ShouldEqual, "id: 1event: evil\nevent: xy\ndata: \n\n: ab\n\n")
+	})
+
+	Convey("Stream sends events and heartbeats until the channel closes", t, func() {
+		rec := httptest.NewRecorder()
+		s, _ := NewSSE(rec)
+		events := make(chan SSEEvent, 1)
+		events <- SSEEvent{ID: "1", Data: []byte("x")}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(events)
+		}()
+		So(s.Stream(context.Background(), events, 10*time.Millisecond), ShouldBeNil)
+		So(rec.Body.String(), ShouldStartWith, "id: 1\ndata: x\n\n")
+		So(rec.Body.String(), ShouldContainSubstring, ": heartbeat\n\n")
+	})
+
+	Convey("Stream ends when the client goes away", t, func() {
+		s, _ := NewSSE(httptest.NewRecorder())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		So(s.Stream(ctx, nil, 0), ShouldEqual, context.Canceled)
+	})
+
+	Convey("Streams end when the server shuts down, so it doesn't wait for them", t, func() {
+		started := make(chan struct{})
+		mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := NewSSE(w)
+			if err != nil {
+				return
+			}
+			close(started)
+			_ = s.Stream(r.Context(), nil, time.Hour)
+		})
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		ctx, stop := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- ServeContext(ctx, ln, mux, "sse-test") }()
+
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		So(err, ShouldBeNil)
+		defer func() { _ = resp.Body.Close() }()
+		<-started
+
+		begun := time.Now()
+		stop()
+		So(<-done, ShouldBeNil)
+		So(time.Since(begun), ShouldBeLessThan, ShutdownTimeout)
+		rest, _ := bufio.NewReader(resp.Body).ReadString(0)
+		So(strings.TrimSpace(rest), ShouldBeEmpty)
+	})
+}
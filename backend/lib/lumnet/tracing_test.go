@@ -0,0 +1,59 @@
+package lumnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() { otel.SetTracerProvider(prevTP); otel.SetTextMapPropagator(prevProp) }()
+
+	r := NewRouter(RouterOptions{WithRequestID: true, WithTracing: true, WithRecovery: true})
+	r.Get("/albums/{id}", func(w http.ResponseWriter, r *http.Request) { NoContent(w, r) })
+	r.Get("/boom", func(http.ResponseWriter, *http.Request) { panic("boom") })
+
+	attr := func(s sdktrace.ReadOnlySpan, k attribute.Key) attribute.Value {
+		for _, kv := range s.Attributes() {
+			if kv.Key == k {
+				return kv.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	Convey("Tracing names the span after the route and continues an incoming trace", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/albums/42", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := sr.Ended()
+		So(spans, ShouldNotBeEmpty)
+		s := spans[len(spans)-1]
+		So(s.Name(), ShouldEqual, "GET /albums/{id}")
+		So(s.SpanContext().TraceID().String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(s.Parent().SpanID().String(), ShouldEqual, "00f067aa0ba902b7")
+		So(attr(s, "http.response.status_code").AsInt64(), ShouldEqual, http.StatusNoContent)
+		So(attr(s, "http.request.id").AsString(), ShouldNotBeBlank)
+	})
+
+	Convey("A 5xx marks the span as an error", t, func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+		spans := sr.Ended()
+		s := spans[len(spans)-1]
+		So(s.Name(), ShouldEqual, "GET /boom")
+		So(s.Status().Code, ShouldEqual, codes.Error)
+	})
+}
@@ -59,9 +59,14 @@ func InitValidator() *ValidatorSvc {
 
 		v := validator.New(validator.WithRequiredStructEnabled())
 
-		// prefer JSON tag names in messages
+		// prefer JSON tag names in messages, then query, path, form and header names
 		v.RegisterTagNameFunc(func(fld reflect.StructField) string {
 			tag := fld.Tag.Get("json")
+			for _, k := range []string{"query", "path", "form", "header"} {
+				if tag == "" {
+					tag = fld.Tag.Get(k)
+				}
+			}
 			if tag == "-" || tag == "" {
 				return fld.Name
 			}
@@ -162,8 +167,7 @@ func ParseJSON[T any](r *http.Request, opts ...JSONOptions) (T, error) {
 			lp.Error().Err(inv).Msg("validator internal error")
 			return zero, commonErrors.JSONErrf("validation error")
 		}
-		field, msg := ValidationFieldAndMessage(err)
-		return zero, commonErrors.NewValidationError(commonErrors.ErrorCodeValidation, msg, field)
+		return zero, ValidationError(err)
 	}
 
 	return dst, nil
@@ -207,6 +211,21 @@ func ValidationFieldAndMessage(err error) (field, message string) {
 	return "", err.Error()
 }
 
+// ValidationError turns the validator's errors into one validation error listing every invalid
+// field, with translated messages
+func ValidationError(err error) error {
+	verrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		field, msg := ValidationFieldAndMessage(err)
+		return commonErrors.NewValidationError(commonErrors.ErrorCodeValidation, msg, field)
+	}
+	fields := make([]commonErrors.FieldError, len(verrs))
+	for i, fe := range verrs {
+		fields[i] = commonErrors.FieldError{Field: fe.Field(), Message: fe.Translate(GetValidator().Translator)}
+	}
+	return commonErrors.NewValidationErrors(fields)
+}
+
 // GetRequestID helps with convenience to get request id safely
 func GetRequestID(r *http.Request) string {
 	return middleware.GetReqID(r.Context())
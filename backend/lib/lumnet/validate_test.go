@@ -91,6 +91,17 @@ func TestParseJSON_ValidationError(t *testing.T) {
 		So(As(err, &e), ShouldBeTrue)
 		So(e.Field(), ShouldNotBeBlank)
 	})
+
+	Convey("ParseJSON reports every invalid field, not just the first", t, func() {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"name":"r","age":0}`))
+
+		_, err := ParseJSON[testIn](req)
+		var e *lumErrors.Error
+		So(As(err, &e), ShouldBeTrue)
+		So(len(e.Fields()), ShouldEqual, 2)
+		So(e.Field(), ShouldEqual, e.Fields()[0].Field)
+		So(e.Fields()[1].Message, ShouldNotBeBlank)
+	})
 }
 
 // TestParseJSON_MaxBytes tests POST max bytes
@@ -0,0 +1,75 @@
+// Package metrics holds the process-wide Prometheus registry. Libraries register their standard
+// instrumentation here (HTTP in lumnet, pools and queries in store), and services add their own:
+//
+//	var processed = metrics.NewCounterVec("exifd_photos_processed_total",
+//		"Photos whose EXIF was extracted, by outcome", "outcome")
+//	...
+//	processed.WithLabelValues("ok").Inc()
+//
+// Everything is exposed by Handler, which lumnet mounts at /metrics
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric created through this package
+const Namespace = "lumium"
+
+var (
+	once sync.Once
+	reg  *prometheus.Registry
+)
+
+// Registry returns the process-wide registry, with the Go runtime and process collectors
+func Registry() *prometheus.Registry {
+	once.Do(func() {
+		reg = prometheus.NewRegistry()
+		reg.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	})
+	return reg
+}
+
+// MustRegister adds collectors to the registry, panicking on a duplicate, which is a programming
+// error best caught at startup
+func MustRegister(cs ...prometheus.Collector) {
+	Registry().MustRegister(cs...)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	r := Registry()
+	return promhttp.HandlerFor(r, promhttp.HandlerOpts{Registry: r})
+}
+
+// NewCounterVec creates and registers a counter named lumium_<name>
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: Namespace, Name: name, Help: help}, labels)
+	MustRegister(c)
+	return c
+}
+
+// NewGaugeVec creates and registers a gauge named lumium_<name>
+func NewGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: Namespace, Name: name, Help: help}, labels)
+	MustRegister(g)
+	return g
+}
+
+// NewHistogramVec creates and registers a histogram named lumium_<name>; nil buckets means
+// prometheus.DefBuckets, which suit latencies in seconds
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace, Name: name, Help: help, Buckets: buckets,
+	}, labels)
+	MustRegister(h)
+	return h
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Metrics are namespaced and served by Handler", t, func() {
+		c := NewCounterVec("test_events_total", "Events seen by the test", "kind")
+		c.WithLabelValues("a").Add(3)
+
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		b, _ := io.ReadAll(rec.Body)
+		So(string(b), ShouldContainSubstring, `lumium_test_events_total{kind="a"} 3`)
+		So(string(b), ShouldContainSubstring, "process_start_time_seconds")
+	})
+
+	Convey("Registering the same metric twice panics", t, func() {
+		So(func() { NewCounterVec("test_dupe_total", "dupe") }, ShouldNotPanic)
+		So(func() { NewCounterVec("test_dupe_total", "dupe") }, ShouldPanic)
+	})
+}
@@ -0,0 +1,140 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+)
+
+// partSize is the size of each part of a streamed write; S3 wants at least 5 MiB for all but
+// the last. A stream shorter than one part is written with a single PUT
+const partSize = 8 << 20
+
+// PutStream implements Store with an S3 multipart upload, one part in memory at a time
+func (s *S3) PutStream(ctx context.Context, key string, r io.Reader, contentType string) (int64, error) {
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return int64(n), s.Put(ctx, key, bytes.NewReader(buf[:n]), int64(n), contentType)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID, err := s.createMultipart(ctx, key, contentType)
+	if err != nil {
+		return 0, err
+	}
+	var parts []completedPart
+	var total int64
+	for {
+		etag, err := s.uploadPart(ctx, key, uploadID, len(parts)+1, buf[:n])
+		if err != nil {
+			s.abortMultipart(key, uploadID)
+			return 0, err
+		}
+		parts = append(parts, completedPart{PartNumber: len(parts) + 1, ETag: etag})
+		total += int64(n)
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			s.abortMultipart(key, uploadID)
+			return 0, err
+		}
+	}
+	if err := s.completeMultipart(ctx, key, uploadID, parts); err != nil {
+		s.abortMultipart(key, uploadID)
+		return 0, err
+	}
+	return total, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3) createMultipart(ctx context.Context, key, contentType string) (string, error) {
+	req, err := s.request(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = drain(resp) }()
+	var out struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil || out.UploadID == "" {
+		return "", lumErrors.Unavailablef("objstore: start multipart upload of %s: no upload id", key)
+	}
+	return out.UploadID, nil
+}
+
+func (s *S3) uploadPart(ctx context.Context, key, uploadID string, number int, b []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	req, err := s.request(ctx, http.MethodPut, key, q, io.NopCloser(bytes.NewReader(b)))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = int64(len(b))
+	resp, err := s.do(req, "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return "", err
+	}
+	etag := resp.Header.Get("ETag")
+	return etag, drain(resp)
+}
+
+func (s *S3) completeMultipart(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "objstore: marshal parts: %v", err)
+	}
+	req, err := s.request(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}},
+		io.NopCloser(bytes.NewReader(body)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(body))
+	resp, err := s.do(req, "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return err
+	}
+	// S3 may report a failed completion in a 200 response
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = drain(resp)
+	if strings.Contains(string(reply), "<Error>") {
+		return lumErrors.Unavailablef("objstore: complete multipart upload of %s: %s", key, reply)
+	}
+	return nil
+}
+
+// abortMultipart drops the parts of a failed upload, so they don't linger as billed storage
+func (s *S3) abortMultipart(key, uploadID string) {
+	req, err := s.request(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := s.do(req, emptySHA256); err == nil {
+		_ = drain(resp)
+	}
+}
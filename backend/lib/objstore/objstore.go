@@ -0,0 +1,119 @@
+// Package objstore keeps blobs (originals, upload chunks, derivatives) in an S3-compatible object
+// store. Services depend on Store; S3 talks to MinIO or AWS, and Memory backs tests and local runs
+// that opt out of an object store
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"lumium/lib/config"
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+)
+
+// Store is a flat key/value blob store. Keys are slash-separated paths, e.g.
+// "uploads/<tenant>/<id>/<chunk>"
+type Store interface {
+	// Put writes size bytes from r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// PutStream writes r under key without knowing its size up front, holding at most one part
+	// in memory, and returns the bytes written. An error from r aborts the write and is returned
+	PutStream(ctx context.Context, key string, r io.Reader, contentType string) (int64, error)
+
+	// Get opens the object under key; a missing key is a NotFound error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object under key; a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns the S3 store configured by SERVICE_S3_*. Without SERVICE_S3_ENDPOINT it fails,
+// unless OBJSTORE_MEMORY opts into a Memory store for local development
+func FromEnv() (Store, error) {
+	endpoint := config.MayString("SERVICE_S3_ENDPOINT", "")
+	if endpoint == "" {
+		if !config.MayBool("OBJSTORE_MEMORY", false) {
+			return nil, lumErrors.InvalidArgf(
+				"objstore: SERVICE_S3_ENDPOINT is unset; set OBJSTORE_MEMORY=true to keep objects in memory")
+		}
+		l := logger.Get()
+		l.Warn().Msg("OBJSTORE_MEMORY is set; objects are kept in memory and lost on restart")
+		return NewMemory(), nil
+	}
+	return NewS3(S3Config{
+		Endpoint:  endpoint,
+		Region:    config.MayString("SERVICE_S3_REGION", "us-east-1"),
+		Bucket:    config.MayString("SERVICE_S3_BUCKET", "lumium"),
+		AccessKey: config.MayString("SERVICE_S3_ACCESS_KEY", ""),
+		SecretKey: config.MayString("SERVICE_S3_SECRET_KEY", ""),
+		UseSSL:    config.MayBool("SERVICE_S3_USE_SSL", false),
+	})
+}
+
+// Memory is an in-process Store
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory creates an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{objects: map[string][]byte{}}
+}
+
+// Put implements Store
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64, _ string) error {
+	b, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeUnavailable, "objstore: read %s", key)
+	}
+	if int64(len(b)) != size {
+		return lumErrors.InvalidArgf("objstore: %s: got %d bytes, want %d", key, len(b), size)
+	}
+	m.mu.Lock()
+	m.objects[key] = b
+	m.mu.Unlock()
+	return nil
+}
+
+// PutStream implements Store
+func (m *Memory) PutStream(ctx context.Context, key string, r io.Reader, _ string) (int64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	m.objects[key] = b
+	m.mu.Unlock()
+	return int64(len(b)), nil
+}
+
+// Get implements Store
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	b, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, lumErrors.NotFoundf("objstore: %s not found", key)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// Delete implements Store
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.objects, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of objects held, for tests
+func (m *Memory) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.objects)
+}
@@ -0,0 +1,246 @@
+package objstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+)
+
+// S3Config addresses a bucket on an S3-compatible server
+type S3Config struct {
+	Endpoint  string // e.g. http://minio:9000; without a scheme, UseSSL picks one
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3 is a Store on an S3-compatible server. It speaks the handful of object calls it needs with
+// path-style URLs and Signature Version 4, which MinIO and AWS both accept
+type S3 struct {
+	base   *url.URL
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time // seam for tests
+}
+
+// emptySHA256 is the payload hash of a request without a body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3 creates an S3 store
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint := cfg.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+		if cfg.UseSSL {
+			endpoint = "https://" + cfg.Endpoint
+		}
+	}
+	base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, lumErrors.InvalidArgf("objstore: invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, lumErrors.InvalidArgf("objstore: bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3{base: base, cfg: cfg, client: http.DefaultClient, now: time.Now}, nil
+}
+
+// Put implements Store. The body is streamed unsigned, so it needn't be read twice
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, nil, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req, "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return err
+	}
+	return drain(resp)
+}
+
+// Get implements Store
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete implements Store
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return drain(resp)
+}
+
+func (s *S3) request(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	body io.ReadCloser,
+) (*http.Request, error) {
+	if key == "" {
+		return nil, lumErrors.InvalidArgf("objstore: key is required")
+	}
+	u := *s.base
+	u.Path = s.base.Path + "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = s.base.Path + "/" + uriEncode(s.cfg.Bucket, false) + "/" + uriEncode(key, false)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, lumErrors.InvalidArgf("objstore: %s %s: %v", method, key, err)
+	}
+	return req, nil
+}
+
+// do signs and sends req, turning S3 error responses into lumErrors
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeUnavailable, "objstore: %s %s", req.Method, req.URL.Path)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+	msg := fmt.Sprintf("objstore: %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, lumErrors.NotFoundf("%s", msg)
+	case resp.StatusCode >= 500:
+		return nil, lumErrors.Unavailablef("%s", msg)
+	default:
+		return nil, lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "%s", msg)
+	}
+}
+
+func drain(resp *http.Response) error {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// sign adds a Signature Version 4 Authorization header to req. Host, Content-Type, Range and the
+// x-amz-* headers are signed
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "range" || lk == "content-md5" {
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), v[k]...)
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(val, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode is S3's URI encoding: everything but unreserved characters is percent-encoded, and
+// '/' too in query strings
+func uriEncode(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !slash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/tracing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+)
+
+// headers added to every published message
+const (
+	HeaderAggregateType = "Lumium-Aggregate-Type"
+	HeaderAggregateID   = "Lumium-Aggregate-Id"
+	HeaderOutboxID      = "Lumium-Outbox-Id"
+)
+
+// StreamConfig describes the JetStream stream the relay publishes into
+type StreamConfig struct {
+	Name     string
+	Subjects []string
+
+	// DuplicateWindow is how long JetStream remembers message IDs. A relay that crashes between
+	// publishing and marking must re-publish within it for the duplicate to be dropped
+	DuplicateWindow time.Duration
+}
+
+// LoadStreamConfig reads the stream settings from the environment
+func LoadStreamConfig() StreamConfig {
+	subjects := config.MayList("OUTBOX_SUBJECTS")
+	if len(subjects) == 0 {
+		subjects = []string{"events.>"}
+	}
+	return StreamConfig{
+		Name:            config.MayString("OUTBOX_STREAM", "EVENTS"),
+		Subjects:        subjects,
+		DuplicateWindow: config.MayDuration("OUTBOX_DEDUP_WINDOW", 10*time.Minute),
+	}
+}
+
+// EnsureStream creates or updates the stream
+func EnsureStream(ctx context.Context, js jetstream.JetStream, c StreamConfig) error {
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       c.Name,
+		Subjects:   c.Subjects,
+		Duplicates: c.DuplicateWindow,
+		Storage:    jetstream.FileStorage,
+	})
+	return err
+}
+
+// JetStreamPublisher publishes records to JetStream and waits for the stream's ack
+type JetStreamPublisher struct {
+	js jetstream.JetStream
+}
+
+// NewJetStreamPublisher returns a Publisher over js
+func NewJetStreamPublisher(js jetstream.JetStream) *JetStreamPublisher {
+	return &JetStreamPublisher{js: js}
+}
+
+// Publish sends rec with its outbox msg_id as Nats-Msg-Id. The publish span continues the trace
+// of the request that enqueued rec, and consumers continue the publish span
+func (p *JetStreamPublisher) Publish(ctx context.Context, rec Record) error {
+	msg := nats.NewMsg(rec.Subject)
+	msg.Data = rec.Payload
+	for k, v := range rec.Headers {
+		msg.Header.Set(k, v)
+	}
+	msg.Header.Set(HeaderAggregateType, rec.AggregateType)
+	msg.Header.Set(HeaderAggregateID, rec.AggregateID)
+	msg.Header.Set(HeaderOutboxID, strconv.FormatInt(rec.ID, 10))
+
+	ctx, span := tracing.StartPublish(tracing.ExtractNATS(ctx, msg.Header), rec.Subject, msg.Header)
+	defer span.End()
+	span.SetAttributes(semconv.MessagingMessageID(rec.MsgID))
+
+	if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(rec.MsgID)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish failed")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package outbox publishes events reliably: producers Enqueue them inside the transaction that
+// makes the change, and a Relay publishes committed rows to NATS JetStream afterwards. Events for
+// one aggregate are published in the order they were enqueued, and each carries a stable
+// Nats-Msg-Id, so a re-publish after a crash is dropped by JetStream's duplicate window
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Event is a fact to publish once the surrounding transaction commits
+type Event struct {
+	AggregateType string // e.g. "photo"
+	AggregateID   string
+	Subject       string // NATS subject, e.g. "events.photo.ingested"
+	Payload       any    // marshalled as JSON
+	Headers       map[string]string
+}
+
+// Record is an outbox row awaiting publication
+type Record struct {
+	ID            int64
+	AggregateType string
+	AggregateID   string
+	Subject       string
+	Payload       []byte
+	Headers       map[string]string
+	MsgID         string
+	Attempts      int
+	CreatedAt     time.Time
+}
+
+// Enqueue writes events to the outbox. Call it with the transaction's Queryer inside
+// store.WithTx so the events exist if and only if the change commits.
+//
+// Row ids are assigned at insert but become visible at commit, so two transactions touching one
+// aggregate could commit out of id order and the relay would publish the later event first.
+// Enqueue holds a lock per aggregate until the transaction ends, so rows of one aggregate are
+// numbered in commit order
+func Enqueue(ctx context.Context, q store.Queryer, events ...Event) error {
+	keys := make([]string, 0, len(events))
+	for _, ev := range events {
+		if strings.TrimSpace(ev.Subject) == "" || ev.AggregateType == "" || ev.AggregateID == "" {
+			return lumErrors.InvalidArgf("outbox: subject, aggregate type and aggregate id are required")
+		}
+		keys = append(keys, ev.AggregateType+":"+ev.AggregateID)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	// a fixed order, so transactions enqueueing for the same aggregates can't deadlock
+	slices.Sort(keys)
+	if _, err := q.Exec(ctx,
+		`SELECT pg_advisory_xact_lock(hashtextextended('outbox:' || k, 0)) FROM UNNEST($1::text[]) AS k`,
+		slices.Compact(keys),
+	); err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "outbox: lock aggregates")
+	}
+
+	for _, ev := range events {
+		payload, err := json.Marshal(ev.Payload)
+		if err != nil {
+			return lumErrors.JSONErrf("outbox: marshal %s payload: %v", ev.Subject, err)
+		}
+		// the producer's trace context rides along, so the relay's publish joins the request's trace
+		headers := map[string]string{}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+		for k, v := range ev.Headers {
+			headers[k] = v
+		}
+		hdr, err := json.Marshal(headers)
+		if err != nil {
+			return lumErrors.JSONErrf("outbox: marshal %s headers: %v", ev.Subject, err)
+		}
+
+		if _, err := q.Exec(ctx,
+			`INSERT INTO outbox (aggregate_type, aggregate_id, subject, payload, headers)
+			 VALUES ($1, $2, $3, $4::jsonb, $5::jsonb)`,
+			ev.AggregateType, ev.AggregateID, ev.Subject, string(payload), string(hdr),
+		); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "outbox: enqueue %s", ev.Subject)
+		}
+	}
+	return nil
+}
+
+// Store is the relay's view of the outbox table
+type Store interface {
+	// Lock blocks until this relay is the only one publishing, or ctx ends. Until unlock, the
+	// other methods run on the session holding the lock, so losing it surfaces as their errors
+	Lock(ctx context.Context) (unlock func(), err error)
+
+	// Pending returns up to limit publishable records in id order. A record is publishable when
+	// it isn't dead, is due, and no earlier record of its aggregate is still waiting on a retry
+	Pending(ctx context.Context, limit int) ([]Record, error)
+
+	// MarkPublished records a successful publish
+	MarkPublished(ctx context.Context, id int64) error
+
+	// MarkFailed records a failed attempt, scheduling the next one at next; dead parks the record
+	MarkFailed(ctx context.Context, id int64, reason string, next time.Time, dead bool) error
+
+	// Purge deletes records published before olderThan
+	Purge(ctx context.Context, olderThan time.Time) (int64, error)
+}
+
+// Publisher delivers one record to the event bus and returns once the bus has accepted it
+type Publisher interface {
+	Publish(ctx context.Context, rec Record) error
+}
@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// relayLockID is the advisory lock key that elects the single active relay
+const relayLockID int64 = 7_140_033
+
+// pgStore is the Postgres Store. While locked, every query runs on the locked session
+type pgStore struct {
+	pool *pgxpool.Pool
+	conn *pgxpool.Conn
+}
+
+// NewPGStore returns the Postgres-backed Store
+func NewPGStore(pool *pgxpool.Pool) Store {
+	return &pgStore{pool: pool}
+}
+
+func (s *pgStore) q() store.Queryer {
+	if s.conn != nil {
+		return s.conn
+	}
+	return s.pool
+}
+
+// Lock polls pg_try_advisory_lock on a dedicated connection until it wins
+func (s *pgStore) Lock(ctx context.Context) (func(), error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var ok bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, relayLockID).Scan(&ok); err != nil {
+			conn.Release()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			conn.Release()
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	s.conn = conn
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, relayLockID)
+		conn.Release()
+		s.conn = nil
+	}, nil
+}
+
+// Pending returns publishable records in id order
+func (s *pgStore) Pending(ctx context.Context, limit int) ([]Record, error) {
+	rows, err := s.q().Query(ctx,
+		`SELECT o.id, o.aggregate_type, o.aggregate_id, o.subject, o.payload, o.headers,
+		        o.msg_id::text, o.attempts, o.created_at
+		   FROM outbox o
+		  WHERE o.published_at IS NULL AND o.dead_at IS NULL
+		    AND NOT EXISTS (
+		      SELECT 1 FROM outbox w
+		       WHERE w.aggregate_type = o.aggregate_type AND w.aggregate_id = o.aggregate_id
+		         AND w.id <= o.id AND w.published_at IS NULL AND w.dead_at IS NULL
+		         AND w.next_attempt_at > NOW())
+		  ORDER BY o.id
+		  LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Record
+	for rows.Next() {
+		var (
+			r   Record
+			hdr []byte
+		)
+		if err := rows.Scan(
+			&r.ID, &r.AggregateType, &r.AggregateID, &r.Subject, &r.Payload, &hdr,
+			&r.MsgID, &r.Attempts, &r.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(hdr, &r.Headers); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// MarkPublished records a successful publish
+func (s *pgStore) MarkPublished(ctx context.Context, id int64) error {
+	_, err := s.q().Exec(ctx,
+		`UPDATE outbox SET published_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1`, id)
+	return err
+}
+
+// MarkFailed records a failed attempt
+func (s *pgStore) MarkFailed(ctx context.Context, id int64, reason string, next time.Time, dead bool) error {
+	_, err := s.q().Exec(ctx,
+		`UPDATE outbox
+		    SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3,
+		        dead_at = CASE WHEN $4 THEN NOW() END
+		  WHERE id = $1`,
+		id, reason, next, dead)
+	return err
+}
+
+// Purge deletes records published before olderThan
+func (s *pgStore) Purge(ctx context.Context, olderThan time.Time) (int64, error) {
+	tag, err := s.q().Exec(ctx, `DELETE FROM outbox WHERE published_at < $1`, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,196 @@
+package outbox
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/metrics"
+)
+
+var relayed = metrics.NewCounterVec("outbox_relayed_total",
+	"Outbox records handled by the relay, by outcome: published, failed (will retry) or dead",
+	"outcome")
+
+// Options tune a Relay
+type Options struct {
+	BatchSize    int
+	PollInterval time.Duration // wait between empty polls
+
+	// failed publishes retry after BaseBackoff * 2^(attempts-1), capped at MaxBackoff, with
+	// jitter. After MaxAttempts (0 = never) the record is parked as dead
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+
+	Retention time.Duration // published records are purged after this; 0 keeps them
+}
+
+// LoadOptions reads the relay settings from the environment
+func LoadOptions() Options {
+	return Options{
+		BatchSize:    config.MayInt("OUTBOX_BATCH_SIZE", 100),
+		PollInterval: config.MayDuration("OUTBOX_POLL_INTERVAL", 500*time.Millisecond),
+		BaseBackoff:  config.MayDuration("OUTBOX_RETRY_BACKOFF", time.Second),
+		MaxBackoff:   config.MayDuration("OUTBOX_RETRY_MAX_BACKOFF", 5*time.Minute),
+		MaxAttempts:  config.MayInt("OUTBOX_MAX_ATTEMPTS", 25),
+		Retention:    config.MayDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+	}
+}
+
+// Relay moves committed outbox records onto the event bus
+type Relay struct {
+	store Store
+	pub   Publisher
+	opts  Options
+	now   func() time.Time
+}
+
+// NewRelay returns a Relay, filling unset options with defaults
+func NewRelay(s Store, p Publisher, o Options) *Relay {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 500 * time.Millisecond
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = time.Second
+	}
+	if o.MaxBackoff < o.BaseBackoff {
+		o.MaxBackoff = o.BaseBackoff
+	}
+	return &Relay{store: s, pub: p, opts: o, now: time.Now}
+}
+
+// Run publishes until ctx ends. Only one relay publishes at a time; others wait on the lock,
+// which keeps per-aggregate ordering simple and makes standby relays cheap
+func (r *Relay) Run(ctx context.Context) error {
+	l := logger.Get()
+	for ctx.Err() == nil {
+		unlock, err := r.store.Lock(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			l.Warn().Err(err).Msg("outbox: lock")
+			sleep(ctx, r.opts.PollInterval)
+			continue
+		}
+		l.Info().Msg("outbox: relay active")
+
+		err = r.loop(ctx)
+		unlock()
+		if err != nil && ctx.Err() == nil {
+			l.Warn().Err(err).Msg("outbox: relay lost its session; re-electing")
+			sleep(ctx, r.opts.PollInterval)
+		}
+	}
+	return nil
+}
+
+// loop drains the outbox while this relay holds the lock
+func (r *Relay) loop(ctx context.Context) error {
+	l := logger.Get()
+	var lastPurge time.Time
+	for ctx.Err() == nil {
+		n, err := r.RunOnce(ctx)
+		if err != nil {
+			return err
+		}
+
+		if r.opts.Retention > 0 && r.now().Sub(lastPurge) > time.Hour {
+			lastPurge = r.now()
+			if purged, err := r.store.Purge(ctx, r.now().Add(-r.opts.Retention)); err != nil {
+				l.Warn().Err(err).Msg("outbox: purge")
+			} else if purged > 0 {
+				l.Info().Int64("purged", purged).Msg("outbox: purged published records")
+			}
+		}
+
+		if n < r.opts.BatchSize {
+			sleep(ctx, r.opts.PollInterval)
+		}
+	}
+	return nil
+}
+
+// RunOnce publishes one batch in id order and returns how many records it handled. When a
+// publish fails, the rest of that aggregate's records wait for the retry so order holds
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	recs, err := r.store.Pending(ctx, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	l := logger.Get()
+	blocked := map[[2]string]bool{}
+	for _, rec := range recs {
+		key := [2]string{rec.AggregateType, rec.AggregateID}
+		if blocked[key] {
+			continue
+		}
+
+		perr := r.pub.Publish(ctx, rec)
+		if perr == nil {
+			if err := r.store.MarkPublished(ctx, rec.ID); err != nil {
+				// the message is out; the retry re-publishes with the same Nats-Msg-Id and
+				// JetStream drops it, so the books catch up without a duplicate
+				return 0, err
+			}
+			relayed.WithLabelValues("published").Inc()
+			continue
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		blocked[key] = true
+		attempts := rec.Attempts + 1
+		dead := r.opts.MaxAttempts > 0 && attempts >= r.opts.MaxAttempts
+		next := r.now().Add(r.backoff(attempts))
+		if err := r.store.MarkFailed(ctx, rec.ID, perr.Error(), next, dead); err != nil {
+			return 0, err
+		}
+
+		ev := l.Warn()
+		outcome := "failed"
+		if dead {
+			ev = l.Error()
+			outcome = "dead"
+		}
+		relayed.WithLabelValues(outcome).Inc()
+		ev.Err(perr).
+			Int64("id", rec.ID).
+			Str("subject", rec.Subject).
+			Int("attempts", attempts).
+			Bool("dead", dead).
+			Time("next_attempt", next).
+			Msg("outbox: publish failed")
+	}
+	return len(recs), nil
+}
+
+// backoff is the delay before attempt+1, with up to 20% jitter
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.opts.BaseBackoff
+	for i := 1; i < attempts && d < r.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, r.opts.MaxBackoff)
+	if d >= 5 {
+		d += time.Duration(rand.Int63n(int64(d) / 5))
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,311 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// memStore is an in-memory Store with the same publishability rules as the SQL
+type memStore struct {
+	mu          sync.Mutex
+	recs        []*memRec
+	now         func() time.Time
+	failMarkFor map[int64]int // MarkPublished fails this many times for the id
+}
+
+type memRec struct {
+	Record
+	next      time.Time
+	published bool
+	dead      bool
+	lastErr   string
+}
+
+func (s *memStore) add(aggType, aggID, subject, payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := int64(len(s.recs) + 1)
+	s.recs = append(s.recs, &memRec{Record: Record{
+		ID: id, AggregateType: aggType, AggregateID: aggID, Subject: subject,
+		Payload: []byte(payload), MsgID: fmt.Sprintf("msg-%d", id),
+	}})
+}
+
+func (s *memStore) Lock(context.Context) (func(), error) { return func() {}, nil }
+
+func (s *memStore) Pending(_ context.Context, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiting := map[[2]string]bool{}
+	var out []Record
+	for _, r := range s.recs {
+		if r.published || r.dead {
+			continue
+		}
+		key := [2]string{r.AggregateType, r.AggregateID}
+		if r.next.After(s.now()) {
+			waiting[key] = true
+		}
+		if waiting[key] || len(out) == limit {
+			continue
+		}
+		out = append(out, r.Record)
+	}
+	return out, nil
+}
+
+func (s *memStore) MarkPublished(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failMarkFor[id] > 0 {
+		s.failMarkFor[id]--
+		return errors.New("connection reset")
+	}
+	s.recs[id-1].published = true
+	return nil
+}
+
+func (s *memStore) MarkFailed(_ context.Context, id int64, reason string, next time.Time, dead bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.recs[id-1]
+	r.Attempts++
+	r.next, r.dead, r.lastErr = next, dead, reason
+	return nil
+}
+
+func (s *memStore) Purge(context.Context, time.Time) (int64, error) { return 0, nil }
+
+// flakyPublisher fails publishes for the listed subjects until healed
+type flakyPublisher struct {
+	Publisher
+	failing map[string]bool
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, rec Record) error {
+	if p.failing[rec.Subject] {
+		return errors.New("nats: timeout")
+	}
+	return p.Publisher.Publish(ctx, rec)
+}
+
+// runJetStream starts an in-process NATS server with JetStream
+func runJetStream(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+// streamMessages returns every message in the stream, in stream order
+func streamMessages(ctx context.Context, js jetstream.JetStream, name string) []*jetstream.RawStreamMsg {
+	s, err := js.Stream(ctx, name)
+	So(err, ShouldBeNil)
+	info, err := s.Info(ctx)
+	So(err, ShouldBeNil)
+
+	var out []*jetstream.RawStreamMsg
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && info.State.Msgs > 0; seq++ {
+		m, err := s.GetMsg(ctx, seq)
+		So(err, ShouldBeNil)
+		out = append(out, m)
+	}
+	return out
+}
+
+func payloads(msgs []*jetstream.RawStreamMsg) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = string(m.Data)
+	}
+	return out
+}
+
+func TestRelay(t *testing.T) {
+	ns := runJetStream(t)
+
+	Convey("Given a relay publishing to an in-process JetStream", t, func() {
+		ctx := context.Background()
+		nc, err := nats.Connect(ns.ClientURL())
+		So(err, ShouldBeNil)
+		defer nc.Close()
+		js, err := jetstream.New(nc)
+		So(err, ShouldBeNil)
+
+		name := strings.ReplaceAll(t.Name(), "/", "_") + fmt.Sprint(time.Now().UnixNano())
+		So(EnsureStream(ctx, js, StreamConfig{
+			Name:            name,
+			Subjects:        []string{name + ".>"},
+			DuplicateWindow: time.Minute,
+		}), ShouldBeNil)
+		subj := func(s string) string { return name + "." + s }
+
+		clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		st := &memStore{now: func() time.Time { return clock }, failMarkFor: map[int64]int{}}
+		pub := &flakyPublisher{Publisher: NewJetStreamPublisher(js), failing: map[string]bool{}}
+		r := NewRelay(st, pub, Options{BatchSize: 10, BaseBackoff: time.Second, MaxBackoff: time.Minute, MaxAttempts: 3})
+		r.now = st.now
+
+		Convey("pending records are published in order with their headers", func() {
+			st.add("photo", "p1", subj("photo.ingested"), `{"n":1}`)
+			st.add("photo", "p2", subj("photo.ingested"), `{"n":2}`)
+			st.add("photo", "p1", subj("photo.thumbnailed"), `{"n":3}`)
+
+			n, err := r.RunOnce(ctx)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+
+			msgs := streamMessages(ctx, js, name)
+			So(payloads(msgs), ShouldResemble, []string{`{"n":1}`, `{"n":2}`, `{"n":3}`})
+			So(msgs[0].Header.Get(HeaderAggregateID), ShouldEqual, "p1")
+			So(msgs[0].Header.Get(jetstream.MsgIDHeader), ShouldEqual, "msg-1")
+		})
+
+		Convey("a failed publish holds back that aggregate only, then retries in order", func() {
+			st.add("photo", "p1", subj("photo.ingested"), `{"n":1}`)
+			st.add("photo", "p1", subj("photo.thumbnailed"), `{"n":2}`)
+			st.add("photo", "p2", subj("photo.deleted"), `{"n":3}`)
+			pub.failing[subj("photo.ingested")] = true
+
+			_, err := r.RunOnce(ctx)
+			So(err, ShouldBeNil)
+			So(payloads(streamMessages(ctx, js, name)), ShouldResemble, []string{`{"n":3}`})
+			So(st.recs[0].Attempts, ShouldEqual, 1)
+			So(st.recs[0].next, ShouldHappenAfter, clock)
+
+			Convey("nothing moves for p1 before the backoff elapses", func() {
+				delete(pub.failing, subj("photo.ingested"))
+				n, _ := r.RunOnce(ctx)
+				So(n, ShouldEqual, 0)
+
+				clock = clock.Add(2 * time.Second)
+				_, err := r.RunOnce(ctx)
+				So(err, ShouldBeNil)
+				So(payloads(streamMessages(ctx, js, name)), ShouldResemble, []string{`{"n":3}`, `{"n":1}`, `{"n":2}`})
+			})
+
+			Convey("a record that keeps failing is parked as dead and unblocks its aggregate", func() {
+				for range 3 {
+					clock = clock.Add(2 * time.Minute)
+					_, _ = r.RunOnce(ctx)
+				}
+				So(st.recs[0].dead, ShouldBeTrue)
+				So(st.recs[0].lastErr, ShouldEqual, "nats: timeout")
+				So(st.recs[1].published, ShouldBeTrue)
+			})
+		})
+
+		Convey("a crash between publishing and bookkeeping does not duplicate the message", func() {
+			st.add("album", "a1", subj("album.created"), `{"n":1}`)
+			st.failMarkFor[1] = 1
+
+			_, err := r.RunOnce(ctx)
+			So(err, ShouldNotBeNil)
+			So(st.recs[0].published, ShouldBeFalse)
+
+			_, err = r.RunOnce(ctx)
+			So(err, ShouldBeNil)
+			So(st.recs[0].published, ShouldBeTrue)
+			So(streamMessages(ctx, js, name), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("backoff doubles up to the cap", t, func() {
+		r := NewRelay(&memStore{}, nil, Options{BaseBackoff: time.Second, MaxBackoff: 8 * time.Second})
+		So(r.backoff(1), ShouldBeBetweenOrEqual, time.Second, 1200*time.Millisecond)
+		So(r.backoff(3), ShouldBeBetweenOrEqual, 4*time.Second, 4800*time.Millisecond)
+		So(r.backoff(10), ShouldBeBetweenOrEqual, 8*time.Second, 9600*time.Millisecond)
+	})
+}
+
+// recQueryer captures Enqueue's inserts and the aggregate locks taken before them
+type recQueryer struct {
+	store.Queryer
+	locks [][]string
+	args  [][]any
+}
+
+func (q *recQueryer) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "pg_advisory_xact_lock") {
+		q.locks = append(q.locks, args[0].([]string))
+		return pgconn.CommandTag{}, nil
+	}
+	q.args = append(q.args, args)
+	return pgconn.CommandTag{}, nil
+}
+
+func TestEnqueue(t *testing.T) {
+	Convey("Enqueue writes one row per event with JSON payload and headers", t, func() {
+		q := &recQueryer{}
+		err := Enqueue(context.Background(), q,
+			Event{AggregateType: "photo", AggregateID: "p1", Subject: "events.photo.ingested",
+				Payload: map[string]string{"id": "p1"}, Headers: map[string]string{"traceparent": "00-x"}},
+			Event{AggregateType: "photo", AggregateID: "p2", Subject: "events.photo.ingested", Payload: nil},
+		)
+		So(err, ShouldBeNil)
+		So(q.args, ShouldHaveLength, 2)
+		So(q.args[0][3], ShouldEqual, `{"id":"p1"}`)
+		So(q.args[0][4], ShouldEqual, `{"traceparent":"00-x"}`)
+		So(q.args[1][4], ShouldEqual, `{}`)
+	})
+
+	Convey("Enqueue locks each aggregate once, in a fixed order, before writing", t, func() {
+		q := &recQueryer{}
+		err := Enqueue(context.Background(), q,
+			Event{AggregateType: "photo", AggregateID: "p2", Subject: "events.photo.ingested"},
+			Event{AggregateType: "album", AggregateID: "a1", Subject: "events.album.item_added"},
+			Event{AggregateType: "photo", AggregateID: "p2", Subject: "events.photo.tagged"},
+		)
+		So(err, ShouldBeNil)
+		So(q.locks, ShouldResemble, [][]string{{"album:a1", "photo:p2"}})
+		So(q.args, ShouldHaveLength, 3)
+	})
+
+	Convey("Enqueue carries the caller's trace context in the headers", t, func() {
+		prev := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		defer otel.SetTextMapPropagator(prev)
+
+		ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+		defer span.End()
+		q := &recQueryer{}
+		So(Enqueue(ctx, q, Event{AggregateType: "photo", AggregateID: "p1", Subject: "events.x"}), ShouldBeNil)
+		So(q.args[0][4], ShouldContainSubstring, span.SpanContext().TraceID().String())
+	})
+
+	Convey("Enqueue rejects events without a subject or aggregate", t, func() {
+		q := &recQueryer{}
+		err := Enqueue(context.Background(), q, Event{Subject: "events.x"})
+		So(err, ShouldNotBeNil)
+		So(q.locks, ShouldBeEmpty)
+	})
+}
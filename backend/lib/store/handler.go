@@ -3,7 +3,9 @@ package store
 import (
 	"context"
 	"math/rand"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"lumium/lib/config"
@@ -19,6 +21,19 @@ var (
 	poolPing          = func(p *pgxpool.Pool, ctx context.Context) error { return p.Ping(ctx) }
 	poolClose         = func(p *pgxpool.Pool) { p.Close() }
 	timeSleep         = time.Sleep
+	loadPoolConfig    = LoadPoolConfig
+
+	// replicaLag reports how far a standby's replay is behind. A standby that has replayed
+	// everything it received isn't lagging, however long ago the primary last wrote
+	replicaLag = func(p *pgxpool.Pool, ctx context.Context) (time.Duration, error) {
+		var secs float64
+		err := p.QueryRow(ctx,
+			`SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			             ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+			        END`,
+		).Scan(&secs)
+		return time.Duration(secs * float64(time.Second)), err
+	}
 
 	// singleton, handler and initialized
 	once           sync.Once
@@ -26,9 +41,22 @@ var (
 	initializedPgx bool
 )
 
-// Handler is our database wrapper
+// Handler is our database wrapper. PgxPool is the primary; reads that tolerate replication lag
+// can go to Replica(ctx)
 type Handler struct {
 	PgxPool *pgxpool.Pool
+
+	cfg      PoolConfig
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+}
+
+// replica is one read replica pool and its last health check
+type replica struct {
+	host    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
 }
 
 // NewHandler creates a new handler and returns it
@@ -48,73 +76,54 @@ func GetHandler() *Handler {
 	return handler
 }
 
-// InitializeDB creates the pgx pool
+// InitializeDB creates the primary pool, waiting for it to answer, and the replica pools
 func (h *Handler) InitializeDB() {
 	if initializedPgx && h.PgxPool != nil {
 		return
 	}
 
-	// Honestly, I pulled these config values out of my hat
-	// They could be env variables or part of the config package
-	const (
-		minConns        = int32(0)
-		maxConns        = int32(10)
-		maxConnLifetime = 30 * time.Minute
-		maxConnIdleTime = 15 * time.Minute
-		pingTimeout     = 5 * time.Second
-		maxRetries      = 8
-		baseBackoff     = 500 * time.Millisecond
-		maxBackoff      = 10 * time.Second
-	)
-
 	l := logger.Get()
+	h.cfg = loadPoolConfig()
+	TenantRole = h.cfg.TenantRole
 
 	dsn := config.MustString("SERVICE_PGSQL_DBURL")
-	pgcfg, err := parsePoolConfig(dsn)
+	pool, err := h.newPool(dsn)
 	if err != nil {
-		l.Fatal().Err(err).Msg("pgxpool: could not parse SERVICE_PGSQL_DBURL")
-	}
-
-	pgcfg.MinConns = minConns
-	pgcfg.MaxConns = maxConns
-	pgcfg.MaxConnLifetime = maxConnLifetime
-	pgcfg.MaxConnIdleTime = maxConnIdleTime
-
-	// attach tracer so we can view SQL activity
-	pgcfg.ConnConfig.Tracer = &dbQueryTracer{log: l}
-
-	pool, err := newPoolWithConfig(context.Background(), pgcfg)
-	if err != nil {
-		l.Fatal().Err(err).Msg("pgxpool: failed to create pool")
+		l.Fatal().Err(err).Msg("pgxpool: could not create pool from SERVICE_PGSQL_DBURL")
 	}
 
 	var lastErr error
-	for i := 0; i <= maxRetries; i++ {
-		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	for i := 0; i <= h.cfg.MaxRetries; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.PingTimeout)
 		lastErr = poolPing(pool, ctx)
 		cancel()
 
 		if lastErr == nil {
 			h.PgxPool = pool
 			initializedPgx = true
-			l.Info().Int32("max_conns", maxConns).Msg("Database connection established")
+			registerPoolMetrics(h)
+			l.Info().Int32("max_conns", h.cfg.MaxConns).Msg("Database connection established")
+			h.initReplicas()
 			return
 		}
 
-		// exponential backoff capped at maxBackoff, with ~20% jitter
-		backoff := baseBackoff * (1 << i)
-		if backoff > maxBackoff {
-			backoff = maxBackoff
+		// exponential backoff capped at MaxBackoff, with ~20% jitter
+		backoff := h.cfg.BaseBackoff * (1 << i)
+		if backoff > h.cfg.MaxBackoff || backoff <= 0 {
+			backoff = h.cfg.MaxBackoff
 		}
 
-		jitter := time.Duration(rand.Int63n(int64(backoff) / 5))
+		var jitter time.Duration
+		if backoff >= 5 {
+			jitter = time.Duration(rand.Int63n(int64(backoff) / 5))
+		}
 		sleep := backoff + jitter
 
 		l.Warn().
 			Err(lastErr).
 			Dur("retry_in", sleep).
 			Int("attempt", i+1).
-			Int("max", maxRetries+1).
+			Int("max", h.cfg.MaxRetries+1).
 			Msg("Database ping failed; retrying")
 
 		timeSleep(sleep)
@@ -124,11 +133,157 @@ func (h *Handler) InitializeDB() {
 	l.Fatal().Err(lastErr).Msg("pgxpool: could not establish database connectivity")
 }
 
-// Close closes the database connection
+// newPool parses dsn and applies the pool settings
+func (h *Handler) newPool(dsn string) (*pgxpool.Pool, error) {
+	pgcfg, err := parsePoolConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pgcfg.MinConns = h.cfg.MinConns
+	pgcfg.MaxConns = h.cfg.MaxConns
+	pgcfg.MaxConnLifetime = h.cfg.MaxConnLifetime
+	pgcfg.MaxConnIdleTime = h.cfg.MaxConnIdleTime
+	if h.cfg.HealthCheckPeriod > 0 {
+		pgcfg.HealthCheckPeriod = h.cfg.HealthCheckPeriod
+	}
+
+	// attach tracer so we can view SQL activity
+	pgcfg.ConnConfig.Tracer = newQueryTracer(logger.Get())
+
+	return newPoolWithConfig(context.Background(), pgcfg)
+}
+
+// initReplicas creates the replica pools and starts their health checks. A replica that is down
+// at boot doesn't stop the service: reads fall back to the primary until it answers
+func (h *Handler) initReplicas() {
+	l := logger.Get()
+	h.replicas = nil
+	for _, dsn := range h.cfg.ReplicaURLs {
+		host := dsnHost(dsn)
+		pool, err := h.newPool(dsn)
+		if err != nil {
+			l.Error().Err(err).Str("replica", host).Msg("pgxpool: skipping read replica")
+			continue
+		}
+		h.replicas = append(h.replicas, &replica{host: host, pool: pool})
+	}
+	if len(h.replicas) == 0 {
+		return
+	}
+
+	h.CheckReplicas(context.Background())
+	h.stop = make(chan struct{})
+	go h.watchReplicas(h.stop)
+	l.Info().Int("replicas", len(h.replicas)).Msg("Read replicas configured")
+}
+
+// watchReplicas re-checks replica health until stop closes
+func (h *Handler) watchReplicas(stop chan struct{}) {
+	interval := h.cfg.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			h.CheckReplicas(context.Background())
+		}
+	}
+}
+
+// CheckReplicas pings every replica and checks its replication lag, updating which ones
+// Replica may hand out
+func (h *Handler) CheckReplicas(ctx context.Context) {
+	l := logger.Get()
+	for _, r := range h.replicas {
+		ok := h.replicaHealthy(ctx, r)
+		if was := r.healthy.Swap(ok); was != ok {
+			if ok {
+				l.Info().Str("replica", r.host).Msg("Read replica healthy")
+			} else {
+				l.Warn().Str("replica", r.host).Msg("Read replica unhealthy; reads fall back to primary")
+			}
+		}
+	}
+}
+
+func (h *Handler) replicaHealthy(ctx context.Context, r *replica) bool {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.PingTimeout)
+	defer cancel()
+	if err := poolPing(r.pool, ctx); err != nil {
+		return false
+	}
+	if h.cfg.MaxReplicaLag <= 0 {
+		return true
+	}
+	lag, err := replicaLag(r.pool, ctx)
+	return err == nil && lag <= h.cfg.MaxReplicaLag
+}
+
+// Primary returns the primary pool; all writes go here
+func (h *Handler) Primary() *pgxpool.Pool {
+	return h.PgxPool
+}
+
+// Replica returns a healthy read replica, round-robin. It returns the primary when no replica
+// is configured, none is healthy, or ctx asked for ReadYourWrites
+func (h *Handler) Replica(ctx context.Context) *pgxpool.Pool {
+	if len(h.replicas) == 0 || WantsPrimary(ctx) {
+		return h.PgxPool
+	}
+	start := h.next.Add(1)
+	for i := range uint64(len(h.replicas)) {
+		r := h.replicas[(start+i)%uint64(len(h.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+	return h.PgxPool
+}
+
+// Close closes the database connections
 func (h *Handler) Close() {
+	if h.stop != nil {
+		close(h.stop)
+		h.stop = nil
+	}
+	for _, r := range h.replicas {
+		poolClose(r.pool)
+	}
+	h.replicas = nil
+
 	if h.PgxPool != nil {
 		poolClose(h.PgxPool) // use seam, not h.PgxPool.Close()
 		h.PgxPool = nil
 	}
 	initializedPgx = false
 }
+
+// dsnHost is the host part of a DSN, for logs that mustn't carry credentials
+func dsnHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "replica"
+}
+
+type ctxKey uint8
+
+const primaryKey ctxKey = iota
+
+// ReadYourWrites marks ctx so Replica returns the primary. Use it for reads that must observe a
+// write made moments earlier (e.g. re-reading a row just inserted) and can't tolerate lag
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// WantsPrimary reports whether ctx was marked with ReadYourWrites
+func WantsPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey).(bool)
+	return v
+}
@@ -24,13 +24,15 @@ func resetHandlerSeams() {
 	poolPing = func(p *pgxpool.Pool, ctx context.Context) error { return p.Ping(ctx) }
 	poolClose = func(p *pgxpool.Pool) { p.Close() }
 	timeSleep = time.Sleep
+	loadPoolConfig = LoadPoolConfig
+	replicaLag = func(_ *pgxpool.Pool, _ context.Context) (time.Duration, error) { return 0, nil }
 }
 
 // TestNewHandler tests a new singleton
 func TestNewHandler(t *testing.T) {
 	Convey("NewHandler(false) returns singleton and does not initialize pgx", t, func() {
 		resetHandlerSeams()
-		t.Setenv("DATABASE_URL", "postgres://ignore@localhost/db")
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
 
 		h1 := NewHandler(false)
 		So(h1, ShouldNotBeNil)
@@ -46,7 +48,7 @@ func TestNewHandler(t *testing.T) {
 func TestInitializeDB(t *testing.T) {
 	Convey("InitializeDB succeeds and sets pool + initializedPgx", t, func() {
 		resetHandlerSeams()
-		t.Setenv("DATABASE_URL", "postgres://ignore@localhost/db")
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
 
 		// stub: parse config returns a minimal usable config
 		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
@@ -81,7 +83,7 @@ func TestInitializeDB(t *testing.T) {
 func TestInitializeDB_Retry(t *testing.T) {
 	Convey("InitializeDB retries on ping failures and succeeds", t, func() {
 		resetHandlerSeams()
-		t.Setenv("DATABASE_URL", "postgres://ignore@localhost/db")
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
 
 		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
 			cfg := &pgxpool.Config{ConnConfig: &pgx.ConnConfig{}}
@@ -113,7 +115,7 @@ func TestInitializeDB_Retry(t *testing.T) {
 func TestClose(t *testing.T) {
 	Convey("Close() closes the pool and resets state", t, func() {
 		resetHandlerSeams()
-		t.Setenv("DATABASE_URL", "postgres://ignore@localhost/db")
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
 
 		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
 			return &pgxpool.Config{ConnConfig: &pgx.ConnConfig{}}, nil
@@ -144,7 +146,7 @@ func TestInitializeDB_Fatal(t *testing.T) {
 	Convey("Guard: with seams in place, we never hit l.Fatal() in tests", t, func() {
 		resetHandlerSeams()
 		// Provide a URL so ParseConfig seam is invoked (we don't want to test Fatal path)
-		t.Setenv("DATABASE_URL", "postgres://ignore@localhost/db")
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
 
 		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
 			return &pgxpool.Config{ConnConfig: &pgx.ConnConfig{}}, nil
@@ -158,3 +160,112 @@ func TestInitializeDB_Fatal(t *testing.T) {
 		So(h, ShouldNotBeNil)
 	})
 }
+
+// TestLoadPoolConfig tests the env-driven pool settings
+func TestLoadPoolConfig(t *testing.T) {
+	Convey("LoadPoolConfig reads overrides and keeps defaults", t, func() {
+		t.Setenv("SERVICE_PGSQL_MAX_CONNS", "25")
+		t.Setenv("SERVICE_PGSQL_MAX_CONN_LIFETIME", "1h")
+		t.Setenv("SERVICE_PGSQL_REPLICA_URLS", "postgres://a/db, postgres://b/db")
+
+		c := LoadPoolConfig()
+		So(c.MaxConns, ShouldEqual, 25)
+		So(c.MaxConnLifetime, ShouldEqual, time.Hour)
+		So(c.MaxConnIdleTime, ShouldEqual, 15*time.Minute)
+		So(c.MaxRetries, ShouldEqual, 8)
+		So(c.ReplicaURLs, ShouldResemble, []string{"postgres://a/db", "postgres://b/db"})
+	})
+
+	Convey("InitializeDB applies the pool settings", t, func() {
+		resetHandlerSeams()
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@localhost/db")
+		loadPoolConfig = func() PoolConfig {
+			return PoolConfig{MaxConns: 3, MaxConnLifetime: time.Minute, PingTimeout: time.Second}
+		}
+		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
+			return &pgxpool.Config{ConnConfig: &pgx.ConnConfig{}}, nil
+		}
+		var got *pgxpool.Config
+		newPoolWithConfig = func(_ context.Context, c *pgxpool.Config) (*pgxpool.Pool, error) {
+			got = c
+			return &pgxpool.Pool{}, nil
+		}
+		poolPing = func(_ *pgxpool.Pool, _ context.Context) error { return nil }
+
+		NewHandler(true)
+		So(got.MaxConns, ShouldEqual, 3)
+		So(got.MaxConnLifetime, ShouldEqual, time.Minute)
+	})
+}
+
+// TestReplicas tests read routing, fallback and read-your-writes
+func TestReplicas(t *testing.T) {
+	Convey("Given a primary and two replicas", t, func() {
+		resetHandlerSeams()
+		t.Setenv("SERVICE_PGSQL_DBURL", "postgres://ignore@primary/db")
+		loadPoolConfig = func() PoolConfig {
+			return PoolConfig{
+				PingTimeout:          time.Second,
+				ReplicaURLs:          []string{"postgres://u:secret@r1/db", "postgres://u:secret@r2/db"},
+				ReplicaCheckInterval: time.Hour, // checks are driven by the test
+				MaxReplicaLag:        5 * time.Second,
+			}
+		}
+		parsePoolConfig = func(_ string) (*pgxpool.Config, error) {
+			return &pgxpool.Config{ConnConfig: &pgx.ConnConfig{}}, nil
+		}
+		newPoolWithConfig = func(_ context.Context, _ *pgxpool.Config) (*pgxpool.Pool, error) {
+			return &pgxpool.Pool{}, nil
+		}
+
+		down := map[*pgxpool.Pool]bool{}
+		lag := map[*pgxpool.Pool]time.Duration{}
+		poolPing = func(p *pgxpool.Pool, _ context.Context) error {
+			if down[p] {
+				return context.DeadlineExceeded
+			}
+			return nil
+		}
+		replicaLag = func(p *pgxpool.Pool, _ context.Context) (time.Duration, error) { return lag[p], nil }
+		poolClose = func(_ *pgxpool.Pool) {}
+
+		h := NewHandler(true)
+		defer h.Close()
+		So(h.replicas, ShouldHaveLength, 2)
+		r1, r2 := h.replicas[0].pool, h.replicas[1].pool
+		ctx := context.Background()
+
+		Convey("reads alternate between healthy replicas and never hit the primary", func() {
+			seen := map[*pgxpool.Pool]int{}
+			for range 4 {
+				seen[h.Replica(ctx)]++
+			}
+			So(seen[r1], ShouldEqual, 2)
+			So(seen[r2], ShouldEqual, 2)
+			So(seen[h.Primary()], ShouldEqual, 0)
+			So(h.replicas[0].host, ShouldEqual, "r1")
+		})
+
+		Convey("a replica that stops answering or falls behind is skipped", func() {
+			down[r1] = true
+			lag[r2] = time.Minute
+			h.CheckReplicas(ctx)
+			So(h.Replica(ctx), ShouldEqual, h.Primary())
+
+			lag[r2] = time.Second
+			h.CheckReplicas(ctx)
+			So(h.Replica(ctx), ShouldEqual, r2)
+			So(h.Replica(ctx), ShouldEqual, r2)
+		})
+
+		Convey("ReadYourWrites pins reads to the primary", func() {
+			So(WantsPrimary(ctx), ShouldBeFalse)
+			So(h.Replica(ReadYourWrites(ctx)), ShouldEqual, h.Primary())
+		})
+	})
+
+	Convey("Without replicas, Replica is the primary", t, func() {
+		h := &Handler{PgxPool: &pgxpool.Pool{}}
+		So(h.Replica(context.Background()), ShouldEqual, h.PgxPool)
+	})
+}
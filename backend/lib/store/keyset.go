@@ -0,0 +1,169 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+)
+
+// Keyset pagination: instead of OFFSET, each page asks for the rows after the last one it saw,
+// comparing the sort key as a tuple. That stays an index range scan however deep the page is
+
+// SortFields whitelists the sortable fields of a list endpoint: API name -> SQL column. Only
+// these columns ever reach the ORDER BY, so the sort parameter can't inject SQL
+type SortFields map[string]string
+
+// SortColumn is one column of an ORDER BY
+type SortColumn struct {
+	Name   string // API name, as it appears in the sort parameter
+	Column string // SQL column or expression
+	Desc   bool
+}
+
+// ParseSort turns a sort parameter like "-taken_at,title" into columns, a leading '-' meaning
+// descending. An empty spec uses def. The tiebreak field (a unique, NOT NULL column such as the
+// id) is appended when missing, so the order is total and keyset pages neither skip nor repeat
+func (f SortFields) ParseSort(spec, def, tiebreak string) ([]SortColumn, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = def
+	}
+	var cols []SortColumn
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+		col, ok := f[name]
+		if !ok {
+			return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+				fmt.Sprintf("sort must be one of %s", f.names()), "sort")
+		}
+		if seen[name] {
+			return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+				fmt.Sprintf("sort lists %s twice", name), "sort")
+		}
+		seen[name] = true
+		cols = append(cols, SortColumn{Name: name, Column: col, Desc: desc})
+	}
+	if !seen[tiebreak] {
+		col, ok := f[tiebreak]
+		if !ok {
+			col = tiebreak
+		}
+		cols = append(cols, SortColumn{Name: tiebreak, Column: col, Desc: cols[len(cols)-1].Desc})
+	}
+	return cols, nil
+}
+
+// names lists the sortable fields for error messages, sorted for a stable message
+func (f SortFields) names() string {
+	out := make([]string, 0, len(f))
+	for n := range f {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
+
+// SortSpec is the canonical sort parameter for cols, e.g. "-taken_at,-id"
+func SortSpec(cols []SortColumn) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = c.Name
+		if c.Desc {
+			parts[i] = "-" + c.Name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Page is one keyset page request: the sort, the sort key of the last row already seen (nil for
+// the first page) and the page size
+type Page struct {
+	Sort  []SortColumn
+	After []string
+	Limit int
+}
+
+// OrderBy is the ORDER BY list, without the keywords
+func (p Page) OrderBy() string {
+	parts := make([]string, len(p.Sort))
+	for i, c := range p.Sort {
+		parts[i] = c.Column + " ASC"
+		if c.Desc {
+			parts[i] = c.Column + " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Where returns the predicate selecting rows after p.After and its arguments, numbered from
+// $argStart. It is "TRUE" for the first page. When every column sorts the same way it is a row
+// comparison, (a, b) > ($1, $2), which Postgres answers from a matching composite index; mixed
+// directions expand to (a > $1) OR (a = $1 AND b < $2). Sort columns must be NOT NULL.
+// Values are passed as text and cast by Postgres to the column's type
+func (p Page) Where(argStart int) (string, []any, error) {
+	if len(p.After) == 0 {
+		return "TRUE", nil, nil
+	}
+	if len(p.After) != len(p.Sort) {
+		return "", nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+			"cursor does not match the sort", "cursor")
+	}
+
+	args := make([]any, len(p.After))
+	ph := make([]string, len(p.After))
+	for i, v := range p.After {
+		args[i] = v
+		ph[i] = fmt.Sprintf("$%d", argStart+i)
+	}
+
+	uniform := true
+	for _, c := range p.Sort[1:] {
+		uniform = uniform && c.Desc == p.Sort[0].Desc
+	}
+	if uniform {
+		cols := make([]string, len(p.Sort))
+		for i, c := range p.Sort {
+			cols[i] = c.Column
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), cmp(p.Sort[0].Desc),
+			strings.Join(ph, ", ")), args, nil
+	}
+
+	ors := make([]string, len(p.Sort))
+	for i, c := range p.Sort {
+		var ands []string
+		for j := range i {
+			ands = append(ands, fmt.Sprintf("%s = %s", p.Sort[j].Column, ph[j]))
+		}
+		ands = append(ands, fmt.Sprintf("%s %s %s", c.Column, cmp(c.Desc), ph[i]))
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args, nil
+}
+
+// Fetch is the LIMIT to query with: one extra row tells whether there is a next page
+func (p Page) Fetch() int {
+	return p.Limit + 1
+}
+
+// Trim drops the extra row Fetch asked for. When it was there, the last kept row's sort key
+// (key returns it in Sort order, as text) is returned as the next page's After; nil means no
+// next page
+func Trim[T any](p Page, rows []T, key func(T) []string) ([]T, []string) {
+	if len(rows) <= p.Limit {
+		return rows, nil
+	}
+	rows = rows[:p.Limit]
+	return rows, key(rows[len(rows)-1])
+}
+
+func cmp(desc bool) string {
+	if desc {
+		return "<"
+	}
+	return ">"
+}
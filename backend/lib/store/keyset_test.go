@@ -0,0 +1,84 @@
+package store
+
+import (
+	"testing"
+
+	lumErrors "lumium/lib/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyset(t *testing.T) {
+	fields := SortFields{"taken_at": "p.taken_at", "title": "p.title", "id": "p.id"}
+
+	Convey("ParseSort whitelists fields and appends the tiebreak", t, func() {
+		cols, err := fields.ParseSort("-taken_at", "title", "id")
+		So(err, ShouldBeNil)
+		So(cols, ShouldResemble, []SortColumn{
+			{Name: "taken_at", Column: "p.taken_at", Desc: true},
+			{Name: "id", Column: "p.id", Desc: true},
+		})
+		So(SortSpec(cols), ShouldEqual, "-taken_at,-id")
+
+		cols, err = fields.ParseSort("", "title", "id")
+		So(err, ShouldBeNil)
+		So(SortSpec(cols), ShouldEqual, "title,id")
+
+		_, err = fields.ParseSort("taken_at;DROP TABLE photos", "title", "id")
+		So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeValidation), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "sort must be one of id, taken_at, title")
+
+		_, err = fields.ParseSort("title,-title", "title", "id")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given a page sorted one way", t, func() {
+		cols, _ := fields.ParseSort("-taken_at", "", "id")
+		p := Page{Sort: cols, Limit: 2}
+
+		Convey("the first page has no predicate", func() {
+			where, args, err := p.Where(3)
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, "TRUE")
+			So(args, ShouldBeEmpty)
+			So(p.OrderBy(), ShouldEqual, "p.taken_at DESC, p.id DESC")
+			So(p.Fetch(), ShouldEqual, 3)
+		})
+
+		Convey("later pages use a row comparison", func() {
+			p.After = []string{"2026-01-01T00:00:00Z", "abc"}
+			where, args, err := p.Where(3)
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, "(p.taken_at, p.id) < ($3, $4)")
+			So(args, ShouldResemble, []any{"2026-01-01T00:00:00Z", "abc"})
+		})
+
+		Convey("a key of the wrong length is rejected", func() {
+			p.After = []string{"x"}
+			_, _, err := p.Where(1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Mixed directions expand to an OR chain", t, func() {
+		cols, _ := fields.ParseSort("title,-taken_at", "", "id")
+		p := Page{Sort: cols, After: []string{"a", "b", "c"}}
+		where, _, err := p.Where(1)
+		So(err, ShouldBeNil)
+		So(where, ShouldEqual, "((p.title > $1) OR (p.title = $1 AND p.taken_at < $2) OR "+
+			"(p.title = $1 AND p.taken_at = $2 AND p.id < $3))")
+	})
+
+	Convey("Trim drops the probe row and returns the next key", t, func() {
+		p := Page{Limit: 2}
+		key := func(s string) []string { return []string{s} }
+
+		rows, next := Trim(p, []string{"a", "b", "c"}, key)
+		So(rows, ShouldResemble, []string{"a", "b"})
+		So(next, ShouldResemble, []string{"b"})
+
+		rows, next = Trim(p, []string{"a"}, key)
+		So(rows, ShouldResemble, []string{"a"})
+		So(next, ShouldBeNil)
+	})
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"lumium/lib/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	slowQueries = metrics.NewCounterVec("db_slow_queries_total",
+		"Queries slower than the slow-query threshold, by statement keyword", "operation")
+	queryErrors = metrics.NewCounterVec("db_query_errors_total",
+		"Queries that returned an error, by statement keyword", "operation")
+
+	registerPoolsOnce sync.Once
+)
+
+// poolStat is what the collector reads from a pool; *pgxpool.Stat satisfies it
+type poolStat interface {
+	AcquiredConns() int32
+	IdleConns() int32
+	TotalConns() int32
+	MaxConns() int32
+	AcquireCount() int64
+	CanceledAcquireCount() int64
+	EmptyAcquireCount() int64
+	AcquireDuration() time.Duration
+}
+
+// namedStat is one pool's stats and its pool label: "primary" or the replica's host
+type namedStat struct {
+	pool string
+	stat poolStat
+}
+
+func desc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "db_pool", name), help,
+		[]string{"pool"}, nil)
+}
+
+var (
+	poolAcquiredDesc = desc("acquired_conns", "Connections currently checked out")
+	poolIdleDesc     = desc("idle_conns", "Idle connections")
+	poolTotalDesc    = desc("total_conns", "Open connections, acquired, idle or being built")
+	poolMaxDesc      = desc("max_conns", "Pool size limit")
+	poolAcquiresDesc = desc("acquires_total", "Successful connection acquisitions")
+	poolCanceledDesc = desc("canceled_acquires_total", "Acquisitions abandoned because the context ended")
+	poolEmptyDesc    = desc("empty_acquires_total",
+		"Acquisitions that had to wait because no idle connection was free")
+	poolWaitDesc = desc("acquire_duration_seconds_total", "Total time spent acquiring connections")
+)
+
+// poolCollector reads the stats of the handler's pools at scrape time, so they are never stale
+// and cost nothing between scrapes
+type poolCollector struct {
+	h *Handler
+}
+
+// registerPoolMetrics exposes the handler's pools on /metrics. Only the first handler is
+// registered; the process only ever has the singleton
+func registerPoolMetrics(h *Handler) {
+	registerPoolsOnce.Do(func() { metrics.MustRegister(poolCollector{h: h}) })
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		poolAcquiredDesc, poolIdleDesc, poolTotalDesc, poolMaxDesc,
+		poolAcquiresDesc, poolCanceledDesc, poolEmptyDesc, poolWaitDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range poolStats(c.h) {
+		gauge := func(d *prometheus.Desc, v int32) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, float64(v), s.pool)
+		}
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, s.pool)
+		}
+		gauge(poolAcquiredDesc, s.stat.AcquiredConns())
+		gauge(poolIdleDesc, s.stat.IdleConns())
+		gauge(poolTotalDesc, s.stat.TotalConns())
+		gauge(poolMaxDesc, s.stat.MaxConns())
+		counter(poolAcquiresDesc, float64(s.stat.AcquireCount()))
+		counter(poolCanceledDesc, float64(s.stat.CanceledAcquireCount()))
+		counter(poolEmptyDesc, float64(s.stat.EmptyAcquireCount()))
+		counter(poolWaitDesc, s.stat.AcquireDuration().Seconds())
+	}
+}
+
+// poolStats is a seam so tests can collect without a database
+var poolStats = func(h *Handler) []namedStat {
+	var out []namedStat
+	if p := h.PgxPool; p != nil {
+		out = append(out, namedStat{pool: "primary", stat: p.Stat()})
+	}
+	for _, r := range h.replicas {
+		out = append(out, namedStat{pool: r.host, stat: r.pool.Stat()})
+	}
+	return out
+}
+
+var _ poolStat = (*pgxpool.Stat)(nil)
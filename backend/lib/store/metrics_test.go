@@ -0,0 +1,66 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeStat struct{ acquired, idle, total, max int32 }
+
+func (f fakeStat) AcquiredConns() int32           { return f.acquired }
+func (f fakeStat) IdleConns() int32               { return f.idle }
+func (f fakeStat) TotalConns() int32              { return f.total }
+func (f fakeStat) MaxConns() int32                { return f.max }
+func (f fakeStat) AcquireCount() int64            { return 7 }
+func (f fakeStat) CanceledAcquireCount() int64    { return 1 }
+func (f fakeStat) EmptyAcquireCount() int64       { return 2 }
+func (f fakeStat) AcquireDuration() time.Duration { return 1500 * time.Millisecond }
+
+func TestPoolCollector(t *testing.T) {
+	Convey("The pool collector reports every pool under its own label", t, func() {
+		prev := poolStats
+		defer func() { poolStats = prev }()
+		poolStats = func(*Handler) []namedStat {
+			return []namedStat{
+				{pool: "primary", stat: fakeStat{acquired: 3, idle: 2, total: 5, max: 10}},
+				{pool: "replica-1:5432", stat: fakeStat{total: 1, max: 4}},
+			}
+		}
+
+		reg := prometheus.NewRegistry()
+		So(reg.Register(poolCollector{h: &Handler{}}), ShouldBeNil)
+		families, err := reg.Gather()
+		So(err, ShouldBeNil)
+
+		byName := map[string]*dto.MetricFamily{}
+		for _, f := range families {
+			byName[f.GetName()] = f
+		}
+		So(byName, ShouldContainKey, "lumium_db_pool_acquired_conns")
+		So(byName, ShouldContainKey, "lumium_db_pool_acquire_duration_seconds_total")
+
+		value := func(name, pool string) float64 {
+			for _, m := range byName[name].GetMetric() {
+				if m.GetLabel()[0].GetValue() == pool {
+					if m.GetGauge() != nil {
+						return m.GetGauge().GetValue()
+					}
+					return m.GetCounter().GetValue()
+				}
+			}
+			return -1
+		}
+		So(value("lumium_db_pool_acquired_conns", "primary"), ShouldEqual, 3)
+		So(value("lumium_db_pool_max_conns", "replica-1:5432"), ShouldEqual, 4)
+		So(value("lumium_db_pool_acquires_total", "primary"), ShouldEqual, 7)
+		So(value("lumium_db_pool_acquire_duration_seconds_total", "primary"), ShouldEqual, 1.5)
+	})
+
+	Convey("A handler without pools collects nothing", t, func() {
+		So(poolStats(&Handler{}), ShouldBeEmpty)
+	})
+}
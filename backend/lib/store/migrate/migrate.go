@@ -0,0 +1,457 @@
+// Package migrate applies ordered, versioned SQL migrations and records them in a
+// schema_migrations table. Runs are serialized with a Postgres advisory lock, so every replica
+// can migrate on start: the first one applies, the rest wait and find nothing pending
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lumium/lib/logger"
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultLockID is the advisory lock key used when Options.LockID is zero
+const DefaultLockID int64 = 7_140_031
+
+// noTxDirective on the first line of an up/down file runs it outside a transaction, for
+// statements like CREATE INDEX CONCURRENTLY
+const noTxDirective = "-- migrate:no-transaction"
+
+var fileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string // empty if the migration is irreversible
+	Checksum string // sha256 of Up
+}
+
+// Status describes a migration as seen in the files and the database
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied, but the file no longer matches what ran
+	Missing   bool // applied, but no file exists for it
+}
+
+// Baseline lets a database created before migrations existed be adopted: if schema_migrations
+// is empty and Table exists, versions up to Version are recorded as applied without running
+type Baseline struct {
+	Version int64
+	Table   string
+}
+
+// Options tune a Migrator
+type Options struct {
+	// DryRun reports what Up/Down would do without changing anything
+	DryRun bool
+
+	// LockID is the advisory lock key; defaults to DefaultLockID
+	LockID int64
+
+	// Baseline adopts pre-existing schemas, see Baseline
+	Baseline *Baseline
+}
+
+// Conn is a single database connection. It must not be a pool: the advisory lock is held by the
+// session that took it
+type Conn interface {
+	store.Queryer
+	store.Beginner
+}
+
+// Migrator applies one migration set
+type Migrator struct {
+	migrations []Migration
+	opts       Options
+}
+
+// New loads the migrations in fsys
+func New(fsys fs.FS, opts Options) (*Migrator, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if opts.LockID == 0 {
+		opts.LockID = DefaultLockID
+	}
+	return &Migrator{migrations: ms, opts: opts}, nil
+}
+
+// Run applies every pending migration using a connection from the pool
+func Run(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts Options) error {
+	m, err := New(fsys, opts)
+	if err != nil {
+		return err
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	_, err = m.Up(ctx, conn)
+	return err
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql files from the root of fsys, ordered by
+// version. Every version needs an up file; down files are optional
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		parts := fileRe.FindStringSubmatch(e.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migrate: %s: want NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+		}
+		v, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migrate: %s: version must be a positive integer", e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", e.Name(), err)
+		}
+
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: parts[2]}
+			byVersion[v] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by both %q and %q", v, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migrate: version %d (%s) has no up migration", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Migrations returns the loaded migration set
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies pending migrations in order, each in its own transaction, and returns them. With
+// DryRun it returns what would be applied. An applied migration whose file changed, or a pending
+// one older than the newest applied, is an error: both mean databases would diverge
+func (m *Migrator) Up(ctx context.Context, c Conn) ([]Migration, error) {
+	unlock, err := m.lock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	adopted, err := m.prepare(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, mg := range adopted {
+		applied[mg.Version] = appliedRow{name: mg.Name, checksum: mg.Checksum} // only new in dry runs
+	}
+
+	var latest int64
+	for v := range applied {
+		latest = max(latest, v)
+	}
+
+	var pending []Migration
+	for _, mg := range m.migrations {
+		rec, ok := applied[mg.Version]
+		switch {
+		case ok && rec.checksum != mg.Checksum:
+			return nil, fmt.Errorf("migrate: %04d_%s was modified after it was applied", mg.Version, mg.Name)
+		case ok:
+			continue
+		case mg.Version < latest:
+			return nil, fmt.Errorf(
+				"migrate: %04d_%s is older than applied version %d; renumber it", mg.Version, mg.Name, latest)
+		}
+		pending = append(pending, mg)
+	}
+
+	l := logger.Get()
+	for _, mg := range pending {
+		if m.opts.DryRun {
+			l.Info().Int64("version", mg.Version).Str("name", mg.Name).Msg("migrate: would apply")
+			continue
+		}
+		start := time.Now()
+		if err := m.exec(ctx, c, mg.Up, func(q store.Queryer) error {
+			_, err := q.Exec(ctx,
+				`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				mg.Version, mg.Name, mg.Checksum)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("migrate: apply %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		l.Info().
+			Int64("version", mg.Version).
+			Str("name", mg.Name).
+			Dur("took", time.Since(start)).
+			Msg("migrate: applied")
+	}
+	return pending, nil
+}
+
+// Down reverts the newest steps applied migrations and returns them, newest first
+func (m *Migrator) Down(ctx context.Context, c Conn, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, nil
+	}
+	unlock, err := m.lock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := m.prepare(ctx, c); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if _, ok := applied[m.migrations[i].Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(m.migrations[i].Down) == "" {
+			return reverted, fmt.Errorf("migrate: %04d_%s is irreversible", m.migrations[i].Version, m.migrations[i].Name)
+		}
+		reverted = append(reverted, m.migrations[i])
+	}
+
+	l := logger.Get()
+	for _, mg := range reverted {
+		if m.opts.DryRun {
+			l.Info().Int64("version", mg.Version).Str("name", mg.Name).Msg("migrate: would revert")
+			continue
+		}
+		if err := m.exec(ctx, c, mg.Down, func(q store.Queryer) error {
+			_, err := q.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mg.Version)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("migrate: revert %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		l.Info().Int64("version", mg.Version).Str("name", mg.Name).Msg("migrate: reverted")
+	}
+	return reverted, nil
+}
+
+// Status lists every known migration, plus applied versions with no file, ordered by version.
+// It only reads: a database without schema_migrations reports everything pending
+func (m *Migrator) Status(ctx context.Context, c Conn) ([]Status, error) {
+	exists, err := tableExists(ctx, c, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int64]appliedRow{}
+	if exists {
+		if applied, err = m.applied(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if rec, ok := applied[mg.Version]; ok {
+			s.Applied, s.AppliedAt, s.Modified = true, rec.appliedAt, rec.checksum != mg.Checksum
+			delete(applied, mg.Version)
+		}
+		out = append(out, s)
+	}
+	for v, rec := range applied {
+		out = append(out, Status{Version: v, Name: rec.name, Applied: true, AppliedAt: rec.appliedAt, Missing: true})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// lock takes the advisory lock, waiting for any other runner to finish
+func (m *Migrator) lock(ctx context.Context, c Conn) (func(), error) {
+	if _, err := c.Exec(ctx, `SELECT pg_advisory_lock($1)`, m.opts.LockID); err != nil {
+		return nil, fmt.Errorf("migrate: advisory lock: %w", err)
+	}
+	return func() {
+		// a fresh context: the caller's may be cancelled, and a leaked session lock blocks every replica
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = c.Exec(ctx, `SELECT pg_advisory_unlock($1)`, m.opts.LockID)
+	}, nil
+}
+
+// prepare creates schema_migrations and adopts a baseline schema, returning the adopted
+// migrations. Dry runs only read
+func (m *Migrator) prepare(ctx context.Context, c Conn) ([]Migration, error) {
+	exists, err := tableExists(ctx, c, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if m.opts.DryRun {
+		if !exists {
+			return m.adoptBaseline(ctx, c, nil)
+		}
+		return nil, nil
+	}
+
+	if !exists {
+		if _, err := c.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			checksum   TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+			return nil, fmt.Errorf("migrate: create schema_migrations: %w", err)
+		}
+	}
+
+	var n int
+	if err := c.QueryRow(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&n); err != nil {
+		return nil, fmt.Errorf("migrate: count schema_migrations: %w", err)
+	}
+	if n > 0 {
+		return nil, nil
+	}
+	return m.adoptBaseline(ctx, c, c)
+}
+
+// adoptBaseline records baseline versions as applied when the baseline table already exists.
+// A nil q only logs
+func (m *Migrator) adoptBaseline(ctx context.Context, c Conn, q store.Queryer) ([]Migration, error) {
+	b := m.opts.Baseline
+	if b == nil {
+		return nil, nil
+	}
+	exists, err := tableExists(ctx, c, b.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	l := logger.Get()
+	var adopted []Migration
+	for _, mg := range m.migrations {
+		if mg.Version > b.Version {
+			break
+		}
+		adopted = append(adopted, mg)
+		if q == nil {
+			l.Info().Int64("version", mg.Version).Str("name", mg.Name).Msg("migrate: would adopt baseline")
+			continue
+		}
+		if _, err := q.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			mg.Version, mg.Name, mg.Checksum); err != nil {
+			return nil, fmt.Errorf("migrate: adopt baseline: %w", err)
+		}
+		l.Info().Int64("version", mg.Version).Str("name", mg.Name).Msg("migrate: adopted existing schema")
+	}
+	return adopted, nil
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// applied reads schema_migrations keyed by version
+func (m *Migrator) applied(ctx context.Context, c Conn) (map[int64]appliedRow, error) {
+	out := map[int64]appliedRow{}
+	if m.opts.DryRun {
+		if ok, err := tableExists(ctx, c, "schema_migrations"); err != nil || !ok {
+			return out, err
+		}
+	}
+
+	rows, err := c.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			v   int64
+			rec appliedRow
+		)
+		if err := rows.Scan(&v, &rec.name, &rec.checksum, &rec.appliedAt); err != nil {
+			return nil, fmt.Errorf("migrate: read schema_migrations: %w", err)
+		}
+		out[v] = rec
+	}
+	return out, rows.Err()
+}
+
+// exec runs sql and then record, in one transaction unless sql opts out
+func (m *Migrator) exec(ctx context.Context, c Conn, sql string, record func(q store.Queryer) error) error {
+	if strings.HasPrefix(strings.TrimSpace(sql), noTxDirective) {
+		if _, err := c.Exec(ctx, sql); err != nil {
+			return err
+		}
+		return record(c)
+	}
+	return store.WithTx(ctx, c, func(q store.Queryer) error {
+		if _, err := q.Exec(ctx, sql); err != nil {
+			return err
+		}
+		return record(q)
+	})
+}
+
+func tableExists(ctx context.Context, q store.Queryer, name string) (bool, error) {
+	var ok bool
+	if err := q.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&ok); err != nil {
+		return false, fmt.Errorf("migrate: look up %s: %w", name, err)
+	}
+	return ok, nil
+}
+
+// compile-time checks that a single connection can drive a Migrator
+var (
+	_ Conn = (*pgxpool.Conn)(nil)
+	_ Conn = (*pgx.Conn)(nil)
+)
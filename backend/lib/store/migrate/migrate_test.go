@@ -0,0 +1,306 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeRecord struct {
+	name, checksum string
+	at             time.Time
+}
+
+// fakeConn is just enough of Postgres to drive a Migrator: a table registry, schema_migrations
+// rows and a log of the migration SQL that ran. SQL containing FAIL errors
+type fakeConn struct {
+	tables  map[string]bool
+	records map[int64]fakeRecord
+	ran     []string
+	locks   int
+	unlocks int
+}
+
+func newFakeConn(tables ...string) *fakeConn {
+	c := &fakeConn{tables: map[string]bool{}, records: map[int64]fakeRecord{}}
+	for _, t := range tables {
+		c.tables[t] = true
+	}
+	return c
+}
+
+func (c *fakeConn) exec(sql string, args ...any) error {
+	switch {
+	case strings.Contains(sql, "FAIL"):
+		return errors.New("syntax error")
+	case strings.Contains(sql, "pg_advisory_lock"):
+		c.locks++
+	case strings.Contains(sql, "pg_advisory_unlock"):
+		c.unlocks++
+	case strings.Contains(sql, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		c.tables["schema_migrations"] = true
+	case strings.HasPrefix(sql, "INSERT INTO schema_migrations"):
+		c.records[args[0].(int64)] = fakeRecord{name: args[1].(string), checksum: args[2].(string), at: time.Now()}
+	case strings.HasPrefix(sql, "DELETE FROM schema_migrations"):
+		delete(c.records, args[0].(int64))
+	default:
+		c.ran = append(c.ran, strings.TrimSpace(sql))
+	}
+	return nil
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, c.exec(sql, args...)
+}
+
+func (c *fakeConn) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "to_regclass"):
+		return fakeRow{c.tables[args[0].(string)]}
+	case strings.Contains(sql, "COUNT(*)"):
+		return fakeRow{len(c.records)}
+	}
+	return fakeRow{errors.New("unexpected query")}
+}
+
+func (c *fakeConn) Query(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+	r := &fakeRows{i: -1}
+	for v, rec := range c.records {
+		r.versions = append(r.versions, v)
+		r.recs = append(r.recs, rec)
+	}
+	return r, nil
+}
+
+func (c *fakeConn) Begin(_ context.Context) (pgx.Tx, error) {
+	return &fakeTx{c: c}, nil
+}
+
+// fakeTx buffers statements until Commit
+type fakeTx struct {
+	pgx.Tx
+	c   *fakeConn
+	ops []func()
+}
+
+func (t *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "FAIL") {
+		return pgconn.CommandTag{}, errors.New("syntax error")
+	}
+	t.ops = append(t.ops, func() { _ = t.c.exec(sql, args...) })
+	return pgconn.CommandTag{}, nil
+}
+
+func (t *fakeTx) Commit(_ context.Context) error {
+	for _, op := range t.ops {
+		op()
+	}
+	t.ops = nil
+	return nil
+}
+
+func (t *fakeTx) Rollback(_ context.Context) error {
+	t.ops = nil
+	return nil
+}
+
+type fakeRow struct{ v any }
+
+func (r fakeRow) Scan(dest ...any) error {
+	switch v := r.v.(type) {
+	case error:
+		return v
+	case bool:
+		*dest[0].(*bool) = v
+	case int:
+		*dest[0].(*int) = v
+	}
+	return nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+	versions []int64
+	recs     []fakeRecord
+	i        int
+}
+
+func (r *fakeRows) Next() bool { r.i++; return r.i < len(r.versions) }
+func (r *fakeRows) Close()     {}
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Scan(dest ...any) error {
+	*dest[0].(*int64) = r.versions[r.i]
+	*dest[1].(*string) = r.recs[r.i].name
+	*dest[2].(*string) = r.recs[r.i].checksum
+	*dest[3].(*time.Time) = r.recs[r.i].at
+	return nil
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_baseline.up.sql":   {Data: []byte("CREATE TABLE tenants ();")},
+		"0001_baseline.down.sql": {Data: []byte("DROP TABLE tenants;")},
+		"0002_albums.up.sql":     {Data: []byte("CREATE TABLE albums ();")},
+		"0002_albums.down.sql":   {Data: []byte("DROP TABLE albums;")},
+		"0010_index.up.sql":      {Data: []byte("-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY i ON albums (id);")},
+		"README.md":              {Data: []byte("ignored")},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Load orders migrations by version and pairs up/down files", t, func() {
+		ms, err := Load(testFS())
+		So(err, ShouldBeNil)
+		So(ms, ShouldHaveLength, 3)
+		So(ms[0].Version, ShouldEqual, 1)
+		So(ms[0].Down, ShouldEqual, "DROP TABLE tenants;")
+		So(ms[2].Version, ShouldEqual, 10)
+		So(ms[2].Down, ShouldBeEmpty)
+		So(ms[0].Checksum, ShouldHaveLength, 64)
+	})
+
+	Convey("Load rejects malformed sets", t, func() {
+		_, err := Load(fstest.MapFS{"1-init.sql": {Data: []byte("x")}})
+		So(err, ShouldNotBeNil)
+
+		_, err = Load(fstest.MapFS{"0001_init.down.sql": {Data: []byte("x")}})
+		So(err.Error(), ShouldContainSubstring, "no up migration")
+
+		_, err = Load(fstest.MapFS{
+			"0001_a.up.sql": {Data: []byte("x")},
+			"0001_b.up.sql": {Data: []byte("y")},
+		})
+		So(err.Error(), ShouldContainSubstring, "used by both")
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Given an empty database", t, func() {
+		c := newFakeConn()
+		m, err := New(testFS(), Options{})
+		So(err, ShouldBeNil)
+
+		Convey("Up applies everything in order under the advisory lock", func() {
+			applied, err := m.Up(ctx, c)
+			So(err, ShouldBeNil)
+			So(applied, ShouldHaveLength, 3)
+			So(c.ran[0], ShouldEqual, "CREATE TABLE tenants ();")
+			So(c.ran[1], ShouldEqual, "CREATE TABLE albums ();")
+			So(c.records, ShouldHaveLength, 3)
+			So(c.locks, ShouldEqual, 1)
+			So(c.unlocks, ShouldEqual, 1)
+
+			Convey("and a second run finds nothing pending", func() {
+				applied, err := m.Up(ctx, c)
+				So(err, ShouldBeNil)
+				So(applied, ShouldBeEmpty)
+			})
+
+			Convey("Down reverts the newest reversible steps", func() {
+				c.records[10] = fakeRecord{name: "index", checksum: m.migrations[2].Checksum}
+				_, err := m.Down(ctx, c, 1)
+				So(err.Error(), ShouldContainSubstring, "irreversible")
+
+				delete(c.records, 10)
+				reverted, err := m.Down(ctx, c, 1)
+				So(err, ShouldBeNil)
+				So(reverted, ShouldHaveLength, 1)
+				So(reverted[0].Version, ShouldEqual, 2)
+				So(c.records, ShouldNotContainKey, int64(2))
+				So(c.ran[len(c.ran)-1], ShouldEqual, "DROP TABLE albums;")
+			})
+
+			Convey("Up refuses a migration edited after it ran", func() {
+				rec := c.records[1]
+				rec.checksum = "stale"
+				c.records[1] = rec
+				_, err := m.Up(ctx, c)
+				So(err.Error(), ShouldContainSubstring, "modified after it was applied")
+			})
+		})
+
+		Convey("a failing migration stops the run and is not recorded", func() {
+			fsys := testFS()
+			fsys["0002_albums.up.sql"] = &fstest.MapFile{Data: []byte("FAIL")}
+			m, _ := New(fsys, Options{})
+
+			_, err := m.Up(ctx, c)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "0002_albums")
+			So(c.records, ShouldContainKey, int64(1))
+			So(c.records, ShouldNotContainKey, int64(2))
+			So(c.records, ShouldNotContainKey, int64(10))
+			So(c.unlocks, ShouldEqual, 1)
+		})
+
+		Convey("DryRun reports the plan without touching the database", func() {
+			m, _ := New(testFS(), Options{DryRun: true})
+			planned, err := m.Up(ctx, c)
+			So(err, ShouldBeNil)
+			So(planned, ShouldHaveLength, 3)
+			So(c.ran, ShouldBeEmpty)
+			So(c.tables, ShouldNotContainKey, "schema_migrations")
+		})
+
+		Convey("Status reports everything pending", func() {
+			st, err := m.Status(ctx, c)
+			So(err, ShouldBeNil)
+			So(st, ShouldHaveLength, 3)
+			So(st[0].Applied, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a database created before migrations existed", t, func() {
+		c := newFakeConn("tenants")
+		m, _ := New(testFS(), Options{Baseline: &Baseline{Version: 1, Table: "tenants"}})
+
+		Convey("the baseline is adopted, not re-run", func() {
+			applied, err := m.Up(ctx, c)
+			So(err, ShouldBeNil)
+			So(applied, ShouldHaveLength, 2)
+			So(c.ran[0], ShouldEqual, "CREATE TABLE albums ();")
+			So(c.records, ShouldContainKey, int64(1))
+		})
+
+		Convey("a dry run plans the same", func() {
+			m.opts.DryRun = true
+			planned, err := m.Up(ctx, c)
+			So(err, ShouldBeNil)
+			So(planned, ShouldHaveLength, 2)
+			So(planned[0].Version, ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given applied versions ahead of a pending one", t, func() {
+		c := newFakeConn()
+		m, _ := New(testFS(), Options{})
+		c.tables["schema_migrations"] = true
+		c.records[1] = fakeRecord{name: "baseline", checksum: m.migrations[0].Checksum}
+		c.records[10] = fakeRecord{name: "index", checksum: m.migrations[2].Checksum}
+		c.records[99] = fakeRecord{name: "gone"}
+
+		Convey("Up refuses to apply out of order", func() {
+			_, err := m.Up(ctx, c)
+			So(err.Error(), ShouldContainSubstring, "renumber")
+		})
+
+		Convey("Status shows the gap and the missing file", func() {
+			st, err := m.Status(ctx, c)
+			So(err, ShouldBeNil)
+			So(st, ShouldHaveLength, 4)
+			So(st[1].Applied, ShouldBeFalse)
+			So(st[3].Version, ShouldEqual, 99)
+			So(st[3].Missing, ShouldBeTrue)
+		})
+	})
+}
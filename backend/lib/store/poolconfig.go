@@ -0,0 +1,39 @@
+package store
+
+import (
+	"time"
+
+	"lumium/lib/config"
+)
+
+// PoolConfig tunes the pgx pools and the startup connection retries
+type PoolConfig struct {
+	MinConns          int32         `env:"SERVICE_PGSQL_MIN_CONNS" default:"0"`
+	MaxConns          int32         `env:"SERVICE_PGSQL_MAX_CONNS" default:"10"`
+	MaxConnLifetime   time.Duration `env:"SERVICE_PGSQL_MAX_CONN_LIFETIME" default:"30m"`
+	MaxConnIdleTime   time.Duration `env:"SERVICE_PGSQL_MAX_CONN_IDLE_TIME" default:"15m"`
+	HealthCheckPeriod time.Duration `env:"SERVICE_PGSQL_HEALTH_CHECK_PERIOD" default:"1m"`
+
+	// startup: ping with PingTimeout, retrying MaxRetries times with capped exponential backoff
+	PingTimeout time.Duration `env:"SERVICE_PGSQL_PING_TIMEOUT" default:"5s"`
+	MaxRetries  int           `env:"SERVICE_PGSQL_CONNECT_RETRIES" default:"8"`
+	BaseBackoff time.Duration `env:"SERVICE_PGSQL_RETRY_BACKOFF" default:"500ms"`
+	MaxBackoff  time.Duration `env:"SERVICE_PGSQL_RETRY_MAX_BACKOFF" default:"10s"`
+
+	// ReplicaURLs are optional read replica DSNs, checked every ReplicaCheckInterval. A replica
+	// that fails its ping or lags the primary by more than MaxReplicaLag (0 = no limit) is
+	// skipped until it recovers
+	ReplicaURLs          []string      `env:"SERVICE_PGSQL_REPLICA_URLS"`
+	ReplicaCheckInterval time.Duration `env:"SERVICE_PGSQL_REPLICA_CHECK_INTERVAL" default:"5s"`
+	MaxReplicaLag        time.Duration `env:"SERVICE_PGSQL_REPLICA_MAX_LAG" default:"10s"`
+
+	// TenantRole is the role without BYPASSRLS that tenant transactions switch to; empty disables it
+	TenantRole string `env:"SERVICE_PGSQL_TENANT_ROLE" default:"lumiumapp"`
+}
+
+// LoadPoolConfig reads the pool settings; a malformed one stops startup
+func LoadPoolConfig() PoolConfig {
+	var c PoolConfig
+	config.MustLoad(&c)
+	return c
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+)
+
+// defaultRedactColumns are the column name fragments whose bound values never reach the query
+// log: password_hash, refresh_token_hash, code_hash, totp secrets, ...
+var defaultRedactColumns = []string{"password", "secret", "token", "hash"}
+
+// defaultRedactPatterns mask credentials whatever column they are bound to
+var defaultRedactPatterns = []string{
+	`^eyJ[\w-]+\.[\w-]+\.[\w-]*$`, // JWTs
+	`^\$argon2`,                   // password hashes
+	`(?i)^bearer\s`,
+}
+
+// maxRedactCache caps the statements whose bindings are remembered; past it they are parsed
+// on every query, so ad-hoc SQL can't grow the cache without bound
+const maxRedactCache = 1024
+
+// redactor masks query args before they are logged
+type redactor struct {
+	columns  []string
+	patterns []*regexp.Regexp
+
+	mu        sync.Mutex
+	sensitive map[string]map[int]bool // by statement: the arg indexes bound to sensitive columns
+}
+
+// newRedactor masks args bound to a column whose name contains one of columns, and string
+// args matching one of patterns, on top of the defaults. Invalid patterns are logged and skipped
+func newRedactor(columns, patterns []string) *redactor {
+	r := &redactor{sensitive: map[string]map[int]bool{}}
+	for _, c := range append(append([]string{}, defaultRedactColumns...), columns...) {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			r.columns = append(r.columns, c)
+		}
+	}
+	for _, p := range append(append([]string{}, defaultRedactPatterns...), patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			l := logger.Get()
+			l.Warn().Err(err).Str("pattern", p).Msg("Invalid redaction pattern; skipping it")
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+// redactorFromEnv adds LOG_REDACT_COLUMNS and LOG_REDACT_PATTERNS, both comma-separated, to
+// the defaults
+func redactorFromEnv() *redactor {
+	return newRedactor(config.MayList("LOG_REDACT_COLUMNS"), config.MayList("LOG_REDACT_PATTERNS"))
+}
+
+// args returns a copy of args fit for the log: values bound to sensitive columns, or matching
+// a pattern, read config.Redacted. NULLs are kept, since they say the value was absent
+func (r *redactor) args(sql string, args []any) []any {
+	if len(args) == 0 {
+		return args
+	}
+	sensitive := r.sensitiveArgs(sql)
+	out := make([]any, len(args))
+	for i, v := range args {
+		switch {
+		case v == nil:
+		case sensitive[i] || r.matches(v):
+			v = config.Redacted
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// sensitiveArgs returns the indexes of sql's args bound to sensitive columns
+func (r *redactor) sensitiveArgs(sql string) map[int]bool {
+	r.mu.Lock()
+	s, ok := r.sensitive[sql]
+	r.mu.Unlock()
+	if ok {
+		return s
+	}
+	s = map[int]bool{}
+	for n, cols := range boundColumns(sql) {
+		for _, col := range cols {
+			if r.sensitiveColumn(col) {
+				s[n-1] = true
+			}
+		}
+	}
+	r.mu.Lock()
+	if len(r.sensitive) < maxRedactCache {
+		r.sensitive[sql] = s
+	}
+	r.mu.Unlock()
+	return s
+}
+
+func (r *redactor) sensitiveColumn(col string) bool {
+	for _, c := range r.columns {
+		if strings.Contains(col, c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) matches(v any) bool {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return false
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// col = $1, t.col <> LOWER($1), col::text = $1
+	columnThenArg = regexp.MustCompile(
+		`([a-z_][a-z0-9_]*)(?:::[a-z]+)?\s*(?:=|<>|!=|\blike\b|\bilike\b)\s*(?:[a-z_]+\()?\$(\d+)`)
+	// $1 = col, $1 = t.col
+	argThenColumn = regexp.MustCompile(`\$(\d+)(?:::[a-z]+)?\s*(?:=|<>|!=)\s*(?:[a-z_]+\.)?([a-z_][a-z0-9_]*)`)
+	insertColumns = regexp.MustCompile(`insert\s+into\s+[a-z0-9_."]+\s*\(([^)]*)\)\s*values\s*`)
+	argRef        = regexp.MustCompile(`\$(\d+)`)
+	sqlComment    = regexp.MustCompile(`--[^\n]*`)
+)
+
+// boundColumns maps the $N placeholders of sql to the columns each is compared with, assigned
+// to or inserted into, as far as a quick read of the statement tells. A placeholder it can't
+// place isn't listed; such args still go through the patterns
+func boundColumns(sql string) map[int][]string {
+	sql = strings.ToLower(sqlComment.ReplaceAllString(sql, ""))
+	out := map[int][]string{}
+	for _, m := range columnThenArg.FindAllStringSubmatch(sql, -1) {
+		bind(out, m[2], m[1])
+	}
+	for _, m := range argThenColumn.FindAllStringSubmatch(sql, -1) {
+		bind(out, m[1], m[2])
+	}
+	for _, loc := range insertColumns.FindAllStringSubmatchIndex(sql, -1) {
+		cols := strings.Split(sql[loc[2]:loc[3]], ",")
+		rest := sql[loc[1]:]
+		// every row of a multi-row VALUES lines up with the same columns
+		for strings.HasPrefix(rest, "(") {
+			tuple, after := enclosed(rest)
+			for i, expr := range splitTopLevel(tuple) {
+				if i >= len(cols) {
+					break
+				}
+				for _, m := range argRef.FindAllStringSubmatch(expr, -1) {
+					bind(out, m[1], strings.Trim(strings.TrimSpace(cols[i]), `"`))
+				}
+			}
+			rest = strings.TrimLeft(strings.TrimPrefix(strings.TrimSpace(after), ","), " \t\n")
+		}
+	}
+	return out
+}
+
+func bind(out map[int][]string, n, col string) {
+	if i, err := strconv.Atoi(n); err == nil && i > 0 {
+		out[i] = append(out[i], col)
+	}
+}
+
+// enclosed splits s, which starts with "(", into what its parentheses hold and what follows
+func enclosed(s string) (inner, rest string) {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s[1:i], s[i+1:]
+			}
+		}
+	}
+	return s[1:], ""
+}
+
+// splitTopLevel splits s at the commas outside parentheses and quotes
+func splitTopLevel(s string) []string {
+	var (
+		out   []string
+		depth int
+		quote bool
+		start int
+	)
+	for i, c := range s {
+		switch {
+		case c == '\'':
+			quote = !quote
+		case quote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestBoundColumns tests placing $N placeholders against columns
+func TestBoundColumns(t *testing.T) {
+	Convey("Comparisons, assignments and inserts bind placeholders to columns", t, func() {
+		So(boundColumns(`SELECT id FROM users WHERE email = LOWER($1) AND u.tenant_id::text=$2`),
+			ShouldResemble, map[int][]string{1: {"email"}, 2: {"tenant_id"}})
+		So(boundColumns(`UPDATE c SET attempts = CASE WHEN $2 = code_hash THEN 1 END WHERE id=$1`),
+			ShouldResemble, map[int][]string{1: {"id"}, 2: {"code_hash"}})
+		So(boundColumns(`
+			INSERT INTO auth_sessions (user_id, tenant_id, refresh_token_hash, expires_at)
+			VALUES (
+				$1,
+				NULLIF($2, '')::uuid, -- cast, then (a comment, with commas)
+				$3,
+				NOW() + ($4::bigint * interval '1 second')
+			)`),
+			ShouldResemble, map[int][]string{1: {"user_id"}, 2: {"tenant_id"}, 3: {"refresh_token_hash"},
+				4: {"expires_at"}})
+		So(boundColumns(`INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)`),
+			ShouldResemble, map[int][]string{1: {"a"}, 2: {"b"}, 3: {"a"}, 4: {"b"}})
+	})
+}
+
+// TestRedactArgs tests masking query args for the log
+func TestRedactArgs(t *testing.T) {
+	Convey("Args bound to sensitive columns or matching a pattern are masked, in a copy", t, func() {
+		r := newRedactor([]string{"phone"}, []string{`^sk_live_`, `(`})
+		args := []any{"u1", []byte("h4sh"), nil, "eyJhbGciOi.eyJzdWIi.c2ln", "sk_live_123", "+15551234567"}
+		out := r.args(`INSERT INTO x (user_id, password_hash, secret, note, key, phone)
+			VALUES ($1, $2, $3, $4, $5, $6)`, args)
+		So(out, ShouldResemble, []any{"u1", config.Redacted, nil, config.Redacted, config.Redacted, config.Redacted})
+		So(args[1], ShouldResemble, []byte("h4sh"))
+	})
+}
+
+// TestTraceQueryRedaction tests the tracer logs redacted args, to the request's logger
+func TestTraceQueryRedaction(t *testing.T) {
+	Convey("The query log masks secrets, leaves the caller's args alone and carries the request", t, func() {
+		tr, _ := newTracerWithBuffer()
+		var buf bytes.Buffer
+		rl := zerolog.New(&buf).With().Str("request_id", "r1").Logger()
+		ctx := logger.WithContext(context.Background(), &rl)
+
+		args := []any{"a@b.c", "$argon2id$v=19$m=65536"}
+		ctx = tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+			SQL:  "UPDATE users SET password_hash = $2 WHERE email = $1",
+			Args: args,
+		})
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+		So(buf.String(), ShouldContainSubstring, `"request_id":"r1"`)
+		So(buf.String(), ShouldContainSubstring, `"args":["a@b.c","[redacted]"]`)
+		So(buf.String(), ShouldNotContainSubstring, "argon2")
+		So(args[1], ShouldEqual, "$argon2id$v=19$m=65536")
+	})
+}
@@ -5,18 +5,27 @@ import (
 	"strings"
 	"time"
 
+	"lumium/lib/logger"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
 	dbQueryTracer struct {
-		log zerolog.Logger
+		log     zerolog.Logger
+		redact  *redactor
+		sampler zerolog.Sampler // for the debug line of every query; see logger.DebugSampler
 	}
 	traceQueryData struct {
 		start time.Time
 		sql   string
 		args  []any
+		span  trace.Span
 	}
 	traceKey struct{}
 )
@@ -25,24 +34,44 @@ const (
 	maxSQLLen   = 4000                   // truncate long statements
 	maxArgsShow = 50                     // cap args logged
 	slowThresh  = 500 * time.Millisecond // half a second query time, seems reasonable
+
+	tracerName = "lumium/lib/store"
 )
 
-// TraceQueryStart adds debugging information to the context
+// newQueryTracer logs to l, or to the request's logger when the query runs for one
+func newQueryTracer(l zerolog.Logger) *dbQueryTracer {
+	return &dbQueryTracer{log: l, redact: redactorFromEnv(), sampler: logger.DebugSampler()}
+}
+
+// TraceQueryStart adds debugging information to the context and opens a client span for the
+// query. The span carries the statement text but never its arguments, which may hold user data
 func (t *dbQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
 	sql := data.SQL
 	if len(sql) > maxSQLLen {
 		sql = sql[:maxSQLLen] + "..."
 	}
 
-	args := data.Args
+	// a redacted copy: appending the marker to data.Args would overwrite the query's own args
+	args := t.redact.args(data.SQL, data.Args)
 	if len(args) > maxArgsShow {
 		args = append(args[:maxArgsShow], "...(truncated)")
 	}
 
+	op := operation(sql)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(op),
+			semconv.DBQueryText(compactSQL(sql)),
+		),
+	)
+
 	q := &traceQueryData{
 		start: time.Now(),
 		sql:   sql,
 		args:  args,
+		span:  span,
 	}
 
 	return context.WithValue(ctx, traceKey{}, q)
@@ -64,9 +93,20 @@ func (t *dbQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx
 		elapsed = time.Since(q.start)
 		sql = compactSQL(q.sql)
 		args = q.args
+		if q.span != nil {
+			if data.Err != nil {
+				q.span.RecordError(data.Err)
+				q.span.SetStatus(codes.Error, "query failed")
+			}
+			q.span.End()
+		}
 	}
 
-	ev := t.log.With().Dur("elapsed", elapsed).Logger()
+	l := t.log
+	if rl, ok := logger.FromContext(ctx); ok {
+		l = *rl // carries the request id, user and tenant
+	}
+	ev := l.Sample(t.sampler).With().Dur("elapsed", elapsed).Logger()
 
 	// Normalize command label
 	cmd := strings.ToUpper(strings.TrimSpace(data.CommandTag.String()))
@@ -74,13 +114,16 @@ func (t *dbQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx
 		cmd = "QUERY"
 	}
 
+	op := operation(sql)
 	evt := ev.Debug()
 	// warn for slow queries (only meaningful if we captured a start time)
 	if slowThresh > 0 && elapsed >= slowThresh {
 		evt = ev.Warn()
+		slowQueries.WithLabelValues(op).Inc()
 	}
 
 	if data.Err != nil {
+		queryErrors.WithLabelValues(op).Inc()
 		ev.Error().
 			Err(data.Err).
 			Str("cmd", cmd).
@@ -97,6 +140,15 @@ func (t *dbQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx
 		Msg("Query finished")
 }
 
+// operation is the statement's leading keyword, e.g. SELECT, used as the span name
+func operation(sql string) string {
+	f := strings.Fields(sql)
+	if len(f) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(f[0])
+}
+
 // compactSQL flattens all whitespace (including \n and \t) to single spaces
 func compactSQL(s string) string {
 	return strings.Join(strings.Fields(s), " ")
@@ -13,13 +13,17 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/rs/zerolog"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // Logs to an in-memory buffer instead of stdout. This lets the test inspect what was logged
 func newTracerWithBuffer() (*dbQueryTracer, *bytes.Buffer) {
 	var buf bytes.Buffer
 	log := zerolog.New(&buf).Level(zerolog.DebugLevel)
-	return &dbQueryTracer{log: log}, &buf
+	return &dbQueryTracer{log: log, redact: newRedactor(nil, nil)}, &buf
 }
 
 // TestTraceQueryStart_Truncated tests the query tracing so huge statements don't give us grief
@@ -129,3 +133,31 @@ func TestTraceQuery_Normalization(t *testing.T) {
 		So(out, ShouldContainSubstring, `"args":[`)
 	})
 }
+
+// TestTraceQuerySpans checks each query becomes a span without its arguments
+func TestTraceQuerySpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(prev)
+
+	Convey("A query opens a client span named for its operation, ended with its outcome", t, func() {
+		tr, _ := newTracerWithBuffer()
+		ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+			SQL:  "select *\n  from albums where id = $1",
+			Args: []any{"secret-id"},
+		})
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+		spans := sr.Ended()
+		So(spans, ShouldHaveLength, 1)
+		So(spans[0].Name(), ShouldEqual, "SELECT")
+		So(spans[0].Status().Code, ShouldEqual, codes.Error)
+		for _, kv := range spans[0].Attributes() {
+			So(kv.Value.Emit(), ShouldNotContainSubstring, "secret-id")
+			if kv.Key == "db.query.text" {
+				So(kv.Value.AsString(), ShouldEqual, "select * from albums where id = $1")
+			}
+		}
+	})
+}
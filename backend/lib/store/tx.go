@@ -2,24 +2,179 @@ package store
 
 import (
 	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
 
 	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// txSleep waits between transaction retries; overwritten in tests
+var txSleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // WithTx begins a transaction, runs fn, and commits/rolls back appropriately.
 // Pass a *pgxpool.Pool (it implements Beginner). fn receives the tx as a Queryer.
 func WithTx(ctx context.Context, b Beginner, fn func(q Queryer) error) error {
+	return WithTxOptions(ctx, b, TxOptions{}, fn)
+}
+
+// TxOptions configure WithTxOptions. The zero value is a plain read-committed transaction run once
+type TxOptions struct {
+	IsoLevel         pgx.TxIsoLevel // empty keeps the server default
+	ReadOnly         bool
+	StatementTimeout time.Duration // per statement, SET LOCAL; 0 keeps the server default
+
+	// MaxRetries re-runs the whole transaction after a serialization failure (40001) or deadlock
+	// (40P01), waiting BaseBackoff * 2^attempt (capped at MaxBackoff) with jitter in between.
+	// fn must then be safe to run more than once: no side effects outside the transaction
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// WithTxOptions is WithTx with an isolation level, read-only mode, statement timeout and bounded
+// retry of transactions that lost a serialization conflict. fn's errors are returned as-is, so
+// wrap pg errors with lumErrors.WrapErrorf (not DBf) to keep them retryable. When retries run
+// out the last error comes back as ErrorCodeSerialization
+func WithTxOptions(ctx context.Context, b Beginner, o TxOptions, fn func(q Queryer) error) error {
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 10 * time.Millisecond
+	}
+	if o.MaxBackoff < o.BaseBackoff {
+		o.MaxBackoff = max(500*time.Millisecond, o.BaseBackoff)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, b, o, fn)
+		if err == nil || !lumErrors.IsRetryableDB(err) {
+			return err
+		}
+		if attempt >= o.MaxRetries {
+			if o.MaxRetries == 0 {
+				return err
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeSerialization,
+				"tx: gave up after %d attempts", attempt+1)
+		}
+
+		d := o.BaseBackoff << attempt
+		if d > o.MaxBackoff || d <= 0 {
+			d = o.MaxBackoff
+		}
+		d += time.Duration(rand.Int63n(int64(d)/2 + 1)) // up to 50% jitter spreads out the retriers
+		l := logger.Get()
+		l.Debug().Err(err).Int("attempt", attempt+1).Dur("retry_in", d).Msg("tx: retrying")
+		if err := txSleep(ctx, d); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "tx: retry")
+		}
+	}
+}
+
+// runTx is one attempt of WithTxOptions
+func runTx(ctx context.Context, b Beginner, o TxOptions, fn func(q Queryer) error) error {
 	tx, err := b.Begin(ctx)
 	if err != nil {
 		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "begin tx")
 	}
 	defer tx.Rollback(ctx) // safe if already committed
 
+	if err := applyTxOptions(ctx, tx, o); err != nil {
+		return err
+	}
 	if err := fn(tx); err != nil {
 		return err
 	}
 	if err := tx.Commit(ctx); err != nil {
-		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "commit tx")
+		return lumErrors.DBConstraintErrorf(err, "commit tx")
+	}
+	return nil
+}
+
+// applyTxOptions sets the transaction's characteristics; it must run before any query
+func applyTxOptions(ctx context.Context, q Queryer, o TxOptions) error {
+	var modes []string
+	if o.IsoLevel != "" {
+		modes = append(modes, "ISOLATION LEVEL "+string(o.IsoLevel))
+	}
+	if o.ReadOnly {
+		modes = append(modes, "READ ONLY")
+	}
+	if len(modes) > 0 {
+		if _, err := q.Exec(ctx, "SET TRANSACTION "+strings.Join(modes, ", ")); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "set transaction")
+		}
+	}
+	if o.StatementTimeout > 0 {
+		ms := strconv.FormatInt(o.StatementTimeout.Milliseconds(), 10)
+		if _, err := q.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`, ms); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "set statement timeout")
+		}
+	}
+	return nil
+}
+
+// Scope identifies the caller for row-level security. Its values are published to Postgres as
+// transaction-local settings (app.tenant_id, app.user_id and app.<key> for each Vars entry)
+// which the RLS policies read via current_setting, and the transaction runs as TenantRole
+type Scope struct {
+	TenantID string
+	UserID   string
+	Vars     map[string]string
+}
+
+// WithTenantTx is WithTx with the scope's settings applied first, so every statement fn runs is
+// filtered by the tenant/ACL policies. Settings are SET LOCAL: they vanish at commit/rollback and
+// never leak to the next user of the pooled connection
+func WithTenantTx(ctx context.Context, b Beginner, s Scope, fn func(q Queryer) error) error {
+	return WithTenantTxOptions(ctx, b, s, TxOptions{}, fn)
+}
+
+// WithTenantTxOptions is WithTenantTx with TxOptions; the scope is re-applied on every retry
+func WithTenantTxOptions(ctx context.Context, b Beginner, s Scope, o TxOptions, fn func(q Queryer) error) error {
+	return WithTxOptions(ctx, b, o, func(q Queryer) error {
+		if err := applyScope(ctx, q, s); err != nil {
+			return err
+		}
+		return fn(q)
+	})
+}
+
+// TenantRole is the role tenant transactions switch to (SET LOCAL ROLE) so the RLS policies
+// apply even when the service connects as a BYPASSRLS owner; empty keeps the connecting role.
+// InitializeDB sets it from SERVICE_PGSQL_TENANT_ROLE
+var TenantRole = "lumiumapp"
+
+// applyScope sets the scope's settings on the current transaction
+func applyScope(ctx context.Context, q Queryer, s Scope) error {
+	names := []string{"app.tenant_id", "app.user_id"}
+	values := []string{s.TenantID, s.UserID}
+	if TenantRole != "" {
+		names = append(names, "role")
+		values = append(values, TenantRole)
+	}
+	for k, v := range s.Vars {
+		names = append(names, "app."+k)
+		values = append(values, v)
+	}
+	_, err := q.Exec(ctx,
+		`SELECT set_config(n, v, true) FROM UNNEST($1::text[], $2::text[]) AS s(n, v)`,
+		names, values,
+	)
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "apply tenant scope")
 	}
 	return nil
 }
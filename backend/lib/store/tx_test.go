@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeTx records Exec calls and how the transaction ended; unused pgx.Tx methods panic
+type fakeTx struct {
+	pgx.Tx
+	execSQL    []string
+	execArgs   [][]any
+	execErr    error
+	committed  bool
+	rolledBack bool
+}
+
+func (t *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	t.execSQL = append(t.execSQL, sql)
+	t.execArgs = append(t.execArgs, args)
+	return pgconn.CommandTag{}, t.execErr
+}
+
+func (t *fakeTx) Commit(context.Context) error {
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	if !t.committed {
+		t.rolledBack = true
+	}
+	return nil
+}
+
+type fakeBeginner struct{ tx *fakeTx }
+
+func (b fakeBeginner) Begin(context.Context) (pgx.Tx, error) { return b.tx, nil }
+
+// TestWithTenantTx verifies the scope is applied before fn runs
+func TestWithTenantTx(t *testing.T) {
+	Convey("WithTenantTx sets app.* settings, switches to the tenant role and commits", t, func() {
+		TenantRole = "lumiumapp"
+		tx := &fakeTx{}
+		scope := Scope{TenantID: "t1", UserID: "u1", Vars: map[string]string{"acl_floor": "2"}}
+
+		ran := false
+		err := WithTenantTx(context.Background(), fakeBeginner{tx}, scope, func(q Queryer) error {
+			ran = true
+			So(tx.execSQL, ShouldHaveLength, 1)
+			return nil
+		})
+
+		So(err, ShouldBeNil)
+		So(ran, ShouldBeTrue)
+		So(tx.committed, ShouldBeTrue)
+		So(tx.execSQL[0], ShouldContainSubstring, "set_config")
+		So(tx.execArgs[0][0], ShouldResemble, []string{"app.tenant_id", "app.user_id", "role", "app.acl_floor"})
+		So(tx.execArgs[0][1], ShouldResemble, []string{"t1", "u1", "lumiumapp", "2"})
+	})
+
+	Convey("WithTenantTx keeps the connecting role when no tenant role is set", t, func() {
+		TenantRole = ""
+		defer func() { TenantRole = "lumiumapp" }()
+		tx := &fakeTx{}
+
+		err := WithTenantTx(context.Background(), fakeBeginner{tx}, Scope{TenantID: "t1", UserID: "u1"},
+			func(q Queryer) error { return nil })
+
+		So(err, ShouldBeNil)
+		So(tx.execArgs[0][0], ShouldResemble, []string{"app.tenant_id", "app.user_id"})
+	})
+
+	Convey("WithTenantTx rolls back without running fn when the scope can't be applied", t, func() {
+		tx := &fakeTx{execErr: errors.New("boom")}
+
+		ran := false
+		err := WithTenantTx(context.Background(), fakeBeginner{tx}, Scope{TenantID: "t1"}, func(q Queryer) error {
+			ran = true
+			return nil
+		})
+
+		So(err, ShouldNotBeNil)
+		So(ran, ShouldBeFalse)
+		So(tx.committed, ShouldBeFalse)
+		So(tx.rolledBack, ShouldBeTrue)
+	})
+}
+
+// seqBeginner hands out a fresh fakeTx per Begin
+type seqBeginner struct{ txs []*fakeTx }
+
+func (b *seqBeginner) Begin(context.Context) (pgx.Tx, error) {
+	tx := &fakeTx{}
+	b.txs = append(b.txs, tx)
+	return tx, nil
+}
+
+// TestWithTxOptions verifies transaction modes and retries
+func TestWithTxOptions(t *testing.T) {
+	var slept []time.Duration
+	origSleep := txSleep
+	txSleep = func(_ context.Context, d time.Duration) error { slept = append(slept, d); return nil }
+	defer func() { txSleep = origSleep }()
+
+	serialization := func() error {
+		return lumErrors.WrapErrorf(&pgconn.PgError{Code: "40001"}, lumErrors.ErrorCodeDB, "insert")
+	}
+
+	Convey("Given WithTxOptions", t, func() {
+		slept = nil
+		b := &seqBeginner{}
+		ctx := context.Background()
+
+		Convey("modes and the statement timeout are set before fn runs", func() {
+			o := TxOptions{IsoLevel: pgx.Serializable, ReadOnly: true, StatementTimeout: 2 * time.Second}
+			err := WithTxOptions(ctx, b, o, func(q Queryer) error { return nil })
+			So(err, ShouldBeNil)
+			tx := b.txs[0]
+			So(tx.execSQL, ShouldHaveLength, 2)
+			So(tx.execSQL[0], ShouldEqual, "SET TRANSACTION ISOLATION LEVEL serializable, READ ONLY")
+			So(tx.execArgs[1], ShouldResemble, []any{"2000"})
+			So(tx.committed, ShouldBeTrue)
+		})
+
+		Convey("the zero value runs fn once with no extra statements", func() {
+			calls := 0
+			err := WithTxOptions(ctx, b, TxOptions{}, func(q Queryer) error { calls++; return serialization() })
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeDB), ShouldBeTrue)
+			So(calls, ShouldEqual, 1)
+			So(b.txs[0].execSQL, ShouldBeEmpty)
+		})
+
+		Convey("serialization failures are retried with growing backoff", func() {
+			calls := 0
+			err := WithTxOptions(ctx, b, TxOptions{MaxRetries: 3, BaseBackoff: 10 * time.Millisecond},
+				func(q Queryer) error {
+					if calls++; calls < 3 {
+						return serialization()
+					}
+					return nil
+				})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+			So(b.txs, ShouldHaveLength, 3)
+			So(b.txs[0].rolledBack, ShouldBeTrue)
+			So(b.txs[2].committed, ShouldBeTrue)
+			So(slept, ShouldHaveLength, 2)
+			So(slept[0], ShouldBeBetweenOrEqual, 10*time.Millisecond, 15*time.Millisecond)
+			So(slept[1], ShouldBeBetweenOrEqual, 20*time.Millisecond, 30*time.Millisecond)
+		})
+
+		Convey("running out of retries reports ErrorCodeSerialization", func() {
+			err := WithTxOptions(ctx, b, TxOptions{MaxRetries: 2}, func(q Queryer) error {
+				return fmt.Errorf("update: %w", &pgconn.PgError{Code: "40P01"})
+			})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeSerialization), ShouldBeTrue)
+			So(b.txs, ShouldHaveLength, 3)
+		})
+
+		Convey("other errors are not retried", func() {
+			err := WithTxOptions(ctx, b, TxOptions{MaxRetries: 3}, func(q Queryer) error {
+				return lumErrors.NotFoundf("nope")
+			})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			So(b.txs, ShouldHaveLength, 1)
+		})
+
+		Convey("WithTenantTxOptions re-applies the scope on each attempt", func() {
+			calls := 0
+			err := WithTenantTxOptions(ctx, b, Scope{TenantID: "t1"}, TxOptions{MaxRetries: 1},
+				func(q Queryer) error {
+					if calls++; calls == 1 {
+						return serialization()
+					}
+					return nil
+				})
+			So(err, ShouldBeNil)
+			So(b.txs[1].execSQL[0], ShouldContainSubstring, "set_config")
+		})
+	})
+}
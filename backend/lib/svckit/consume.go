@@ -0,0 +1,141 @@
+package svckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/metrics"
+	"lumium/lib/tracing"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	consumed = metrics.NewCounterVec("events_consumed_total",
+		"Events handled by a worker consumer, by outcome: ok, retry or dead", "consumer", "outcome")
+	consumeDuration = metrics.NewHistogramVec("event_handle_duration_seconds",
+		"Time spent in a consumer's handler", nil, "consumer")
+)
+
+// Consumer is a durable JetStream consumer on the events stream
+type Consumer struct {
+	Name     string   // durable name, shared by every replica of the worker so they split the load
+	Subjects []string // e.g. "events.photo.ingested"
+
+	// Handle processes one event. nil acks it; an error redelivers it after a backoff, until
+	// MaxDeliver attempts have been made. Wrap an error with Permanent to drop the event at once
+	Handle func(ctx context.Context, msg jetstream.Msg) error
+
+	MaxDeliver int           // 10 when unset
+	AckWait    time.Duration // how long a handler may run before redelivery; 1m when unset
+}
+
+// errPermanent marks an error no retry will fix
+var errPermanent = errors.New("permanent")
+
+// Permanent wraps err so the event is terminated instead of redelivered
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", errPermanent, err)
+}
+
+// Consume creates or updates the durable consumer c on the events stream (OUTBOX_STREAM) and
+// starts handling its messages. Each message gets a consumer span continuing the publisher's
+// trace. On shutdown the consumer drains: buffered messages are handled before NATS closes
+func (rt *Runtime) Consume(ctx context.Context, c Consumer) error {
+	if rt.JS == nil {
+		return errors.New("consume: the service was started without UseNATS")
+	}
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = 10
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = time.Minute
+	}
+
+	stream := config.MayString("OUTBOX_STREAM", "EVENTS")
+	cons, err := rt.JS.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:        c.Name,
+		FilterSubjects: c.Subjects,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		AckWait:        c.AckWait,
+		MaxDeliver:     c.MaxDeliver,
+	})
+	if err != nil {
+		return fmt.Errorf("consumer %s: %w", c.Name, err)
+	}
+
+	cc, err := cons.Consume(func(m jetstream.Msg) { rt.handle(c, m) })
+	if err != nil {
+		return fmt.Errorf("consumer %s: %w", c.Name, err)
+	}
+	rt.OnStop("consumer "+c.Name, func(ctx context.Context) error {
+		cc.Drain()
+		select {
+		case <-cc.Closed():
+			return nil
+		case <-ctx.Done():
+			cc.Stop()
+			return ctx.Err()
+		}
+	})
+	return nil
+}
+
+// handle runs the handler for one message and acks, naks or terminates it
+func (rt *Runtime) handle(c Consumer, m jetstream.Msg) {
+	l := logger.Get()
+	ctx, span := tracing.StartConsume(context.Background(), m.Subject(), m.Headers())
+	defer span.End()
+
+	start := time.Now()
+	err := safeHandle(ctx, c.Handle, m)
+	consumeDuration.WithLabelValues(c.Name).Observe(time.Since(start).Seconds())
+	if err == nil {
+		consumed.WithLabelValues(c.Name, "ok").Inc()
+		_ = m.Ack()
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "handler failed")
+	var delivered uint64
+	if md, mderr := m.Metadata(); mderr == nil {
+		delivered = md.NumDelivered
+	}
+
+	if errors.Is(err, errPermanent) || delivered >= uint64(c.MaxDeliver) {
+		consumed.WithLabelValues(c.Name, "dead").Inc()
+		l.Error().Err(err).Str("consumer", c.Name).Str("subject", m.Subject()).
+			Uint64("delivered", delivered).Msg("Event dropped")
+		_ = m.Term()
+		return
+	}
+	consumed.WithLabelValues(c.Name, "retry").Inc()
+	l.Warn().Err(err).Str("consumer", c.Name).Str("subject", m.Subject()).
+		Uint64("delivered", delivered).Msg("Event failed; will retry")
+	_ = m.NakWithDelay(redeliveryDelay(delivered))
+}
+
+// safeHandle turns a handler panic into an error, so one bad event can't take the worker down
+func safeHandle(ctx context.Context, h func(context.Context, jetstream.Msg) error, m jetstream.Msg) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h(ctx, m)
+}
+
+// redeliveryDelay backs off 1s, 2s, 4s, ... up to a minute
+func redeliveryDelay(delivered uint64) time.Duration {
+	d := time.Second
+	for i := uint64(1); i < delivered && d < time.Minute; i++ {
+		d *= 2
+	}
+	return min(d, time.Minute)
+}
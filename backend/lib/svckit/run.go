@@ -0,0 +1,221 @@
+package svckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/health"
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+	"lumium/lib/store"
+	"lumium/lib/tracing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Service describes a worker daemon for Run
+type Service struct {
+	Name string // e.g. "lumium_exifd"; names logs, traces, metrics and the NATS connection
+
+	UseDB   bool // connect the store handler (SERVICE_PGSQL_DBURL) and check it on /ready
+	UseNATS bool // connect to SERVICE_NATS_URL with JetStream and check it on /ready
+
+	// Setup registers the worker's consumers, background loops, checks and stop hooks. An error
+	// aborts startup. ctx ends when shutdown begins
+	Setup func(ctx context.Context, rt *Runtime) error
+}
+
+// Runtime is what a worker gets from Run
+type Runtime struct {
+	Name   string
+	DB     *store.Handler // nil unless UseDB
+	NATS   *nats.Conn     // nil unless UseNATS
+	JS     jetstream.JetStream
+	Health *health.Registry
+
+	ctx   context.Context
+	fail  context.CancelCauseFunc
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	stops []stopHook
+}
+
+type stopHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// OnStop registers fn to run on shutdown. Hooks run in reverse registration order, so a
+// component stops before whatever it was built on: consumers before NATS, NATS before the DB
+func (rt *Runtime) OnStop(name string, fn func(ctx context.Context) error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.stops = append(rt.stops, stopHook{name: name, fn: fn})
+}
+
+// Go runs fn in the background until ctx ends. fn returning an error before then shuts the
+// service down, so a dead loop gets the container restarted instead of idling as healthy
+func (rt *Runtime) Go(name string, fn func(ctx context.Context) error) {
+	rt.wg.Go(func() {
+		if err := fn(rt.ctx); err != nil && rt.ctx.Err() == nil {
+			rt.fail(fmt.Errorf("%s: %w", name, err))
+		}
+	})
+}
+
+// seams, which are overwritten in tests
+var (
+	listenFn     = net.Listen
+	newHandlerFn = func() *store.Handler { return store.NewHandler(true) }
+	connectNATS  = func(url, name string) (*nats.Conn, error) {
+		return nats.Connect(url, nats.Name(name), nats.MaxReconnects(-1))
+	}
+)
+
+// Run is the whole life of a worker daemon. It serves /health, /ready, /whoami and /metrics on
+// SERVICE_HTTP_PORT (8080), sets up tracing, the database and the event bus as the Service asks,
+// registers their health checks and calls Setup. On SIGINT/SIGTERM, or when a Go loop fails, it
+// marks the service as draining, cancels ctx, waits for the loops and runs the stop hooks newest
+// first, all within SERVICE_SHUTDOWN_TIMEOUT (30s). The HTTP server stops last, so /ready
+// reports the drain while consumers finish. It exits the process on a failed startup
+func Run(svc Service) {
+	ctx, stop := lumnet.SignalContext(context.Background())
+	defer stop()
+	if err := run(ctx, svc); err != nil {
+		l := logger.Get()
+		l.Fatal().Err(err).Str("service", svc.Name).Msg("Service failed")
+	}
+}
+
+// run is Run without the signal handling and the exit
+func run(parent context.Context, svc Service) error {
+	l := logger.Get()
+	ctx, fail := context.WithCancelCause(parent)
+	defer fail(nil)
+
+	rt := &Runtime{Name: svc.Name, Health: health.NewRegistry(svc.Name), ctx: ctx, fail: fail}
+
+	// on any exit, including a failed startup, release what was already set up
+	defer rt.shutdown(config.MayDuration("SERVICE_SHUTDOWN_TIMEOUT", 30*time.Second))
+
+	if err := rt.serve(); err != nil {
+		return err
+	}
+	if err := rt.start(svc); err != nil {
+		return err
+	}
+
+	l.Info().Str("service", svc.Name).Strs("checks", rt.Health.Names()).Msg("Service running")
+	<-ctx.Done()
+	if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+		l.Error().Err(cause).Str("service", svc.Name).Msg("Service stopping after a failure")
+	}
+	return nil
+}
+
+// serve starts the health and metrics server. It has its own context, stopped by the first
+// hook registered and so the last to run
+func (rt *Runtime) serve() error {
+	addr := ":" + config.MayString("SERVICE_HTTP_PORT", "8080")
+	ln, err := listenFn("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	r := lumnet.NewRouter(lumnet.RouterOptions{WithRecovery: true, WithMetrics: true, Health: rt.Health})
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		err := lumnet.ServeContext(ctx, ln, r, rt.Name)
+		if err != nil {
+			rt.fail(fmt.Errorf("http: %w", err))
+		}
+		served <- err
+	}()
+	rt.OnStop("http", func(context.Context) error { stop(); return <-served })
+	return nil
+}
+
+// start sets up tracing, connects the dependencies and runs Setup
+func (rt *Runtime) start(svc Service) error {
+	shutdownTracing, err := tracing.Init(rt.ctx, tracing.LoadConfig(svc.Name))
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	rt.OnStop("tracing", shutdownTracing)
+
+	if svc.UseDB {
+		rt.DB = newHandlerFn()
+		rt.OnStop("postgres", func(context.Context) error { rt.DB.Close(); return nil })
+		rt.Health.Register(health.Check{Name: "postgres", Fn: health.Ping(rt.DB.PgxPool)})
+	}
+
+	if svc.UseNATS {
+		nc, err := connectNATS(config.MustString("SERVICE_NATS_URL"), svc.Name)
+		if err != nil {
+			return fmt.Errorf("connect to NATS: %w", err)
+		}
+		rt.NATS = nc
+		rt.OnStop("nats", func(context.Context) error { return drainNATS(nc) })
+		rt.Health.Register(health.Check{Name: "nats", Fn: health.NATS(nc)})
+
+		if rt.JS, err = jetstream.New(nc); err != nil {
+			return fmt.Errorf("JetStream: %w", err)
+		}
+	}
+
+	if svc.Setup != nil {
+		if err := svc.Setup(rt.ctx, rt); err != nil {
+			return fmt.Errorf("setup: %w", err)
+		}
+	}
+	return nil
+}
+
+// drainNATS flushes pending publishes and waits for the connection to close
+func drainNATS(nc *nats.Conn) error {
+	closed := make(chan struct{})
+	nc.SetClosedHandler(func(*nats.Conn) { close(closed) })
+	if err := nc.Drain(); err != nil {
+		nc.Close()
+		return err
+	}
+	<-closed
+	return nil
+}
+
+// shutdown drains, stops the loops and runs the stop hooks newest first
+func (rt *Runtime) shutdown(timeout time.Duration) {
+	l := logger.Get()
+	rt.Health.Drain()
+	rt.fail(context.Canceled)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	loops := make(chan struct{})
+	go func() { rt.wg.Wait(); close(loops) }()
+	select {
+	case <-loops:
+	case <-ctx.Done():
+		l.Warn().Str("service", rt.Name).Msg("Background loops still running at the shutdown timeout")
+	}
+
+	rt.mu.Lock()
+	stops := rt.stops
+	rt.stops = nil
+	rt.mu.Unlock()
+	for i := len(stops) - 1; i >= 0; i-- {
+		h := stops[i]
+		if err := h.fn(ctx); err != nil {
+			l.Warn().Err(err).Str("service", rt.Name).Str("component", h.name).Msg("Stop hook failed")
+		}
+	}
+	l.Info().Str("service", rt.Name).Msg("Service stopped")
+}
@@ -0,0 +1,204 @@
+package svckit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// listenLocal points the health server at an ephemeral port and reports its address
+func listenLocal(t *testing.T) <-chan string {
+	addrs := make(chan string, 1)
+	prev := listenFn
+	listenFn = func(string, string) (net.Listener, error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err == nil {
+			addrs <- ln.Addr().String()
+		}
+		return ln, err
+	}
+	t.Cleanup(func() { listenFn = prev })
+	return addrs
+}
+
+func closed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestRun(t *testing.T) {
+	Convey("Run serves the probes, then stops loops and hooks in reverse order", t, func() {
+		addrs := listenLocal(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var mu sync.Mutex
+		var order []string
+		record := func(s string) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, s)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- run(ctx, Service{Name: "test", Setup: func(_ context.Context, rt *Runtime) error {
+				rt.OnStop("first", func(context.Context) error { record("first"); return nil })
+				rt.OnStop("second", func(context.Context) error { record("second"); return nil })
+				rt.Go("loop", func(ctx context.Context) error {
+					<-ctx.Done()
+					record("loop")
+					return nil
+				})
+				return nil
+			}})
+		}()
+
+		addr := <-addrs
+		var res *http.Response
+		var err error
+		for range 50 { // the server starts in the background
+			if res, err = http.Get("http://" + addr + "/ready"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(err, ShouldBeNil)
+		_ = res.Body.Close()
+		So(res.StatusCode, ShouldEqual, http.StatusOK)
+
+		cancel()
+		So(<-done, ShouldBeNil)
+		So(order, ShouldResemble, []string{"loop", "second", "first"})
+	})
+
+	Convey("A failing loop shuts the service down", t, func() {
+		listenLocal(t)
+		stopped := make(chan struct{})
+		err := run(context.Background(), Service{Name: "test", Setup: func(_ context.Context, rt *Runtime) error {
+			rt.OnStop("hook", func(context.Context) error { close(stopped); return nil })
+			rt.Go("loop", func(context.Context) error { return errors.New("lost the lock") })
+			return nil
+		}})
+		So(err, ShouldBeNil)
+		So(closed(stopped), ShouldBeTrue)
+	})
+
+	Convey("A failed Setup aborts startup and still runs the hooks", t, func() {
+		listenLocal(t)
+		stopped := make(chan struct{})
+		err := run(context.Background(), Service{Name: "test", Setup: func(_ context.Context, rt *Runtime) error {
+			rt.OnStop("hook", func(context.Context) error { close(stopped); return nil })
+			return errors.New("no stream")
+		}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no stream")
+		So(closed(stopped), ShouldBeTrue)
+	})
+}
+
+// runJetStream starts an in-process NATS server with JetStream
+func runJetStream(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+func TestConsume(t *testing.T) {
+	ns := runJetStream(t)
+	t.Setenv("SERVICE_NATS_URL", ns.ClientURL())
+	t.Setenv("OUTBOX_STREAM", "TEST")
+
+	Convey("Consume acks, retries and drops events by handler outcome", t, func() {
+		listenLocal(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		seen := map[string]int{}
+		all := make(chan struct{})
+		handle := func(_ context.Context, m jetstream.Msg) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[m.Subject()]++
+			if seen["events.t.ok"] == 1 && seen["events.t.flaky"] == 2 && seen["events.t.bad"] == 1 {
+				close(all)
+			}
+			switch {
+			case m.Subject() == "events.t.bad":
+				return Permanent(errors.New("unparseable"))
+			case m.Subject() == "events.t.flaky" && seen[m.Subject()] == 1:
+				panic("boom")
+			}
+			return nil
+		}
+
+		ready := make(chan *Runtime, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- run(ctx, Service{Name: "test", UseNATS: true, Setup: func(ctx context.Context, rt *Runtime) error {
+				if _, err := rt.JS.CreateStream(ctx, jetstream.StreamConfig{
+					Name: "TEST", Subjects: []string{"events.>"},
+				}); err != nil {
+					return err
+				}
+				ready <- rt
+				return rt.Consume(ctx, Consumer{Name: "test", Subjects: []string{"events.t.>"}, Handle: handle})
+			}})
+		}()
+
+		rt := <-ready
+		for _, s := range []string{"events.t.ok", "events.t.flaky", "events.t.bad"} {
+			_, err := rt.JS.Publish(ctx, s, []byte("{}"))
+			So(err, ShouldBeNil)
+		}
+
+		select {
+		case <-all:
+		case <-time.After(10 * time.Second):
+			t.Fatal("events were not handled in time")
+		}
+		So(rt.Health.Names(), ShouldContain, "nats")
+
+		cancel()
+		So(<-done, ShouldBeNil)
+		So(seen["events.t.bad"], ShouldEqual, 1)
+	})
+
+	Convey("Consume needs NATS", t, func() {
+		So((&Runtime{}).Consume(context.Background(), Consumer{Name: "x"}), ShouldNotBeNil)
+	})
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	Convey("Redeliveries back off exponentially up to a minute", t, func() {
+		So(redeliveryDelay(1), ShouldEqual, time.Second)
+		So(redeliveryDelay(3), ShouldEqual, 4*time.Second)
+		So(redeliveryDelay(100), ShouldEqual, time.Minute)
+	})
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const natsTracer = "lumium/lib/tracing/nats"
+
+// natsCarrier adapts NATS headers, which share http.Header's shape, to the propagator
+func natsCarrier(h nats.Header) propagation.TextMapCarrier {
+	return propagation.HeaderCarrier(http.Header(h))
+}
+
+// InjectNATS writes ctx's trace context into h
+func InjectNATS(ctx context.Context, h nats.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, natsCarrier(h))
+}
+
+// ExtractNATS returns ctx carrying the trace context found in h
+func ExtractNATS(ctx context.Context, h nats.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, natsCarrier(h))
+}
+
+// StartPublish starts a producer span for a message on subject, parented by ctx, and writes the
+// span's context into h so consumers continue the trace. End the span once the bus acks
+func StartPublish(ctx context.Context, subject string, h nats.Header) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(natsTracer).Start(ctx, "send "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+	InjectNATS(ctx, h)
+	return ctx, span
+}
+
+// StartConsume starts a consumer span for a message received on subject with headers h,
+// continuing the trace its publisher started. Workers call it first thing in their handler
+// (StartConsume(ctx, m.Subject(), m.Headers()) for a jetstream.Msg) and end the span on ack
+func StartConsume(ctx context.Context, subject string, h nats.Header) (context.Context, trace.Span) {
+	ctx = ExtractNATS(ctx, h)
+	return otel.Tracer(natsTracer).Start(ctx, "process "+subject,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+}
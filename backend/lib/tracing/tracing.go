@@ -0,0 +1,99 @@
+// Package tracing sets up OpenTelemetry tracing for a service: the exporter, the sampler and the
+// W3C trace-context propagator that carries a trace across HTTP, SQL and the event bus.
+// Instrumentation lives next to what it instruments (lumnet.Tracing for HTTP, the pgx tracer in
+// store, outbox for publishing); this package holds the process-wide setup and the NATS helpers
+package tracing
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"lumium/lib/config"
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+)
+
+// Exporters accepted by Config.Exporter
+const (
+	ExporterNone   = "none"   // spans are dropped; context still propagates
+	ExporterStdout = "stdout" // pretty-printed JSON on stdout, for local runs
+	ExporterOTLP   = "otlp"   // OTLP/HTTP; endpoint and headers from the standard OTEL_EXPORTER_OTLP_* vars
+)
+
+// Config selects how spans leave the process
+type Config struct {
+	ServiceName string
+	Exporter    string
+	SampleRatio float64 // fraction of new traces recorded; a sampled parent is always followed
+}
+
+// LoadConfig reads OTEL_TRACES_EXPORTER and OTEL_TRACES_SAMPLER_RATIO. OTEL_SERVICE_NAME overrides
+// the service name
+func LoadConfig(serviceName string) Config {
+	ratio := 1.0
+	if v := config.MayString("OTEL_TRACES_SAMPLER_RATIO", ""); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			l := logger.Get()
+			l.Warn().Str("value", v).Msg("OTEL_TRACES_SAMPLER_RATIO must be between 0 and 1; sampling everything")
+		} else {
+			ratio = r
+		}
+	}
+	return Config{
+		ServiceName: config.MayString("OTEL_SERVICE_NAME", serviceName),
+		Exporter:    strings.ToLower(config.MayString("OTEL_TRACES_EXPORTER", ExporterNone)),
+		SampleRatio: ratio,
+	}
+}
+
+// Init installs the global tracer provider and propagator. Call the returned shutdown before
+// exiting so buffered spans are flushed
+func Init(ctx context.Context, c Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exp sdktrace.SpanExporter
+	switch c.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, lumErrors.InvalidArgf("tracing: unknown exporter %q (want none, stdout or otlp)", c.Exporter)
+	}
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeUnknown, "tracing: create %s exporter", c.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(c.ServiceName),
+	))
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeUnknown, "tracing: build resource")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	l := logger.Get()
+	l.Info().Str("exporter", c.Exporter).Float64("sample_ratio", c.SampleRatio).Msg("Tracing enabled")
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInit(t *testing.T) {
+	Convey("Init with no exporter installs only the propagator", t, func() {
+		shutdown, err := Init(context.Background(), Config{ServiceName: "test", Exporter: ExporterNone})
+		So(err, ShouldBeNil)
+		So(shutdown(context.Background()), ShouldBeNil)
+		So(otel.GetTextMapPropagator().Fields(), ShouldContain, "traceparent")
+	})
+
+	Convey("Init rejects an unknown exporter", t, func() {
+		_, err := Init(context.Background(), Config{Exporter: "zipkin"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("LoadConfig defaults to no exporter and full sampling", t, func() {
+		t.Setenv("OTEL_TRACES_EXPORTER", "")
+		t.Setenv("OTEL_TRACES_SAMPLER_RATIO", "2")
+		c := LoadConfig("lumium_api")
+		So(c.Exporter, ShouldEqual, ExporterNone)
+		So(c.SampleRatio, ShouldEqual, 1.0)
+		So(c.ServiceName, ShouldEqual, "lumium_api")
+	})
+}
+
+func TestNATSPropagation(t *testing.T) {
+	_, _ = Init(context.Background(), Config{Exporter: ExporterNone})
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	Convey("A consumer span continues the publisher's trace through the headers", t, func() {
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+		h := nats.Header{}
+		_, pub := StartPublish(ctx, "events.photo.ingested", h)
+		pub.End()
+		parent.End()
+		So(h.Get("Traceparent"), ShouldNotBeBlank)
+
+		_, con := StartConsume(context.Background(), "events.photo.ingested", h)
+		con.End()
+
+		spans := sr.Ended()
+		byName := map[string]sdktrace.ReadOnlySpan{}
+		for _, s := range spans {
+			byName[s.Name()] = s
+		}
+		So(byName, ShouldContainKey, "send events.photo.ingested")
+		So(byName, ShouldContainKey, "process events.photo.ingested")
+
+		send, proc := byName["send events.photo.ingested"], byName["process events.photo.ingested"]
+		So(send.Parent().SpanID(), ShouldEqual, parent.SpanContext().SpanID())
+		So(proc.Parent().SpanID(), ShouldEqual, send.SpanContext().SpanID())
+		So(proc.SpanContext().TraceID(), ShouldEqual, parent.SpanContext().TraceID())
+		So(proc.SpanKind(), ShouldEqual, trace.SpanKindConsumer)
+	})
+}
@@ -0,0 +1,17 @@
+-- Drops everything the baseline created. Roles are cluster-wide and left in place.
+
+DROP TABLE IF EXISTS
+  auth_mfa_challenges,
+  auth_mfa_factors,
+  auth_login_attempts,
+  auth_one_time_tokens,
+  auth_password_reset_tokens,
+  auth_sessions,
+  auth_role_permissions,
+  auth_permissions,
+  users_tenants,
+  users,
+  tenants
+  CASCADE;
+
+DROP TYPE IF EXISTS role_enum;
@@ -1,3 +1,6 @@
+-- Baseline: the schema exactly as it was last shipped as docker/pgsql/init.sql. Databases created
+-- from init.sql are adopted at this version without re-running it; everything since is 0002+
+
 CREATE EXTENSION IF NOT EXISTS pgcrypto;  -- gen_random_uuid()
 
 CREATE TYPE role_enum AS ENUM ('admin','member','viewer');
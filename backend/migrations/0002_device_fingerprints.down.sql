@@ -0,0 +1,8 @@
+DELETE FROM auth_one_time_tokens WHERE purpose = 'session_revoke';
+ALTER TABLE auth_one_time_tokens DROP CONSTRAINT IF EXISTS auth_one_time_tokens_purpose_check;
+ALTER TABLE auth_one_time_tokens ADD CONSTRAINT auth_one_time_tokens_purpose_check
+  CHECK (purpose IN ('email_verify','mfa','invite'));
+
+DROP INDEX IF EXISTS auth_login_attempts_idx_user_device;
+ALTER TABLE auth_login_attempts DROP COLUMN IF EXISTS device_fingerprint;
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS device_fingerprint;
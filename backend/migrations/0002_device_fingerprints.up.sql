@@ -0,0 +1,12 @@
+-- Coarse device fingerprints (sha256 of UA family + IP prefix, see auth/device.go) so logins
+-- from an unfamiliar device can be noticed, and a one-time token purpose to revoke them
+ALTER TABLE auth_sessions ADD COLUMN IF NOT EXISTS device_fingerprint TEXT;
+
+ALTER TABLE auth_login_attempts ADD COLUMN IF NOT EXISTS device_fingerprint TEXT;
+CREATE INDEX IF NOT EXISTS auth_login_attempts_idx_user_device
+  ON auth_login_attempts (user_id, device_fingerprint)
+  WHERE success;
+
+ALTER TABLE auth_one_time_tokens DROP CONSTRAINT IF EXISTS auth_one_time_tokens_purpose_check;
+ALTER TABLE auth_one_time_tokens ADD CONSTRAINT auth_one_time_tokens_purpose_check
+  CHECK (purpose IN ('email_verify','mfa','invite','session_revoke'));
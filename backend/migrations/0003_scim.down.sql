@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tenant_api_tokens;
+DROP INDEX IF EXISTS users_tenants_idx_external_id;
+ALTER TABLE users_tenants DROP COLUMN IF EXISTS is_active;
+ALTER TABLE users_tenants DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,21 @@
+-- SCIM provisioning: the identity provider's id for each member, a per-tenant active flag it
+-- can suspend a member with (the account and its other tenants are not its to disable), and the
+-- tenant-scoped tokens its client authenticates with
+ALTER TABLE users_tenants ADD COLUMN IF NOT EXISTS external_id TEXT;
+ALTER TABLE users_tenants ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenants_idx_external_id ON users_tenants (tenant_id, external_id)
+  WHERE external_id IS NOT NULL;
+
+-- Machine credentials scoped to one tenant (e.g. an identity provider's SCIM client)
+CREATE TABLE IF NOT EXISTS tenant_api_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE, -- sha256 of the opaque token; never store plaintext
+  scopes TEXT[] NOT NULL DEFAULT '{scim}',
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS tenant_api_tokens_idx_tenant_id ON tenant_api_tokens (tenant_id);
@@ -0,0 +1,17 @@
+-- Custom roles have no enum equivalent; only built-in grants survive the way back
+DROP INDEX IF EXISTS users_tenants_idx_role_id;
+ALTER TABLE users_tenants DROP COLUMN IF EXISTS role_id;
+
+ALTER TABLE auth_role_permissions ADD COLUMN role role_enum;
+UPDATE auth_role_permissions rp
+   SET role = r.key::role_enum
+  FROM auth_roles r
+ WHERE r.id = rp.role_id AND r.tenant_id IS NULL;
+DELETE FROM auth_role_permissions WHERE role IS NULL;
+ALTER TABLE auth_role_permissions DROP CONSTRAINT auth_role_permissions_pkey;
+ALTER TABLE auth_role_permissions DROP COLUMN role_id;
+ALTER TABLE auth_role_permissions ALTER COLUMN role SET NOT NULL;
+ALTER TABLE auth_role_permissions ALTER COLUMN permission_code DROP NOT NULL;
+ALTER TABLE auth_role_permissions ADD PRIMARY KEY (role, permission_code);
+
+DROP TABLE IF EXISTS auth_roles;
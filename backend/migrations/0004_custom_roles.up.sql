@@ -0,0 +1,65 @@
+-- Roles are permission sets. Built-ins (tenant_id NULL) mirror role_enum and cannot be edited;
+-- tenants compose their own (e.g. 'retoucher', 'client-proofing') from auth_permissions codes
+CREATE TABLE auth_roles (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE, -- NULL = built-in, shared by all tenants
+  key TEXT NOT NULL CHECK (key ~ '^[a-z0-9-]{2,64}$'),
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  is_builtin BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX auth_roles_idx_builtin_key ON auth_roles (key) WHERE tenant_id IS NULL;
+CREATE UNIQUE INDEX auth_roles_idx_tenant_key ON auth_roles (tenant_id, key) WHERE tenant_id IS NOT NULL;
+
+INSERT INTO auth_roles (key, name, description, is_builtin) VALUES
+  ('admin',  'Admin',  'Full access to the tenant', TRUE),
+  ('member', 'Member', 'Upload, organise and share photos', TRUE),
+  ('viewer', 'Viewer', 'Read-only access', TRUE);
+
+INSERT INTO auth_permissions (code, description) VALUES
+  ('tenant.manage',   'Edit tenant settings'),
+  ('users.read',      'List tenant members'),
+  ('users.write',     'Invite, remove and re-assign tenant members'),
+  ('roles.read',      'List roles and permissions'),
+  ('roles.write',     'Create, edit and delete custom roles'),
+  ('scim.manage',     'Manage SCIM provisioning tokens'),
+  ('albums.read',     'View albums'),
+  ('albums.write',    'Create and edit albums'),
+  ('albums.share',    'Share albums and manage album access'),
+  ('photos.read',     'View photos'),
+  ('photos.write',    'Upload and edit photos'),
+  ('photos.delete',   'Delete photos'),
+  ('photos.download', 'Download originals'),
+  ('comments.write',  'Comment on and proof photos')
+ON CONFLICT (code) DO NOTHING;
+
+-- Re-key role permissions from the enum to auth_roles, keeping whatever grants already exist
+ALTER TABLE auth_role_permissions ADD COLUMN role_id UUID REFERENCES auth_roles(id) ON DELETE CASCADE;
+UPDATE auth_role_permissions rp
+   SET role_id = r.id
+  FROM auth_roles r
+ WHERE r.tenant_id IS NULL AND r.key = rp.role::TEXT;
+DELETE FROM auth_role_permissions WHERE role_id IS NULL OR permission_code IS NULL;
+ALTER TABLE auth_role_permissions DROP CONSTRAINT auth_role_permissions_pkey;
+ALTER TABLE auth_role_permissions DROP COLUMN role;
+ALTER TABLE auth_role_permissions ALTER COLUMN role_id SET NOT NULL;
+ALTER TABLE auth_role_permissions ALTER COLUMN permission_code SET NOT NULL;
+ALTER TABLE auth_role_permissions ADD PRIMARY KEY (role_id, permission_code);
+
+INSERT INTO auth_role_permissions (role_id, permission_code)
+SELECT r.id, p.code
+FROM auth_roles r
+JOIN auth_permissions p ON
+  (r.key = 'admin')
+  OR (r.key = 'member' AND p.code IN (
+    'users.read','roles.read','albums.read','albums.write','albums.share',
+    'photos.read','photos.write','photos.delete','photos.download','comments.write'))
+  OR (r.key = 'viewer' AND p.code IN ('albums.read','photos.read','comments.write'))
+WHERE r.tenant_id IS NULL
+ON CONFLICT DO NOTHING;
+
+-- Custom role assignment; NULL falls back to the built-in role named by users_tenants.role
+ALTER TABLE users_tenants ADD COLUMN role_id UUID REFERENCES auth_roles(id) ON DELETE SET NULL;
+CREATE INDEX users_tenants_idx_role_id ON users_tenants (role_id) WHERE role_id IS NOT NULL;
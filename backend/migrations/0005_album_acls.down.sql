@@ -0,0 +1,9 @@
+DELETE FROM auth_permissions WHERE code = 'albums.read_all';
+
+DROP TABLE IF EXISTS acl_entries, acl_group_members, acl_groups, album_items, albums CASCADE;
+
+DROP FUNCTION IF EXISTS app_acl_allows(UUID, TEXT, UUID, INT);
+DROP FUNCTION IF EXISTS acl_effective_level(UUID, UUID, TEXT, UUID);
+DROP FUNCTION IF EXISTS acl_rank(acl_level);
+
+DROP TYPE IF EXISTS acl_level;
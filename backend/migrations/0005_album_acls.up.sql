@@ -0,0 +1,182 @@
+-- Albums and per-resource access control: explicit grants to users or groups, inherited from
+-- albums by their items, enforced by the API authorizer and by RLS
+
+CREATE TYPE acl_level AS ENUM ('view','contribute','manage');
+
+CREATE TABLE albums (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  title TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX albums_idx_tenant_id ON albums (tenant_id);
+
+CREATE TABLE album_items (
+  album_id UUID NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  item_id UUID NOT NULL, -- photo/asset id; an item may live in several albums
+  added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (album_id, item_id)
+);
+CREATE INDEX album_items_idx_item_id ON album_items (tenant_id, item_id);
+
+-- Named sets of tenant members ACLs can be granted to, e.g. 'grandparents', 'client: Smith wedding'
+CREATE TABLE acl_groups (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE acl_group_members (
+  group_id UUID NOT NULL REFERENCES acl_groups(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX acl_group_members_idx_user_id ON acl_group_members (user_id);
+
+-- Grants on a single album or item. Album grants with inherit apply to every item in the album
+CREATE TABLE acl_entries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  resource_type TEXT NOT NULL CHECK (resource_type IN ('album','item')),
+  resource_id UUID NOT NULL,
+  principal_type TEXT NOT NULL CHECK (principal_type IN ('user','group')),
+  principal_id UUID NOT NULL,
+  level acl_level NOT NULL,
+  inherit BOOLEAN NOT NULL DEFAULT TRUE,
+  granted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (tenant_id, resource_type, resource_id, principal_type, principal_id)
+);
+CREATE INDEX acl_entries_idx_principal ON acl_entries (tenant_id, principal_type, principal_id);
+
+CREATE FUNCTION acl_rank(l acl_level) RETURNS INT
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT CASE l WHEN 'view' THEN 1 WHEN 'contribute' THEN 2 WHEN 'manage' THEN 3 ELSE 0 END
+$$;
+
+-- Highest level (0 none, 1 view, 2 contribute, 3 manage) p_user holds on a resource through
+-- ownership, direct grants, group grants and, for items, inherited album grants.
+-- SECURITY DEFINER so RLS policies on albums/album_items can call it without recursing
+CREATE FUNCTION acl_effective_level(p_tenant UUID, p_user UUID, p_type TEXT, p_id UUID) RETURNS INT
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+  WITH principals AS (
+    SELECT 'user'::TEXT AS kind, p_user AS id
+    UNION ALL
+    SELECT 'group', gm.group_id
+      FROM acl_group_members gm
+      JOIN acl_groups g ON g.id = gm.group_id
+     WHERE gm.user_id = p_user AND g.tenant_id = p_tenant
+  ),
+  containers AS ( -- the resource itself plus, for items, every album holding it
+    SELECT p_type AS type, p_id AS id, FALSE AS inherited
+    UNION ALL
+    SELECT 'album', ai.album_id, TRUE
+      FROM album_items ai
+     WHERE p_type = 'item' AND ai.item_id = p_id AND ai.tenant_id = p_tenant
+  )
+  SELECT COALESCE(MAX(rank), 0) FROM (
+    SELECT 3 AS rank
+      FROM containers c
+      JOIN albums a ON c.type = 'album' AND a.id = c.id
+     WHERE a.tenant_id = p_tenant AND a.owner_id = p_user
+    UNION ALL
+    SELECT acl_rank(e.level)
+      FROM containers c
+      JOIN acl_entries e ON e.resource_type = c.type AND e.resource_id = c.id
+      JOIN principals p ON p.kind = e.principal_type AND p.id = e.principal_id
+     WHERE e.tenant_id = p_tenant AND (NOT c.inherited OR e.inherit)
+  ) levels
+$$;
+
+-- RLS predicate: the session's tenant-wide floor (app.acl_floor, derived from role permissions)
+-- or the user's effective level on the resource must reach p_min
+CREATE FUNCTION app_acl_allows(p_tenant UUID, p_type TEXT, p_id UUID, p_min INT) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT p_tenant::TEXT = current_setting('app.tenant_id', TRUE)
+     AND (
+       COALESCE(NULLIF(current_setting('app.acl_floor', TRUE), ''), '0')::INT >= p_min
+       OR acl_effective_level(
+            p_tenant, NULLIF(current_setting('app.user_id', TRUE), '')::UUID, p_type, p_id
+          ) >= p_min
+     )
+$$;
+
+ALTER TABLE albums ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY albums_select ON albums
+  FOR SELECT
+  USING (app_acl_allows(tenant_id, 'album', id, 1));
+
+-- new albums are owned by the session user
+CREATE POLICY albums_insert ON albums
+  FOR INSERT
+  WITH CHECK (
+    tenant_id::TEXT = current_setting('app.tenant_id', TRUE)
+    AND owner_id::TEXT = current_setting('app.user_id', TRUE)
+  );
+
+CREATE POLICY albums_update ON albums
+  FOR UPDATE
+  USING (app_acl_allows(tenant_id, 'album', id, 3))
+  WITH CHECK (tenant_id::TEXT = current_setting('app.tenant_id', TRUE));
+
+CREATE POLICY albums_delete ON albums
+  FOR DELETE
+  USING (app_acl_allows(tenant_id, 'album', id, 3));
+
+ALTER TABLE album_items ENABLE ROW LEVEL SECURITY;
+
+-- items are visible through any album the user can view, or a direct item grant
+CREATE POLICY album_items_select ON album_items
+  FOR SELECT
+  USING (
+    app_acl_allows(tenant_id, 'album', album_id, 1)
+    OR app_acl_allows(tenant_id, 'item', item_id, 1)
+  );
+
+CREATE POLICY album_items_insert ON album_items
+  FOR INSERT
+  WITH CHECK (app_acl_allows(tenant_id, 'album', album_id, 2));
+
+CREATE POLICY album_items_delete ON album_items
+  FOR DELETE
+  USING (app_acl_allows(tenant_id, 'album', album_id, 2));
+
+-- ACL rows themselves are tenant-isolated; who may edit them is decided by the API authorizer
+ALTER TABLE acl_entries ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY acl_entries_tenant ON acl_entries
+  USING (tenant_id::TEXT = current_setting('app.tenant_id', TRUE))
+  WITH CHECK (tenant_id::TEXT = current_setting('app.tenant_id', TRUE));
+
+ALTER TABLE acl_groups ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY acl_groups_tenant ON acl_groups
+  USING (tenant_id::TEXT = current_setting('app.tenant_id', TRUE))
+  WITH CHECK (tenant_id::TEXT = current_setting('app.tenant_id', TRUE));
+
+-- Seeing every album in the tenant is its own permission. albums.read alone reaches only the
+-- albums shared with the user, which is what a guest role (e.g. "grandparents") needs
+INSERT INTO auth_permissions (code, description) VALUES
+  ('albums.read_all', 'View every album in the tenant')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO auth_role_permissions (role_id, permission_code)
+SELECT id, 'albums.read_all' FROM auth_roles WHERE tenant_id IS NULL AND key IN ('admin', 'member', 'viewer')
+ON CONFLICT DO NOTHING;
+
+-- The service connects as a role with BYPASSRLS, so tenant transactions switch to lumiumapp
+-- (SET LOCAL ROLE, see store.WithTenantTx) for the policies above to apply
+DO $$
+BEGIN
+  IF current_user <> 'lumiumapp' THEN
+    GRANT lumiumapp TO CURRENT_USER;
+  END IF;
+END$$;
@@ -0,0 +1,4 @@
+ALTER TABLE auth_mfa_challenges DROP COLUMN IF EXISTS purpose;
+DROP TABLE IF EXISTS auth_sms_sends;
+DROP INDEX IF EXISTS auth_mfa_factors_idx_user_sms;
+ALTER TABLE auth_mfa_factors DROP COLUMN IF EXISTS confirmed_at;
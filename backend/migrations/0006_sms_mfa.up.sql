@@ -0,0 +1,20 @@
+-- SMS factors must be confirmed before they gate login. Factors that predate confirmation were
+-- already trusted, so they count as confirmed when they were created
+ALTER TABLE auth_mfa_factors ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMPTZ;
+UPDATE auth_mfa_factors SET confirmed_at = created_at WHERE confirmed_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS auth_mfa_factors_idx_user_sms ON auth_mfa_factors (user_id, secret)
+  WHERE type = 'sms';
+
+-- Every SMS we pay for, keyed by destination so per-number rate limits survive restarts
+CREATE TABLE IF NOT EXISTS auth_sms_sends (
+  id BIGSERIAL PRIMARY KEY,
+  phone TEXT NOT NULL, -- E.164
+  user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  purpose TEXT NOT NULL CHECK (purpose IN ('enroll','login')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS auth_sms_sends_idx_phone_created_at ON auth_sms_sends (phone, created_at DESC);
+
+-- What a challenge was issued for: a code texted to confirm a new number must not log anyone in
+ALTER TABLE auth_mfa_challenges
+  ADD COLUMN IF NOT EXISTS purpose TEXT NOT NULL DEFAULT 'login' CHECK (purpose IN ('login','enroll'));
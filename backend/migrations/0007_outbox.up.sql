@@ -0,0 +1,23 @@
+-- Transactional outbox: events are inserted in the same transaction as the write they describe
+-- and published to NATS by the relay (lib/outbox), in id order per aggregate
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  aggregate_type TEXT NOT NULL, -- e.g. 'photo', 'album'
+  aggregate_id TEXT NOT NULL,
+  subject TEXT NOT NULL,        -- NATS subject, e.g. 'events.photo.ingested'
+  payload JSONB NOT NULL,
+  headers JSONB NOT NULL DEFAULT '{}',
+  msg_id UUID NOT NULL DEFAULT gen_random_uuid() UNIQUE, -- Nats-Msg-Id; JetStream drops re-publishes
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  published_at TIMESTAMPTZ,
+  dead_at TIMESTAMPTZ           -- gave up after the max attempts; needs a human
+);
+CREATE INDEX outbox_idx_pending ON outbox (id)
+  WHERE published_at IS NULL AND dead_at IS NULL;
+CREATE INDEX outbox_idx_aggregate_pending ON outbox (aggregate_type, aggregate_id, id)
+  WHERE published_at IS NULL AND dead_at IS NULL;
+CREATE INDEX outbox_idx_published_at ON outbox (published_at)
+  WHERE published_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- migrate:no-transaction
+-- Matches the album listing's default keyset sort (-created_at, -id), so deep pages stay range
+-- scans. CONCURRENTLY keeps writes flowing while it builds; it must be the file's only statement,
+-- since a multi-statement file runs as one implicit transaction
+CREATE INDEX CONCURRENTLY IF NOT EXISTS albums_idx_tenant_created ON albums (tenant_id, created_at, id);
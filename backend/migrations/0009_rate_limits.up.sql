@@ -0,0 +1,8 @@
+-- Rate limit buckets shared by API replicas (lumnet.PGRateStore). One row per bucket holding its
+-- theoretical arrival time; a row whose tat has passed is a full bucket and may be pruned.
+-- UNLOGGED: losing the buckets in a crash only resets the limits
+CREATE UNLOGGED TABLE rate_limits (
+  key TEXT PRIMARY KEY, -- '<policy>:<ip|user|tenant|key>:<value>'
+  tat TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX rate_limits_idx_tat ON rate_limits (tat);
@@ -0,0 +1,14 @@
+-- Idempotency-Key records (lumnet.PGIdempotencyStore): the fingerprint of the first request made
+-- with a key and, once it finished, its response, replayed to retries until expires_at
+CREATE TABLE idempotency_keys (
+  key TEXT PRIMARY KEY,       -- '<scope>:<Idempotency-Key>', scope being the user or client IP
+  fingerprint TEXT NOT NULL,  -- sha256 of method, path, content type and body
+  status INT,                 -- NULL while the first request runs
+  headers JSONB,
+  body BYTEA,
+  locked_until TIMESTAMPTZ NOT NULL, -- a running request past this died; a retry takes over
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMPTZ
+);
+CREATE INDEX idempotency_keys_idx_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS tenant_storage_used(UUID);
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+DROP TABLE IF EXISTS photos;
+ALTER TABLE tenants DROP COLUMN IF EXISTS storage_quota_bytes;
@@ -0,0 +1,78 @@
+-- Per-tenant storage quota in bytes; NULL falls back to STORAGE_QUOTA_BYTES (0 = unlimited)
+ALTER TABLE tenants ADD COLUMN storage_quota_bytes BIGINT CHECK (storage_quota_bytes >= 0);
+
+-- Originals kept in the object store. A finished upload becomes a photo
+CREATE TABLE photos (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  object_key TEXT NOT NULL,
+  filename TEXT NOT NULL DEFAULT '',
+  content_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+  size BIGINT NOT NULL CHECK (size >= 0),
+  sha256 TEXT NOT NULL, -- hex digest of the original
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX photos_idx_tenant_sha256 ON photos (tenant_id, sha256);
+
+-- Resumable (tus) uploads. upload_offset is how many bytes have been received; the bytes live in
+-- upload_chunks objects until the upload completes and is assembled into a photo
+CREATE TABLE uploads (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  length BIGINT NOT NULL CHECK (length >= 0),
+  upload_offset BIGINT NOT NULL DEFAULT 0 CHECK (upload_offset BETWEEN 0 AND length),
+  metadata JSONB NOT NULL DEFAULT '{}', -- the decoded Upload-Metadata pairs
+  photo_id UUID REFERENCES photos(id) ON DELETE SET NULL, -- set once assembled
+  completed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX uploads_idx_tenant_pending ON uploads (tenant_id) WHERE completed_at IS NULL;
+
+-- One object per PATCH; the key on (upload_id, start_offset) lets only one of two racing PATCHes
+-- at the same offset land
+CREATE TABLE upload_chunks (
+  upload_id UUID NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+  tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+  start_offset BIGINT NOT NULL,
+  size BIGINT NOT NULL CHECK (size > 0),
+  object_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (upload_id, start_offset)
+);
+
+-- Bytes a tenant stores or has reserved: its photos plus the declared length of unfinished
+-- uploads. SECURITY DEFINER so the quota check sees every member's uploads, not just the caller's
+CREATE FUNCTION tenant_storage_used(p_tenant UUID) RETURNS BIGINT
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+  SELECT COALESCE((SELECT SUM(size) FROM photos WHERE tenant_id = p_tenant), 0)
+       + COALESCE((SELECT SUM(length) FROM uploads WHERE tenant_id = p_tenant AND completed_at IS NULL), 0)
+$$;
+
+ALTER TABLE photos ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY photos_tenant ON photos
+  USING (tenant_id::TEXT = current_setting('app.tenant_id', TRUE))
+  WITH CHECK (tenant_id::TEXT = current_setting('app.tenant_id', TRUE));
+
+-- uploads are private to the user who started them
+ALTER TABLE uploads ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY uploads_owner ON uploads
+  USING (
+    tenant_id::TEXT = current_setting('app.tenant_id', TRUE)
+    AND user_id::TEXT = current_setting('app.user_id', TRUE)
+  )
+  WITH CHECK (
+    tenant_id::TEXT = current_setting('app.tenant_id', TRUE)
+    AND user_id::TEXT = current_setting('app.user_id', TRUE)
+  );
+
+ALTER TABLE upload_chunks ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY upload_chunks_tenant ON upload_chunks
+  USING (tenant_id::TEXT = current_setting('app.tenant_id', TRUE))
+  WITH CHECK (tenant_id::TEXT = current_setting('app.tenant_id', TRUE));
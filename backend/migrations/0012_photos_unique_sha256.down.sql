@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS photos_idx_tenant_sha256;
+CREATE INDEX photos_idx_tenant_sha256 ON photos (tenant_id, sha256);
@@ -0,0 +1,40 @@
+-- A tenant keeps one copy of each original, and ingest relies on it with ON CONFLICT (tenant_id,
+-- sha256). 0011's index isn't unique, so a tenant may already hold the same bytes two or more
+-- times: keep the oldest photo of each, copy the album items and item grants of the others onto
+-- it once per album and principal, then drop them. Their originals stay in the object store
+CREATE TEMP TABLE photo_dupes AS
+SELECT id AS dupe_id, keep_id
+  FROM (SELECT id, first_value(id) OVER (PARTITION BY tenant_id, sha256 ORDER BY created_at, id) AS keep_id
+          FROM photos) p
+ WHERE id <> keep_id;
+
+UPDATE uploads u SET photo_id = d.keep_id FROM photo_dupes d WHERE u.photo_id = d.dupe_id;
+
+-- several copies may sit in one album: one row per album, the earliest added
+INSERT INTO album_items (album_id, tenant_id, item_id, added_by, added_at)
+SELECT DISTINCT ON (ai.album_id, d.keep_id) ai.album_id, ai.tenant_id, d.keep_id, ai.added_by, ai.added_at
+  FROM album_items ai JOIN photo_dupes d ON ai.item_id = d.dupe_id
+ ORDER BY ai.album_id, d.keep_id, ai.added_at
+    ON CONFLICT (album_id, item_id) DO UPDATE SET added_at = LEAST(album_items.added_at, EXCLUDED.added_at);
+DELETE FROM album_items ai USING photo_dupes d WHERE ai.item_id = d.dupe_id;
+
+-- a principal granted on several copies keeps the highest level among them and the kept photo
+INSERT INTO acl_entries (
+  tenant_id, resource_type, resource_id, principal_type, principal_id, level, inherit, granted_by, created_at
+)
+SELECT DISTINCT ON (e.tenant_id, d.keep_id, e.principal_type, e.principal_id)
+       e.tenant_id, 'item', d.keep_id, e.principal_type, e.principal_id, e.level, e.inherit, e.granted_by,
+       e.created_at
+  FROM acl_entries e JOIN photo_dupes d ON e.resource_id = d.dupe_id
+ WHERE e.resource_type = 'item'
+ ORDER BY e.tenant_id, d.keep_id, e.principal_type, e.principal_id, acl_rank(e.level) DESC, e.created_at
+    ON CONFLICT (tenant_id, resource_type, resource_id, principal_type, principal_id) DO UPDATE
+   SET level = EXCLUDED.level
+ WHERE acl_rank(EXCLUDED.level) > acl_rank(acl_entries.level);
+DELETE FROM acl_entries e USING photo_dupes d WHERE e.resource_type = 'item' AND e.resource_id = d.dupe_id;
+
+DELETE FROM photos p USING photo_dupes d WHERE p.id = d.dupe_id;
+DROP TABLE photo_dupes;
+
+DROP INDEX IF EXISTS photos_idx_tenant_sha256;
+CREATE UNIQUE INDEX photos_idx_tenant_sha256 ON photos (tenant_id, sha256);
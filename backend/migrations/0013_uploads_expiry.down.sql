@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uploads_idx_pending_updated;
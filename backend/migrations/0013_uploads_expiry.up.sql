@@ -0,0 +1,2 @@
+-- the reaper's scan for unfinished uploads idle past UPLOAD_EXPIRY
+CREATE INDEX uploads_idx_pending_updated ON uploads (updated_at) WHERE completed_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS auth_sessions_idx_family;
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS family_id;
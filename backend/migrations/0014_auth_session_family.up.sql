@@ -0,0 +1,4 @@
+-- a refresh rotates the session into a new row; family_id points every rotation back at the
+-- login that started the chain, which keeps its own id (family_id NULL)
+ALTER TABLE auth_sessions ADD COLUMN family_id UUID;
+CREATE INDEX auth_sessions_idx_family ON auth_sessions ((COALESCE(family_id, id))) WHERE revoked_at IS NULL;
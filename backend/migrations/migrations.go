@@ -0,0 +1,23 @@
+// Package migrations holds the Postgres schema as ordered, versioned SQL files applied by
+// lib/store/migrate. Files are named NNNN_name.up.sql / NNNN_name.down.sql; never edit one
+// that has shipped, add a new version instead
+package migrations
+
+import (
+	"embed"
+
+	"lumium/lib/store/migrate"
+)
+
+// FS is the embedded migration set
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Options returns the runner options for this schema. Databases bootstrapped from the old
+// docker init.sql already contain the baseline; they're recognised by the tenants table
+func Options() migrate.Options {
+	return migrate.Options{
+		Baseline: &migrate.Baseline{Version: 1, Table: "tenants"},
+	}
+}
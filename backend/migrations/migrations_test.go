@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"lumium/lib/store/migrate"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testDatabaseEnv names an empty Postgres database the schema tests may fill and empty again;
+// they are skipped without one
+const testDatabaseEnv = "LUMIUM_TEST_DATABASE_URL"
+
+// upTo is the migration set as it stood at version n
+func upTo(t *testing.T, n int64) fs.FS {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := fstest.MapFS{}
+	for _, e := range entries {
+		v, err := strconv.ParseInt(e.Name()[:4], 10, 64)
+		if err != nil || v > n {
+			continue
+		}
+		b, err := fs.ReadFile(FS, e.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub[e.Name()] = &fstest.MapFile{Data: b}
+	}
+	return sub
+}
+
+func TestPhotosUniqueSHA256(t *testing.T) {
+	url := os.Getenv(testDatabaseEnv)
+	if url == "" {
+		t.Skip(testDatabaseEnv + " is not set")
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	Convey("Given a tenant holding three copies of one photo before 0012", t, func() {
+		before, err := migrate.New(upTo(t, 11), Options())
+		So(err, ShouldBeNil)
+		all, err := migrate.New(FS, Options())
+		So(err, ShouldBeNil)
+		_, err = before.Up(ctx, conn)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			_, err := all.Down(ctx, conn, len(all.Migrations()))
+			So(err, ShouldBeNil)
+		})
+
+		_, err = conn.Exec(ctx, `
+			INSERT INTO tenants (id, slug, name) VALUES ('10000000-0000-4000-8000-000000000001', 'acme', 'Acme');
+			INSERT INTO users (id, email, password_hash) VALUES
+			  ('20000000-0000-4000-8000-000000000001', 'ann@example.test', 'x'),
+			  ('20000000-0000-4000-8000-000000000002', 'bob@example.test', 'x');
+			INSERT INTO photos (id, tenant_id, object_key, size, sha256, created_at) VALUES
+			  ('30000000-0000-4000-8000-000000000001', '10000000-0000-4000-8000-000000000001', 'a', 1, 'ab',
+			   NOW() - interval '3 days'),
+			  ('30000000-0000-4000-8000-000000000002', '10000000-0000-4000-8000-000000000001', 'b', 1, 'ab',
+			   NOW() - interval '2 days'),
+			  ('30000000-0000-4000-8000-000000000003', '10000000-0000-4000-8000-000000000001', 'c', 1, 'ab',
+			   NOW() - interval '1 day');
+			INSERT INTO albums (id, tenant_id, title) VALUES
+			  ('40000000-0000-4000-8000-000000000001', '10000000-0000-4000-8000-000000000001', 'Beach'),
+			  ('40000000-0000-4000-8000-000000000002', '10000000-0000-4000-8000-000000000001', 'Hills');
+			-- the two later copies share an album the kept one isn't in
+			INSERT INTO album_items (album_id, tenant_id, item_id) VALUES
+			  ('40000000-0000-4000-8000-000000000001', '10000000-0000-4000-8000-000000000001',
+			   '30000000-0000-4000-8000-000000000002'),
+			  ('40000000-0000-4000-8000-000000000001', '10000000-0000-4000-8000-000000000001',
+			   '30000000-0000-4000-8000-000000000003'),
+			  ('40000000-0000-4000-8000-000000000002', '10000000-0000-4000-8000-000000000001',
+			   '30000000-0000-4000-8000-000000000001'),
+			  ('40000000-0000-4000-8000-000000000002', '10000000-0000-4000-8000-000000000001',
+			   '30000000-0000-4000-8000-000000000003');
+			-- bob views both later copies; ann views the kept one and manages the last
+			INSERT INTO acl_entries (tenant_id, resource_type, resource_id, principal_type, principal_id, level)
+			VALUES
+			  ('10000000-0000-4000-8000-000000000001', 'item', '30000000-0000-4000-8000-000000000002', 'user',
+			   '20000000-0000-4000-8000-000000000002', 'view'),
+			  ('10000000-0000-4000-8000-000000000001', 'item', '30000000-0000-4000-8000-000000000003', 'user',
+			   '20000000-0000-4000-8000-000000000002', 'view'),
+			  ('10000000-0000-4000-8000-000000000001', 'item', '30000000-0000-4000-8000-000000000001', 'user',
+			   '20000000-0000-4000-8000-000000000001', 'view'),
+			  ('10000000-0000-4000-8000-000000000001', 'item', '30000000-0000-4000-8000-000000000003', 'user',
+			   '20000000-0000-4000-8000-000000000001', 'manage');
+		`)
+		So(err, ShouldBeNil)
+
+		Convey("the migration keeps the oldest and merges the others onto it", func() {
+			_, err := all.Up(ctx, conn)
+			So(err, ShouldBeNil)
+
+			var photos int
+			So(conn.QueryRow(ctx, `SELECT count(*) FROM photos`).Scan(&photos), ShouldBeNil)
+			So(photos, ShouldEqual, 1)
+
+			rows, err := conn.Query(ctx, `SELECT album_id::text, item_id::text FROM album_items ORDER BY 1`)
+			So(err, ShouldBeNil)
+			items, err := pgx.CollectRows(rows, pgx.RowToStructByPos[struct{ Album, Item string }])
+			So(err, ShouldBeNil)
+			So(items, ShouldResemble, []struct{ Album, Item string }{
+				{"40000000-0000-4000-8000-000000000001", "30000000-0000-4000-8000-000000000001"},
+				{"40000000-0000-4000-8000-000000000002", "30000000-0000-4000-8000-000000000001"},
+			})
+
+			rows, err = conn.Query(ctx, `
+				SELECT principal_id::text, resource_id::text, level::text FROM acl_entries ORDER BY 1`)
+			So(err, ShouldBeNil)
+			grants, err := pgx.CollectRows(rows, pgx.RowToStructByPos[struct{ Principal, Item, Level string }])
+			So(err, ShouldBeNil)
+			So(grants, ShouldResemble, []struct{ Principal, Item, Level string }{
+				{"20000000-0000-4000-8000-000000000001", "30000000-0000-4000-8000-000000000001", "manage"},
+				{"20000000-0000-4000-8000-000000000002", "30000000-0000-4000-8000-000000000001", "view"},
+			})
+		})
+	})
+}
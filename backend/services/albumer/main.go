@@ -1,12 +1,13 @@
+// Command albumer is the trip, stack and album builder. It has no consumers yet; they are
+// registered in Setup as the events they handle come online
 package main
 
-import (
-	"fmt"
-	"net/http"
-)
+import "lumium/lib/svckit"
 
 func main() {
-	http.ListenAndServe(":8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "Hello, world!")
-	}))
+	svckit.Run(svckit.Service{
+		Name:    "lumium_albumer",
+		UseDB:   true,
+		UseNATS: true,
+	})
 }
@@ -0,0 +1,68 @@
+// Package acl implements per-album and per-item access control lists. Grants go to users or
+// tenant groups at view/contribute/manage level and are enforced twice: by the Authorizer in the
+// API and by the RLS policies on albums/album_items (see migrations/0005_album_acls.up.sql)
+package acl
+
+import (
+	"lumium/lib/lumnet"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	authz *Authorizer
+}
+
+// Config is the configuration wrapper for ACLs. Nothing is tunable yet
+type Config struct{}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+func NewService(db *pgxpool.Pool, c Config, o ...svckit.Opt[*pgxpool.Pool, Repo, Config]) Service {
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), authz: NewAuthorizer()}
+}
+
+// ACL is the wrapper for the /acl service
+type ACL struct {
+	app     *handlers.App
+	svc     Service
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new ACL pointer
+func New(app *handlers.App, perms auth.PermissionResolver) *ACL {
+	return &ACL{app: app, svc: NewService(app.DB, Config{}), authCfg: auth.LoadConfig(), perms: perms}
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *ACL) Wire(r chi.Router) {
+	r.Route("/acl", func(r chi.Router) {
+		// no codes: resolves the caller's permissions so the tenant-wide ACL floor is known
+		r.Use(auth.Authenticate(h.authCfg), auth.RequirePermission(h.perms))
+
+		r.Get("/{kind}/{id}/entries", lumnet.Adapt(h.ListEntries))
+		r.With(auth.Idempotent(h.app.Idempotency)).Post("/{kind}/{id}/entries", lumnet.Adapt(h.Grant))
+		r.Delete("/{kind}/{id}/entries/{entryID}", lumnet.Adapt(h.Revoke))
+
+		r.Route("/groups", func(r chi.Router) {
+			r.Use(auth.RequirePermission(h.perms, "albums.share"))
+			r.Get("/", lumnet.Adapt(h.ListGroups))
+			r.With(auth.Idempotent(h.app.Idempotency)).Post("/", lumnet.Adapt(h.CreateGroup))
+			r.Delete("/{id}", lumnet.Adapt(h.DeleteGroup))
+			r.Put("/{id}/members/{userID}", lumnet.Adapt(h.AddGroupMember))
+			r.Delete("/{id}/members/{userID}", lumnet.Adapt(h.RemoveGroupMember))
+		})
+	})
+	lumnet.InitValidator()
+}
@@ -0,0 +1,268 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	tenantID = "00000000-0000-4000-8000-000000000001"
+	userID   = "00000000-0000-4000-8000-000000000002"
+	otherID  = "00000000-0000-4000-8000-000000000003"
+	albumID  = "00000000-0000-4000-8000-0000000000a1"
+	secretID = "00000000-0000-4000-8000-0000000000a2"
+)
+
+// rankQueryer answers acl_effective_level() from an in-memory resource id -> rank map
+type rankQueryer struct {
+	ranks   map[string]int
+	queries int
+	err     error
+}
+
+func (q *rankQueryer) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	q.queries++
+	return rankRow{rank: q.ranks[args[3].(string)], err: q.err}
+}
+
+func (q *rankQueryer) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	q.queries++
+	if q.err != nil {
+		return nil, q.err
+	}
+	rows := &rankRows{i: -1}
+	for i, id := range args[3].([]string) {
+		rows.data = append(rows.data, [2]int{i + 1, q.ranks[id]})
+	}
+	return rows, nil
+}
+
+func (q *rankQueryer) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+type rankRow struct {
+	rank int
+	err  error
+}
+
+func (r rankRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int) = r.rank
+	return nil
+}
+
+type rankRows struct {
+	data [][2]int // ordinality, rank
+	i    int
+}
+
+func (r *rankRows) Close()                                       {}
+func (r *rankRows) Err() error                                   { return nil }
+func (r *rankRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *rankRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *rankRows) Next() bool                                   { r.i++; return r.i < len(r.data) }
+func (r *rankRows) Values() ([]any, error)                       { return nil, nil }
+func (r *rankRows) RawValues() [][]byte                          { return nil }
+func (r *rankRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *rankRows) Scan(dest ...any) error {
+	*dest[0].(*int64), *dest[1].(*int) = int64(r.data[r.i][0]), r.data[r.i][1]
+	return nil
+}
+
+// fakeRepo keeps grants and groups in memory; members lists the tenant's users
+type fakeRepo struct {
+	Repo
+	members map[string]bool
+	groups  map[string]string // id -> name
+	entries []Entry
+}
+
+func (f *fakeRepo) IsMember(_ context.Context, _ store.Queryer, _, id string) (bool, error) {
+	return f.members[id], nil
+}
+
+func (f *fakeRepo) GroupExists(_ context.Context, _ store.Queryer, _, id string) (bool, error) {
+	_, ok := f.groups[id]
+	return ok, nil
+}
+
+func (f *fakeRepo) UpsertEntry(
+	_ context.Context,
+	_ store.Queryer,
+	_ string,
+	res Resource,
+	principalType, principalID string,
+	level Level,
+	inherit bool,
+	_ string,
+) (*Entry, error) {
+	e := Entry{
+		ResourceType: string(res.Type), ResourceID: res.ID, PrincipalType: principalType,
+		PrincipalID: principalID, Level: level.String(), Inherit: inherit,
+	}
+	f.entries = append(f.entries, e)
+	return &e, nil
+}
+
+func (f *fakeRepo) InsertGroup(_ context.Context, _ store.Queryer, _, name string) (*Group, error) {
+	for _, n := range f.groups {
+		if n == name {
+			return nil, &pgconn.PgError{Code: "23505"}
+		}
+	}
+	f.groups[name] = name
+	return &Group{ID: name, Name: name}, nil
+}
+
+func TestACL(t *testing.T) {
+	Convey("FloorFor maps role permissions onto a tenant-wide level", t, func() {
+		So(FloorFor(nil), ShouldEqual, LevelNone)
+		So(FloorFor(map[string]bool{"albums.read": true}), ShouldEqual, LevelNone)
+		So(FloorFor(map[string]bool{"albums.read": true, "albums.read_all": true}), ShouldEqual, LevelView)
+		So(FloorFor(map[string]bool{"albums.write": true}), ShouldEqual, LevelContribute)
+		So(FloorFor(map[string]bool{"albums.share": true, "albums.write": true}), ShouldEqual, LevelManage)
+	})
+
+	Convey("levels round-trip through their enum labels", t, func() {
+		for _, l := range []Level{LevelView, LevelContribute, LevelManage} {
+			p, ok := ParseLevel(l.String())
+			So(ok, ShouldBeTrue)
+			So(p, ShouldEqual, l)
+		}
+		_, ok := ParseLevel("owner")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("a principal's scope carries its floor for the RLS policies", t, func() {
+		s := Principal{TenantID: tenantID, UserID: userID, Floor: LevelContribute}.Scope()
+		So(s.TenantID, ShouldEqual, tenantID)
+		So(s.UserID, ShouldEqual, userID)
+		So(s.Vars, ShouldResemble, map[string]string{"acl_floor": "2"})
+	})
+
+	Convey("Given an Authorizer over one granted album", t, func() {
+		a := NewAuthorizer()
+		q := &rankQueryer{ranks: map[string]int{albumID: int(LevelContribute)}}
+		ctx := context.Background()
+		p := Principal{TenantID: tenantID, UserID: userID}
+
+		Convey("the granted level applies to that album only", func() {
+			l, err := a.Level(ctx, q, p, Album(albumID))
+			So(err, ShouldBeNil)
+			So(l, ShouldEqual, LevelContribute)
+
+			l, _ = a.Level(ctx, q, p, Album(secretID))
+			So(l, ShouldEqual, LevelNone)
+		})
+
+		Convey("the floor lifts albums without grants but never lowers a grant", func() {
+			p.Floor = LevelView
+			l, _ := a.Level(ctx, q, p, Album(secretID))
+			So(l, ShouldEqual, LevelView)
+			l, _ = a.Level(ctx, q, p, Album(albumID))
+			So(l, ShouldEqual, LevelContribute)
+		})
+
+		Convey("malformed ids are never queried", func() {
+			l, err := a.Level(ctx, q, p, Album("1 OR 1=1"))
+			So(err, ShouldBeNil)
+			So(l, ShouldEqual, LevelNone)
+			So(q.queries, ShouldEqual, 0)
+		})
+
+		Convey("a failed lookup is a database error", func() {
+			q.err = errors.New("connection reset")
+			_, err := a.Level(ctx, q, p, Album(albumID))
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeDB), ShouldBeTrue)
+		})
+
+		Convey("Levels looks several resources up at once, floor and malformed ids included", func() {
+			p.Floor = LevelView
+			l, err := a.Levels(ctx, q, p, []Resource{Album(albumID), Album(secretID), Item("1 OR 1=1")})
+			So(err, ShouldBeNil)
+			So(l, ShouldResemble, map[Resource]Level{
+				Album(albumID): LevelContribute, Album(secretID): LevelView, Item("1 OR 1=1"): LevelNone,
+			})
+			So(q.queries, ShouldEqual, 1)
+
+			q.err = errors.New("connection reset")
+			_, err = a.Levels(ctx, q, p, []Resource{Album(albumID)})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeDB), ShouldBeTrue)
+		})
+
+		Convey("Require hides albums the caller can't see and forbids the ones they can't change", func() {
+			So(a.Require(ctx, q, p, Album(albumID), LevelContribute), ShouldBeNil)
+			So(lumErrors.IsErrorCode(a.Require(ctx, q, p, Album(albumID), LevelManage),
+				lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+			So(lumErrors.IsErrorCode(a.Require(ctx, q, p, Album(secretID), LevelView),
+				lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given the ACL service", t, func() {
+		q := &rankQueryer{ranks: map[string]int{albumID: int(LevelManage)}}
+		var scopes []store.Scope
+		withTenantTx = func(_ context.Context, _ store.Beginner, s store.Scope, fn func(store.Queryer) error) error {
+			scopes = append(scopes, s)
+			return fn(q)
+		}
+		repo := &fakeRepo{members: map[string]bool{otherID: true}, groups: map[string]string{}}
+		s := NewService(nil, Config{}, svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))
+		ctx := context.Background()
+		p := Principal{TenantID: tenantID, UserID: userID, Floor: LevelView}
+		grant := GrantInput{PrincipalType: "user", PrincipalID: otherID, Level: LevelView, Inherit: true}
+
+		Convey("a manager grants a tenant member access in the principal's scope", func() {
+			e, err := s.Grant(ctx, p, Album(albumID), grant)
+			So(err, ShouldBeNil)
+			So(e.Level, ShouldEqual, "view")
+			So(repo.entries, ShouldHaveLength, 1)
+			So(scopes, ShouldResemble, []store.Scope{p.Scope()})
+		})
+
+		Convey("the floor alone isn't enough to share", func() {
+			_, err := s.Grant(ctx, p, Album(secretID), grant)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+			So(repo.entries, ShouldBeEmpty)
+		})
+
+		Convey("grants only name members and groups of the tenant", func() {
+			grant.PrincipalID = "00000000-0000-4000-8000-0000000000ff"
+			_, err := s.Grant(ctx, p, Album(albumID), grant)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+
+			grant.PrincipalType = "group"
+			_, err = s.Grant(ctx, p, Album(albumID), grant)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			So(repo.entries, ShouldBeEmpty)
+		})
+
+		Convey("a grant needs a level", func() {
+			grant.Level = LevelNone
+			_, err := s.Grant(ctx, p, Album(albumID), grant)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeValidation), ShouldBeTrue)
+			So(scopes, ShouldBeEmpty)
+		})
+
+		Convey("group names are unique per tenant", func() {
+			_, err := s.CreateGroup(ctx, p, " Family ")
+			So(err, ShouldBeNil)
+			_, err = s.CreateGroup(ctx, p, "Family")
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeDuplicateKey), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package acl
+
+import "time"
+
+// Entry is one ACL grant
+// swagger:model
+type Entry struct {
+	ID            string    `json:"id"             db:"id"`
+	ResourceType  string    `json:"resource_type"  db:"resource_type"`
+	ResourceID    string    `json:"resource_id"    db:"resource_id"`
+	PrincipalType string    `json:"principal_type" db:"principal_type"`
+	PrincipalID   string    `json:"principal_id"   db:"principal_id"`
+	Level         string    `json:"level"          db:"level"`
+	Inherit       bool      `json:"inherit"        db:"inherit"`
+	GrantedBy     *string   `json:"granted_by"     db:"granted_by"`
+	CreatedAt     time.Time `json:"created_at"     db:"created_at"`
+}
+
+// Group is a named set of tenant members ACLs can be granted to
+// swagger:model
+type Group struct {
+	ID        string    `json:"id"         db:"id"`
+	Name      string    `json:"name"       db:"name"`
+	Members   []string  `json:"members"    db:"members"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// GrantDTO is the http data transfer object for granting access to an album or item
+// swagger:model
+type GrantDTO struct {
+	PrincipalType string `json:"principal_type"    validate:"required,oneof=user group"`
+	PrincipalID   string `json:"principal_id"      validate:"required,uuid" format:"uuid"`
+	Level         string `json:"level"             validate:"required,oneof=view contribute manage"`
+	Inherit       *bool  `json:"inherit,omitempty"` // album grants apply to its items; default true
+}
+
+// CreateGroupDTO is the http data transfer object for creating an ACL group
+// swagger:model
+type CreateGroupDTO struct {
+	Name string `json:"name" validate:"required,max=120"`
+}
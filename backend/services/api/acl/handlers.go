@@ -0,0 +1,253 @@
+package acl
+
+import (
+	"net/http"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// resourceFrom maps /acl/{kind}/{id} onto a Resource
+func resourceFrom(r *http.Request) (Resource, error) {
+	id := chi.URLParam(r, "id")
+	var res Resource
+	switch chi.URLParam(r, "kind") {
+	case "albums":
+		res = Album(id)
+	case "items":
+		res = Item(id)
+	default:
+		return res, lumErrors.NotFoundf("not found")
+	}
+	if !uuidRe.MatchString(id) {
+		return res, lumErrors.NotFoundf("%s not found", res.Type)
+	}
+	return res, nil
+}
+
+// ListEntries is the handler endpoint for listing grants on an album or item
+//
+// @Summary     List grants
+// @Description Lists the ACL entries on an album or item. Requires manage access.
+// @Tags        acl
+// @Produce     json
+// @Security    BearerAuth
+// @Param       kind  path      string  true  "albums or items"
+// @Param       id    path      string  true  "album or item id"
+// @Success     200   {array}   Entry
+// @Failure     404   {string}  string          "not found"
+// @Failure     401   {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403   {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/{kind}/{id}/entries [get]
+func (h *ACL) ListEntries(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	res, err := resourceFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	es, err := h.svc.ListEntries(r.Context(), p, res)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(es)
+}
+
+// Grant is the handler endpoint for granting access to an album or item
+//
+// @Summary     Grant access
+// @Description Grants a user or group view/contribute/manage on an album or item. Re-granting updates the level.
+// @Description Album grants apply to the album's items unless inherit is false.
+// @Tags        acl
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       kind   path      string    true  "albums or items"
+// @Param       id     path      string    true  "album or item id"
+// @Param       input  body      GrantDTO  true  "grant"
+// @Success     201    {object}  Entry
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     404    {string}  string          "resource or principal not found"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/{kind}/{id}/entries [post]
+func (h *ACL) Grant(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[GrantDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	res, err := resourceFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	level, _ := ParseLevel(in.Level)
+	inherit := in.Inherit == nil || *in.Inherit
+
+	e, err := h.svc.Grant(r.Context(), p, res, GrantInput{
+		PrincipalType: in.PrincipalType,
+		PrincipalID:   in.PrincipalID,
+		Level:         level,
+		Inherit:       inherit,
+	})
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.CreatedR(e, "")
+}
+
+// Revoke is the handler endpoint for removing a grant
+//
+// @Summary     Revoke access
+// @Tags        acl
+// @Security    BearerAuth
+// @Param       kind     path  string  true  "albums or items"
+// @Param       id       path  string  true  "album or item id"
+// @Param       entryID  path  string  true  "grant id"
+// @Success     204 "revoked; no content"
+// @Failure     404 {string}  string          "not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/{kind}/{id}/entries/{entryID} [delete]
+func (h *ACL) Revoke(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	res, err := resourceFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.Revoke(r.Context(), p, res, chi.URLParam(r, "entryID")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// ListGroups is the handler endpoint for listing ACL groups
+//
+// @Summary     List ACL groups
+// @Tags        acl
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200  {array}   Group
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/groups [get]
+func (h *ACL) ListGroups(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	gs, err := h.svc.ListGroups(r.Context(), p)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(gs)
+}
+
+// CreateGroup is the handler endpoint for creating an ACL group
+//
+// @Summary     Create ACL group
+// @Tags        acl
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body      CreateGroupDTO  true  "group"
+// @Success     201    {object}  Group
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     409    {string}  string          "group already exists"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/groups [post]
+func (h *ACL) CreateGroup(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[CreateGroupDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	g, err := h.svc.CreateGroup(r.Context(), p, in.Name)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.CreatedR(g, "")
+}
+
+// DeleteGroup is the handler endpoint for deleting an ACL group
+//
+// @Summary     Delete ACL group
+// @Description Deletes a group and every grant made to it.
+// @Tags        acl
+// @Security    BearerAuth
+// @Param       id  path  string  true  "group id"
+// @Success     204 "deleted; no content"
+// @Failure     404 {string}  string          "group not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/groups/{id} [delete]
+func (h *ACL) DeleteGroup(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.DeleteGroup(r.Context(), p, chi.URLParam(r, "id")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// AddGroupMember is the handler endpoint for adding a member to an ACL group
+//
+// @Summary     Add ACL group member
+// @Tags        acl
+// @Security    BearerAuth
+// @Param       id      path  string  true  "group id"
+// @Param       userID  path  string  true  "tenant member user id"
+// @Success     204 "added; no content"
+// @Failure     404 {string}  string          "group or member not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/groups/{id}/members/{userID} [put]
+func (h *ACL) AddGroupMember(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.AddGroupMember(r.Context(), p, chi.URLParam(r, "id"), chi.URLParam(r, "userID")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// RemoveGroupMember is the handler endpoint for removing a member from an ACL group
+//
+// @Summary     Remove ACL group member
+// @Tags        acl
+// @Security    BearerAuth
+// @Param       id      path  string  true  "group id"
+// @Param       userID  path  string  true  "member user id"
+// @Success     204 "removed; no content"
+// @Failure     404 {string}  string          "group or member not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /acl/groups/{id}/members/{userID} [delete]
+func (h *ACL) RemoveGroupMember(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.RemoveGroupMember(r.Context(), p, chi.URLParam(r, "id"), chi.URLParam(r, "userID")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
@@ -0,0 +1,205 @@
+package acl
+
+import (
+	"context"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Repo is the ACL data-access interface. Implementations read/write acl_entries, acl_groups and
+// acl_group_members via a store.Queryer, always filtered by tenant.
+type Repo interface {
+	// ListEntries returns the grants on one resource.
+	ListEntries(ctx context.Context, q store.Queryer, tenantID string, res Resource) ([]Entry, error)
+
+	// UpsertEntry grants (or re-grants at a new level) access on res to a principal.
+	UpsertEntry(
+		ctx context.Context,
+		q store.Queryer,
+		tenantID string,
+		res Resource,
+		principalType, principalID string,
+		level Level,
+		inherit bool,
+		grantedBy string,
+	) (*Entry, error)
+
+	// DeleteEntry removes one grant from res. Returns false if no such grant.
+	DeleteEntry(ctx context.Context, q store.Queryer, tenantID string, res Resource, entryID string) (bool, error)
+
+	// IsMember reports whether the user is an active member of the tenant.
+	IsMember(ctx context.Context, q store.Queryer, tenantID, userID string) (bool, error)
+
+	// GroupExists reports whether the group belongs to the tenant.
+	GroupExists(ctx context.Context, q store.Queryer, tenantID, groupID string) (bool, error)
+
+	// ListGroups returns the tenant's groups with their member IDs.
+	ListGroups(ctx context.Context, q store.Queryer, tenantID string) ([]Group, error)
+
+	// InsertGroup creates a group.
+	InsertGroup(ctx context.Context, q store.Queryer, tenantID, name string) (*Group, error)
+
+	// DeleteGroup removes a group and every grant made to it. Returns false if no such group.
+	DeleteGroup(ctx context.Context, q store.Queryer, tenantID, groupID string) (bool, error)
+
+	// AddGroupMember adds a user to a group (idempotent).
+	AddGroupMember(ctx context.Context, q store.Queryer, groupID, userID string) error
+
+	// RemoveGroupMember removes a user from a group. Returns false if they weren't a member.
+	RemoveGroupMember(ctx context.Context, q store.Queryer, groupID, userID string) (bool, error)
+}
+
+const entryColumns = `id::text AS id, resource_type, resource_id::text AS resource_id, principal_type,
+	principal_id::text AS principal_id, level::text AS level, inherit, granted_by::text AS granted_by, created_at`
+
+// ListEntries returns the grants on one resource.
+func (r *repo) ListEntries(ctx context.Context, q store.Queryer, tenantID string, res Resource) ([]Entry, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+entryColumns+`
+		   FROM acl_entries
+		  WHERE tenant_id = $1 AND resource_type = $2 AND resource_id = $3
+		  ORDER BY created_at`,
+		tenantID, string(res.Type), res.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Entry](rows)
+}
+
+// UpsertEntry grants (or re-grants at a new level) access on res to a principal.
+func (r *repo) UpsertEntry(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	res Resource,
+	principalType, principalID string,
+	level Level,
+	inherit bool,
+	grantedBy string,
+) (*Entry, error) {
+	rows, err := q.Query(ctx,
+		`INSERT INTO acl_entries
+		   (tenant_id, resource_type, resource_id, principal_type, principal_id, level, inherit, granted_by)
+		 VALUES ($1, $2, $3, $4, $5, $6::acl_level, $7, NULLIF($8, '')::uuid)
+		 ON CONFLICT (tenant_id, resource_type, resource_id, principal_type, principal_id)
+		 DO UPDATE SET level = EXCLUDED.level, inherit = EXCLUDED.inherit, granted_by = EXCLUDED.granted_by
+		 RETURNING `+entryColumns,
+		tenantID, string(res.Type), res.ID, principalType, principalID, level.String(), inherit, grantedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	e, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Entry])
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// DeleteEntry removes one grant from res. Returns false if no such grant.
+func (r *repo) DeleteEntry(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	res Resource,
+	entryID string,
+) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM acl_entries
+		  WHERE id::text = $4 AND tenant_id = $1 AND resource_type = $2 AND resource_id = $3`,
+		tenantID, string(res.Type), res.ID, entryID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// IsMember reports whether the user is an active member of the tenant.
+func (r *repo) IsMember(ctx context.Context, q store.Queryer, tenantID, userID string) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users_tenants WHERE tenant_id = $1 AND user_id = $2 AND is_active)`,
+		tenantID, userID,
+	).Scan(&ok)
+	return ok, err
+}
+
+// GroupExists reports whether the group belongs to the tenant.
+func (r *repo) GroupExists(ctx context.Context, q store.Queryer, tenantID, groupID string) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM acl_groups WHERE tenant_id = $1 AND id::text = $2)`,
+		tenantID, groupID,
+	).Scan(&ok)
+	return ok, err
+}
+
+const groupColumns = `g.id::text AS id, g.name,
+	COALESCE(ARRAY(SELECT gm.user_id::text FROM acl_group_members gm WHERE gm.group_id = g.id), '{}') AS members,
+	g.created_at`
+
+// ListGroups returns the tenant's groups with their member IDs.
+func (r *repo) ListGroups(ctx context.Context, q store.Queryer, tenantID string) ([]Group, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+groupColumns+` FROM acl_groups g WHERE g.tenant_id = $1 ORDER BY g.name`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Group](rows)
+}
+
+// InsertGroup creates a group.
+func (r *repo) InsertGroup(ctx context.Context, q store.Queryer, tenantID, name string) (*Group, error) {
+	g := Group{Name: name, Members: []string{}}
+	err := q.QueryRow(ctx,
+		`INSERT INTO acl_groups (tenant_id, name) VALUES ($1, $2) RETURNING id::text, created_at`,
+		tenantID, name,
+	).Scan(&g.ID, &g.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// DeleteGroup removes a group and every grant made to it. Returns false if no such group.
+func (r *repo) DeleteGroup(ctx context.Context, q store.Queryer, tenantID, groupID string) (bool, error) {
+	// principal_id can't carry a FK (it points at users or groups), so clean up grants by hand
+	if _, err := q.Exec(ctx,
+		`DELETE FROM acl_entries WHERE tenant_id = $1 AND principal_type = 'group' AND principal_id::text = $2`,
+		tenantID, groupID,
+	); err != nil {
+		return false, err
+	}
+	tag, err := q.Exec(ctx, `DELETE FROM acl_groups WHERE tenant_id = $1 AND id::text = $2`, tenantID, groupID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AddGroupMember adds a user to a group (idempotent).
+func (r *repo) AddGroupMember(ctx context.Context, q store.Queryer, groupID, userID string) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO acl_group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		groupID, userID,
+	)
+	return err
+}
+
+// RemoveGroupMember removes a user from a group. Returns false if they weren't a member.
+func (r *repo) RemoveGroupMember(ctx context.Context, q store.Queryer, groupID, userID string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM acl_group_members WHERE group_id::text = $1 AND user_id::text = $2`,
+		groupID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,221 @@
+package acl
+
+import (
+	"context"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTenantTx = func(ctx context.Context, b store.Beginner, s store.Scope, fn func(q store.Queryer) error) error {
+		return store.WithTenantTx(ctx, b, s, fn)
+	}
+)
+
+// GrantInput is the service contract for granting access
+type GrantInput struct {
+	PrincipalType string
+	PrincipalID   string
+	Level         Level
+	Inherit       bool
+}
+
+// Service defines the ACL management operations exposed to HTTP handlers. Every call runs in a
+// tenant-scoped transaction as the principal
+type Service interface {
+	// ListEntries returns the grants on res; requires manage
+	ListEntries(ctx context.Context, p Principal, res Resource) ([]Entry, error)
+
+	// Grant gives a user or group access to res; requires manage
+	Grant(ctx context.Context, p Principal, res Resource, in GrantInput) (*Entry, error)
+
+	// Revoke removes a grant from res; requires manage
+	Revoke(ctx context.Context, p Principal, res Resource, entryID string) error
+
+	// ListGroups returns the tenant's ACL groups
+	ListGroups(ctx context.Context, p Principal) ([]Group, error)
+
+	// CreateGroup creates an ACL group
+	CreateGroup(ctx context.Context, p Principal, name string) (*Group, error)
+
+	// DeleteGroup removes a group along with its grants
+	DeleteGroup(ctx context.Context, p Principal, groupID string) error
+
+	// AddGroupMember adds a tenant member to a group
+	AddGroupMember(ctx context.Context, p Principal, groupID, userID string) error
+
+	// RemoveGroupMember removes a user from a group
+	RemoveGroupMember(ctx context.Context, p Principal, groupID, userID string) error
+}
+
+// ListEntries returns the grants on res; requires manage
+func (s *svc) ListEntries(ctx context.Context, p Principal, res Resource) ([]Entry, error) {
+	var out []Entry
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, res, LevelManage); err != nil {
+			return err
+		}
+		es, err := s.Repo.ListEntries(ctx, q, p.TenantID, res)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list grants")
+		}
+		out = es
+		return nil
+	})
+	return out, err
+}
+
+// Grant gives a user or group access to res; requires manage
+func (s *svc) Grant(ctx context.Context, p Principal, res Resource, in GrantInput) (*Entry, error) {
+	if in.Level == LevelNone {
+		return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid level", "level")
+	}
+
+	var out *Entry
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, res, LevelManage); err != nil {
+			return err
+		}
+		if err := s.checkPrincipal(ctx, q, p.TenantID, in.PrincipalType, in.PrincipalID); err != nil {
+			return err
+		}
+		e, err := s.Repo.UpsertEntry(
+			ctx, q, p.TenantID, res, in.PrincipalType, in.PrincipalID, in.Level, in.Inherit, p.UserID,
+		)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "grant access")
+		}
+		out = e
+		return nil
+	})
+	return out, err
+}
+
+// Revoke removes a grant from res; requires manage
+func (s *svc) Revoke(ctx context.Context, p Principal, res Resource, entryID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, res, LevelManage); err != nil {
+			return err
+		}
+		ok, err := s.Repo.DeleteEntry(ctx, q, p.TenantID, res, entryID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "revoke access")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("grant not found")
+		}
+		return nil
+	})
+}
+
+// ListGroups returns the tenant's ACL groups
+func (s *svc) ListGroups(ctx context.Context, p Principal) ([]Group, error) {
+	var out []Group
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		gs, err := s.Repo.ListGroups(ctx, q, p.TenantID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list groups")
+		}
+		out = gs
+		return nil
+	})
+	return out, err
+}
+
+// CreateGroup creates an ACL group
+func (s *svc) CreateGroup(ctx context.Context, p Principal, name string) (*Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "name is required", "name")
+	}
+
+	var out *Group
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		g, err := s.Repo.InsertGroup(ctx, q, p.TenantID, name)
+		if err != nil {
+			if c := lumErrors.DBErrorCode(err); c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+				return lumErrors.DuplicateKeyFieldf("name", "group already exists")
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create group")
+		}
+		out = g
+		return nil
+	})
+	return out, err
+}
+
+// DeleteGroup removes a group along with its grants
+func (s *svc) DeleteGroup(ctx context.Context, p Principal, groupID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		ok, err := s.Repo.DeleteGroup(ctx, q, p.TenantID, groupID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "delete group")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("group not found")
+		}
+		return nil
+	})
+}
+
+// AddGroupMember adds a tenant member to a group
+func (s *svc) AddGroupMember(ctx context.Context, p Principal, groupID, userID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.checkPrincipal(ctx, q, p.TenantID, "group", groupID); err != nil {
+			return err
+		}
+		if err := s.checkPrincipal(ctx, q, p.TenantID, "user", userID); err != nil {
+			return err
+		}
+		if err := s.Repo.AddGroupMember(ctx, q, groupID, userID); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "add group member")
+		}
+		return nil
+	})
+}
+
+// RemoveGroupMember removes a user from a group
+func (s *svc) RemoveGroupMember(ctx context.Context, p Principal, groupID, userID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.checkPrincipal(ctx, q, p.TenantID, "group", groupID); err != nil {
+			return err
+		}
+		ok, err := s.Repo.RemoveGroupMember(ctx, q, groupID, userID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "remove group member")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("member not found")
+		}
+		return nil
+	})
+}
+
+// checkPrincipal makes sure grants only ever name members and groups of the same tenant
+func (s *svc) checkPrincipal(ctx context.Context, q store.Queryer, tenantID, kind, id string) error {
+	if !uuidRe.MatchString(id) {
+		return lumErrors.NotFoundf("%s not found", kind)
+	}
+	var (
+		ok  bool
+		err error
+	)
+	switch kind {
+	case "user":
+		ok, err = s.Repo.IsMember(ctx, q, tenantID, id)
+	case "group":
+		ok, err = s.Repo.GroupExists(ctx, q, tenantID, id)
+	default:
+		return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid principal_type", "principal_type")
+	}
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "check %s", kind)
+	}
+	if !ok {
+		return lumErrors.NotFoundf("%s not found", kind)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Package albums serves tenant albums and their items. Every query runs in a tenant-scoped
+// transaction so the ACL row-level security policies apply on top of the acl.Authorizer checks
+package albums
+
+import (
+	"context"
+
+	"lumium/lib/lumnet"
+	"lumium/lib/svckit"
+	"lumium/services/api/acl"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	authz *acl.Authorizer
+	read  func(ctx context.Context) *pgxpool.Pool // listings; may be a lagging replica
+}
+
+// Config is the configuration wrapper for albums
+type Config struct{}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+// Listings read from read, or from db when read is nil
+func NewService(
+	db *pgxpool.Pool,
+	read func(ctx context.Context) *pgxpool.Pool,
+	c Config,
+	o ...svckit.Opt[*pgxpool.Pool, Repo, Config],
+) Service {
+	if read == nil {
+		read = func(context.Context) *pgxpool.Pool { return db }
+	}
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), authz: acl.NewAuthorizer(), read: read}
+}
+
+// Albums is the wrapper for the /albums service
+type Albums struct {
+	app     *handlers.App
+	svc     Service
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new Albums pointer
+func New(app *handlers.App, perms auth.PermissionResolver) *Albums {
+	return &Albums{app: app, svc: NewService(app.DB, app.Reader, Config{}), authCfg: auth.LoadConfig(), perms: perms}
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *Albums) Wire(r chi.Router) {
+	r.Route("/albums", func(r chi.Router) {
+		// no codes: resolves the caller's permissions so the tenant-wide ACL floor is known
+		r.Use(auth.Authenticate(h.authCfg), auth.RequirePermission(h.perms))
+
+		// reads are private and revalidated on every use: a 304 when nothing changed
+		read := r.With(lumnet.CacheControl(lumnet.CachePrivate))
+
+		read.With(lumnet.ETags).Get("/", lumnet.Adapt(h.List))
+		r.With(auth.RequirePermission(h.perms, "albums.write"), auth.Idempotent(h.app.Idempotency)).
+			Post("/", lumnet.Adapt(h.Create))
+		read.Get("/{id}", lumnet.Adapt(h.Get))
+		r.Delete("/{id}", lumnet.Adapt(h.Delete))
+
+		read.With(lumnet.ETags).Get("/{id}/items", lumnet.Adapt(h.ListItems))
+		r.With(auth.Idempotent(h.app.Idempotency)).Post("/{id}/items", lumnet.Adapt(h.AddItem))
+		r.Delete("/{id}/items/{itemID}", lumnet.Adapt(h.RemoveItem))
+	})
+	lumnet.InitValidator()
+}
@@ -0,0 +1,213 @@
+package albums
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+	"lumium/services/api/acl"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	tenantID = "00000000-0000-4000-8000-000000000001"
+	userID   = "00000000-0000-4000-8000-000000000002"
+	sharedID = "00000000-0000-4000-8000-0000000000a1"
+	privID   = "00000000-0000-4000-8000-0000000000a2"
+	photoID  = "00000000-0000-4000-8000-0000000000f1"
+)
+
+// aclQueryer answers the Authorizer from an album id -> rank map and records outbox subjects
+type aclQueryer struct {
+	ranks  map[string]int
+	events []string
+}
+
+func (q *aclQueryer) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	return rankRow(q.ranks[args[3].(string)])
+}
+
+func (q *aclQueryer) Query(context.Context, string, ...any) (pgx.Rows, error) { return nil, nil }
+
+func (q *aclQueryer) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "INSERT INTO outbox") {
+		q.events = append(q.events, args[2].(string))
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+type rankRow int
+
+func (r rankRow) Scan(dest ...any) error {
+	*dest[0].(*int) = int(r)
+	return nil
+}
+
+// fakeRepo keeps albums and their items in memory
+type fakeRepo struct {
+	seq    int
+	albums map[string]*Album
+	items  map[string][]string // album id -> item ids
+	floors []int
+}
+
+func (f *fakeRepo) ListVisible(
+	_ context.Context,
+	_ store.Queryer,
+	_, _ string,
+	floor int,
+	page store.Page,
+) ([]Album, error) {
+	f.floors = append(f.floors, floor)
+	var out []Album
+	for _, id := range []string{sharedID, privID} {
+		if a, ok := f.albums[id]; ok && len(out) < page.Fetch() {
+			out = append(out, *a)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) Get(_ context.Context, _ store.Queryer, _, albumID string) (*Album, error) {
+	a, ok := f.albums[albumID]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return a, nil
+}
+
+func (f *fakeRepo) Insert(_ context.Context, _ store.Queryer, _, ownerID, title, description string) (*Album, error) {
+	f.seq++
+	a := &Album{ID: fmt.Sprintf("new-%d", f.seq), OwnerID: &ownerID, Title: title, Description: description}
+	f.albums[a.ID] = a
+	return a, nil
+}
+
+func (f *fakeRepo) Delete(_ context.Context, _ store.Queryer, _, albumID string) (bool, error) {
+	_, ok := f.albums[albumID]
+	delete(f.albums, albumID)
+	return ok, nil
+}
+
+func (f *fakeRepo) ListItems(_ context.Context, _ store.Queryer, _, albumID string) ([]Item, error) {
+	var out []Item
+	for _, id := range f.items[albumID] {
+		out = append(out, Item{ItemID: id})
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) AddItem(_ context.Context, _ store.Queryer, _, albumID, itemID, _ string) error {
+	f.items[albumID] = append(f.items[albumID], itemID)
+	return nil
+}
+
+func (f *fakeRepo) RemoveItem(_ context.Context, _ store.Queryer, _, albumID, itemID string) (bool, error) {
+	for i, id := range f.items[albumID] {
+		if id == itemID {
+			f.items[albumID] = append(f.items[albumID][:i], f.items[albumID][i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAlbums(t *testing.T) {
+	Convey("Given a user with a view grant on one of two albums", t, func() {
+		q := &aclQueryer{ranks: map[string]int{sharedID: int(acl.LevelView)}}
+		var scopes []store.Scope
+		withTenantTx = func(_ context.Context, _ store.Beginner, s store.Scope, fn func(store.Queryer) error) error {
+			scopes = append(scopes, s)
+			return fn(q)
+		}
+		now := time.Now()
+		repo := &fakeRepo{
+			albums: map[string]*Album{
+				sharedID: {ID: sharedID, Title: "Summer", CreatedAt: now},
+				privID:   {ID: privID, Title: "Taxes", CreatedAt: now},
+			},
+			items: map[string][]string{},
+		}
+		s := NewService(nil, nil, Config{}, svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))
+		ctx := context.Background()
+		p := acl.Principal{TenantID: tenantID, UserID: userID}
+
+		Convey("they can read the shared album but not find the other", func() {
+			a, err := s.Get(ctx, p, sharedID)
+			So(err, ShouldBeNil)
+			So(a.Title, ShouldEqual, "Summer")
+
+			_, err = s.Get(ctx, p, privID)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			_, err = s.ListItems(ctx, p, privID)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+		})
+
+		Convey("every call runs in the principal's RLS scope", func() {
+			_, _ = s.Get(ctx, p, sharedID)
+			So(scopes, ShouldResemble, []store.Scope{p.Scope()})
+		})
+
+		Convey("viewing isn't enough to change or delete it", func() {
+			err := s.AddItem(ctx, p, sharedID, photoID)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+			So(lumErrors.IsErrorCode(s.Delete(ctx, p, sharedID), lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+			So(repo.items, ShouldBeEmpty)
+			So(repo.albums, ShouldContainKey, sharedID)
+		})
+
+		Convey("listing passes the caller's floor down to the query and pages the result", func() {
+			p.Floor = acl.LevelView
+			page := store.Page{Sort: []store.SortColumn{{Name: "created_at", Column: "a.created_at"}}, Limit: 1}
+			as, next, err := s.List(ctx, p, page)
+			So(err, ShouldBeNil)
+			So(as, ShouldHaveLength, 1)
+			So(next, ShouldResemble, []string{now.Format(time.RFC3339Nano)})
+			So(repo.floors, ShouldResemble, []int{int(acl.LevelView)})
+		})
+
+		Convey("with contribute they add and remove items, announcing additions", func() {
+			q.ranks[sharedID] = int(acl.LevelContribute)
+			So(s.AddItem(ctx, p, sharedID, photoID), ShouldBeNil)
+			So(repo.items[sharedID], ShouldResemble, []string{photoID})
+			So(q.events, ShouldResemble, []string{"events.album.item_added"})
+
+			So(s.RemoveItem(ctx, p, sharedID, photoID), ShouldBeNil)
+			So(lumErrors.IsErrorCode(s.RemoveItem(ctx, p, sharedID, photoID), lumErrors.ErrorCodeNotFound),
+				ShouldBeTrue)
+		})
+
+		Convey("a tenant-wide floor still can't add to an album that doesn't exist", func() {
+			p.Floor = acl.LevelManage
+			err := s.AddItem(ctx, p, "00000000-0000-4000-8000-0000000000a9", photoID)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			So(q.events, ShouldBeEmpty)
+		})
+
+		Convey("with manage they delete it", func() {
+			q.ranks[sharedID] = int(acl.LevelManage)
+			So(s.Delete(ctx, p, sharedID), ShouldBeNil)
+			So(repo.albums, ShouldNotContainKey, sharedID)
+		})
+
+		Convey("creating an album records the owner and announces it", func() {
+			a, err := s.Create(ctx, p, "  Trip  ", "")
+			So(err, ShouldBeNil)
+			So(a.Title, ShouldEqual, "Trip")
+			So(*a.OwnerID, ShouldEqual, userID)
+			So(q.events, ShouldResemble, []string{"events.album.created"})
+
+			_, err = s.Create(ctx, p, " ", "")
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeValidation), ShouldBeTrue)
+		})
+	})
+}
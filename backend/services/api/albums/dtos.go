@@ -0,0 +1,97 @@
+package albums
+
+import (
+	"time"
+
+	"lumium/lib/lumnet"
+	"lumium/lib/store"
+)
+
+// Album is a tenant album
+// swagger:model
+type Album struct {
+	ID          string    `json:"id"          db:"id"`
+	OwnerID     *string   `json:"owner_id"    db:"owner_id"`
+	Title       string    `json:"title"       db:"title"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at"  db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"  db:"updated_at"`
+}
+
+// ETag is the album's version, for conditional requests
+func (a Album) ETag() string {
+	return lumnet.VersionETag(a.ID, a.UpdatedAt)
+}
+
+// Item is an entry in an album
+// swagger:model
+type Item struct {
+	ItemID  string    `json:"item_id"  db:"item_id"`
+	AddedBy *string   `json:"added_by" db:"added_by"`
+	AddedAt time.Time `json:"added_at" db:"added_at"`
+}
+
+// albumPages is the sort whitelist for album listings
+var albumPages = lumnet.PageSpec{
+	Fields: store.SortFields{
+		"created_at": "a.created_at",
+		"updated_at": "a.updated_at",
+		"title":      "a.title",
+		"id":         "a.id",
+	},
+	DefaultSort: "-created_at",
+	Tiebreak:    "id",
+}
+
+// AlbumPage is a page of albums. Total is -1: visibility is decided per album, so counting
+// would mean scanning every album
+// swagger:model
+type AlbumPage struct {
+	Items []Album  `json:"items"`
+	Total int64    `json:"total"`
+	Meta  PageMeta `json:"meta"`
+}
+
+// PageMeta describes a keyset page
+// swagger:model
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListAlbumsQuery is the query string of GET /albums
+type ListAlbumsQuery struct {
+	lumnet.PageQuery
+}
+
+// sortKey is the album's value for each sort column, as text for the keyset cursor
+func (a Album) sortKey(cols []store.SortColumn) []string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case "created_at":
+			out[i] = a.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			out[i] = a.UpdatedAt.Format(time.RFC3339Nano)
+		case "title":
+			out[i] = a.Title
+		case "id":
+			out[i] = a.ID
+		}
+	}
+	return out
+}
+
+// CreateAlbumDTO is the http data transfer object for creating an album
+// swagger:model
+type CreateAlbumDTO struct {
+	Title       string `json:"title"                 validate:"required,max=200"`
+	Description string `json:"description,omitempty" validate:"omitempty,max=2000"`
+}
+
+// AddItemDTO is the http data transfer object for adding an item to an album
+// swagger:model
+type AddItemDTO struct {
+	ItemID string `json:"item_id" validate:"required,uuid" format:"uuid"`
+}
@@ -0,0 +1,203 @@
+package albums
+
+import (
+	"net/http"
+
+	"lumium/lib/lumnet"
+	"lumium/services/api/acl"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// List is the handler endpoint for listing albums
+//
+// @Summary     List albums
+// @Description Lists the albums the caller can view, through their role or album grants, a page at a
+// @Description time. Follow meta.next_cursor (or the Link header's rel="next") for the next page.
+// @Tags        albums
+// @Produce     json
+// @Security    BearerAuth
+// @Param       sort    query     string  false  "created_at, updated_at, title or id; -x = desc"  default(-created_at)
+// @Param       limit   query     int     false  "page size, 1-200"  default(50)
+// @Param       cursor  query     string  false  "opaque cursor from the previous page"
+// @Success     200     {object}  AlbumPage
+// @Failure     400     {string}  string          "invalid sort, limit or cursor"
+// @Failure     401     {object}  auth.ErrorWire  "unauthorized"
+// @Router      /albums [get]
+func (h *Albums) List(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	q, err := lumnet.ParseQuery[ListAlbumsQuery](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	page, err := albumPages.Page(q.PageQuery, lumnet.Cursors())
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	as, after, err := h.svc.List(r.Context(), p, page)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.ListPageR(as, -1, page, lumnet.NextCursor(lumnet.Cursors(), page, after))
+}
+
+// Create is the handler endpoint for creating an album
+//
+// @Summary     Create album
+// @Description Creates an album owned by the caller. Owners always hold manage access.
+// @Tags        albums
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body      CreateAlbumDTO  true  "album"
+// @Success     201    {object}  Album
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Router      /albums [post]
+func (h *Albums) Create(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[CreateAlbumDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	a, err := h.svc.Create(r.Context(), p, in.Title, in.Description)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	w.Header().Set("ETag", a.ETag())
+	return lumnet.CreatedR(a, "/api/v1/albums/"+a.ID)
+}
+
+// Get is the handler endpoint for a single album
+//
+// @Summary     Get album
+// @Tags        albums
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id   path      string  true  "album id"
+// @Param       If-None-Match  header  string  false  "ETag of the cached copy"
+// @Success     200  {object}  Album
+// @Success     304  "not modified"
+// @Failure     404  {string}  string          "album not found"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Router      /albums/{id} [get]
+func (h *Albums) Get(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	a, err := h.svc.Get(r.Context(), p, chi.URLParam(r, "id"))
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if lumnet.NotModified(w, r, a.ETag(), a.UpdatedAt) {
+		return nil
+	}
+	return lumnet.OKR(a)
+}
+
+// Delete is the handler endpoint for deleting an album
+//
+// @Summary     Delete album
+// @Description Deletes an album and the grants on it. Requires manage access.
+// @Tags        albums
+// @Security    BearerAuth
+// @Param       id  path  string  true  "album id"
+// @Success     204 "deleted; no content"
+// @Failure     404 {string}  string          "album not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /albums/{id} [delete]
+func (h *Albums) Delete(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.Delete(r.Context(), p, chi.URLParam(r, "id")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// ListItems is the handler endpoint for an album's items
+//
+// @Summary     List album items
+// @Tags        albums
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id   path      string  true  "album id"
+// @Success     200  {array}   Item
+// @Failure     404  {string}  string          "album not found"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Router      /albums/{id}/items [get]
+func (h *Albums) ListItems(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	items, err := h.svc.ListItems(r.Context(), p, chi.URLParam(r, "id"))
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(items)
+}
+
+// AddItem is the handler endpoint for adding an item to an album
+//
+// @Summary     Add album item
+// @Description Adds an item to the album. Requires contribute access.
+// @Tags        albums
+// @Accept      json
+// @Security    BearerAuth
+// @Param       id     path  string      true  "album id"
+// @Param       input  body  AddItemDTO  true  "item"
+// @Success     204 "added; no content"
+// @Failure     400 {string}  string          "bad request / validation error"
+// @Failure     404 {string}  string          "album not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /albums/{id}/items [post]
+func (h *Albums) AddItem(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[AddItemDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.AddItem(r.Context(), p, chi.URLParam(r, "id"), in.ItemID); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// RemoveItem is the handler endpoint for removing an item from an album
+//
+// @Summary     Remove album item
+// @Tags        albums
+// @Security    BearerAuth
+// @Param       id      path  string  true  "album id"
+// @Param       itemID  path  string  true  "item id"
+// @Success     204 "removed; no content"
+// @Failure     404 {string}  string          "album or item not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /albums/{id}/items/{itemID} [delete]
+func (h *Albums) RemoveItem(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.RemoveItem(r.Context(), p, chi.URLParam(r, "id"), chi.URLParam(r, "itemID")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
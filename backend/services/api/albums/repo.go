@@ -0,0 +1,157 @@
+package albums
+
+import (
+	"context"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Repo is the albums data-access interface. Callers pass the tenant-scoped transaction from
+// store.WithTenantTx so RLS applies; the queries filter by ACL as well for roles that bypass it.
+type Repo interface {
+	// ListVisible returns a keyset page of the albums userID can view, given the tenant-wide ACL
+	// floor. It fetches page.Fetch() rows; the caller trims the extra one.
+	ListVisible(ctx context.Context, q store.Queryer, tenantID, userID string, floor int, page store.Page) ([]Album, error)
+
+	// Get returns one album, or pgx.ErrNoRows.
+	Get(ctx context.Context, q store.Queryer, tenantID, albumID string) (*Album, error)
+
+	// Insert creates an album owned by ownerID.
+	Insert(ctx context.Context, q store.Queryer, tenantID, ownerID, title, description string) (*Album, error)
+
+	// Delete removes an album, its items and the grants on it.
+	Delete(ctx context.Context, q store.Queryer, tenantID, albumID string) (bool, error)
+
+	// ListItems returns the album's items, newest first.
+	ListItems(ctx context.Context, q store.Queryer, tenantID, albumID string) ([]Item, error)
+
+	// AddItem puts an item in the album (idempotent).
+	AddItem(ctx context.Context, q store.Queryer, tenantID, albumID, itemID, addedBy string) error
+
+	// RemoveItem takes an item out of the album. Returns false if it wasn't there.
+	RemoveItem(ctx context.Context, q store.Queryer, tenantID, albumID, itemID string) (bool, error)
+}
+
+const albumColumns = `a.id::text AS id, a.owner_id::text AS owner_id, a.title, a.description,
+	a.created_at, a.updated_at`
+
+// ListVisible returns a keyset page of the albums userID can view, given the tenant-wide ACL floor.
+func (r *repo) ListVisible(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, userID string,
+	floor int,
+	page store.Page,
+) ([]Album, error) {
+	after, afterArgs, err := page.Where(5)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx,
+		`SELECT `+albumColumns+`
+		   FROM albums a
+		  WHERE a.tenant_id = $1
+		    AND ($3 >= 1 OR acl_effective_level(a.tenant_id, $2::uuid, 'album', a.id) >= 1)
+		    AND `+after+`
+		  ORDER BY `+page.OrderBy()+`
+		  LIMIT $4`,
+		append([]any{tenantID, userID, floor, page.Fetch()}, afterArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Album](rows)
+}
+
+// Get returns one album, or pgx.ErrNoRows.
+func (r *repo) Get(ctx context.Context, q store.Queryer, tenantID, albumID string) (*Album, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+albumColumns+` FROM albums a WHERE a.tenant_id = $1 AND a.id = $2`,
+		tenantID, albumID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Album])
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Insert creates an album owned by ownerID.
+func (r *repo) Insert(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, ownerID, title, description string,
+) (*Album, error) {
+	rows, err := q.Query(ctx,
+		`INSERT INTO albums AS a (tenant_id, owner_id, title, description)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+albumColumns,
+		tenantID, ownerID, title, description,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Album])
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Delete removes an album, its items and the grants on it.
+func (r *repo) Delete(ctx context.Context, q store.Queryer, tenantID, albumID string) (bool, error) {
+	if _, err := q.Exec(ctx,
+		`DELETE FROM acl_entries WHERE tenant_id = $1 AND resource_type = 'album' AND resource_id = $2`,
+		tenantID, albumID,
+	); err != nil {
+		return false, err
+	}
+	tag, err := q.Exec(ctx, `DELETE FROM albums WHERE tenant_id = $1 AND id = $2`, tenantID, albumID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListItems returns the album's items, newest first.
+func (r *repo) ListItems(ctx context.Context, q store.Queryer, tenantID, albumID string) ([]Item, error) {
+	rows, err := q.Query(ctx,
+		`SELECT item_id::text AS item_id, added_by::text AS added_by, added_at
+		   FROM album_items
+		  WHERE tenant_id = $1 AND album_id = $2
+		  ORDER BY added_at DESC`,
+		tenantID, albumID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Item](rows)
+}
+
+// AddItem puts an item in the album (idempotent).
+func (r *repo) AddItem(ctx context.Context, q store.Queryer, tenantID, albumID, itemID, addedBy string) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO album_items (album_id, tenant_id, item_id, added_by)
+		 VALUES ($2, $1, $3, $4)
+		 ON CONFLICT (album_id, item_id) DO NOTHING`,
+		tenantID, albumID, itemID, addedBy,
+	)
+	return err
+}
+
+// RemoveItem takes an item out of the album. Returns false if it wasn't there.
+func (r *repo) RemoveItem(ctx context.Context, q store.Queryer, tenantID, albumID, itemID string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM album_items WHERE tenant_id = $1 AND album_id = $2 AND item_id::text = $3`,
+		tenantID, albumID, itemID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,186 @@
+package albums
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/outbox"
+	"lumium/lib/store"
+	"lumium/services/api/acl"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTenantTx = func(ctx context.Context, b store.Beginner, s store.Scope, fn func(q store.Queryer) error) error {
+		return store.WithTenantTx(ctx, b, s, fn)
+	}
+)
+
+// Service defines the album operations exposed to HTTP handlers. Access is decided per album by
+// the acl.Authorizer: view to read, contribute to add/remove items, manage to delete
+type Service interface {
+	// List returns a page of the albums the principal can view, and the next page's sort key
+	List(ctx context.Context, p acl.Principal, page store.Page) ([]Album, []string, error)
+
+	// Get returns one album; requires view
+	Get(ctx context.Context, p acl.Principal, albumID string) (*Album, error)
+
+	// Create makes a new album owned by the principal
+	Create(ctx context.Context, p acl.Principal, title, description string) (*Album, error)
+
+	// Delete removes an album; requires manage
+	Delete(ctx context.Context, p acl.Principal, albumID string) error
+
+	// ListItems returns the album's items; requires view
+	ListItems(ctx context.Context, p acl.Principal, albumID string) ([]Item, error)
+
+	// AddItem puts an item in the album; requires contribute
+	AddItem(ctx context.Context, p acl.Principal, albumID, itemID string) error
+
+	// RemoveItem takes an item out of the album; requires contribute
+	RemoveItem(ctx context.Context, p acl.Principal, albumID, itemID string) error
+}
+
+// List returns a page of the albums the principal can view. It reads from a replica: an album
+// created a moment ago may be missing until replication catches up, unless ctx is
+// store.ReadYourWrites
+func (s *svc) List(ctx context.Context, p acl.Principal, page store.Page) ([]Album, []string, error) {
+	var out []Album
+	err := withTenantTx(ctx, s.read(ctx), p.Scope(), func(q store.Queryer) error {
+		as, err := s.Repo.ListVisible(ctx, q, p.TenantID, p.UserID, int(p.Floor), page)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list albums")
+		}
+		out = as
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	out, next := store.Trim(page, out, func(a Album) []string { return a.sortKey(page.Sort) })
+	return out, next, nil
+}
+
+// Get returns one album; requires view
+func (s *svc) Get(ctx context.Context, p acl.Principal, albumID string) (*Album, error) {
+	var out *Album
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, acl.Album(albumID), acl.LevelView); err != nil {
+			return err
+		}
+		a, err := s.Repo.Get(ctx, q, p.TenantID, albumID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lumErrors.NotFoundf("album not found")
+		}
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "get album")
+		}
+		out = a
+		return nil
+	})
+	return out, err
+}
+
+// Create makes a new album owned by the principal
+func (s *svc) Create(ctx context.Context, p acl.Principal, title, description string) (*Album, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "title is required", "title")
+	}
+
+	var out *Album
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		a, err := s.Repo.Insert(ctx, q, p.TenantID, p.UserID, title, description)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create album")
+		}
+		out = a
+		return outbox.Enqueue(ctx, q, outbox.Event{
+			AggregateType: "album",
+			AggregateID:   a.ID,
+			Subject:       "events.album.created",
+			Payload:       map[string]string{"tenant_id": p.TenantID, "album_id": a.ID, "owner_id": p.UserID},
+		})
+	})
+	return out, err
+}
+
+// Delete removes an album; requires manage
+func (s *svc) Delete(ctx context.Context, p acl.Principal, albumID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, acl.Album(albumID), acl.LevelManage); err != nil {
+			return err
+		}
+		ok, err := s.Repo.Delete(ctx, q, p.TenantID, albumID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "delete album")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("album not found")
+		}
+		return nil
+	})
+}
+
+// ListItems returns the album's items; requires view
+func (s *svc) ListItems(ctx context.Context, p acl.Principal, albumID string) ([]Item, error) {
+	var out []Item
+	err := withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, acl.Album(albumID), acl.LevelView); err != nil {
+			return err
+		}
+		items, err := s.Repo.ListItems(ctx, q, p.TenantID, albumID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list items")
+		}
+		out = items
+		return nil
+	})
+	return out, err
+}
+
+// AddItem puts an item in the album; requires contribute
+func (s *svc) AddItem(ctx context.Context, p acl.Principal, albumID, itemID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, acl.Album(albumID), acl.LevelContribute); err != nil {
+			return err
+		}
+		// a tenant-wide floor passes Require for any ID, so confirm the album exists
+		if _, err := s.Repo.Get(ctx, q, p.TenantID, albumID); errors.Is(err, pgx.ErrNoRows) {
+			return lumErrors.NotFoundf("album not found")
+		} else if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "get album")
+		}
+		// the album may be deleted concurrently; that FK violation is a 409, not a 500
+		if err := s.Repo.AddItem(ctx, q, p.TenantID, albumID, itemID, p.UserID); err != nil {
+			return lumErrors.DBConstraintErrorf(err, "add item")
+		}
+		return outbox.Enqueue(ctx, q, outbox.Event{
+			AggregateType: "album",
+			AggregateID:   albumID,
+			Subject:       "events.album.item_added",
+			Payload:       map[string]string{"tenant_id": p.TenantID, "album_id": albumID, "item_id": itemID},
+		})
+	})
+}
+
+// RemoveItem takes an item out of the album; requires contribute
+func (s *svc) RemoveItem(ctx context.Context, p acl.Principal, albumID, itemID string) error {
+	return withTenantTx(ctx, s.DB, p.Scope(), func(q store.Queryer) error {
+		if err := s.authz.Require(ctx, q, p, acl.Album(albumID), acl.LevelContribute); err != nil {
+			return err
+		}
+		ok, err := s.Repo.RemoveItem(ctx, q, p.TenantID, albumID, itemID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "remove item")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("item not found")
+		}
+		return nil
+	})
+}
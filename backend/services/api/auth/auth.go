@@ -2,6 +2,8 @@
 package auth
 
 import (
+	"net/http"
+
 	"lumium/lib/lumnet"
 	"lumium/lib/svckit"
 	"lumium/services/api/handlers"
@@ -13,11 +15,15 @@ import (
 // svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
 type svc struct {
 	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	notify Notifier
+	sms    SMSGateway
 }
 
 // NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+// Notifications are only noted in the log, without their bodies, until a delivery channel is
+// configured; SMS goes through the gateway selected by AUTH_SMS_GATEWAY_URL
 func NewService(db *pgxpool.Pool, c Config, o ...svckit.Opt[*pgxpool.Pool, Repo, Config]) Service {
-	return &svc{Kit: svckit.New(db, NewRepo, c, o...)}
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), notify: logNotifier{}, sms: NewSMSGateway(c)}
 }
 
 // Config returns the auth config
@@ -43,20 +49,41 @@ func New(app *handlers.App) *Auth {
 	return &Auth{app: app, svc: svc}
 }
 
+// limit builds a rate limit policy on the app's store
+func (h *Auth) limit(name string, rate lumnet.Rate, key lumnet.RateKeyFunc) func(http.Handler) http.Handler {
+	return lumnet.RateLimit(lumnet.RatePolicy{Name: "auth_" + name, Rate: rate, Key: key, Store: h.app.RateLimits})
+}
+
 // Wire defines the HTTP endpoint structure
 func (h *Auth) Wire(r chi.Router) {
+	cfg := h.svc.Config()
 	r.Route("/auth", func(r chi.Router) {
-		r.Post("/login", lumnet.Adapt(h.Login))
-		r.Post("/register", lumnet.Adapt(h.Register))
-		r.Post("/refresh", lumnet.Adapt(h.Refresh))
+		r.With(
+			h.limit("login", cfg.LoginRate, nil),
+			h.limit("login_account", cfg.LoginAccountRate, rateKeyLoginAccount),
+		).Post("/login", lumnet.Adapt(h.Login))
+		r.With(h.limit("register", cfg.RegisterRate, nil)).Post("/register", lumnet.Adapt(h.Register))
+		r.With(h.limit("refresh", cfg.RefreshRate, nil)).Post("/refresh", lumnet.Adapt(h.Refresh))
 		r.Post("/logout", lumnet.Adapt(h.Logout))
+		// revoke a session from a new-device notice
+		r.With(h.limit("not_me", cfg.NotMeRate, nil)).Post("/not-me", lumnet.Adapt(h.NotMe))
 		r.Get("/me", lumnet.Adapt(h.Me))
 
-		r.Post("/mfa/challenge", lumnet.Adapt(h.MFAChallenge)) // optional resend/new
-		r.Post("/mfa/verify", lumnet.Adapt(h.MFAVerify))
+		r.With(
+			h.limit("mfa_challenge", cfg.MFAChallengeRate, nil),
+			h.limit("mfa_challenge_user", cfg.MFAChallengeUserRate, rateKeyMFAUser),
+		).Post("/mfa/challenge", lumnet.Adapt(h.MFAChallenge)) // optional resend/new
+		r.With(h.limit("mfa_verify", cfg.MFAVerifyRate, nil)).Post("/mfa/verify", lumnet.Adapt(h.MFAVerify))
+		r.Group(func(r chi.Router) {
+			r.Use(Authenticate(cfg))
+			r.Use(h.limit("mfa_enroll", cfg.MFAEnrollRate, RateKeyUser))
+			r.Post("/mfa/sms/enroll", lumnet.Adapt(h.EnrollSMS))
+			r.Post("/mfa/sms/confirm", lumnet.Adapt(h.ConfirmSMS))
+			r.Delete("/mfa/factors/{id}", lumnet.Adapt(h.DeleteMFAFactor))
+		})
 
-		r.Post("/forgot", lumnet.Adapt(h.Forgot)) // 202 always
-		r.Post("/reset", lumnet.Adapt(h.Reset))   // { token, password }
+		r.With(h.limit("forgot", cfg.ForgotRate, nil)).Post("/forgot", lumnet.Adapt(h.Forgot)) // 202 always
+		r.With(h.limit("reset", cfg.ResetRate, nil)).Post("/reset", lumnet.Adapt(h.Reset))     // { token, password }
 	})
 	lumnet.InitValidator()
 }
@@ -1,6 +1,12 @@
 package auth
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"strings"
 
@@ -42,25 +48,38 @@ func (h *Auth) Login(w http.ResponseWriter, r *http.Request) lumnet.Reply {
 
 	// MFA path: 423 with structured payload
 	if mfa != nil && err == nil {
-		return lumnet.JSONStatusR(map[string]any{
-			"code":    "mfa_required",
-			"message": "Additional verification required",
-			"details": map[string]any{
-				"challenge_id": mfa.ChallengeID,
-				"factors":      mfa.Factors,
+		details := map[string]any{
+			"challenge_id": mfa.ChallengeID,
+			"factors":      mfa.Factors,
+		}
+		return lumnet.ErrorR(&lumnet.Problem{
+			Status:     http.StatusLocked, // 423
+			Code:       "mfa-required",
+			Title:      "Additional verification required",
+			Detail:     "Complete the MFA challenge, then log in again with its id and code.",
+			Extensions: details,
+			Legacy: map[string]any{
+				"code":    "mfa_required",
+				"message": "Additional verification required",
+				"details": details,
 			},
-		}, http.StatusLocked) // 423
+		})
 	}
 
 	if err != nil {
-		// Map "invalid credentials" to 401 with simple top-level payload
-		msg := strings.ToLower(err.Error())
-		if strings.Contains(msg, "invalid credentials") ||
-			lumErrors.IsErrorCode(err, lumErrors.ErrorCodeInvalidArgument) {
-			return lumnet.JSONStatusR(map[string]any{
-				"code":    "invalid_credentials",
-				"message": "Invalid email or password.",
-			}, http.StatusUnauthorized) // 401
+		// Every authentication failure is the same 401, so the response doesn't tell an unknown
+		// email from a wrong password or a disabled account
+		if lumErrors.IsErrorCode(err, lumErrors.ErrorCodeUnauthenticated) {
+			return lumnet.ErrorR(&lumnet.Problem{
+				Status: http.StatusUnauthorized, // 401
+				Code:   "invalid-credentials",
+				Title:  "Invalid credentials",
+				Detail: "Invalid email or password.",
+				Legacy: map[string]any{
+					"code":    "invalid_credentials",
+					"message": "Invalid email or password.",
+				},
+			})
 		}
 		// Fallback to standard error envelope for everything else
 		return lumnet.ErrorR(err)
@@ -98,20 +117,48 @@ func nullIfEmpty(s string) *string {
 	return &s
 }
 
+// clientIP is the client's address. Forwarding headers are never read here, since any client can
+// send them: behind a proxy, the router's RealIP (TRUSTED_PROXIES) has already put the client's
+// address in RemoteAddr
 func clientIP(r *http.Request) string {
-	// Chi's middleware.RealIP enabled in the router, this header is reliable
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		if i := strings.IndexByte(ip, ','); i >= 0 {
-			return strings.TrimSpace(ip[:i])
-		}
-		return strings.TrimSpace(ip)
+	return host
+}
+
+// rateKeyMaxBody is how much of a body the rate keys read looking for their field
+const rateKeyMaxBody = 64 << 10
+
+// peekJSON decodes up to rateKeyMaxBody of r's body into v for a rate key, and puts the body back
+// for the handler. It reports whether there was a JSON body to decode
+func peekJSON(r *http.Request, v any) bool {
+	if r.Body == nil {
+		return false
+	}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, rateKeyMaxBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(raw), r.Body), r.Body}
+	return err == nil && json.Unmarshal(raw, v) == nil
+}
+
+// rateKeyLoginAccount keys the login limit on the account being tried, so guessing one account's
+// password from many addresses is limited too. The email is normalized as Login does and hashed,
+// so the store never holds it. A body without an email falls back to the client IP
+func rateKeyLoginAccount(r *http.Request) string {
+	var in struct {
+		Email string `json:"email"`
 	}
-	host := r.RemoteAddr
-	if i := strings.LastIndexByte(host, ':'); i >= 0 {
-		return host[:i]
+	if !peekJSON(r, &in) {
+		return ""
 	}
-	return host
+	email := strings.ToLower(strings.TrimSpace(in.Email))
+	if email == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(email))
+	return "account:" + hex.EncodeToString(sum[:12])
 }
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoginRateKey(t *testing.T) {
+	Convey("Given the login route limited per address and per account", t, func() {
+		store := lumnet.NewMemoryRateStore()
+		var bodies []string
+		h := lumnet.RateLimit(lumnet.RatePolicy{
+			Name: "login", Rate: lumnet.Rate{Limit: 100, Period: time.Minute}, Store: store,
+		})(lumnet.RateLimit(lumnet.RatePolicy{
+			Name: "login_account", Rate: lumnet.Rate{Limit: 2, Period: time.Minute}, Key: rateKeyLoginAccount,
+			Store: store,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			w.WriteHeader(http.StatusNoContent)
+		})))
+		login := func(ip, body string) int {
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+			req.RemoteAddr = ip + ":4000"
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		Convey("guesses at one account are limited however many addresses they come from", func() {
+			So(login("203.0.113.1", `{"email":"ann@example.test","password":"a"}`), ShouldEqual, http.StatusNoContent)
+			So(login("203.0.113.2", `{"email":" Ann@Example.TEST ","password":"b"}`), ShouldEqual, http.StatusNoContent)
+			So(login("203.0.113.3", `{"email":"ann@example.test","password":"c"}`), ShouldEqual, http.StatusTooManyRequests)
+
+			Convey("while other accounts are unaffected", func() {
+				So(login("203.0.113.3", `{"email":"bob@example.test","password":"c"}`), ShouldEqual, http.StatusNoContent)
+			})
+		})
+
+		Convey("the handler still reads the whole body", func() {
+			body := `{"email":"ann@example.test","password":"` + strings.Repeat("x", rateKeyMaxBody) + `"}`
+			So(login("203.0.113.1", body), ShouldEqual, http.StatusNoContent)
+			So(bodies, ShouldResemble, []string{body})
+		})
+
+		Convey("the key never holds the email", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"ann@example.test"}`))
+			k := rateKeyLoginAccount(req)
+			So(k, ShouldStartWith, "account:")
+			So(k, ShouldNotContainSubstring, "ann")
+		})
+
+		Convey("a body without an email falls back to the address", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`not json`))
+			So(rateKeyLoginAccount(req), ShouldBeEmpty)
+		})
+	})
+}
+
+// routeService answers every route it is asked about with an error, for tests of the limits in
+// front of it; every other Service method is unused here
+type routeService struct {
+	Service
+	cfg Config
+}
+
+func (s routeService) Config() Config { return s.cfg }
+
+func (s routeService) NotMe(context.Context, string) error {
+	return lumErrors.InvalidArgf("invalid or expired token")
+}
+
+func (s routeService) MFAChallenge(context.Context, MFAChallengeInput) (*MFAChallengeResult, error) {
+	return nil, lumErrors.NotFoundf("user not found")
+}
+
+func TestAuthRateLimits(t *testing.T) {
+	Convey("Given the auth routes with tight limits", t, func() {
+		twice := lumnet.Rate{Limit: 2, Period: time.Minute}
+		h := &Auth{
+			app: &handlers.App{RateLimits: lumnet.NewMemoryRateStore()},
+			svc: routeService{cfg: Config{
+				RefreshCookieName:    "refresh_token",
+				RefreshRate:          twice,
+				NotMeRate:            twice,
+				MFAChallengeRate:     lumnet.Rate{Limit: 3, Period: time.Minute},
+				MFAChallengeUserRate: twice,
+			}},
+		}
+		r := chi.NewRouter()
+		h.Wire(r)
+		post := func(path, ip, body string) int {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.RemoteAddr = ip + ":4000"
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		Convey("refreshing and the not-me link are limited per address", func() {
+			for _, path := range []string{"/auth/refresh", "/auth/not-me"} {
+				body := `{"token":"guess"}`
+				So(post(path, "203.0.113.1", body), ShouldNotEqual, http.StatusTooManyRequests)
+				So(post(path, "203.0.113.1", body), ShouldNotEqual, http.StatusTooManyRequests)
+				So(post(path, "203.0.113.1", body), ShouldEqual, http.StatusTooManyRequests)
+				So(post(path, "203.0.113.2", body), ShouldNotEqual, http.StatusTooManyRequests)
+			}
+		})
+
+		Convey("challenges for one user are limited however many addresses they come from", func() {
+			const ann = `{"user_id":"00000000-0000-4000-8000-0000000000a1"}`
+			So(post("/auth/mfa/challenge", "203.0.113.1", ann), ShouldEqual, http.StatusNotFound)
+			So(post("/auth/mfa/challenge", "203.0.113.2", ann), ShouldEqual, http.StatusNotFound)
+			So(post("/auth/mfa/challenge", "203.0.113.3", ann), ShouldEqual, http.StatusTooManyRequests)
+
+			Convey("while other users are unaffected", func() {
+				const bob = `{"user_id":"00000000-0000-4000-8000-0000000000b2"}`
+				So(post("/auth/mfa/challenge", "203.0.113.3", bob), ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("challenges from one address are limited whichever users they name", func() {
+			for i, id := range []string{"a1", "a2", "a3", "a4"} {
+				code := post("/auth/mfa/challenge", "203.0.113.9", `{"user_id":"00000000-0000-4000-8000-0000000000`+id+`"}`)
+				if i < 3 {
+					So(code, ShouldEqual, http.StatusNotFound)
+				} else {
+					So(code, ShouldEqual, http.StatusTooManyRequests)
+				}
+			}
+		})
+
+		Convey("the challenge key is the user id", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user_id":" ABC "}`))
+			So(rateKeyMFAUser(req), ShouldEqual, "user:abc")
+			req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`not json`))
+			So(rateKeyMFAUser(req), ShouldBeEmpty)
+		})
+	})
+}
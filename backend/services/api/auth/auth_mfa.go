@@ -2,8 +2,11 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 
 	"lumium/lib/lumnet"
+
+	"github.com/go-chi/chi/v5"
 )
 
 // MFAChallenge starts a one-time MFA challenge for a user
@@ -29,6 +32,21 @@ func (h *Auth) MFAChallenge(w http.ResponseWriter, r *http.Request) lumnet.Reply
 	return lumnet.OKR(res)
 }
 
+// rateKeyMFAUser keys the challenge limit on the user being challenged, so their phone can't be
+// texted over and over from many addresses. A body without a user_id falls back to the client IP
+func rateKeyMFAUser(r *http.Request) string {
+	var in struct {
+		UserID string `json:"user_id"`
+	}
+	if !peekJSON(r, &in) {
+		return ""
+	}
+	if id := strings.ToLower(strings.TrimSpace(in.UserID)); id != "" {
+		return "user:" + id
+	}
+	return ""
+}
+
 // MFAVerify verifies and consumes an MFA challenge code
 // @Summary     Verify MFA code
 // @Description Verifies the 6-digit code for a challenge
@@ -55,6 +73,76 @@ func (h *Auth) MFAVerify(w http.ResponseWriter, r *http.Request) lumnet.Reply {
 	return lumnet.OKR(MFAVerifyOK{OK: ok})
 }
 
+// EnrollSMS registers a phone number as an MFA factor
+// @Summary     Enroll SMS factor
+// @Description Texts a 6-digit code to the number. The factor is unusable until confirmed with /auth/mfa/sms/confirm
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body      SMSEnrollDTO     true  "phone number"
+// @Success     201    {object}  SMSEnrollResult  "pending factor and challenge"
+// @Failure     400    {string}  string           "bad request / validation error"
+// @Failure     409    {string}  string           "phone already enrolled"
+// @Failure     401    {object}  ErrorWire        "unauthorized"
+// @Failure     429    {object}  ErrorWire        "rate limited"
+// @Router      /auth/mfa/sms/enroll [post]
+func (h *Auth) EnrollSMS(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[SMSEnrollDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := ClaimsFromContext(r.Context())
+	res, err := h.svc.EnrollSMS(r.Context(), SMSEnrollInput{UserID: claims.Sub, Phone: in.Phone, Label: in.Label})
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.CreatedR(res, "")
+}
+
+// ConfirmSMS confirms a phone number with the code texted at enrollment
+// @Summary     Confirm SMS factor
+// @Description Verifies the enrollment code; the number is then offered as an MFA factor
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body  SMSConfirmDTO  true  "enrollment challenge and code"
+// @Success     200    {object}  MFAVerifyOK  "confirmed"
+// @Failure     400    {string}  string       "bad request / validation error"
+// @Failure     422    {object}  ErrorWire    "invalid or expired code"
+// @Router      /auth/mfa/sms/confirm [post]
+func (h *Auth) ConfirmSMS(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[SMSConfirmDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := ClaimsFromContext(r.Context())
+	err = h.svc.ConfirmSMS(r.Context(), SMSConfirmInput{UserID: claims.Sub, ChallengeID: in.ChallengeID, Code: in.Code})
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(MFAVerifyOK{OK: true})
+}
+
+// DeleteMFAFactor removes one of the caller's MFA factors
+// @Summary     Delete MFA factor
+// @Description Removes an MFA factor (e.g. a lost phone number)
+// @Tags        auth
+// @Security    BearerAuth
+// @Param       id   path  string  true  "factor id"
+// @Success     204  "deleted"
+// @Failure     404  {string}  string     "factor not found"
+// @Failure     401  {object}  ErrorWire  "unauthorized"
+// @Router      /auth/mfa/factors/{id} [delete]
+func (h *Auth) DeleteMFAFactor(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := ClaimsFromContext(r.Context())
+	if err := h.svc.DeleteMFAFactor(r.Context(), claims.Sub, chi.URLParam(r, "id")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
 // MFAVerifyOK is a tiny success envelope for MFA verify
 // swagger:model
 type MFAVerifyOK struct {
@@ -2,7 +2,6 @@ package auth
 
 import (
 	"net/http"
-	"strings"
 
 	lumErrors "lumium/lib/errors"
 	"lumium/lib/lumnet"
@@ -17,13 +16,13 @@ import (
 // @Produce     json
 // @Success     200 {object}  RefreshWire  "OK"
 // @Header      200 {string}  Set-Cookie   "New HttpOnly refresh token cookie (name & attributes per server config)"
-// @Failure     422 {object}  ErrorWire    "unauthorized or invalid/expired refresh token"
+// @Failure     401 {object}  ErrorWire    "unauthorized or invalid/expired refresh token"
 // @Router      /auth/refresh [post]
 func (h *Auth) Refresh(w http.ResponseWriter, r *http.Request) lumnet.Reply {
 	cfg := h.svc.Config()
 	c, err := r.Cookie(cfg.RefreshCookieName)
 	if err != nil || c.Value == "" {
-		return lumnet.ErrorR(lumErrors.InvalidArgf("unauthorized"))
+		return lumnet.ErrorR(lumErrors.Unauthenticatedf("unauthorized"))
 	}
 
 	res, err := h.svc.Refresh(r.Context(), RefreshInput{
@@ -60,6 +59,31 @@ func (h *Auth) Logout(w http.ResponseWriter, r *http.Request) lumnet.Reply {
 	return lumnet.NoContentR()
 }
 
+// NotMe is the http endpoint behind the "this wasn't me" link in new-device notices
+//
+// @Summary     Revoke an unrecognized session
+// @Description Consume the single-use token from a new-device notification and revoke the session it names,
+// @Description along with every session refreshed from it.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       input  body  NotMeDTO  true  "token from the notification link"
+// @Success     204    "session revoked; no content"
+// @Failure     400    {string}  string     "bad request / validation error"
+// @Failure     410    {object}  ErrorWire  "the session is already signed out"
+// @Failure     422    {object}  ErrorWire  "invalid or expired token"
+// @Router      /auth/not-me [post]
+func (h *Auth) NotMe(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[NotMeDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.NotMe(r.Context(), in.Token); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
 // Me is the http endpoint for describing the current user
 //
 // @Summary     Current user
@@ -68,17 +92,16 @@ func (h *Auth) Logout(w http.ResponseWriter, r *http.Request) lumnet.Reply {
 // @Produce     json
 // @Param       Authorization  header  string  true  "Bearer {access_token}"
 // @Success     200 {object}   UserPublic
-// @Failure     422 {object}   ErrorWire "unauthorized"
+// @Failure     401 {object}   ErrorWire "unauthorized"
 // @Router      /auth/me [get]
 func (h *Auth) Me(w http.ResponseWriter, r *http.Request) lumnet.Reply {
-	authz := strings.TrimSpace(r.Header.Get("Authorization"))
-	if !strings.HasPrefix(strings.ToLower(authz), "bearer ") {
-		return lumnet.ErrorR(lumErrors.InvalidArgf("unauthorized"))
+	raw, ok := bearerToken(r)
+	if !ok {
+		return lumnet.ErrorR(lumErrors.Unauthenticatedf("unauthorized"))
 	}
-	raw := strings.TrimSpace(authz[7:])
 	claims, err := h.svc.Config().ParseAccess(raw)
 	if err != nil {
-		return lumnet.ErrorR(lumErrors.InvalidArgf("unauthorized"))
+		return lumnet.ErrorR(lumErrors.Unauthenticatedf("unauthorized"))
 	}
 	return lumnet.OKR(UserPublic{
 		ID:              claims.Sub,
@@ -4,46 +4,73 @@ import (
 	"time"
 
 	"lumium/lib/config"
+	"lumium/lib/lumnet"
 )
 
 // Config is the configuration wrapper for authentication
 type Config struct {
-	JWTSecret           []byte
-	JWTIssuer           string
-	CoreMFAEnabled      bool
-	AccessTTL           time.Duration
-	RefreshTTL          time.Duration
-	RefreshCookieName   string
-	RefreshCookieSecure bool
-
-	ArgonMemKiB   uint32
-	ArgonIter     uint32
-	ArgonParallel uint8
-	ArgonSaltLen  uint32
-	ArgonKeyLen   uint32
+	JWTSecret           []byte        `env:"JWT_SECRET,required,secret"`
+	JWTIssuer           string        `env:"JWT_ISSUER,required"`
+	CoreMFAEnabled      bool          `env:"CORE_MFA_ENABLED" default:"false"`
+	AccessTTL           time.Duration `env:"AUTH_ACCESS_TTL_SECONDS" default:"600"`
+	RefreshTTL          time.Duration `env:"AUTH_REFRESH_TTL_SECONDS" default:"720h"`
+	RefreshCookieName   string        `env:"REFRESH_COOKIE_NAME" default:"refresh_token"`
+	RefreshCookieSecure bool          `env:"REFRESH_COOKIE_SECURE" default:"true"`
+
+	AppURL                 string        `env:"AUTH_APP_URL" default:"http://localhost:5173"`
+	NotifyNewDevice        bool          `env:"AUTH_NOTIFY_NEW_DEVICE" default:"true"`
+	MFAForUnfamiliarDevice bool          `env:"AUTH_MFA_UNFAMILIAR_DEVICE" default:"false"`
+	RevokeLinkTTL          time.Duration `env:"AUTH_REVOKE_LINK_TTL_SECONDS" default:"168h"`
+
+	PermissionCacheTTL time.Duration `env:"AUTH_PERMISSION_CACHE_TTL_SECONDS" default:"60"`
+
+	SMSGatewayURL   string        `env:"AUTH_SMS_GATEWAY_URL"` // required unless SMSLogOnly
+	SMSGatewayToken string        `env:"AUTH_SMS_GATEWAY_TOKEN,secret"`
+	SMSLogOnly      bool          `env:"AUTH_SMS_LOG_ONLY" default:"false"` // development: log, never deliver
+	SMSFrom         string        `env:"AUTH_SMS_FROM" default:"Lumium"`
+	SMSMaxPerHour   int           `env:"AUTH_SMS_MAX_PER_HOUR" default:"5"`
+	SMSMinInterval  time.Duration `env:"AUTH_SMS_MIN_INTERVAL_SECONDS" default:"30"`
+
+	// per-client rate limits on the endpoints open to guessing; see lumnet.ParseRate
+	LoginRate            lumnet.Rate `env:"AUTH_RATE_LOGIN" default:"10/1m"`
+	LoginAccountRate     lumnet.Rate `env:"AUTH_RATE_LOGIN_ACCOUNT" default:"10/15m"` // per account, from any address
+	RegisterRate         lumnet.Rate `env:"AUTH_RATE_REGISTER" default:"10/1h"`
+	MFAVerifyRate        lumnet.Rate `env:"AUTH_RATE_MFA_VERIFY" default:"10/5m"`
+	MFAChallengeRate     lumnet.Rate `env:"AUTH_RATE_MFA_CHALLENGE" default:"10/15m"`
+	MFAChallengeUserRate lumnet.Rate `env:"AUTH_RATE_MFA_CHALLENGE_USER" default:"5/15m"` // per user challenged
+	RefreshRate          lumnet.Rate `env:"AUTH_RATE_REFRESH" default:"60/1m"`
+	NotMeRate            lumnet.Rate `env:"AUTH_RATE_NOT_ME" default:"10/15m"`
+	ForgotRate           lumnet.Rate `env:"AUTH_RATE_FORGOT" default:"5/15m"`
+	ResetRate            lumnet.Rate `env:"AUTH_RATE_RESET" default:"10/15m"`
+	MFAEnrollRate        lumnet.Rate `env:"AUTH_RATE_MFA_ENROLL" default:"10/1h"`
+
+	ArgonMemKiB   uint32 `env:"ARGON2_MEM_KIB" default:"65536"`
+	ArgonIter     uint32 `env:"ARGON2_ITER" default:"3"`
+	ArgonParallel uint8  `env:"ARGON2_PAR" default:"1"`
+	ArgonSaltLen  uint32 `env:"ARGON2_SALT_LEN" default:"16"`
+	ArgonKeyLen   uint32 `env:"ARGON2_KEY_LEN" default:"32"`
 }
 
-// LoadConfig returns the configuration wrapper for authentication
+// LoadConfig returns the configuration wrapper for authentication; a missing or malformed
+// setting stops startup, listing every one at once
 func LoadConfig() Config {
-	c := Config{
-		JWTSecret:           []byte(config.MustString("JWT_SECRET")),
-		JWTIssuer:           config.MustString("JWT_ISSUER"),
-		CoreMFAEnabled:      config.MayBool("CORE_MFA_ENABLED", false),
-		AccessTTL:           time.Duration(config.MayInt("AUTH_ACCESS_TTL_SECONDS", 600)) * time.Second,
-		RefreshTTL:          time.Duration(config.MayInt("AUTH_REFRESH_TTL_SECONDS", 30*24*60*60)) * time.Second,
-		RefreshCookieName:   config.MayString("REFRESH_COOKIE_NAME", "refresh_token"),
-		RefreshCookieSecure: config.MayBool("REFRESH_COOKIE_SECURE", true),
-
-		ArgonMemKiB:   uint32(config.MayInt("ARGON2_MEM_KIB", 64*1024)),
-		ArgonIter:     uint32(config.MayInt("ARGON2_ITER", 3)),
-		ArgonParallel: uint8(config.MayInt("ARGON2_PAR", 1)),
-		ArgonSaltLen:  uint32(config.MayInt("ARGON2_SALT_LEN", 16)),
-		ArgonKeyLen:   uint32(config.MayInt("ARGON2_KEY_LEN", 32)),
-	}
+	var c Config
+	config.MustLoad(&c)
 	normalizeArgon(&c)
 	return c
 }
 
+// Validate checks the settings that depend on each other
+func (c *Config) Validate() error {
+	if c.SMSGatewayURL == "" && !c.SMSLogOnly {
+		return &config.LoadError{Problems: []config.Problem{{
+			Key:     "AUTH_SMS_GATEWAY_URL",
+			Message: "unset; set AUTH_SMS_LOG_ONLY=true to log texts instead of sending them",
+		}}}
+	}
+	return nil
+}
+
 func normalizeArgon(c *Config) {
 	if c.ArgonMemKiB == 0 || c.ArgonMemKiB > 262144 { // cap at 256 MB, default 64 MB
 		c.ArgonMemKiB = 64 * 1024
@@ -64,6 +64,37 @@ type MFAChallengeResult struct {
 	Factors     []string
 }
 
+// MFAFactor is a confirmed MFA factor. Secret is the E.164 number for sms factors
+type MFAFactor struct {
+	ID        string
+	Type      string
+	Label     string
+	Secret    string
+	IsPrimary bool
+}
+
+// SMSEnrollInput is the service contract for enrolling a phone number
+type SMSEnrollInput struct {
+	UserID string
+	Phone  string
+	Label  string
+}
+
+// SMSEnrollResult is the service contract response for SMS enrollment
+// swagger:model
+type SMSEnrollResult struct {
+	FactorID    string `json:"factor_id"`
+	ChallengeID string `json:"challenge_id"`
+	Phone       string `json:"phone" example:"+1••••••4567"` // masked
+}
+
+// SMSConfirmInput is the service contract for confirming a phone number
+type SMSConfirmInput struct {
+	UserID      string
+	ChallengeID string
+	Code        string
+}
+
 // ForgotInput is the service contract response for forgotten passwords
 // swagger:model
 type ForgotInput struct {
@@ -84,10 +115,12 @@ type AccessClaims struct {
 	Sub      string   `json:"sub"`
 	TenantID string   `json:"tenant_id,omitempty"`
 	Roles    []string `json:"roles,omitempty"`
+	RoleIDs  []string `json:"role_ids,omitempty"`
 }
 
 type mfaChallengeShape struct {
-	UserID string `json:"user_id" validate:"required,uuid4"`
+	UserID string `json:"user_id"          validate:"required,uuid4"`
+	Factor string `json:"factor,omitempty" validate:"omitempty,oneof=email sms"` // delivery channel
 }
 type mfaVerifyShape struct {
 	ChallengeID string `json:"challenge_id" validate:"required,uuid4"`
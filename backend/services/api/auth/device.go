@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// deviceInfo is the coarse identity of the client a login came from. We deliberately ignore
+// versions and host bits so browser updates or DHCP churn don't look like a new device
+type deviceInfo struct {
+	UAFamily    string // e.g. "Firefox on Linux"
+	Network     string // IPv4 /24 or IPv6 /48, e.g. "203.0.113.0/24"
+	Fingerprint string // hex sha256 of UAFamily + Network
+}
+
+// uaBrowsers is ordered: more specific tokens first (Edge and Opera also claim Chrome & Safari)
+var uaBrowsers = []struct{ token, family string }{
+	{"edg/", "Edge"},
+	{"opr/", "Opera"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+	{"okhttp", "OkHttp"},
+	{"cfnetwork", "Apple CFNetwork"},
+}
+
+// uaPlatforms is ordered: Android also claims Linux, iOS also claims "like Mac OS X"
+var uaPlatforms = []struct{ token, family string }{
+	{"android", "Android"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"windows", "Windows"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"cros", "ChromeOS"},
+	{"linux", "Linux"},
+}
+
+// fingerprintDevice reduces a user agent and client IP to a stable device fingerprint
+func fingerprintDevice(userAgent, ip string) deviceInfo {
+	d := deviceInfo{
+		UAFamily: uaFamily(userAgent),
+		Network:  ipPrefix(ip),
+	}
+	sum := sha256.Sum256([]byte(d.UAFamily + "|" + d.Network))
+	d.Fingerprint = hex.EncodeToString(sum[:])
+	return d
+}
+
+// uaFamily returns "<browser> on <platform>", falling back to "Unknown" for either half
+func uaFamily(ua string) string {
+	s := strings.ToLower(ua)
+
+	browser := "Unknown"
+	for _, b := range uaBrowsers {
+		if strings.Contains(s, b.token) {
+			browser = b.family
+			break
+		}
+	}
+
+	platform := "Unknown"
+	for _, p := range uaPlatforms {
+		if strings.Contains(s, p.token) {
+			platform = p.family
+			break
+		}
+	}
+
+	return browser + " on " + platform
+}
+
+// ipPrefix masks an address to the network it most likely belongs to: /24 for IPv4 and /48 for
+// IPv6. Unparseable input is returned as-is so it still contributes to the fingerprint
+func ipPrefix(raw string) string {
+	ip := net.ParseIP(strings.TrimSpace(raw))
+	if ip == nil {
+		return strings.TrimSpace(raw)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		n := net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return n.String()
+	}
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}
+	return n.String()
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// deviceRepo keeps one user's login attempts, sessions and one-time tokens in memory; every
+// other Repo method is unused here
+type deviceRepo struct {
+	Repo
+	userID   string
+	pwHash   string
+	attempts []deviceAttempt
+	sessions map[string]bool   // session id -> revoked
+	families map[string]string // session id -> the session that started its family
+	hashes   map[string]string // refresh token hash -> session id
+	tokens   map[string]*deviceToken
+}
+
+type deviceAttempt struct {
+	success     bool
+	fingerprint string
+}
+
+type deviceToken struct {
+	userID, purpose string
+	meta            map[string]string
+	used            bool
+}
+
+func newDeviceRepo(userID, pwHash string) *deviceRepo {
+	return &deviceRepo{
+		userID:   userID,
+		pwHash:   pwHash,
+		sessions: map[string]bool{},
+		families: map[string]string{},
+		hashes:   map[string]string{},
+		tokens:   map[string]*deviceToken{},
+	}
+}
+
+func (r *deviceRepo) GetUserByEmail(context.Context, store.Queryer, string) (string, string, bool, error) {
+	return r.userID, r.pwHash, true, nil
+}
+
+func (r *deviceRepo) GetPrimaryTenantID(context.Context, store.Queryer, string) (string, error) {
+	return "t1", nil
+}
+
+func (r *deviceRepo) TenantRequiresMFA(context.Context, store.Queryer, string) (bool, error) {
+	return false, nil
+}
+
+func (r *deviceRepo) UserHasMFAFactor(context.Context, store.Queryer, string) (bool, error) {
+	return false, nil
+}
+
+func (r *deviceRepo) GetRolesForUserTenant(
+	context.Context,
+	store.Queryer,
+	string,
+	string,
+) ([]string, []string, error) {
+	return []string{"member"}, nil, nil
+}
+
+func (r *deviceRepo) InsertLoginAttempt(
+	_ context.Context,
+	_ store.Queryer,
+	_ *string,
+	_ string,
+	success bool,
+	_, _, _ string,
+	fingerprint string,
+) error {
+	r.attempts = append(r.attempts, deviceAttempt{success: success, fingerprint: fingerprint})
+	return nil
+}
+
+func (r *deviceRepo) DeviceSeen(_ context.Context, _ store.Queryer, _, fingerprint string) (bool, bool, error) {
+	var seen, history bool
+	for _, a := range r.attempts {
+		if a.success {
+			history = true
+			seen = seen || a.fingerprint == fingerprint
+		}
+	}
+	return seen, history, nil
+}
+
+func (r *deviceRepo) InsertSession(
+	_ context.Context,
+	_ store.Queryer,
+	_, _, hash, _, _, _ string,
+	familyID string,
+	_ time.Duration,
+) (string, error) {
+	id := fmt.Sprintf("s%d", len(r.sessions)+1)
+	if familyID == "" {
+		familyID = id
+	}
+	r.sessions[id] = false
+	r.families[id] = familyID
+	r.hashes[hash] = id
+	return id, nil
+}
+
+func (r *deviceRepo) GetActiveSessionByHash(
+	_ context.Context,
+	_ store.Queryer,
+	hash string,
+) (string, string, string, error) {
+	id, ok := r.hashes[hash]
+	if !ok || r.sessions[id] {
+		return "", "", "", errors.New("no rows in result set")
+	}
+	return r.userID, "t1", r.families[id], nil
+}
+
+func (r *deviceRepo) RevokeSessionByHash(_ context.Context, _ store.Queryer, hash string) error {
+	if id, ok := r.hashes[hash]; ok {
+		r.sessions[id] = true
+	}
+	return nil
+}
+
+func (r *deviceRepo) InsertOneTimeToken(
+	_ context.Context,
+	_ store.Queryer,
+	userID, purpose, tokenHash string,
+	meta map[string]string,
+	_ time.Duration,
+) error {
+	r.tokens[tokenHash] = &deviceToken{userID: userID, purpose: purpose, meta: meta}
+	return nil
+}
+
+func (r *deviceRepo) ConsumeOneTimeToken(
+	_ context.Context,
+	_ store.Queryer,
+	purpose, tokenHash string,
+) (string, map[string]string, error) {
+	t, ok := r.tokens[tokenHash]
+	if !ok || t.used || t.purpose != purpose {
+		return "", nil, errors.New("no rows in result set")
+	}
+	t.used = true
+	return t.userID, t.meta, nil
+}
+
+func (r *deviceRepo) RevokeSessionFamily(_ context.Context, _ store.Queryer, _, sessionID string) (int64, error) {
+	var n int64
+	for id, revoked := range r.sessions {
+		if !revoked && r.families[id] == r.families[sessionID] {
+			r.sessions[id] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// noticeRecorder keeps every notification instead of delivering it
+type noticeRecorder struct{ sent []Notification }
+
+func (n *noticeRecorder) Notify(_ context.Context, m Notification) error {
+	n.sent = append(n.sent, m)
+	return nil
+}
+
+var notMeLink = regexp.MustCompile(`(https?://\S+/auth/not-me)\?token=(\S+)`)
+
+func TestDevice(t *testing.T) {
+	const (
+		firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+		chrome  = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/537.36 " +
+			"(KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	)
+
+	Convey("uaFamily names browser and platform, most specific token first", t, func() {
+		So(uaFamily(firefox), ShouldEqual, "Firefox on Linux")
+		So(uaFamily(chrome), ShouldEqual, "Chrome on macOS")
+		So(uaFamily("Mozilla/5.0 (Windows NT 10.0) Chrome/126.0 Safari/537.36 Edg/126.0"),
+			ShouldEqual, "Edge on Windows")
+		So(uaFamily("Mozilla/5.0 (Linux; Android 14) Chrome/126.0 Mobile Safari/537.36"),
+			ShouldEqual, "Chrome on Android")
+		So(uaFamily("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Version/17.5 Safari/604.1"),
+			ShouldEqual, "Safari on iOS")
+		So(uaFamily(""), ShouldEqual, "Unknown on Unknown")
+	})
+
+	Convey("ipPrefix masks host bits", t, func() {
+		So(ipPrefix("203.0.113.77"), ShouldEqual, "203.0.113.0/24")
+		So(ipPrefix(" 2001:db8:abcd:12::1 "), ShouldEqual, "2001:db8:abcd::/48")
+		So(ipPrefix("not-an-ip"), ShouldEqual, "not-an-ip")
+	})
+
+	Convey("fingerprintDevice", t, func() {
+		a := fingerprintDevice(firefox, "203.0.113.77")
+		So(a.UAFamily, ShouldEqual, "Firefox on Linux")
+		So(a.Network, ShouldEqual, "203.0.113.0/24")
+		So(a.Fingerprint, ShouldHaveLength, 64)
+
+		Convey("ignores browser updates and addresses within the same network", func() {
+			newer := "Mozilla/5.0 (X11; Linux x86_64; rv:129.0) Gecko/20100101 Firefox/129.0"
+			So(fingerprintDevice(newer, "203.0.113.9").Fingerprint, ShouldEqual, a.Fingerprint)
+		})
+
+		Convey("changes with the browser or the network", func() {
+			So(fingerprintDevice(chrome, "203.0.113.77").Fingerprint, ShouldNotEqual, a.Fingerprint)
+			So(fingerprintDevice(firefox, "198.51.100.77").Fingerprint, ShouldNotEqual, a.Fingerprint)
+		})
+	})
+
+	Convey("the log notifier keeps the body, and the link in it, out of the log", t, func() {
+		var buf bytes.Buffer
+		l := zerolog.New(&buf)
+		ctx := logger.WithContext(context.Background(), &l)
+		So(logNotifier{}.Notify(ctx, Notification{
+			Kind: NotifyNewDevice, UserID: "u1", To: "ann@example.test",
+			Body: "https://app.example.test/auth/not-me?token=s3cr3t",
+		}), ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, NotifyNewDevice)
+		So(buf.String(), ShouldContainSubstring, "ann@example.test")
+		So(buf.String(), ShouldNotContainSubstring, "s3cr3t")
+	})
+
+	Convey("Given a user logging in with new-device notices on", t, func() {
+		cfg := Config{
+			JWTSecret:       []byte("test-secret"),
+			AccessTTL:       time.Minute,
+			RefreshTTL:      time.Hour,
+			RevokeLinkTTL:   time.Hour,
+			AppURL:          "https://app.example.test/",
+			NotifyNewDevice: true,
+			ArgonMemKiB:     1024,
+			ArgonIter:       1,
+			ArgonParallel:   1,
+			ArgonSaltLen:    16,
+			ArgonKeyLen:     32,
+		}
+		hash, err := HashPassword("correct horse", cfg)
+		So(err, ShouldBeNil)
+
+		withTx = func(_ context.Context, _ store.Beginner, fn func(store.Queryer) error) error {
+			return fn(nil)
+		}
+		repo := newDeviceRepo("u1", hash)
+		notices := &noticeRecorder{}
+		s := &svc{
+			Kit:    svckit.New[*pgxpool.Pool, Repo, Config](nil, func() Repo { return repo }, cfg),
+			notify: notices,
+		}
+		ctx := context.Background()
+		login := func(ua, ip string) *LoginResult {
+			res, mfa, err := s.Login(ctx, LoginInput{
+				Email: "Ann@Example.test", Password: "correct horse", UserAgent: ua, IP: ip,
+			})
+			So(err, ShouldBeNil)
+			So(mfa, ShouldBeNil)
+			So(res.UserID, ShouldEqual, "u1")
+			return res
+		}
+
+		Convey("the first ever login has nothing to compare against and sends no notice", func() {
+			login(firefox, "203.0.113.77")
+			So(notices.sent, ShouldBeEmpty)
+
+			Convey("nor does a later login from the same device", func() {
+				login(firefox, "203.0.113.80")
+				So(notices.sent, ShouldBeEmpty)
+			})
+
+			Convey("a login from an unfamiliar device is noticed", func() {
+				res := login(chrome, "198.51.100.7")
+				So(notices.sent, ShouldHaveLength, 1)
+				n := notices.sent[0]
+				So(n.Kind, ShouldEqual, NotifyNewDevice)
+				So(n.To, ShouldEqual, "ann@example.test")
+				So(n.Body, ShouldContainSubstring, "Chrome on macOS")
+				So(n.Body, ShouldContainSubstring, "198.51.100.0/24")
+
+				m := notMeLink.FindStringSubmatch(n.Body)
+				So(m, ShouldNotBeNil)
+				So(m[1], ShouldEqual, "https://app.example.test/auth/not-me")
+				token, err := url.QueryUnescape(m[2])
+				So(err, ShouldBeNil)
+
+				Convey("and its link revokes only the new session, once", func() {
+					So(s.NotMe(ctx, token), ShouldBeNil)
+					So(repo.sessions["s1"], ShouldBeFalse)
+					So(repo.sessions["s2"], ShouldBeTrue)
+
+					So(s.NotMe(ctx, token), ShouldNotBeNil)
+				})
+
+				Convey("and its link still signs that device out after it refreshed", func() {
+					ref, err := s.Refresh(ctx, RefreshInput{
+						RefreshOpaque: res.RefreshRaw, UserAgent: chrome, IP: "198.51.100.7",
+					})
+					So(err, ShouldBeNil)
+					ref, err = s.Refresh(ctx, RefreshInput{
+						RefreshOpaque: ref.RefreshRaw, UserAgent: chrome, IP: "198.51.100.7",
+					})
+					So(err, ShouldBeNil)
+					So(repo.sessions, ShouldResemble, map[string]bool{"s1": false, "s2": true, "s3": true, "s4": false})
+
+					So(s.NotMe(ctx, token), ShouldBeNil)
+					So(repo.sessions["s4"], ShouldBeTrue)
+					So(repo.sessions["s1"], ShouldBeFalse)
+
+					_, err = s.Refresh(ctx, RefreshInput{RefreshOpaque: ref.RefreshRaw})
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("and its link fails when that device already signed out", func() {
+					So(s.Logout(ctx, res.RefreshRaw), ShouldBeNil)
+					err := s.NotMe(ctx, token)
+					So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeGone), ShouldBeTrue)
+				})
+
+				Convey("and it is only stored hashed", func() {
+					_, plain := repo.tokens[token]
+					So(plain, ShouldBeFalse)
+					So(repo.tokens, ShouldHaveLength, 1)
+				})
+			})
+		})
+
+		Convey("NotMe rejects empty and unknown tokens", func() {
+			So(s.NotMe(ctx, " "), ShouldNotBeNil)
+			So(s.NotMe(ctx, "deadbeef"), ShouldNotBeNil)
+		})
+	})
+}
@@ -56,6 +56,12 @@ type ResetDTO struct {
 	Password string `json:"password" validate:"required,min=8,max=128"`
 }
 
+// NotMeDTO defines the data transfer object for revoking a session from a new-device notice
+// swagger:model
+type NotMeDTO struct {
+	Token string `json:"token" validate:"required"`
+}
+
 // ResultWire defines the wire response for authentication
 // swagger:model
 type ResultWire struct {
@@ -86,6 +92,20 @@ type (
 	MFAVerifyDTO mfaVerifyShape
 )
 
+// SMSEnrollDTO defines the data transfer object for enrolling a phone number as an MFA factor
+// swagger:model
+type SMSEnrollDTO struct {
+	Phone string `json:"phone"           validate:"required,min=7,max=32" example:"+1 415 555 0123"`
+	Label string `json:"label,omitempty" validate:"omitempty,max=60"`
+}
+
+// SMSConfirmDTO defines the data transfer object for confirming a phone number
+// swagger:model
+type SMSConfirmDTO struct {
+	ChallengeID string `json:"challenge_id" validate:"required,uuid4"`
+	Code        string `json:"code"         validate:"required,len=6,numeric"`
+}
+
 // AcceptedWire is a small acknowledgement envelope for 202 responses.
 // swagger:model
 type AcceptedWire struct {
@@ -4,35 +4,147 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"slices"
 	"strings"
 	"time"
 
 	lumErrors "lumium/lib/errors"
 )
 
+// mfaTTL is how long a challenge code stays valid
+const mfaTTL = 10 * time.Minute
+
+// Challenge purposes, matching auth_mfa_challenges.purpose and auth_sms_sends.purpose
+const (
+	mfaPurposeEnroll = "enroll"
+	mfaPurposeLogin  = "login"
+)
+
 // MFAChallenge issues a new MFA challenge (6-digit), store hash, return challenge id + advertised factors.
+// The code goes out over in.Factor when given, else the user's primary factor
 func (s *svc) MFAChallenge(ctx context.Context, in MFAChallengeInput) (*MFAChallengeResult, error) {
 	userID := strings.TrimSpace(in.UserID)
 	if userID == "" {
 		return nil, lumErrors.InvalidArgf("user_id required")
 	}
 
+	chID, factors, err := s.issueChallenge(ctx, userID, in.Factor)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResult{ChallengeID: chID, Factors: factors}, nil
+}
+
+// issueChallenge creates a challenge and delivers its code. It returns the factors the user can
+// choose between: email always, plus each confirmed factor type
+func (s *svc) issueChallenge(ctx context.Context, userID, want string) (string, []string, error) {
+	enrolled, err := s.Repo.ListMFAFactors(ctx, s.DB, userID)
+	if err != nil {
+		return "", nil, lumErrors.DBf("list factors")
+	}
+
+	factors := []string{"email"}
+	var sms *MFAFactor
+	for i, f := range enrolled {
+		if !slices.Contains(factors, f.Type) {
+			factors = append(factors, f.Type)
+		}
+		if f.Type == "sms" && sms == nil {
+			sms = &enrolled[i] // primary first, so this is the preferred number
+		}
+	}
+
+	useSMS := want == "sms" || (want == "" && sms != nil && sms.IsPrimary)
+	if useSMS && sms == nil {
+		return "", nil, lumErrors.WithField(lumErrors.InvalidArgf("no sms factor enrolled"), "factor")
+	}
+
 	code := random6()
 	sum := sha256.Sum256([]byte(code))
 	hash := hex.EncodeToString(sum[:])
 
-	chID, err := s.Repo.CreateMFAChallenge(ctx, s.DB, userID, 10*time.Minute, hash)
+	factorID := ""
+	if useSMS {
+		factorID = sms.ID
+	}
+	chID, err := s.Repo.CreateMFAChallenge(ctx, s.DB, userID, factorID, mfaPurposeLogin, mfaTTL, hash)
 	if err != nil {
-		return nil, lumErrors.DBf("create challenge")
+		return "", nil, lumErrors.DBf("create challenge")
+	}
+
+	// a delivery failure still returns the challenge: the caller may ask again over another factor
+	if useSMS {
+		return chID, factors, s.sendSMSCode(ctx, userID, sms.Secret, mfaPurposeLogin, code)
 	}
 
-	// TODO: deliver `code` via email/SMS/TOTP; never return it to the client.
+	// TODO: deliver `code` via email; never return it to the client.
 	_ = code
+	return chID, factors, nil
+}
+
+// EnrollSMS registers a phone number and texts it a code; the factor is unusable until ConfirmSMS
+func (s *svc) EnrollSMS(ctx context.Context, in SMSEnrollInput) (*SMSEnrollResult, error) {
+	phone, err := normalizePhone(in.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	factorID, confirmed, err := s.Repo.UpsertSMSFactor(ctx, s.DB, in.UserID, phone, strings.TrimSpace(in.Label))
+	if err != nil {
+		return nil, lumErrors.DBf("enroll sms")
+	}
+	if confirmed {
+		return nil, lumErrors.WithField(lumErrors.DuplicateKeyf("phone already enrolled"), "phone")
+	}
+
+	code := random6()
+	sum := sha256.Sum256([]byte(code))
+	chID, err := s.Repo.CreateMFAChallenge(
+		ctx, s.DB, in.UserID, factorID, mfaPurposeEnroll, mfaTTL, hex.EncodeToString(sum[:]),
+	)
+	if err != nil {
+		return nil, lumErrors.DBf("create challenge")
+	}
+	if err := s.sendSMSCode(ctx, in.UserID, phone, mfaPurposeEnroll, code); err != nil {
+		return nil, err
+	}
+
+	return &SMSEnrollResult{FactorID: factorID, ChallengeID: chID, Phone: maskPhone(phone)}, nil
+}
+
+// ConfirmSMS verifies the enrollment code and marks the phone factor as confirmed
+func (s *svc) ConfirmSMS(ctx context.Context, in SMSConfirmInput) error {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(in.Code)))
+	ok, owner, err := s.Repo.VerifyAndConsumeMFA(
+		ctx, s.DB, in.ChallengeID, mfaPurposeEnroll, hex.EncodeToString(sum[:]),
+	)
+	if err != nil || owner != in.UserID {
+		return lumErrors.InvalidArgf("invalid or expired challenge")
+	}
+	if !ok {
+		return lumErrors.InvalidArgf("invalid code")
+	}
+
+	confirmed, err := s.Repo.ConfirmMFAFactor(ctx, s.DB, in.UserID, in.ChallengeID)
+	if err != nil {
+		return lumErrors.DBf("confirm factor")
+	}
+	if !confirmed {
+		return lumErrors.InvalidArgf("challenge is not an enrollment")
+	}
+	return nil
+}
 
-	return &MFAChallengeResult{
-		ChallengeID: chID,
-		Factors:     []string{"email"}, // future: include sms/totp if present
-	}, nil
+// DeleteMFAFactor removes one of the caller's factors
+func (s *svc) DeleteMFAFactor(ctx context.Context, userID, factorID string) error {
+	ok, err := s.Repo.DeleteMFAFactor(ctx, s.DB, userID, factorID)
+	if err != nil {
+		return lumErrors.DBf("delete factor")
+	}
+	if !ok {
+		return lumErrors.NotFoundf("factor not found")
+	}
+	return nil
 }
 
 // MFAVerify verifies an MFA challenge code atomically (increments attempts, fulfills on match).
@@ -46,7 +158,7 @@ func (s *svc) MFAVerify(ctx context.Context, in MFAVerifyInput) (bool, error) {
 	sum := sha256.Sum256([]byte(code))
 	codeHash := hex.EncodeToString(sum[:])
 
-	ok, _, err := s.Repo.VerifyAndConsumeMFA(ctx, s.DB, chID, codeHash)
+	ok, _, err := s.Repo.VerifyAndConsumeMFA(ctx, s.DB, chID, mfaPurposeLogin, codeHash)
 	if err != nil {
 		// invalid/expired challenge, or DB error
 		return false, lumErrors.InvalidArgf("invalid or expired challenge")
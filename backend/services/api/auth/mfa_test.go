@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mfaRepo is a deviceRepo whose user has MFA on, with challenges kept in memory
+type mfaRepo struct {
+	*deviceRepo
+	challenges map[string]*mfaChallenge
+}
+
+type mfaChallenge struct {
+	userID, purpose, hash string
+	fulfilled             bool
+}
+
+func (r *mfaRepo) UserHasMFAFactor(context.Context, store.Queryer, string) (bool, error) {
+	return true, nil
+}
+
+func (r *mfaRepo) ListMFAFactors(context.Context, store.Queryer, string) ([]MFAFactor, error) {
+	return nil, nil
+}
+
+func (r *mfaRepo) CreateMFAChallenge(
+	_ context.Context,
+	_ store.Queryer,
+	userID, _, purpose string,
+	_ time.Duration,
+	codeHash string,
+) (string, error) {
+	id := fmt.Sprintf("ch%d", len(r.challenges)+1)
+	r.challenges[id] = &mfaChallenge{userID: userID, purpose: purpose, hash: codeHash}
+	return id, nil
+}
+
+func (r *mfaRepo) VerifyAndConsumeMFA(
+	_ context.Context,
+	_ store.Queryer,
+	challengeID, purpose, codeHash string,
+) (bool, string, error) {
+	c, ok := r.challenges[challengeID]
+	if !ok || c.fulfilled || c.purpose != purpose {
+		return false, "", errors.New("no rows in result set")
+	}
+	c.fulfilled = c.hash == codeHash
+	return c.fulfilled, c.userID, nil
+}
+
+func codeHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMFA(t *testing.T) {
+	Convey("Given a user whose login requires a second factor", t, func() {
+		cfg := Config{
+			JWTSecret:     []byte("test-secret"),
+			AccessTTL:     time.Minute,
+			RefreshTTL:    time.Hour,
+			ArgonMemKiB:   1024,
+			ArgonIter:     1,
+			ArgonParallel: 1,
+			ArgonSaltLen:  16,
+			ArgonKeyLen:   32,
+		}
+		hash, err := HashPassword("correct horse", cfg)
+		So(err, ShouldBeNil)
+
+		repo := &mfaRepo{deviceRepo: newDeviceRepo("u1", hash), challenges: map[string]*mfaChallenge{}}
+		s := &svc{Kit: svckit.New[*pgxpool.Pool, Repo, Config](nil, func() Repo { return repo }, cfg)}
+		ctx := context.Background()
+		login := func(chID, code string) (*LoginResult, error) {
+			res, _, err := s.Login(ctx, LoginInput{
+				Email: "ann@example.test", Password: "correct horse", MFAChallengeID: chID, MFACode: code,
+			})
+			return res, err
+		}
+
+		_, mfa, err := s.Login(ctx, LoginInput{Email: "ann@example.test", Password: "correct horse"})
+		So(err, ShouldBeNil)
+		So(mfa, ShouldNotBeNil)
+		So(repo.challenges[mfa.ChallengeID].purpose, ShouldEqual, mfaPurposeLogin)
+		repo.challenges[mfa.ChallengeID].hash = codeHash("123456")
+
+		Convey("the code from their login challenge signs them in", func() {
+			res, err := login(mfa.ChallengeID, "123456")
+			So(err, ShouldBeNil)
+			So(res.UserID, ShouldEqual, "u1")
+		})
+
+		Convey("a wrong code doesn't", func() {
+			_, err := login(mfa.ChallengeID, "654321")
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeUnauthenticated), ShouldBeTrue)
+		})
+
+		Convey("another user's challenge is refused even with its code", func() {
+			repo.challenges["theirs"] = &mfaChallenge{userID: "u2", purpose: mfaPurposeLogin, hash: codeHash("111111")}
+			_, err := login("theirs", "111111")
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeUnauthenticated), ShouldBeTrue)
+			So(repo.sessions, ShouldBeEmpty)
+		})
+
+		Convey("a phone enrollment code can't stand in for a login code", func() {
+			repo.challenges["enroll"] = &mfaChallenge{userID: "u1", purpose: mfaPurposeEnroll, hash: codeHash("222222")}
+			_, err := login("enroll", "222222")
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeUnauthenticated), ShouldBeTrue)
+			So(repo.sessions, ShouldBeEmpty)
+		})
+
+		Convey("nor can a login code confirm a phone", func() {
+			err := s.ConfirmSMS(ctx, SMSConfirmInput{UserID: "u1", ChallengeID: mfa.ChallengeID, Code: "123456"})
+			So(err, ShouldNotBeNil)
+			So(repo.challenges[mfa.ChallengeID].fulfilled, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lumium/lib/lumnet"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotent(t *testing.T) {
+	Convey("Given Idempotent on a route", t, func() {
+		runs := 0
+		h := Idempotent(lumnet.NewMemoryIdempotencyStore())(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				runs++
+				c, _ := ClaimsFromContext(r.Context())
+				_, _ = w.Write([]byte(c.TenantID))
+			}))
+		post := func(tenant, user string) string {
+			req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{}`))
+			req.Header.Set("Idempotency-Key", "k1")
+			req = req.WithContext(context.WithValue(req.Context(), claimsKey,
+				&AccessClaims{Sub: user, TenantID: tenant}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+
+		Convey("a retry in the same tenant is replayed", func() {
+			So(post("t1", "u1"), ShouldEqual, "t1")
+			So(post("t1", "u1"), ShouldEqual, "t1")
+			So(runs, ShouldEqual, 1)
+		})
+
+		Convey("the same key from the same user in another tenant runs there", func() {
+			So(post("t1", "u1"), ShouldEqual, "t1")
+			So(post("t2", "u1"), ShouldEqual, "t2")
+			So(runs, ShouldEqual, 2)
+		})
+
+		Convey("and another user's key is their own", func() {
+			post("t1", "u1")
+			post("t1", "u2")
+			So(runs, ShouldEqual, 2)
+		})
+	})
+}
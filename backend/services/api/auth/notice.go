@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+)
+
+// purposeSessionRevoke is the auth_one_time_tokens purpose for "this wasn't me" links
+const purposeSessionRevoke = "session_revoke"
+
+// notifyNewDevice tells the user about a login from an unfamiliar device, with a single-use
+// link that revokes the new session. Best-effort: failures are logged, never returned
+func (s *svc) notifyNewDevice(
+	ctx context.Context,
+	userID, email, sessionID string,
+	dev deviceInfo,
+	ip string,
+) {
+	l := logger.Ctx(ctx)
+
+	opaque, hash, err := NewOpaque(32)
+	if err != nil {
+		l.Warn().Err(err).Str("user_id", userID).Msg("new-device notice: token")
+		return
+	}
+	meta := map[string]string{"session_id": sessionID}
+	if err := s.Repo.InsertOneTimeToken(
+		ctx, s.DB, userID, purposeSessionRevoke, hash, meta, s.Cfg.RevokeLinkTTL,
+	); err != nil {
+		l.Warn().Err(err).Str("user_id", userID).Msg("new-device notice: store token")
+		return
+	}
+
+	link := strings.TrimRight(s.Cfg.AppURL, "/") + "/auth/not-me?token=" + url.QueryEscape(opaque)
+	body := fmt.Sprintf(
+		"We noticed a new sign-in to your Lumium account.\n\n"+
+			"Device:  %s\nNetwork: %s\nIP:      %s\nTime:    %s\n\n"+
+			"If this was you, there's nothing to do.\n"+
+			"If this wasn't you, sign that device out and change your password:\n%s\n",
+		dev.UAFamily, dev.Network, ip, time.Now().UTC().Format(time.RFC1123), link,
+	)
+
+	if err := s.notify.Notify(ctx, Notification{
+		Kind:    NotifyNewDevice,
+		UserID:  userID,
+		To:      email,
+		Subject: "New sign-in to your Lumium account",
+		Body:    body,
+	}); err != nil {
+		l.Warn().Err(err).Str("user_id", userID).Msg("new-device notice: deliver")
+	}
+}
+
+// NotMe consumes a session-revoke token and revokes the session it was issued for, along with
+// every session refreshed from it since. It fails when none of them was still signed in
+func (s *svc) NotMe(ctx context.Context, token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return lumErrors.InvalidArgf("invalid or expired token")
+	}
+	sum := sha256.Sum256([]byte(token))
+
+	return withTx(ctx, s.DB, func(q store.Queryer) error {
+		uid, meta, err := s.Repo.ConsumeOneTimeToken(
+			ctx, q, purposeSessionRevoke, hex.EncodeToString(sum[:]),
+		)
+		if err != nil || meta["session_id"] == "" {
+			return lumErrors.InvalidArgf("invalid or expired token")
+		}
+		n, err := s.Repo.RevokeSessionFamily(ctx, q, uid, meta["session_id"])
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "revoke session")
+		}
+		if n == 0 {
+			return lumErrors.Gonef("that device is already signed out")
+		}
+		return nil
+	})
+}
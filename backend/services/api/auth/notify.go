@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+
+	"lumium/lib/logger"
+)
+
+// Notification kinds
+const (
+	NotifyNewDevice = "new_device"
+)
+
+// Notification is an out-of-band message to a user (email today)
+type Notification struct {
+	Kind    string
+	UserID  string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier is the delivery channel for user notifications. Implementations should be
+// best-effort and fast; callers never fail a request because a notification couldn't be sent
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// logNotifier notes notifications in the service log. It's the default until a real mail
+// transport is configured; bodies can hold single-use links, so only the kind and recipient are
+// logged and nothing is delivered
+type logNotifier struct{}
+
+// Notify logs that a notification would have been sent
+func (logNotifier) Notify(ctx context.Context, n Notification) error {
+	l := logger.Ctx(ctx)
+	l.Info().
+		Str("kind", n.Kind).
+		Str("user_id", n.UserID).
+		Str("to", n.To).
+		Msg("Notification not sent: no mail transport")
+	return nil
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lumium/lib/store"
+	"lumium/services/api/handlers"
+)
+
+// PermissionResolver maps the role IDs carried in access tokens onto permission codes
+type PermissionResolver interface {
+	Permissions(ctx context.Context, roleIDs []string) (map[string]bool, error)
+}
+
+// PermissionCache resolves role IDs against auth_role_permissions and caches each role's set
+// for the configured TTL. Role edits in this process invalidate immediately; other replicas
+// converge within one TTL
+type PermissionCache struct {
+	db  store.Queryer
+	ttl time.Duration
+
+	mu   sync.RWMutex
+	sets map[string]permissionSet
+}
+
+type permissionSet struct {
+	codes   []string
+	expires time.Time
+}
+
+// NewPermissionCache creates the shared resolver used by RequirePermission
+func NewPermissionCache(app *handlers.App) *PermissionCache {
+	return NewPermissionCacheWith(app.DB, LoadConfig().PermissionCacheTTL)
+}
+
+// NewPermissionCacheWith creates a resolver reading role permissions through db, keeping each
+// role's set for ttl
+func NewPermissionCacheWith(db store.Queryer, ttl time.Duration) *PermissionCache {
+	return &PermissionCache{db: db, ttl: ttl, sets: map[string]permissionSet{}}
+}
+
+// Permissions returns the union of the permissions granted by roleIDs
+func (c *PermissionCache) Permissions(ctx context.Context, roleIDs []string) (map[string]bool, error) {
+	now := time.Now()
+	out := map[string]bool{}
+	var missing []string
+
+	c.mu.RLock()
+	for _, id := range roleIDs {
+		set, ok := c.sets[id]
+		if !ok || now.After(set.expires) {
+			missing = append(missing, id)
+			continue
+		}
+		for _, code := range set.codes {
+			out[code] = true
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := c.db.Query(ctx,
+		`SELECT role_id::text, permission_code FROM auth_role_permissions WHERE role_id::text = ANY($1)`,
+		missing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// roles without permissions (or deleted ones) are cached as empty sets too
+	fresh := make(map[string][]string, len(missing))
+	for _, id := range missing {
+		fresh[id] = nil
+	}
+	for rows.Next() {
+		var id, code string
+		if err := rows.Scan(&id, &code); err != nil {
+			return nil, err
+		}
+		fresh[id] = append(fresh[id], code)
+		out[code] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for id, codes := range fresh {
+		c.sets[id] = permissionSet{codes: codes, expires: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return out, nil
+}
+
+// Invalidate drops the cached sets for roleIDs, or every set when called without arguments
+func (c *PermissionCache) Invalidate(roleIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(roleIDs) == 0 {
+		c.sets = map[string]permissionSet{}
+		return
+	}
+	for _, id := range roleIDs {
+		delete(c.sets, id)
+	}
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// grantQueryer answers the PermissionCache query from an in-memory role -> codes map
+type grantQueryer struct {
+	grants  map[string][]string
+	queries int
+	err     error
+}
+
+func (q *grantQueryer) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	q.queries++
+	if q.err != nil {
+		return nil, q.err
+	}
+	rows := &grantRows{i: -1}
+	for _, id := range args[0].([]string) {
+		for _, code := range q.grants[id] {
+			rows.data = append(rows.data, [2]string{id, code})
+		}
+	}
+	return rows, nil
+}
+
+func (q *grantQueryer) QueryRow(context.Context, string, ...any) pgx.Row { return nil }
+
+func (q *grantQueryer) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+type grantRows struct {
+	data [][2]string
+	i    int
+}
+
+func (r *grantRows) Close()                                       {}
+func (r *grantRows) Err() error                                   { return nil }
+func (r *grantRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *grantRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *grantRows) Next() bool                                   { r.i++; return r.i < len(r.data) }
+func (r *grantRows) Values() ([]any, error)                       { return nil, nil }
+func (r *grantRows) RawValues() [][]byte                          { return nil }
+func (r *grantRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *grantRows) Scan(dest ...any) error {
+	*dest[0].(*string), *dest[1].(*string) = r.data[r.i][0], r.data[r.i][1]
+	return nil
+}
+
+func TestPermissions(t *testing.T) {
+	Convey("Given a permission cache over two roles", t, func() {
+		q := &grantQueryer{grants: map[string][]string{
+			"viewer":    {"albums.read", "photos.read"},
+			"retoucher": {"photos.read", "photos.write"},
+		}}
+		c := NewPermissionCacheWith(q, time.Minute)
+		ctx := context.Background()
+
+		Convey("a role's codes resolve from its id", func() {
+			p, err := c.Permissions(ctx, []string{"viewer"})
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, map[string]bool{"albums.read": true, "photos.read": true})
+		})
+
+		Convey("several roles resolve to the union of their codes", func() {
+			p, err := c.Permissions(ctx, []string{"viewer", "retoucher"})
+			So(err, ShouldBeNil)
+			So(p, ShouldHaveLength, 3)
+			So(p["photos.write"], ShouldBeTrue)
+		})
+
+		Convey("unknown roles grant nothing", func() {
+			p, err := c.Permissions(ctx, []string{"deleted"})
+			So(err, ShouldBeNil)
+			So(p, ShouldBeEmpty)
+		})
+
+		Convey("resolved sets are cached", func() {
+			_, _ = c.Permissions(ctx, []string{"viewer", "deleted"})
+			_, _ = c.Permissions(ctx, []string{"viewer", "deleted"})
+			So(q.queries, ShouldEqual, 1)
+
+			Convey("until the role is invalidated", func() {
+				q.grants["viewer"] = []string{"albums.read"}
+				c.Invalidate("viewer")
+				p, _ := c.Permissions(ctx, []string{"viewer"})
+				So(q.queries, ShouldEqual, 2)
+				So(p, ShouldResemble, map[string]bool{"albums.read": true})
+			})
+
+			Convey("or everything is", func() {
+				c.Invalidate()
+				_, _ = c.Permissions(ctx, []string{"deleted"})
+				So(q.queries, ShouldEqual, 2)
+			})
+
+			Convey("or the TTL passes", func() {
+				c.ttl = 0
+				c.Invalidate()
+				_, _ = c.Permissions(ctx, []string{"viewer"})
+				_, _ = c.Permissions(ctx, []string{"viewer"})
+				So(q.queries, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given a route guarded by RequirePermission", t, func() {
+		cfg := Config{JWTSecret: []byte("test-secret"), AccessTTL: time.Minute}
+		q := &grantQueryer{grants: map[string][]string{"viewer": {"albums.read"}}}
+		var seen map[string]bool
+		h := Authenticate(cfg)(RequirePermission(NewPermissionCacheWith(q, time.Minute), "albums.read")(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen, _ = PermissionsFromContext(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			}),
+		))
+		call := func(roleIDs ...string) int {
+			tok, _, err := cfg.MintAccess("u1", "t1", nil, roleIDs)
+			So(err, ShouldBeNil)
+			req := httptest.NewRequest(http.MethodGet, "/albums", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		Convey("a caller holding the code gets through with the set in context", func() {
+			So(call("viewer"), ShouldEqual, http.StatusNoContent)
+			So(seen["albums.read"], ShouldBeTrue)
+		})
+
+		Convey("a caller missing the code is forbidden", func() {
+			So(call("nobody"), ShouldEqual, http.StatusForbidden)
+			So(call(), ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("a caller without a token is unauthenticated", func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/albums", nil))
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("a resolver failure fails closed", func() {
+			q.err = errors.New("connection refused")
+			So(call("viewer"), ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
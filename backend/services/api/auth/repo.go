@@ -19,40 +19,80 @@ type Repo interface {
 	GetPrimaryTenantID(ctx context.Context, q store.Queryer, userID string) (
 		tenantID string, err error)
 
-	// GetRolesForUserTenant returns the role list for a user within a tenant. If tenantID is empty,
-	// it returns roles across all memberships.
+	// GetRolesForUserTenant returns the role list and effective role IDs for a user within a tenant.
+	// If tenantID is empty, it returns roles across all memberships.
 	GetRolesForUserTenant(
 		ctx context.Context,
 		q store.Queryer,
 		uID string,
 		tenantID string,
-	) ([]string, error)
+	) (roles []string, roleIDs []string, err error)
 
 	// TenantRequiresMFA reports whether a tenant enforces MFA.
 	TenantRequiresMFA(ctx context.Context, q store.Queryer, tenantID string) (bool, error)
 
-	// UserHasMFAFactor reports whether the user has at least one MFA factor enrolled.
+	// UserHasMFAFactor reports whether the user has at least one confirmed MFA factor.
 	UserHasMFAFactor(ctx context.Context, q store.Queryer, userID string) (bool, error)
 
-	// CreateMFAChallenge creates a one-time MFA challenge with a hashed code and TTL.
+	// CreateMFAChallenge creates a one-time MFA challenge for purpose with a hashed code and TTL,
+	// optionally bound to the factor it was delivered through (factorID "" = none).
 	CreateMFAChallenge(
 		ctx context.Context,
 		q store.Queryer,
 		userID string,
+		factorID string,
+		purpose string,
 		ttl time.Duration,
 		codeHash string,
 	) (challengeID string, err error)
 
-	// VerifyAndConsumeMFA atomically checks an MFA code hash, increments attempts on failure, and
-	// marks the challenge fulfilled on success. Returns (ok, userID).
+	// VerifyAndConsumeMFA atomically checks the code hash of a challenge issued for purpose,
+	// increments attempts on failure, and marks the challenge fulfilled on success. Returns
+	// (ok, userID).
 	VerifyAndConsumeMFA(
 		ctx context.Context,
 		q store.Queryer,
 		challengeID string,
+		purpose string,
 		codeHash string,
 	) (ok bool, userID string, err error)
 
-	// InsertSession writes a refresh session (hashed token) with UA/IP and expiry.
+	// ListMFAFactors returns the user's confirmed MFA factors, primary first.
+	ListMFAFactors(ctx context.Context, q store.Queryer, userID string) ([]MFAFactor, error)
+
+	// UpsertSMSFactor stores (or reuses) an SMS factor for the number and reports whether it is
+	// already confirmed.
+	UpsertSMSFactor(
+		ctx context.Context,
+		q store.Queryer,
+		userID, phone, label string,
+	) (factorID string, confirmed bool, err error)
+
+	// ConfirmMFAFactor marks the factor bound to a fulfilled challenge as confirmed. The first
+	// confirmed factor becomes primary. Returns false if the challenge has no such factor.
+	ConfirmMFAFactor(ctx context.Context, q store.Queryer, userID, challengeID string) (bool, error)
+
+	// DeleteMFAFactor removes one of the user's factors. Returns false if no such factor.
+	DeleteMFAFactor(ctx context.Context, q store.Queryer, userID, factorID string) (bool, error)
+
+	// SMSSendStats returns how many SMS went to phone within window and when the last one did.
+	SMSSendStats(
+		ctx context.Context,
+		q store.Queryer,
+		phone string,
+		window time.Duration,
+	) (count int, last time.Time, err error)
+
+	// InsertSMSSend records an SMS sent to phone for rate limiting.
+	InsertSMSSend(ctx context.Context, q store.Queryer, phone, userID, purpose string) error
+
+	// LockSMSPhone serializes SMS sends to phone until the transaction ends, so the limit check
+	// and the send record can't interleave with another request's.
+	LockSMSPhone(ctx context.Context, q store.Queryer, phone string) error
+
+	// InsertSession writes a refresh session (hashed token) with UA/IP, device fingerprint and
+	// expiry, and returns the session ID. familyID is the session a refresh rotates from; empty
+	// starts a new family.
 	InsertSession(
 		ctx context.Context,
 		q store.Queryer,
@@ -61,8 +101,10 @@ type Repo interface {
 		refreshHash string,
 		ua string,
 		ip string,
+		fingerprint string,
+		familyID string,
 		ttl time.Duration,
-	) error
+	) (sessionID string, err error)
 
 	// InsertLoginAttempt records a login attempt for auditing and lockout logic.
 	InsertLoginAttempt(
@@ -74,8 +116,41 @@ type Repo interface {
 		reason string,
 		ip string,
 		ua string,
+		fingerprint string,
 	) error
 
+	// DeviceSeen reports whether the user has a past successful login from the device
+	// fingerprint, and whether they have any successful login history at all.
+	DeviceSeen(
+		ctx context.Context,
+		q store.Queryer,
+		userID string,
+		fingerprint string,
+	) (seen bool, hasHistory bool, err error)
+
+	// InsertOneTimeToken stores a hashed single-use token for purpose with metadata and expiry.
+	InsertOneTimeToken(
+		ctx context.Context,
+		q store.Queryer,
+		userID string,
+		purpose string,
+		tokenHash string,
+		meta map[string]string,
+		ttl time.Duration,
+	) error
+
+	// ConsumeOneTimeToken marks an unused, unexpired token used and returns its user and metadata.
+	ConsumeOneTimeToken(
+		ctx context.Context,
+		q store.Queryer,
+		purpose string,
+		tokenHash string,
+	) (userID string, meta map[string]string, err error)
+
+	// RevokeSessionFamily revokes every live session rotated from the same login as sessionID
+	// and returns how many it revoked.
+	RevokeSessionFamily(ctx context.Context, q store.Queryer, userID, sessionID string) (int64, error)
+
 	// CreateUser inserts a new user and returns its ID.
 	CreateUser(ctx context.Context, q store.Queryer, email, pwHash, name string) (string, error)
 
@@ -93,7 +168,7 @@ type Repo interface {
 		ctx context.Context,
 		q store.Queryer,
 		hash string,
-	) (userID, tenantID string, err error)
+	) (userID, tenantID, familyID string, err error)
 
 	// RevokeSessionByHash marks a session revoked by token hash (idempotent).
 	RevokeSessionByHash(ctx context.Context, q store.Queryer, hash string) error
@@ -155,32 +230,37 @@ func (r *repo) GetPrimaryTenantID(
 	return tid, err
 }
 
-// GetRolesForUserTenant returns the set of roles the user has in the given tenant (or across all
-// if tenantID is empty).
+// GetRolesForUserTenant returns the built-in role names the user has in the given tenant (or across
+// all if tenantID is empty) and the IDs of the effective permission sets: the assigned custom role,
+// or the built-in role when none is assigned. Suspended memberships grant nothing.
 func (r *repo) GetRolesForUserTenant(
 	ctx context.Context,
 	q store.Queryer,
 	userID string,
 	tenantID string,
-) ([]string, error) {
+) ([]string, []string, error) {
 	rows, err := q.Query(
 		ctx,
-		`SELECT role::text FROM users_tenants WHERE user_id=$1 AND ($2='' OR tenant_id::text=$2)`,
+		`SELECT ut.role::text, COALESCE(ut.role_id, br.id)::text
+		   FROM users_tenants ut
+		   JOIN auth_roles br ON br.tenant_id IS NULL AND br.key = ut.role::text
+		  WHERE ut.user_id=$1 AND ut.is_active AND ($2='' OR ut.tenant_id::text=$2)`,
 		userID,
 		tenantID,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var roles []string
+	var roles, roleIDs []string
 	for rows.Next() {
-		var rr string
-		_ = rows.Scan(&rr)
+		var rr, rid string
+		_ = rows.Scan(&rr, &rid)
 		roles = append(roles, rr)
+		roleIDs = append(roleIDs, rid)
 	}
-	return roles, nil
+	return roles, roleIDs, nil
 }
 
 // TenantRequiresMFA reports whether MFA is enforced for the tenant.
@@ -198,7 +278,7 @@ func (r *repo) TenantRequiresMFA(
 	return f, err
 }
 
-// UserHasMFAFactor reports whether the user has any MFA factor enrolled.
+// UserHasMFAFactor reports whether the user has any confirmed MFA factor.
 func (r *repo) UserHasMFAFactor(
 	ctx context.Context,
 	q store.Queryer,
@@ -207,7 +287,7 @@ func (r *repo) UserHasMFAFactor(
 	var f bool
 	err := q.QueryRow(
 		ctx,
-		`SELECT EXISTS(SELECT 1 FROM auth_mfa_factors WHERE user_id=$1)`,
+		`SELECT EXISTS(SELECT 1 FROM auth_mfa_factors WHERE user_id=$1 AND confirmed_at IS NOT NULL)`,
 		userID,
 	).Scan(&f)
 	return f, err
@@ -218,28 +298,162 @@ func (r *repo) CreateMFAChallenge(
 	ctx context.Context,
 	q store.Queryer,
 	userID string,
+	factorID string,
+	purpose string,
 	ttl time.Duration,
 	codeHash string,
 ) (string, error) {
 	var id string
 	err := q.QueryRow(
 		ctx,
-		`INSERT INTO auth_mfa_challenges (user_id, factor_id, code_hash, max_attempts, expires_at)
-		 VALUES ($1, NULL, $2, 5, NOW() + $3::interval)
+		`INSERT INTO auth_mfa_challenges (user_id, factor_id, purpose, code_hash, max_attempts, expires_at)
+		 VALUES ($1, NULLIF($4, '')::uuid, $5, $2, 5, NOW() + $3::interval)
 		 RETURNING id::text`,
 		userID,
 		codeHash,
 		ttl.String(),
+		factorID,
+		purpose,
 	).Scan(&id)
 	return id, err
 }
 
+// ListMFAFactors returns the user's confirmed MFA factors, primary first.
+func (r *repo) ListMFAFactors(ctx context.Context, q store.Queryer, userID string) ([]MFAFactor, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT id::text, type, COALESCE(label,''), COALESCE(secret,''), is_primary
+		   FROM auth_mfa_factors
+		  WHERE user_id=$1 AND confirmed_at IS NOT NULL
+		  ORDER BY is_primary DESC, created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MFAFactor
+	for rows.Next() {
+		var f MFAFactor
+		if err := rows.Scan(&f.ID, &f.Type, &f.Label, &f.Secret, &f.IsPrimary); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// UpsertSMSFactor stores (or reuses) an SMS factor for the number.
+func (r *repo) UpsertSMSFactor(
+	ctx context.Context,
+	q store.Queryer,
+	userID, phone, label string,
+) (string, bool, error) {
+	var (
+		id        string
+		confirmed bool
+	)
+	err := q.QueryRow(
+		ctx,
+		`INSERT INTO auth_mfa_factors (user_id, type, label, secret)
+		 VALUES ($1, 'sms', NULLIF($3, ''), $2)
+		 ON CONFLICT (user_id, secret) WHERE type = 'sms'
+		 DO UPDATE SET label = COALESCE(EXCLUDED.label, auth_mfa_factors.label)
+		 RETURNING id::text, confirmed_at IS NOT NULL`,
+		userID,
+		phone,
+		label,
+	).Scan(&id, &confirmed)
+	return id, confirmed, err
+}
+
+// ConfirmMFAFactor marks the factor bound to a fulfilled challenge as confirmed.
+func (r *repo) ConfirmMFAFactor(ctx context.Context, q store.Queryer, userID, challengeID string) (bool, error) {
+	tag, err := q.Exec(
+		ctx,
+		`UPDATE auth_mfa_factors f
+		    SET confirmed_at     = COALESCE(f.confirmed_at, NOW()),
+		        last_verified_at = NOW(),
+		        is_primary       = f.is_primary OR NOT EXISTS (
+		          SELECT 1 FROM auth_mfa_factors o
+		           WHERE o.user_id = f.user_id AND o.is_primary AND o.confirmed_at IS NOT NULL)
+		   FROM auth_mfa_challenges c
+		  WHERE c.id::text = $2 AND c.user_id = $1 AND c.fulfilled_at IS NOT NULL
+		    AND f.id = c.factor_id AND f.user_id = $1`,
+		userID,
+		challengeID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteMFAFactor removes one of the user's factors.
+func (r *repo) DeleteMFAFactor(ctx context.Context, q store.Queryer, userID, factorID string) (bool, error) {
+	tag, err := q.Exec(
+		ctx,
+		`DELETE FROM auth_mfa_factors WHERE user_id=$1 AND id::text=$2`,
+		userID,
+		factorID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SMSSendStats returns how many SMS went to phone within window and when the last one did.
+func (r *repo) SMSSendStats(
+	ctx context.Context,
+	q store.Queryer,
+	phone string,
+	window time.Duration,
+) (int, time.Time, error) {
+	var (
+		n    int
+		last *time.Time
+	)
+	err := q.QueryRow(
+		ctx,
+		`SELECT COUNT(*), MAX(created_at)
+		   FROM auth_sms_sends
+		  WHERE phone=$1 AND created_at > NOW() - ($2::bigint * interval '1 second')`,
+		phone,
+		int64(window.Seconds()),
+	).Scan(&n, &last)
+	if err != nil || last == nil {
+		return n, time.Time{}, err
+	}
+	return n, *last, nil
+}
+
+// InsertSMSSend records an SMS sent to phone for rate limiting.
+func (r *repo) InsertSMSSend(ctx context.Context, q store.Queryer, phone, userID, purpose string) error {
+	_, err := q.Exec(
+		ctx,
+		`INSERT INTO auth_sms_sends (phone, user_id, purpose) VALUES ($1, NULLIF($2, '')::uuid, $3)`,
+		phone,
+		userID,
+		purpose,
+	)
+	return err
+}
+
+// LockSMSPhone takes a transaction-scoped advisory lock on the phone number.
+func (r *repo) LockSMSPhone(ctx context.Context, q store.Queryer, phone string) error {
+	_, err := q.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('auth_sms_sends:' || $1, 0))`, phone)
+	return err
+}
+
 // VerifyAndConsumeMFA atomically checks a challenge code hash, increments attempts on mismatch,
-// fulfills on match, and returns (ok, userID).
+// fulfills on match, and returns (ok, userID). Challenges issued for another purpose don't match.
 func (r *repo) VerifyAndConsumeMFA(
 	ctx context.Context,
 	q store.Queryer,
 	challengeID string,
+	purpose string,
 	codeHash string,
 ) (bool, string, error) {
 	var userID string
@@ -249,15 +463,17 @@ func (r *repo) VerifyAndConsumeMFA(
 		`UPDATE auth_mfa_challenges
 		   SET attempts    = CASE WHEN $2 = code_hash THEN attempts ELSE attempts + 1 END,
 		       fulfilled_at = CASE WHEN $2 = code_hash THEN NOW() ELSE fulfilled_at END
-		 WHERE id=$1 AND fulfilled_at IS NULL AND expires_at > NOW() AND attempts < max_attempts
+		 WHERE id=$1 AND purpose=$3
+		   AND fulfilled_at IS NULL AND expires_at > NOW() AND attempts < max_attempts
 		 RETURNING user_id::text, $2 = code_hash`,
 		challengeID,
 		codeHash,
+		purpose,
 	).Scan(&userID, &ok)
 	return ok, userID, err
 }
 
-// InsertSession inserts a refresh session (hashed token) with UA/IP and expiry.
+// InsertSession inserts a refresh session (hashed token) with UA/IP, fingerprint and expiry.
 func (r *repo) InsertSession(
 	ctx context.Context,
 	q store.Queryer,
@@ -266,28 +482,36 @@ func (r *repo) InsertSession(
 	refreshHash string,
 	userAgent string,
 	ip string,
+	fingerprint string,
+	familyID string, // empty string => NULL, a new family
 	ttl time.Duration,
-) error {
-	_, err := q.Exec(ctx, `
+) (string, error) {
+	var id string
+	err := q.QueryRow(ctx, `
 		INSERT INTO auth_sessions (
-			user_id, tenant_id, refresh_token_hash, user_agent, ip, expires_at
+			user_id, tenant_id, refresh_token_hash, user_agent, ip, device_fingerprint, family_id, expires_at
 		) VALUES (
 			$1,
 			NULLIF($2, '')::uuid,                     -- cast AFTER NULLIF
 			$3,
 			$4,
 			$5,
-			NOW() + ($6::bigint * interval '1 second') -- build interval from seconds
+			NULLIF($6, ''),
+			NULLIF($7, '')::uuid,
+			NOW() + ($8::bigint * interval '1 second') -- build interval from seconds
 		)
+		RETURNING id::text
 	`,
 		userID,
 		tenantID, // "" -> NULL
 		refreshHash,
 		userAgent,
 		ip,
+		fingerprint,
+		familyID,               // "" -> NULL
 		int64(ttl/time.Second), // pass seconds, not "720h0m0s"
-	)
-	return err
+	).Scan(&id)
+	return id, err
 }
 
 // InsertLoginAttempt records a login attempt for auditing and lockout logic.
@@ -300,6 +524,7 @@ func (r *repo) InsertLoginAttempt(
 	reason string,
 	ip string,
 	ua string,
+	fingerprint string,
 ) error {
 	var uid any
 	if userID == nil {
@@ -309,18 +534,108 @@ func (r *repo) InsertLoginAttempt(
 	}
 	_, err := q.Exec(
 		ctx,
-		`INSERT INTO auth_login_attempts (user_id, email, success, reason, ip, user_agent)
-		 VALUES ($1,$2,$3,$4,$5,$6)`,
+		`INSERT INTO auth_login_attempts (user_id, email, success, reason, ip, user_agent, device_fingerprint)
+		 VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''))`,
 		uid,
 		email,
 		success,
 		reason,
 		ip,
 		ua,
+		fingerprint,
 	)
 	return err
 }
 
+// DeviceSeen reports (seen, hasHistory) for a device fingerprint against past successful logins.
+func (r *repo) DeviceSeen(
+	ctx context.Context,
+	q store.Queryer,
+	userID string,
+	fingerprint string,
+) (bool, bool, error) {
+	var seen, history bool
+	err := q.QueryRow(
+		ctx,
+		`SELECT
+		   EXISTS(SELECT 1 FROM auth_login_attempts
+		           WHERE user_id=$1 AND success AND device_fingerprint=$2),
+		   EXISTS(SELECT 1 FROM auth_login_attempts
+		           WHERE user_id=$1 AND success)`,
+		userID,
+		fingerprint,
+	).Scan(&seen, &history)
+	return seen, history, err
+}
+
+// InsertOneTimeToken stores a hashed single-use token with metadata and expiry.
+func (r *repo) InsertOneTimeToken(
+	ctx context.Context,
+	q store.Queryer,
+	userID string,
+	purpose string,
+	tokenHash string,
+	meta map[string]string,
+	ttl time.Duration,
+) error {
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	_, err := q.Exec(
+		ctx,
+		`INSERT INTO auth_one_time_tokens (user_id, purpose, token_hash, meta, expires_at)
+		 VALUES ($1, $2, $3, $4, NOW() + ($5::bigint * interval '1 second'))`,
+		userID,
+		purpose,
+		tokenHash,
+		meta,
+		int64(ttl/time.Second),
+	)
+	return err
+}
+
+// ConsumeOneTimeToken atomically marks a valid token used and returns (userID, meta).
+func (r *repo) ConsumeOneTimeToken(
+	ctx context.Context,
+	q store.Queryer,
+	purpose string,
+	tokenHash string,
+) (string, map[string]string, error) {
+	var uid string
+	var meta map[string]string
+	err := q.QueryRow(
+		ctx,
+		`UPDATE auth_one_time_tokens SET used_at=NOW()
+		  WHERE purpose=$1 AND token_hash=$2 AND used_at IS NULL AND expires_at > NOW()
+		  RETURNING user_id::text, meta`,
+		purpose,
+		tokenHash,
+	).Scan(&uid, &meta)
+	return uid, meta, err
+}
+
+// RevokeSessionFamily revokes the live sessions sharing sessionID's family, which is the login
+// that started it and every refresh rotated from it, and returns how many rows it revoked.
+func (r *repo) RevokeSessionFamily(
+	ctx context.Context,
+	q store.Queryer,
+	userID string,
+	sessionID string,
+) (int64, error) {
+	tag, err := q.Exec(
+		ctx,
+		`UPDATE auth_sessions SET revoked_at=NOW()
+		   WHERE user_id=$1
+		     AND revoked_at IS NULL
+		     AND COALESCE(family_id, id) = (
+		       SELECT COALESCE(family_id, id) FROM auth_sessions WHERE id=$2 AND user_id=$1
+		     )`,
+		userID,
+		sessionID,
+	)
+	return tag.RowsAffected(), err
+}
+
 // CreateUser inserts a new user and returns its ID.
 func (r *repo) CreateUser(
 	ctx context.Context,
@@ -394,24 +709,25 @@ func (r *repo) SetPrimaryTenantIfNull(
 	return err
 }
 
-// GetActiveSessionByHash returns (userID, tenantID) for an active session by token hash.
+// GetActiveSessionByHash returns (userID, tenantID, familyID) for an active session by token
+// hash; a session that started its family is its own family.
 func (r *repo) GetActiveSessionByHash(
 	ctx context.Context,
 	q store.Queryer,
 	hash string,
-) (string, string, error) {
-	var uid, tid string
+) (string, string, string, error) {
+	var uid, tid, fid string
 	err := q.QueryRow(
 		ctx,
-		`SELECT user_id::text, COALESCE(tenant_id::text,'')
+		`SELECT user_id::text, COALESCE(tenant_id::text,''), COALESCE(family_id, id)::text
 		   FROM auth_sessions
 		  WHERE refresh_token_hash=$1
 		    AND revoked_at IS NULL
 		    AND expires_at > NOW()
 		  LIMIT 1`,
 		hash,
-	).Scan(&uid, &tid)
-	return uid, tid, err
+	).Scan(&uid, &tid, &fid)
+	return uid, tid, fid, err
 }
 
 // RevokeSessionByHash marks a session revoked by its token hash (idempotent).
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
 	"lumium/lib/store"
 )
 
@@ -42,6 +43,18 @@ type Service interface {
 
 	// Reset validates a reset token, updates the password, and revokes active sessions
 	Reset(ctx context.Context, in ResetInput) error
+
+	// EnrollSMS registers a phone number as an unconfirmed factor and texts it a code
+	EnrollSMS(ctx context.Context, in SMSEnrollInput) (*SMSEnrollResult, error)
+
+	// ConfirmSMS verifies the enrollment code, making the phone usable for MFA
+	ConfirmSMS(ctx context.Context, in SMSConfirmInput) error
+
+	// DeleteMFAFactor removes one of the user's MFA factors
+	DeleteMFAFactor(ctx context.Context, userID, factorID string) error
+
+	// NotMe consumes a "this wasn't me" token from a new-device notice and revokes that session
+	NotMe(ctx context.Context, token string) error
 }
 
 // Login authenticates a user and handles MFA and session creation
@@ -50,28 +63,30 @@ func (s *svc) Login(
 	in LoginInput,
 ) (*LoginResult, *MFARequired, error) {
 	email := strings.ToLower(strings.TrimSpace(in.Email))
+	dev := fingerprintDevice(in.UserAgent, in.IP)
 
 	userID, pwHash, active, err := s.Repo.GetUserByEmail(ctx, s.DB, email)
 	if err != nil {
 		_ = s.Repo.InsertLoginAttempt(
-			ctx, s.DB, nil, email, false, "not_found", in.IP, in.UserAgent,
+			ctx, s.DB, nil, email, false, "not_found", in.IP, in.UserAgent, dev.Fingerprint,
 		)
-		return nil, nil, lumErrors.InvalidArgf("invalid credentials")
+		return nil, nil, lumErrors.Unauthenticatedf("invalid credentials")
 	}
 
 	if !active {
 		_ = s.Repo.InsertLoginAttempt(
-			ctx, s.DB, &userID, email, false, "inactive", in.IP, in.UserAgent,
+			ctx, s.DB, &userID, email, false, "inactive", in.IP, in.UserAgent, dev.Fingerprint,
 		)
-		return nil, nil, lumErrors.InvalidArgf("account disabled")
+		// reported to the client like bad credentials, so it can't probe for disabled accounts
+		return nil, nil, lumErrors.Unauthenticatedf("account disabled")
 	}
 
 	ok, _ := VerifyPassword(in.Password, pwHash)
 	if !ok {
 		_ = s.Repo.InsertLoginAttempt(
-			ctx, s.DB, &userID, email, false, "invalid_password", in.IP, in.UserAgent,
+			ctx, s.DB, &userID, email, false, "invalid_password", in.IP, in.UserAgent, dev.Fingerprint,
 		)
-		return nil, nil, lumErrors.InvalidArgf("invalid credentials")
+		return nil, nil, lumErrors.Unauthenticatedf("invalid credentials")
 	}
 
 	tenantID := strings.TrimSpace(in.TenantID)
@@ -92,59 +107,72 @@ func (s *svc) Login(
 		}
 	}
 
-	if mfaNeeded && in.MFACode == "" {
-		// Create challenge
-		code := random6()
-		sum := sha256.Sum256([]byte(code))
-		codeHash := hex.EncodeToString(sum[:])
+	// Unfamiliar device: a user with login history signing in from a fingerprint we've never
+	// seen succeed. First-ever logins aren't "unfamiliar", there's nothing to compare against
+	seen, history, err := s.Repo.DeviceSeen(ctx, s.DB, userID, dev.Fingerprint)
+	unfamiliar := err == nil && history && !seen
+	if !mfaNeeded && unfamiliar && s.Cfg.MFAForUnfamiliarDevice {
+		mfaNeeded = true
+	}
 
-		chID, err := s.Repo.CreateMFAChallenge(ctx, s.DB, userID, 10*time.Minute, codeHash)
-		if err == nil {
-			_ = s.Repo.InsertLoginAttempt(
-				ctx, s.DB, &userID, email, false, "mfa_required", in.IP, in.UserAgent,
-			)
-			// @TODO: deliver `code` via email/SMS
-			_ = code
-			return nil, &MFARequired{ChallengeID: chID, Factors: []string{"email"}}, nil
+	if mfaNeeded && in.MFACode == "" {
+		chID, factors, err := s.issueChallenge(ctx, userID, "")
+		if chID == "" {
+			// fail closed: never fall through to a session when MFA is required
+			return nil, nil, err
+		}
+		if err != nil {
+			l := logger.Ctx(ctx)
+			l.Warn().Err(err).Str("user_id", userID).Msg("login: mfa code delivery")
 		}
+		_ = s.Repo.InsertLoginAttempt(
+			ctx, s.DB, &userID, email, false, "mfa_required", in.IP, in.UserAgent, dev.Fingerprint,
+		)
+		return nil, &MFARequired{ChallengeID: chID, Factors: factors}, nil
 	}
 
 	if mfaNeeded && in.MFACode != "" {
 		sum := sha256.Sum256([]byte(strings.TrimSpace(in.MFACode)))
-		ok, _, _ := s.Repo.VerifyAndConsumeMFA(
+		// the challenge must be this user's and issued for login, not e.g. a phone enrollment
+		ok, owner, err := s.Repo.VerifyAndConsumeMFA(
 			ctx,
 			s.DB,
 			strings.TrimSpace(in.MFAChallengeID),
+			mfaPurposeLogin,
 			hex.EncodeToString(sum[:]),
 		)
-		if !ok {
+		if err != nil || !ok || owner != userID {
 			_ = s.Repo.InsertLoginAttempt(
-				ctx, s.DB, &userID, email, false, "mfa_invalid", in.IP, in.UserAgent,
+				ctx, s.DB, &userID, email, false, "mfa_invalid", in.IP, in.UserAgent, dev.Fingerprint,
 			)
-			return nil, nil, lumErrors.InvalidArgf("invalid verification code")
+			return nil, nil, lumErrors.Unauthenticatedf("invalid verification code")
 		}
 	}
 
-	roles, _ := s.Repo.GetRolesForUserTenant(ctx, s.DB, userID, tenantID)
+	roles, roleIDs, _ := s.Repo.GetRolesForUserTenant(ctx, s.DB, userID, tenantID)
 
-	access, exp, err := s.Cfg.MintAccess(userID, tenantID, roles)
+	access, exp, err := s.Cfg.MintAccess(userID, tenantID, roles, roleIDs)
 	if err != nil {
-		return nil, nil, lumErrors.DBf("mint access")
+		return nil, nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "mint access")
 	}
 
 	opaque, hash, err := NewOpaque(32)
 	if err != nil {
-		return nil, nil, lumErrors.DBf("refresh token")
+		return nil, nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "refresh token")
 	}
-	if err := s.Repo.InsertSession(
-		ctx, s.DB, userID, tenantID, hash, in.UserAgent, in.IP, s.Cfg.RefreshTTL,
-	); err != nil {
-		return nil, nil, lumErrors.DBf("create session")
+	sessionID, err := s.Repo.InsertSession(
+		ctx, s.DB, userID, tenantID, hash, in.UserAgent, in.IP, dev.Fingerprint, "", s.Cfg.RefreshTTL,
+	)
+	if err != nil {
+		return nil, nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create session")
 	}
 
 	_ = s.Repo.InsertLoginAttempt(
-		ctx, s.DB, &userID, email, true, "ok", in.IP, in.UserAgent,
+		ctx, s.DB, &userID, email, true, "ok", in.IP, in.UserAgent, dev.Fingerprint,
 	)
+	if unfamiliar && s.Cfg.NotifyNewDevice {
+		s.notifyNewDevice(ctx, userID, email, sessionID, dev, in.IP)
+	}
 	return &LoginResult{
 		UserID:     userID,
 		TenantID:   tenantID,
@@ -163,7 +191,7 @@ func (s *svc) Signup(ctx context.Context, in SignupInput) (*SignupResult, error)
 
 	pwHash, err := HashPassword(in.Password, s.Cfg)
 	if err != nil {
-		return nil, lumErrors.DBf("hash password")
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "hash password")
 	}
 
 	var userID, tenantID, access string
@@ -181,7 +209,7 @@ func (s *svc) Signup(ctx context.Context, in SignupInput) (*SignupResult, error)
 					"email",
 				)
 			}
-			return lumErrors.DBf("create user: %v", err)
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create user")
 		}
 		userID = id
 
@@ -189,12 +217,12 @@ func (s *svc) Signup(ctx context.Context, in SignupInput) (*SignupResult, error)
 		if slug != "" {
 			tid, err := s.Repo.EnsureTenantBySlug(ctx, q, slug)
 			if err != nil {
-				return lumErrors.DBf("ensure tenant: %v", err)
+				return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "ensure tenant")
 			}
 			tenantID = tid
 
 			if err := s.Repo.UpsertUserTenantAdmin(ctx, q, userID, tenantID); err != nil {
-				return lumErrors.DBf("add membership")
+				return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "add membership")
 			}
 			_ = s.Repo.SetPrimaryTenantIfNull(ctx, q, userID, tenantID)
 		}
@@ -206,24 +234,25 @@ func (s *svc) Signup(ctx context.Context, in SignupInput) (*SignupResult, error)
 		}
 
 		// Roles + access
-		roles, _ := s.Repo.GetRolesForUserTenant(ctx, q, userID, tenantID)
-		acc, e, err := s.Cfg.MintAccess(userID, tenantID, roles)
+		roles, roleIDs, _ := s.Repo.GetRolesForUserTenant(ctx, q, userID, tenantID)
+		acc, e, err := s.Cfg.MintAccess(userID, tenantID, roles, roleIDs)
 		if err != nil {
-			return lumErrors.DBf("mint access")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "mint access")
 		}
 		access, exp = acc, e
 
 		// Refresh session
 		opaque, hash, err := NewOpaque(32)
 		if err != nil {
-			return lumErrors.DBf("refresh token")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "refresh token")
 		}
 		refreshRaw, refreshHash = opaque, hash
 
-		if err := s.Repo.InsertSession(
-			ctx, q, userID, tenantID, refreshHash, in.UserAgent, in.IP, s.Cfg.RefreshTTL,
+		fp := fingerprintDevice(in.UserAgent, in.IP).Fingerprint
+		if _, err := s.Repo.InsertSession(
+			ctx, q, userID, tenantID, refreshHash, in.UserAgent, in.IP, fp, "", s.Cfg.RefreshTTL,
 		); err != nil {
-			return lumErrors.DBf("create session")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create session")
 		}
 		return nil
 	})
@@ -245,36 +274,37 @@ func (s *svc) Refresh(ctx context.Context, in RefreshInput) (*RefreshResult, err
 	sum := sha256.Sum256([]byte(in.RefreshOpaque))
 	oldHash := hex.EncodeToString(sum[:])
 
-	var userID, tenantID string
+	var userID, tenantID, familyID string
 	var access string
 	var exp time.Time
 	var newOpaque string
 
-	err := store.WithTx(ctx, s.DB, func(q store.Queryer) error {
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
 		var err error
-		userID, tenantID, err = s.Repo.GetActiveSessionByHash(ctx, q, oldHash)
+		userID, tenantID, familyID, err = s.Repo.GetActiveSessionByHash(ctx, q, oldHash)
 		if err != nil {
-			return lumErrors.InvalidArgf("unauthorized")
+			return lumErrors.Unauthenticatedf("unauthorized")
 		}
 
 		_ = s.Repo.RevokeSessionByHash(ctx, q, oldHash)
 
 		opaque, newHash, err := NewOpaque(32)
 		if err != nil {
-			return lumErrors.DBf("opaque")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "opaque")
 		}
 		newOpaque = opaque
 
-		if err := s.Repo.InsertSession(
-			ctx, q, userID, tenantID, newHash, in.UserAgent, in.IP, s.Cfg.RefreshTTL,
+		fp := fingerprintDevice(in.UserAgent, in.IP).Fingerprint
+		if _, err := s.Repo.InsertSession(
+			ctx, q, userID, tenantID, newHash, in.UserAgent, in.IP, fp, familyID, s.Cfg.RefreshTTL,
 		); err != nil {
-			return lumErrors.DBf("insert new session")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "insert new session")
 		}
 
-		roles, _ := s.Repo.GetRolesForUserTenant(ctx, q, userID, tenantID)
-		acc, e, err := s.Cfg.MintAccess(userID, tenantID, roles)
+		roles, roleIDs, _ := s.Repo.GetRolesForUserTenant(ctx, q, userID, tenantID)
+		acc, e, err := s.Cfg.MintAccess(userID, tenantID, roles, roleIDs)
 		if err != nil {
-			return lumErrors.DBf("mint access")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "mint access")
 		}
 		access, exp = acc, e
 
@@ -348,11 +378,11 @@ func (s *svc) Reset(ctx context.Context, in ResetInput) error {
 
 		pwHash, err := HashPassword(in.Password, s.Cfg)
 		if err != nil {
-			return lumErrors.DBf("hash")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "hash")
 		}
 
 		if err := s.Repo.UpdateUserPasswordHash(ctx, q, uid, pwHash); err != nil {
-			return lumErrors.DBf("update password")
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update password")
 		}
 		_ = s.Repo.MarkPasswordResetUsed(ctx, q, th)
 		_ = s.Repo.RevokeAllSessionsForUser(ctx, q, uid)
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTx = func(ctx context.Context, b store.Beginner, fn func(q store.Queryer) error) error {
+		return store.WithTx(ctx, b, fn)
+	}
+)
+
+var e164Re = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SMSMessage is one outbound text message
+type SMSMessage struct {
+	To   string `json:"to"` // E.164
+	From string `json:"from"`
+	Body string `json:"body"`
+}
+
+// SMSGateway delivers text messages. Implementations wrap a provider's API; they should return
+// an error for anything the provider didn't accept so the caller can report it
+type SMSGateway interface {
+	Send(ctx context.Context, m SMSMessage) error
+}
+
+// NewSMSGateway returns the HTTP gateway when AUTH_SMS_GATEWAY_URL is set. Otherwise
+// AUTH_SMS_LOG_ONLY opts into a gateway that only logs, so local stacks work without a provider
+// account; without either, every send fails (Config.Validate stops startup first)
+func NewSMSGateway(c Config) SMSGateway {
+	if c.SMSGatewayURL == "" {
+		if c.SMSLogOnly {
+			return logSMSGateway{}
+		}
+		return noSMSGateway{}
+	}
+	return &httpSMSGateway{
+		url:    c.SMSGatewayURL,
+		token:  c.SMSGatewayToken,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// httpSMSGateway POSTs SMSMessage as JSON with a bearer token. Provider adapters and the
+// smsstub test server speak this shape
+type httpSMSGateway struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// Send delivers m; any non-2xx response is an error
+func (g *httpSMSGateway) Send(ctx context.Context, m SMSMessage) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("sms gateway: status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// logSMSGateway notes messages in the service log instead of delivering them. The body holds a
+// live code, so only the masked number is logged
+type logSMSGateway struct{}
+
+// Send logs that a message would have been sent
+func (logSMSGateway) Send(ctx context.Context, m SMSMessage) error {
+	l := logger.Ctx(ctx)
+	l.Info().Str("to", maskPhone(m.To)).Msg("SMS not sent: AUTH_SMS_LOG_ONLY is set")
+	return nil
+}
+
+// noSMSGateway is the gateway of a config with neither a URL nor AUTH_SMS_LOG_ONLY
+type noSMSGateway struct{}
+
+// Send fails
+func (noSMSGateway) Send(context.Context, SMSMessage) error {
+	return errors.New("sms gateway: AUTH_SMS_GATEWAY_URL is unset")
+}
+
+// normalizePhone strips formatting and validates the result as E.164
+func normalizePhone(raw string) (string, error) {
+	p := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+	if strings.HasPrefix(p, "00") {
+		p = "+" + p[2:]
+	}
+	if !e164Re.MatchString(p) {
+		return "", lumErrors.NewValidationError(
+			lumErrors.ErrorCodeValidation, "phone must be in international format, e.g. +14155550123", "phone")
+	}
+	return p, nil
+}
+
+// maskPhone keeps the country prefix and last four digits
+func maskPhone(p string) string {
+	if len(p) < 7 {
+		return "••••"
+	}
+	return p[:2] + strings.Repeat("•", len(p)-6) + p[len(p)-4:]
+}
+
+// sendSMSCode enforces the per-number limits, records the send and delivers the code. The
+// limits key on the destination, not the user: they exist to stop toll fraud and harassment.
+// The check and the record share a transaction holding the number's lock, so concurrent
+// requests can't all pass the check before any of them is recorded
+func (s *svc) sendSMSCode(ctx context.Context, userID, phone, purpose, code string) error {
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		if err := s.Repo.LockSMSPhone(ctx, q, phone); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "sms rate limit")
+		}
+		n, last, err := s.Repo.SMSSendStats(ctx, q, phone, time.Hour)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "sms rate limit")
+		}
+		if n >= s.Cfg.SMSMaxPerHour || (!last.IsZero() && time.Since(last) < s.Cfg.SMSMinInterval) {
+			return lumErrors.RateLimitedf("too many codes sent to this number, try again later")
+		}
+		if err := s.Repo.InsertSMSSend(ctx, q, phone, userID, purpose); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "sms record")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.sms.Send(ctx, SMSMessage{
+		To:   phone,
+		From: s.Cfg.SMSFrom,
+		Body: fmt.Sprintf("%s is your Lumium verification code. It expires in 10 minutes.", code),
+	}); err != nil {
+		l := logger.Ctx(ctx)
+		l.Warn().Err(err).Str("user_id", userID).Str("to", maskPhone(phone)).Msg("sms: deliver")
+		return lumErrors.Unavailablef("could not send SMS, try again later")
+	}
+	return nil
+}
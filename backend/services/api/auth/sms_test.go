@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lumium/lib/logger"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth/smsstub"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// smsRepo records SMS sends and number locks in memory; every other Repo method is unused here
+type smsRepo struct {
+	Repo
+	sends  map[string][]time.Time
+	locked []string
+}
+
+func (r *smsRepo) LockSMSPhone(_ context.Context, _ store.Queryer, phone string) error {
+	r.locked = append(r.locked, phone)
+	return nil
+}
+
+func (r *smsRepo) SMSSendStats(
+	_ context.Context,
+	_ store.Queryer,
+	phone string,
+	window time.Duration,
+) (int, time.Time, error) {
+	var (
+		n    int
+		last time.Time
+	)
+	for _, t := range r.sends[phone] {
+		if time.Since(t) < window {
+			n++
+			if t.After(last) {
+				last = t
+			}
+		}
+	}
+	return n, last, nil
+}
+
+func (r *smsRepo) InsertSMSSend(_ context.Context, _ store.Queryer, phone, _, _ string) error {
+	r.sends[phone] = append(r.sends[phone], time.Now())
+	return nil
+}
+
+func TestSMS(t *testing.T) {
+	Convey("normalizePhone", t, func() {
+		p, err := normalizePhone(" +1 (415) 555-0123 ")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "+14155550123")
+
+		p, err = normalizePhone("0044 20 7946 0958")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "+442079460958")
+
+		for _, bad := range []string{"4155550123", "+0123456789", "+1 555", "+1415555012a"} {
+			_, err = normalizePhone(bad)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("maskPhone keeps the prefix and last four digits", t, func() {
+		So(maskPhone("+14155550123"), ShouldEqual, "+1••••••0123")
+	})
+
+	Convey("Given the HTTP gateway pointed at the stub provider", t, func() {
+		stub := smsstub.New("secret")
+		srv := httptest.NewServer(stub)
+		defer srv.Close()
+
+		cfg := Config{
+			SMSGatewayURL:   srv.URL,
+			SMSGatewayToken: "secret",
+			SMSFrom:         "Lumium",
+			SMSMaxPerHour:   3,
+			SMSMinInterval:  0,
+		}
+		withTx = func(_ context.Context, _ store.Beginner, fn func(store.Queryer) error) error {
+			return fn(nil)
+		}
+		repo := &smsRepo{sends: map[string][]time.Time{}}
+		s := &svc{
+			Kit: svckit.New[*pgxpool.Pool, Repo, Config](nil, func() Repo { return repo }, cfg),
+			sms: NewSMSGateway(cfg),
+		}
+		ctx := context.Background()
+
+		Convey("a code is delivered to the number", func() {
+			So(s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeLogin, "123456"), ShouldBeNil)
+			m, ok := stub.Last("+14155550123")
+			So(ok, ShouldBeTrue)
+			So(m.From, ShouldEqual, "Lumium")
+			code, ok := stub.Code("+14155550123")
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, "123456")
+			So(repo.locked, ShouldResemble, []string{"+14155550123"})
+		})
+
+		Convey("sends past the hourly limit are refused before reaching the provider", func() {
+			for range 3 {
+				So(s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeLogin, "123456"), ShouldBeNil)
+			}
+			err := s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeLogin, "123456")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "too many codes")
+			So(stub.Messages(), ShouldHaveLength, 3)
+
+			Convey("while other numbers are unaffected", func() {
+				So(s.sendSMSCode(ctx, "u1", "+442079460958", mfaPurposeLogin, "654321"), ShouldBeNil)
+			})
+		})
+
+		Convey("resends inside the minimum interval are refused", func() {
+			s.Cfg.SMSMinInterval = time.Minute
+			So(s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeEnroll, "123456"), ShouldBeNil)
+			So(s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeEnroll, "123456"), ShouldNotBeNil)
+		})
+
+		Convey("a provider outage surfaces as an error", func() {
+			stub.FailNext(1)
+			err := s.sendSMSCode(ctx, "u1", "+14155550123", mfaPurposeLogin, "123456")
+			So(err, ShouldNotBeNil)
+			So(strings.Contains(err.Error(), "could not send"), ShouldBeTrue)
+		})
+
+		Convey("a wrong token is rejected by the provider", func() {
+			g := NewSMSGateway(Config{SMSGatewayURL: srv.URL, SMSGatewayToken: "nope"})
+			So(g.Send(ctx, SMSMessage{To: "+14155550123", Body: "x"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Without a gateway URL", t, func() {
+		ctx := context.Background()
+
+		Convey("startup fails unless logging texts is asked for", func() {
+			err := (&Config{}).Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "AUTH_SMS_GATEWAY_URL")
+			So((&Config{SMSLogOnly: true}).Validate(), ShouldBeNil)
+			So((&Config{SMSGatewayURL: "http://sms.test"}).Validate(), ShouldBeNil)
+			So(NewSMSGateway(Config{}).Send(ctx, SMSMessage{To: "+14155550123"}), ShouldNotBeNil)
+		})
+
+		Convey("the logging gateway never logs the code", func() {
+			var buf bytes.Buffer
+			l := zerolog.New(&buf)
+			ctx := logger.WithContext(ctx, &l)
+			g := NewSMSGateway(Config{SMSLogOnly: true})
+			So(g.Send(ctx, SMSMessage{To: "+14155550123", Body: "Your Lumium code is 482913"}), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "+1••••••0123")
+			So(buf.String(), ShouldNotContainSubstring, "482913")
+			So(buf.String(), ShouldNotContainSubstring, "5550123")
+		})
+	})
+}
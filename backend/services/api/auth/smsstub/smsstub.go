@@ -0,0 +1,100 @@
+// Package smsstub is a local SMS provider speaking the auth package's HTTP gateway protocol.
+// It accepts every message and keeps it in memory, so tests (and local stacks) can read the
+// codes that would have been texted
+package smsstub
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Message is one received SMS
+type Message struct {
+	To   string `json:"to"`
+	From string `json:"from"`
+	Body string `json:"body"`
+}
+
+// Server records messages POSTed to any path and lists them on GET
+type Server struct {
+	token string
+
+	mu       sync.Mutex
+	messages []Message
+	failNext int
+}
+
+// New returns a Server. A non-empty token is required as `Authorization: Bearer <token>`
+func New(token string) *Server {
+	return &Server{token: token}
+}
+
+// ServeHTTP accepts POSTed messages and lists received ones on GET
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Messages())
+	case http.MethodPost:
+		var m Message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.To == "" {
+			http.Error(w, "invalid message", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		if s.failNext > 0 {
+			s.failNext--
+			s.mu.Unlock()
+			http.Error(w, "provider unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.messages = append(s.messages, m)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Messages returns a copy of every received message, oldest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last returns the newest message sent to the number
+func (s *Server) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Code extracts the leading 6-digit code from the newest message sent to the number
+func (s *Server) Code(to string) (string, bool) {
+	m, ok := s.Last(to)
+	if !ok {
+		return "", false
+	}
+	code, _, _ := strings.Cut(m.Body, " ")
+	return code, len(code) == 6
+}
+
+// FailNext makes the next n sends fail with 503, to exercise provider outages
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = n
+}
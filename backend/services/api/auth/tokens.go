@@ -15,17 +15,19 @@ import (
 type tokenClaims struct {
 	TenantID string   `json:"tenant_id,omitempty"`
 	Roles    []string `json:"roles,omitempty"`
+	RoleIDs  []string `json:"rids,omitempty"` // resolved to permissions by RequirePermission
 	jwt.RegisteredClaims
 }
 
 // MintAccess mints a signed JWT access token and returns the token string and its expiry
-func (c Config) MintAccess(userID, tenantID string, roles []string) (string, time.Time, error) {
+func (c Config) MintAccess(userID, tenantID string, roles, roleIDs []string) (string, time.Time, error) {
 	now := time.Now()
 	exp := now.Add(c.AccessTTL)
 
 	cl := tokenClaims{
 		TenantID: tenantID,
 		Roles:    roles,
+		RoleIDs:  roleIDs,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    c.JWTIssuer,
 			Subject:   userID,
@@ -68,5 +70,6 @@ func (c Config) ParseAccess(raw string) (*AccessClaims, error) {
 		Sub:      tc.Subject,
 		TenantID: tc.TenantID,
 		Roles:    tc.Roles,
+		RoleIDs:  tc.RoleIDs,
 	}, nil
 }
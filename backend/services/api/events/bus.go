@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"lumium/lib/logger"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// retryListen is how long Listen waits before trying the events stream again
+var retryListen = 5 * time.Second
+
+// Listen feeds h from the events stream until ctx ends. It reads through an ordered consumer
+// starting after the stream's newest message, so every API replica sees every event without
+// sharing a durable consumer. Until the stream is reachable it retries, and streams stay open
+// with only heartbeats
+func Listen(ctx context.Context, js jetstream.JetStream, c Config, h *Hub) {
+	l := logger.Get()
+	for {
+		cc, err := listen(ctx, js, c, h)
+		if err == nil {
+			<-ctx.Done()
+			cc.Stop()
+			return
+		}
+		l.Warn().Err(err).Str("stream", c.Stream).Msg("events: stream unavailable; retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryListen):
+		}
+	}
+}
+
+func listen(ctx context.Context, js jetstream.JetStream, c Config, h *Hub) (jetstream.ConsumeContext, error) {
+	stream, err := js.Stream(ctx, c.Stream)
+	if err != nil {
+		return nil, err
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cons, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: c.Subjects,
+		DeliverPolicy:  jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:    info.State.LastSeq + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.Start(info.State.LastSeq)
+	return cons.Consume(func(m jetstream.Msg) {
+		md, err := m.Metadata()
+		if err != nil {
+			return
+		}
+		if tenantID := tenantOf(m.Data()); tenantID != "" {
+			h.Publish(tenantID, md.Sequence.Stream, strings.TrimPrefix(m.Subject(), "events."), m.Data())
+		}
+	})
+}
+
+// tenantOf is the tenant_id of an event payload; events without one aren't streamed
+func tenantOf(payload []byte) string {
+	var p struct {
+		TenantID string `json:"tenant_id"`
+	}
+	if json.Unmarshal(payload, &p) != nil {
+		return ""
+	}
+	return p.TenantID
+}
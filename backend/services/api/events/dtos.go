@@ -0,0 +1,6 @@
+package events
+
+// streamHeaders are the headers of an event stream request
+type streamHeaders struct {
+	LastEventID *uint64 `header:"Last-Event-ID"` // set by EventSource when it reconnects
+}
@@ -0,0 +1,84 @@
+// Package events streams a tenant's bus events (photos ingested, thumbnails ready, duplicates
+// found, albums built, ...) to its users over Server-Sent Events, so clients show progress
+// without polling. Each user gets only the events about albums and photos they can view. Streams
+// resume from Last-Event-ID out of a bounded replay buffer
+package events
+
+import (
+	"context"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+	"lumium/services/api/acl"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Config is the configuration wrapper for events
+type Config struct {
+	Stream    string        // the JetStream stream read (OUTBOX_STREAM)
+	Subjects  []string      // subjects streamed to clients (EVENTS_SUBJECTS)
+	Replay    int           // events kept per tenant for Last-Event-ID (EVENTS_REPLAY)
+	Heartbeat time.Duration // comment interval on idle streams (EVENTS_HEARTBEAT)
+	Retry     time.Duration // reconnection delay suggested to clients (EVENTS_RETRY)
+}
+
+// LoadConfig reads the stream settings from the environment
+func LoadConfig() Config {
+	subjects := config.MayList("EVENTS_SUBJECTS")
+	if len(subjects) == 0 {
+		subjects = []string{"events.>"}
+	}
+	return Config{
+		Stream:    config.MayString("OUTBOX_STREAM", "EVENTS"),
+		Subjects:  subjects,
+		Replay:    config.MayInt("EVENTS_REPLAY", 256),
+		Heartbeat: config.MayDuration("EVENTS_HEARTBEAT", lumnet.DefaultHeartbeat),
+		Retry:     config.MayDuration("EVENTS_RETRY", 3*time.Second),
+	}
+}
+
+// Events is the wrapper for the /events service
+type Events struct {
+	app     *handlers.App
+	hub     *Hub
+	cfg     Config
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+	authz   *acl.Authorizer
+}
+
+// New creates a new Events pointer, listening on the app's bus when it has one
+func New(app *handlers.App, perms auth.PermissionResolver) *Events {
+	cfg := LoadConfig()
+	h := &Events{
+		app:     app,
+		hub:     NewHub(cfg.Replay),
+		cfg:     cfg,
+		authCfg: auth.LoadConfig(),
+		perms:   perms,
+		authz:   acl.NewAuthorizer(),
+	}
+	if app.Bus == nil {
+		l := logger.Get()
+		l.Warn().Msg("events: no bus configured; event streams only send heartbeats")
+		return h
+	}
+	go Listen(context.Background(), app.Bus, cfg, h.hub)
+	return h
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *Events) Wire(r chi.Router) {
+	r.Route("/events", func(r chi.Router) {
+		// EventSource can't set headers, so browsers send the access token in the query
+		r.Use(auth.TokenFromQuery, auth.Authenticate(h.authCfg),
+			auth.RequirePermission(h.perms, "albums.read"))
+		r.Get("/", lumnet.Adapt(h.Stream))
+	})
+	lumnet.InitValidator()
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+	"lumium/lib/store"
+	"lumium/services/api/acl"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTenantTx = func(ctx context.Context, b store.Beginner, s store.Scope, fn func(q store.Queryer) error) error {
+		return store.WithTenantTx(ctx, b, s, fn)
+	}
+)
+
+// subjectOf names what an event is about, from its payload
+type subjectOf struct {
+	AlbumID string `json:"album_id"`
+	PhotoID string `json:"photo_id"`
+	ItemID  string `json:"item_id"`
+	OwnerID string `json:"owner_id"`
+}
+
+// maxCachedLevels bounds the levels a stream remembers; past it the cache starts over
+const maxCachedLevels = 4096
+
+// streamFilter decides which events one stream's principal may see. Levels are looked up once
+// per album or item, a batch at a time, and kept for the stream: it lasts at most an access
+// token's lifetime, the same as the permissions it was opened with
+type streamFilter struct {
+	h      *Events
+	p      acl.Principal
+	levels map[acl.Resource]acl.Level
+}
+
+func (h *Events) newFilter(p acl.Principal) *streamFilter {
+	return &streamFilter{h: h, p: p, levels: map[acl.Resource]acl.Level{}}
+}
+
+// subject returns the album or item ev is about, or an empty resource when ev's visibility
+// needs no lookup, with that visibility: resets and the principal's own photos and albums are
+// visible, and an event naming neither goes only to those who view the whole tenant
+func (f *streamFilter) subject(ev lumnet.SSEEvent) (acl.Resource, bool) {
+	if ev.Event == "reset" || f.p.Floor >= acl.LevelView {
+		return acl.Resource{}, true
+	}
+	var sub subjectOf
+	if json.Unmarshal(ev.Data, &sub) != nil {
+		return acl.Resource{}, false
+	}
+	switch {
+	case sub.OwnerID != "" && sub.OwnerID == f.p.UserID:
+		return acl.Resource{}, true
+	case sub.AlbumID != "":
+		return acl.Album(sub.AlbumID), false
+	case sub.PhotoID != "":
+		return acl.Item(sub.PhotoID), false
+	case sub.ItemID != "":
+		return acl.Item(sub.ItemID), false
+	}
+	return acl.Resource{}, false
+}
+
+// visible returns the events of batch the principal may see, in order: its own photos and
+// albums, and anything in an album or item they can view. Levels not yet known are looked up
+// together in one tenant transaction; access that can't be checked hides the event
+func (f *streamFilter) visible(ctx context.Context, batch []lumnet.SSEEvent) []lumnet.SSEEvent {
+	subjects := make([]acl.Resource, len(batch))
+	shown := make([]bool, len(batch))
+	var missing []acl.Resource
+	for i, ev := range batch {
+		subjects[i], shown[i] = f.subject(ev)
+		if subjects[i].ID == "" {
+			continue
+		}
+		if _, ok := f.levels[subjects[i]]; !ok && !slices.Contains(missing, subjects[i]) {
+			missing = append(missing, subjects[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		var levels map[acl.Resource]acl.Level
+		err := withTenantTx(ctx, f.h.app.DB, f.p.Scope(), func(q store.Queryer) error {
+			var err error
+			levels, err = f.h.authz.Levels(ctx, q, f.p, missing)
+			return err
+		})
+		if err != nil {
+			l := logger.Ctx(ctx)
+			l.Warn().Err(err).Int("events", len(batch)).Msg("events: check access; events withheld")
+		}
+		if len(f.levels)+len(levels) > maxCachedLevels {
+			clear(f.levels)
+		}
+		maps.Copy(f.levels, levels)
+	}
+
+	out := batch[:0:0]
+	for i, ev := range batch {
+		if shown[i] || (subjects[i].ID != "" && f.levels[subjects[i]] >= acl.LevelView) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// visibleOnly passes on the events of ch the principal may see, until ch closes or ctx ends.
+// Whatever queued up on ch while one batch was checked is checked as the next
+func (f *streamFilter) visibleOnly(ctx context.Context, ch <-chan lumnet.SSEEvent) <-chan lumnet.SSEEvent {
+	out := make(chan lumnet.SSEEvent)
+	go func() {
+		defer close(out)
+		for ev := range ch {
+			batch := []lumnet.SSEEvent{ev}
+		drain:
+			for len(batch) < subscriberBuffer {
+				select {
+				case ev, ok := <-ch:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			for _, ev := range f.visible(ctx, batch) {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
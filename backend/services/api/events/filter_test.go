@@ -0,0 +1,190 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"lumium/lib/lumnet"
+	"lumium/lib/store"
+	"lumium/services/api/acl"
+	"lumium/services/api/handlers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	tenantID = "00000000-0000-4000-8000-000000000001"
+	userID   = "00000000-0000-4000-8000-000000000002"
+	otherID  = "00000000-0000-4000-8000-000000000003"
+	sharedID = "00000000-0000-4000-8000-0000000000a1"
+	privID   = "00000000-0000-4000-8000-0000000000a2"
+	photoID  = "00000000-0000-4000-8000-0000000000f1"
+)
+
+// rankQueryer answers acl_effective_level() from an in-memory resource id -> rank map. With a
+// gate, each lookup waits for it after announcing itself on started
+type rankQueryer struct {
+	mu      sync.Mutex
+	ranks   map[string]int
+	queries int
+	err     error
+	gate    chan struct{}
+	started chan struct{}
+}
+
+func (q *rankQueryer) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	if q.gate != nil {
+		q.started <- struct{}{}
+		<-q.gate
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queries++
+	if q.err != nil {
+		return nil, q.err
+	}
+	rows := &rankRows{i: -1}
+	for i, id := range args[3].([]string) {
+		rows.data = append(rows.data, [2]int{i + 1, q.ranks[id]})
+	}
+	return rows, nil
+}
+
+func (q *rankQueryer) QueryRow(context.Context, string, ...any) pgx.Row { return nil }
+
+func (q *rankQueryer) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+type rankRows struct {
+	data [][2]int // ordinality, rank
+	i    int
+}
+
+func (r *rankRows) Close()                                       {}
+func (r *rankRows) Err() error                                   { return nil }
+func (r *rankRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *rankRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *rankRows) Next() bool                                   { r.i++; return r.i < len(r.data) }
+func (r *rankRows) Values() ([]any, error)                       { return nil, nil }
+func (r *rankRows) RawValues() [][]byte                          { return nil }
+func (r *rankRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *rankRows) Scan(dest ...any) error {
+	*dest[0].(*int64), *dest[1].(*int) = int64(r.data[r.i][0]), r.data[r.i][1]
+	return nil
+}
+
+func event(id, data string) lumnet.SSEEvent {
+	return lumnet.SSEEvent{ID: id, Event: "album.created", Data: []byte(data)}
+}
+
+func TestVisible(t *testing.T) {
+	Convey("Given a user who can view one album and one photo", t, func() {
+		q := &rankQueryer{ranks: map[string]int{sharedID: int(acl.LevelView), photoID: int(acl.LevelView)}}
+		withTenantTx = func(_ context.Context, _ store.Beginner, _ store.Scope, fn func(store.Queryer) error) error {
+			return fn(q)
+		}
+		h := &Events{app: &handlers.App{}, authz: acl.NewAuthorizer()}
+		ctx := context.Background()
+		p := acl.Principal{TenantID: tenantID, UserID: userID}
+		sees := func(data string) bool {
+			return len(h.newFilter(p).visible(ctx, []lumnet.SSEEvent{event("1", data)})) == 1
+		}
+
+		Convey("they see events about what they can view", func() {
+			So(sees(`{"tenant_id":"`+tenantID+`","album_id":"`+sharedID+`","item_id":"`+privID+`"}`), ShouldBeTrue)
+			So(sees(`{"tenant_id":"`+tenantID+`","photo_id":"`+photoID+`","owner_id":"`+otherID+`"}`), ShouldBeTrue)
+		})
+
+		Convey("and about their own photos and albums", func() {
+			So(sees(`{"album_id":"`+privID+`","owner_id":"`+userID+`"}`), ShouldBeTrue)
+		})
+
+		Convey("but not about anything else", func() {
+			So(sees(`{"album_id":"`+privID+`","owner_id":"`+otherID+`"}`), ShouldBeFalse)
+			So(sees(`{"photo_id":"`+privID+`"}`), ShouldBeFalse)
+			So(sees(`{"tenant_id":"`+tenantID+`"}`), ShouldBeFalse)
+			So(sees(`not json`), ShouldBeFalse)
+		})
+
+		Convey("an event whose access can't be checked is withheld", func() {
+			q.err = errors.New("connection reset")
+			So(sees(`{"album_id":"`+sharedID+`"}`), ShouldBeFalse)
+		})
+
+		Convey("someone who views the whole tenant sees everything", func() {
+			p.Floor = acl.LevelView
+			So(sees(`{"album_id":"`+privID+`"}`), ShouldBeTrue)
+			So(sees(`{"tenant_id":"`+tenantID+`"}`), ShouldBeTrue)
+		})
+
+		Convey("a filtered stream passes on only the visible events, in order", func() {
+			ch := make(chan lumnet.SSEEvent, 3)
+			ch <- event("1", `{"album_id":"`+sharedID+`"}`)
+			ch <- event("2", `{"album_id":"`+privID+`"}`)
+			ch <- event("3", `{"photo_id":"`+photoID+`"}`)
+			close(ch)
+			var got []string
+			for ev := range h.newFilter(p).visibleOnly(ctx, ch) {
+				got = append(got, ev.ID)
+			}
+			So(got, ShouldResemble, []string{"1", "3"})
+		})
+
+		Convey("a resource is looked up once per stream", func() {
+			f := h.newFilter(p)
+			batch := []lumnet.SSEEvent{
+				event("1", `{"album_id":"`+sharedID+`"}`),
+				event("2", `{"album_id":"`+sharedID+`","item_id":"`+privID+`"}`),
+			}
+			So(f.visible(ctx, batch), ShouldHaveLength, 2)
+			So(f.visible(ctx, batch[:1]), ShouldHaveLength, 1)
+			So(q.queries, ShouldEqual, 1)
+		})
+
+		Convey("a reset always goes through", func() {
+			So(h.newFilter(p).visible(ctx, []lumnet.SSEEvent{{ID: "9", Event: "reset", Data: []byte("{}")}}),
+				ShouldHaveLength, 1)
+		})
+
+		Convey("a burst of more events than a stream buffers reaches a viewer who owns none of them", func() {
+			hub := NewHub(0)
+			_, ch, cancel := hub.Subscribe(tenantID, 0, false)
+			defer cancel()
+			q.gate, q.started = make(chan struct{}), make(chan struct{}, 2)
+			out := h.newFilter(p).visibleOnly(ctx, ch)
+
+			// a new photo per event, so no lookup can be skipped; the odd ones are shared
+			photo := func(seq uint64) string { return fmt.Sprintf("00000000-0000-4000-8000-%012d", seq) }
+			publish := func(seq uint64) {
+				if seq%2 == 1 {
+					q.ranks[photo(seq)] = int(acl.LevelView)
+				}
+				hub.Publish(tenantID, seq, "photo.ingested",
+					[]byte(`{"photo_id":"`+photo(seq)+`","owner_id":"`+otherID+`"}`))
+			}
+			publish(1)
+			<-q.started // the stream is stuck on the first lookup while the rest arrive
+			for seq := uint64(2); seq <= 1+subscriberBuffer; seq++ {
+				publish(seq)
+			}
+			close(q.gate)
+
+			var got []string
+			for len(got) < (1+subscriberBuffer)/2+1 {
+				ev, ok := <-out
+				So(ok, ShouldBeTrue)
+				got = append(got, ev.ID)
+			}
+			So(got[0], ShouldEqual, "1")
+			So(got[len(got)-1], ShouldEqual, fmt.Sprint(1+subscriberBuffer))
+			So(q.queries, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"net/http"
+
+	"lumium/lib/lumnet"
+	"lumium/services/api/acl"
+)
+
+// Stream is the handler endpoint for a tenant's event stream
+//
+// @Summary     Event stream
+// @Description Streams the tenant's events as Server-Sent Events: the event type is the bus
+// @Description subject without "events." (photo.ingested, album.created, ...), the data its JSON
+// @Description payload and the id its sequence in the events stream. Only events about the
+// @Description caller's own photos and albums, or ones they can view, are sent. Send Last-Event-ID (as
+// @Description EventSource does on reconnect) to receive what was missed first; when that is no
+// @Description longer held a "reset" event comes instead, and the client should reload. Idle
+// @Description streams carry a comment every EVENTS_HEARTBEAT. Browsers may pass the token as
+// @Description access_token, since EventSource can't set headers. A stream lasts at most an access
+// @Description token's lifetime; the client then reconnects with a fresh token.
+// @Tags        events
+// @Produce     text/event-stream
+// @Security    BearerAuth
+// @Param       Last-Event-ID  header  int     false  "id of the last event received"
+// @Param       access_token   query   string  false  "access token, for clients that can't send Authorization"
+// @Success     200  {string}  string          "text/event-stream"
+// @Failure     400  {string}  string          "malformed Last-Event-ID"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /events [get]
+func (h *Events) Stream(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseHeader[streamHeaders](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	var lastID uint64
+	if in.LastEventID != nil {
+		lastID = *in.LastEventID
+	}
+	backlog, ch, cancel := h.hub.Subscribe(p.TenantID, lastID, in.LastEventID != nil)
+	defer cancel()
+
+	s, err := lumnet.NewSSE(w)
+	if err != nil {
+		return nil
+	}
+	if err := s.Send(lumnet.SSEEvent{Retry: h.cfg.Retry}); err != nil {
+		return nil
+	}
+	// the token is checked once, so a stream outliving it would outlive a revoked user too
+	ctx, stop := context.WithCancel(r.Context())
+	defer stop()
+	if h.authCfg.AccessTTL > 0 {
+		ctx, stop = context.WithTimeout(ctx, h.authCfg.AccessTTL)
+		defer stop()
+	}
+	f := h.newFilter(p)
+	for _, ev := range f.visible(ctx, backlog) {
+		if err := s.Send(ev); err != nil {
+			return nil
+		}
+	}
+	_ = s.Stream(ctx, f.visibleOnly(ctx, ch), h.cfg.Heartbeat)
+	return nil
+}
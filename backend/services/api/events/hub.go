@@ -0,0 +1,159 @@
+package events
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"lumium/lib/lumnet"
+)
+
+// subscriberBuffer is how many events a stream may fall behind before it is cut off. The client
+// reconnects with Last-Event-ID and catches up from the replay buffer
+const subscriberBuffer = 64
+
+// tenantIdle is how long a tenant without streams keeps its replay buffer, long enough for a
+// dropped client to reconnect. After that the tenant is forgotten, so the hub holds only tenants
+// that are listening
+const tenantIdle = 10 * time.Minute
+
+// pruneEvery is how many publishes and subscribes pass between sweeps for idle tenants
+const pruneEvery = 256
+
+// Hub fans bus events out to the streams open for each tenant, and keeps each tenant's last few
+// events for clients resuming with Last-Event-ID. Events are identified by their sequence in the
+// events stream, so ids only ever grow
+type Hub struct {
+	mu      sync.Mutex
+	replay  int
+	start   uint64 // the hub has seen every event after this sequence
+	last    uint64 // the newest sequence seen
+	pruned  uint64 // the newest sequence seen when idle tenants were last forgotten
+	tenants map[string]*tenant
+	ops     int
+	idle    time.Duration
+	now     func() time.Time
+}
+
+type tenant struct {
+	buf       []entry // oldest first, at most replay long
+	floor     uint64  // the newest sequence dropped from buf
+	subs      map[*subscriber]struct{}
+	idleSince time.Time // when the last stream closed; zero while any is open
+}
+
+type entry struct {
+	seq uint64
+	ev  lumnet.SSEEvent
+}
+
+type subscriber struct {
+	ch chan lumnet.SSEEvent
+}
+
+// NewHub creates a hub that keeps replay events per tenant
+func NewHub(replay int) *Hub {
+	return &Hub{replay: max(replay, 0), tenants: map[string]*tenant{}, idle: tenantIdle, now: time.Now}
+}
+
+// Start records that the hub sees every event after seq. Resuming from before it is a gap
+func (h *Hub) Start(seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.start, h.last = seq, max(h.last, seq)
+}
+
+// Publish sends an event to the tenant's streams and keeps it for replay. A stream too far
+// behind to take it is closed
+func (h *Hub) Publish(tenantID string, seq uint64, name string, data []byte) {
+	ev := lumnet.SSEEvent{ID: strconv.FormatUint(seq, 10), Event: name, Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = max(h.last, seq)
+	h.sweep()
+	t := h.tenant(tenantID)
+	t.buf = append(t.buf, entry{seq: seq, ev: ev})
+	if over := len(t.buf) - h.replay; over > 0 {
+		t.floor = t.buf[over-1].seq
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	for s := range t.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			h.unsubscribe(t, s)
+		}
+	}
+}
+
+// Subscribe opens a stream of the tenant's events. With resume, the events after lastID are
+// returned to send first. When some of them are no longer held a reset event is returned
+// instead, and the client should reload what it shows. The channel is closed by cancel, or when
+// the stream falls behind
+func (h *Hub) Subscribe(
+	tenantID string, lastID uint64, resume bool,
+) (backlog []lumnet.SSEEvent, ch <-chan lumnet.SSEEvent, cancel func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sweep()
+	t := h.tenant(tenantID)
+	switch {
+	case !resume:
+	case lastID < max(h.start, t.floor) || lastID > h.last:
+		// the id is the newest seen, so resuming from the reset doesn't reset again
+		backlog = []lumnet.SSEEvent{{ID: strconv.FormatUint(h.last, 10), Event: "reset", Data: []byte("{}")}}
+	default:
+		for _, e := range t.buf {
+			if e.seq > lastID {
+				backlog = append(backlog, e.ev)
+			}
+		}
+	}
+	s := &subscriber{ch: make(chan lumnet.SSEEvent, subscriberBuffer)}
+	t.subs[s] = struct{}{}
+	t.idleSince = time.Time{}
+	return backlog, s.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.unsubscribe(t, s)
+	}
+}
+
+// unsubscribe closes a stream, once; h.mu must be held
+func (h *Hub) unsubscribe(t *tenant, s *subscriber) {
+	if _, ok := t.subs[s]; !ok {
+		return
+	}
+	delete(t.subs, s)
+	close(s.ch)
+	if len(t.subs) == 0 {
+		t.idleSince = h.now()
+	}
+}
+
+// tenant returns the tenant's state, creating it; h.mu must be held. A tenant created after a
+// sweep may have been forgotten by it, so it holds nothing from before that sweep and resuming
+// from earlier resets
+func (h *Hub) tenant(id string) *tenant {
+	t, ok := h.tenants[id]
+	if !ok {
+		t = &tenant{subs: map[*subscriber]struct{}{}, floor: h.pruned, idleSince: h.now()}
+		h.tenants[id] = t
+	}
+	return t
+}
+
+// sweep forgets, every pruneEvery calls, the tenants without streams for longer than h.idle;
+// h.mu must be held
+func (h *Hub) sweep() {
+	if h.ops++; h.ops%pruneEvery != 0 {
+		return
+	}
+	cutoff := h.now().Add(-h.idle)
+	for id, t := range h.tenants {
+		if len(t.subs) == 0 && t.idleSince.Before(cutoff) {
+			delete(h.tenants, id)
+			h.pruned = h.last
+		}
+	}
+}
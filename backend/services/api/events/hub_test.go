@@ -0,0 +1,160 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"lumium/lib/lumnet"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// drain returns the events waiting on ch, and whether it was closed
+func drain(ch <-chan lumnet.SSEEvent) ([]string, bool) {
+	var ids []string
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, ev.ID)
+		default:
+			return ids, false
+		}
+	}
+}
+
+func ids(evs []lumnet.SSEEvent) []string {
+	out := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		out = append(out, ev.Event+":"+ev.ID)
+	}
+	return out
+}
+
+func TestHub(t *testing.T) {
+	Convey("Given a hub keeping three events per tenant, started at sequence 10", t, func() {
+		h := NewHub(3)
+		h.Start(10)
+
+		Convey("a stream gets its tenant's events and no one else's", func() {
+			_, ch, cancel := h.Subscribe("t1", 0, false)
+			defer cancel()
+			h.Publish("t1", 11, "photo.ingested", []byte(`{}`))
+			h.Publish("t2", 12, "photo.ingested", []byte(`{}`))
+			got, closed := drain(ch)
+			So(got, ShouldResemble, []string{"11"})
+			So(closed, ShouldBeFalse)
+		})
+
+		Convey("with five events published", func() {
+			for seq := uint64(11); seq <= 15; seq++ {
+				h.Publish("t1", seq, "photo.ingested", []byte(`{}`))
+			}
+
+			Convey("resuming within the replay buffer sends what was missed", func() {
+				backlog, _, cancel := h.Subscribe("t1", 13, true)
+				defer cancel()
+				So(ids(backlog), ShouldResemble, []string{"photo.ingested:14", "photo.ingested:15"})
+			})
+
+			Convey("resuming at the floor still has everything after it", func() {
+				backlog, _, cancel := h.Subscribe("t1", 12, true)
+				defer cancel()
+				So(ids(backlog), ShouldResemble, []string{"photo.ingested:13", "photo.ingested:14", "photo.ingested:15"})
+			})
+
+			Convey("resuming from below the floor resets to the newest id", func() {
+				backlog, _, cancel := h.Subscribe("t1", 11, true)
+				defer cancel()
+				So(ids(backlog), ShouldResemble, []string{"reset:15"})
+
+				Convey("and resuming from the reset doesn't reset again", func() {
+					backlog, _, cancel := h.Subscribe("t1", 15, true)
+					defer cancel()
+					So(backlog, ShouldBeEmpty)
+				})
+			})
+
+			Convey("resuming from before the hub started, or from an id it never gave, resets", func() {
+				backlog, _, cancel := h.Subscribe("t2", 9, true)
+				defer cancel()
+				So(ids(backlog), ShouldResemble, []string{"reset:15"})
+				backlog, _, cancel2 := h.Subscribe("t1", 99, true)
+				defer cancel2()
+				So(ids(backlog), ShouldResemble, []string{"reset:15"})
+			})
+
+			Convey("a tenant that had nothing since the hub started resumes cleanly", func() {
+				backlog, _, cancel := h.Subscribe("t2", 12, true)
+				defer cancel()
+				So(backlog, ShouldBeEmpty)
+			})
+		})
+
+		Convey("a stream that falls too far behind is closed", func() {
+			_, slow, cancelSlow := h.Subscribe("t1", 0, false)
+			defer cancelSlow()
+			_, fast, cancelFast := h.Subscribe("t1", 0, false)
+			defer cancelFast()
+			for seq := uint64(11); seq <= 11+subscriberBuffer; seq++ {
+				if seq == 11+subscriberBuffer {
+					drain(fast)
+				}
+				h.Publish("t1", seq, "photo.ingested", []byte(`{}`))
+			}
+			got, closed := drain(slow)
+			So(got, ShouldHaveLength, subscriberBuffer)
+			So(closed, ShouldBeTrue)
+			_, closed = drain(fast)
+			So(closed, ShouldBeFalse)
+
+			Convey("and closing it again is harmless", func() {
+				So(cancelSlow, ShouldNotPanic)
+			})
+		})
+
+		Convey("tenants idle past the limit are forgotten", func() {
+			clock := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+			h.now = func() time.Time { return clock }
+			_, _, cancelQuiet := h.Subscribe("quiet", 0, false)
+			h.Publish("quiet", 11, "photo.ingested", []byte(`{}`))
+			cancelQuiet()
+			_, _, cancelBusy := h.Subscribe("busy", 0, false)
+			defer cancelBusy()
+			for i := 0; i < 100; i++ {
+				_, _, cancel := h.Subscribe(fmt.Sprintf("passerby-%d", i), 0, false)
+				cancel()
+			}
+
+			clock = clock.Add(tenantIdle + time.Second)
+			for seq := uint64(12); len(h.tenants) > 1 && seq < 12+pruneEvery; seq++ {
+				h.Publish("busy", seq, "photo.ingested", []byte(`{}`))
+			}
+			So(h.tenants, ShouldContainKey, "busy")
+			So(h.tenants, ShouldNotContainKey, "quiet")
+			So(len(h.tenants), ShouldEqual, 1)
+
+			Convey("and a client of theirs resuming later reloads rather than missing events", func() {
+				backlog, _, cancel := h.Subscribe("quiet", 11, true)
+				defer cancel()
+				So(backlog, ShouldHaveLength, 1)
+				So(backlog[0].Event, ShouldEqual, "reset")
+			})
+		})
+
+		Convey("a tenant with an open stream is kept however long it is quiet", func() {
+			clock := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+			h.now = func() time.Time { return clock }
+			_, _, cancel := h.Subscribe("listening", 0, false)
+			defer cancel()
+			clock = clock.Add(time.Hour)
+			for seq := uint64(11); seq < 11+pruneEvery; seq++ {
+				h.Publish("other", seq, "photo.ingested", []byte(`{}`))
+			}
+			So(h.tenants, ShouldContainKey, "listening")
+		})
+	})
+}
@@ -2,8 +2,14 @@
 package handlers
 
 import (
+	"context"
+
+	"lumium/lib/lumnet"
+	"lumium/lib/objstore"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 // Resource is anything that can wire routes onto a chi.Router
@@ -11,14 +17,33 @@ type Resource interface {
 	Wire(r chi.Router)
 }
 
+// ReplicaRouter hands out a read replica pool, or the primary when replicas can't serve ctx
+type ReplicaRouter interface {
+	Replica(ctx context.Context) *pgxpool.Pool
+}
+
 // App holds shared deps for resources (start with DB, expand later if needed)
 type App struct {
-	DB *pgxpool.Pool
+	DB         *pgxpool.Pool
+	Replicas   ReplicaRouter    // optional; nil reads from DB
+	RateLimits lumnet.RateStore // optional; nil keeps rate limits in process
+
+	Idempotency lumnet.IdempotencyStore // optional; nil keeps Idempotency-Key records in process
+	Objects     objstore.Store          // required by uploads and photos; see objstore.FromEnv
+	Bus         jetstream.JetStream     // optional; nil streams no events from other services
 }
 
 // NewApp accepts a database accessor & returns a new app
 func NewApp(db *pgxpool.Pool) *App { return &App{DB: db} }
 
+// Reader returns the pool for reads that tolerate replication lag
+func (a *App) Reader(ctx context.Context) *pgxpool.Pool {
+	if a.Replicas == nil {
+		return a.DB
+	}
+	return a.Replicas.Replica(ctx)
+}
+
 // MountAPI mounts one or more resources under the given router
 func MountAPI(r chi.Router, resources ...Resource) {
 	for _, res := range resources {
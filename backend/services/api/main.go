@@ -5,31 +5,38 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
-	"os"
 	"strings"
 
 	"lumium/lib/config"
+	"lumium/lib/health"
 	"lumium/lib/logger"
 	"lumium/lib/lumnet"
+	"lumium/lib/objstore"
 	"lumium/lib/store"
+	"lumium/lib/store/migrate"
+	"lumium/lib/tracing"
+	"lumium/migrations"
+	"lumium/services/api/acl"
+	"lumium/services/api/albums"
 	auth "lumium/services/api/auth"
+	"lumium/services/api/events"
 	apihandlers "lumium/services/api/handlers"
+	"lumium/services/api/photos"
+	"lumium/services/api/roles"
+	"lumium/services/api/scim"
+	"lumium/services/api/uploads"
 
 	docs "lumium/services/api/docs"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 const serviceName = "lumium_api"
 
-// WhoAmIResponse is the structure for declaring the instance
-type WhoAmIResponse struct {
-	Hostname string `json:"hostname"`
-	PID      int    `json:"pid"`
-}
-
 // closer is an interface that defines the structure for closing the db handler
 // this is designed to support testing
 type closer interface{ Close() }
@@ -54,46 +61,30 @@ var (
 		// real path: use the store.Handler's pgx pool
 		return h.(*store.Handler).PgxPool
 	}
+
+	// migrateFn brings the schema up to date; replicas serialize on an advisory lock
+	migrateFn = func(h closer) error {
+		return migrate.Run(context.Background(), h.(*store.Handler).PgxPool, migrations.FS, migrations.Options())
+	}
 )
 
 // BuildRouter centralizes all route wiring
 func BuildRouter(db dbPinger) http.Handler {
+	// forwarding headers are only believed from these; unset, RemoteAddr is the client
+	proxies, err := lumnet.ParseTrustedProxies(config.MayList("TRUSTED_PROXIES"))
+	if err != nil {
+		l := logger.Get()
+		l.Panic().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
 	r := lumnet.NewRouter(lumnet.RouterOptions{
-		WithLogger:    true,
-		WithRequestID: true,
-		WithRecovery:  true,
-		WithCORS:      true,
-	})
-
-	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`ok`))
-	})
-
-	// Endpoint to test readiness and avoids serving traffic when the DB is down
-	r.Get("/ready", func(w http.ResponseWriter, _ *http.Request) {
-		if db == nil {
-			http.Error(w, "database not initialized", http.StatusServiceUnavailable)
-			return
-		}
-
-		// Basic ping / health check
-		if err := db.Ping(context.Background()); err != nil {
-			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`rdy`))
-	})
-
-	// Used during swarm testing to ensure different machineIDs
-	// example:
-	// for i in {1..10}; do curl -s http://localhost:9001/whoami; echo; done
-	r.Get("/whoami", func(w http.ResponseWriter, _ *http.Request) {
-		hostname, _ := os.Hostname()
-		resp := WhoAmIResponse{Hostname: hostname, PID: os.Getpid()}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
+		WithLogger:     true,
+		WithRequestID:  true,
+		WithRecovery:   true,
+		WithCORS:       true,
+		WithTracing:    true,
+		WithMetrics:    true,
+		TrustedProxies: proxies,
+		Health:         healthChecks(db),
 	})
 
 	mountRoutes(r, db)
@@ -102,17 +93,73 @@ func BuildRouter(db dbPinger) http.Handler {
 	return r
 }
 
+// healthChecks registers what /ready waits on; the API can't serve anything without Postgres
+func healthChecks(db dbPinger) *health.Registry {
+	reg := health.NewRegistry(serviceName)
+	reg.Register(health.Check{Name: "postgres", Fn: health.Ping(db)})
+	// the settings, secrets redacted, for checking what an instance actually runs with
+	if config.MayBool("WHOAMI_SHOW_CONFIG", false) {
+		reg.ShowConfig("auth", config.Dump(auth.LoadConfig()))
+		reg.ShowConfig("postgres", config.Dump(store.LoadPoolConfig()))
+	}
+	return reg
+}
+
 func mountRoutes(r *chi.Mux, db any) {
 	if pool, ok := db.(*pgxpool.Pool); ok {
+		app := apihandlers.NewApp(pool)
+		app.Replicas = store.GetHandler() // the pool came from the handler, so it exists
+		app.RateLimits = lumnet.RateStoreFromEnv(pool)
+		app.Idempotency = lumnet.NewPGIdempotencyStore(pool)
+		objects, err := objstore.FromEnv()
+		if err != nil {
+			l := logger.Get()
+			l.Panic().Err(err).Msg("Invalid object store configuration")
+		}
+		app.Objects = objects
+		app.Bus = connectBus()
+		perms := auth.NewPermissionCache(app) // shared so role edits invalidate every RequirePermission
 		r.Route("/api/v1", func(api chi.Router) {
-			app := apihandlers.NewApp(pool)
 			apihandlers.MountAPI(api,
-				auth.New(app), // mounts /auth under /api/v1
+				auth.New(app),              // mounts /auth under /api/v1
+				roles.New(app, perms),      // mounts /roles under /api/v1
+				acl.New(app, perms),        // mounts /acl under /api/v1
+				albums.New(app, perms),     // mounts /albums under /api/v1
+				scim.NewTokens(app, perms), // mounts /scim/tokens under /api/v1
+				uploads.New(app, perms),    // mounts /uploads (tus) under /api/v1
+				photos.New(app, perms),     // mounts /photos under /api/v1
+				events.New(app, perms),     // mounts /events (SSE) under /api/v1
 			)
 		})
+
+		// SCIM clients expect the protocol root at a stable, unversioned path
+		r.Route("/scim/v2", func(sr chi.Router) {
+			apihandlers.MountAPI(sr, scim.New(app))
+		})
 	}
 }
 
+// connectBus connects to SERVICE_NATS_URL for the event streams, or returns nil when it's unset.
+// A NATS that is down is retried in the background rather than holding the API back
+func connectBus() jetstream.JetStream {
+	url := config.MayString("SERVICE_NATS_URL", "")
+	if url == "" {
+		return nil
+	}
+	l := logger.Get()
+	nc, err := nats.Connect(url, nats.Name(serviceName), nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if err != nil {
+		l.Error().Err(err).Msg("NATS connection failed; event streams carry no events")
+		return nil
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		l.Error().Err(err).Msg("JetStream unavailable; event streams carry no events")
+		return nil
+	}
+	return js
+}
+
 func mountSwagger(r *chi.Mux) {
 	// Make “Try it out” use /api/v1 prefix
 	docs.SwaggerInfoapi.BasePath = "/api/v1"
@@ -145,11 +192,23 @@ func Run() {
 		return
 	}
 
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.LoadConfig(serviceName))
+	if err != nil {
+		l.Fatal().Err(err).Msg("Tracing setup failed")
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
 	// call newHandlerFn with true to create a postgres connection
 	// We also defer the close
 	h := newHandlerFn(true)
 	defer h.Close()
 
+	if config.MayBool("SERVICE_PGSQL_MIGRATE_ON_START", true) {
+		if err := migrateFn(h); err != nil {
+			l.Fatal().Err(err).Msg("Schema migration failed; refusing to serve an out-of-date schema")
+		}
+	}
+
 	// Build the router
 	r := BuildRouter(extractPingerFn(h))
 
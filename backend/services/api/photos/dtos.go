@@ -0,0 +1,96 @@
+package photos
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Statuses of a file in a multipart upload
+const (
+	StatusCreated   = "created"   // stored as a new photo
+	StatusDuplicate = "duplicate" // the tenant already has these bytes; PhotoID is that photo
+	StatusRejected  = "rejected"  // not stored; Error says why
+)
+
+// Result is the outcome for one file of a multipart upload
+// swagger:model
+type Result struct {
+	Field       string          `json:"field"`
+	Filename    string          `json:"filename"`
+	Status      string          `json:"status"`
+	PhotoID     string          `json:"photo_id,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	SHA256      string          `json:"sha256,omitempty"`
+	Error       *lumErrors.Wire `json:"error,omitempty"`
+}
+
+// Results is the response to a multipart upload, one entry per file part in request order
+// swagger:model
+type Results struct {
+	Files []Result `json:"files"`
+}
+
+// rejected is r refused for err
+func rejected(r Result, err error) Result {
+	r.Status = StatusRejected
+	var e *lumErrors.Error
+	if !errors.As(err, &e) {
+		e = lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "%v", err).(*lumErrors.Error)
+	}
+	w := e.ToWire()
+	r.Error = &w
+	return r
+}
+
+// photo is an original stored in the object store
+type photo struct {
+	ID          string
+	ObjectKey   string
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// sniffLen is how much of a file is read to detect its media type, mimetype's default limit
+const sniffLen = 3072
+
+// acceptedTypes are the media types kept as originals, by their sniffed type
+var acceptedTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp", "image/heic", "image/heif", "image/avif",
+	"image/tiff", "video/mp4", "video/quicktime",
+}
+
+// rawTypes are camera raw formats by extension. mimetype sees the TIFF-based ones as image/tiff
+// and the rest as application/octet-stream, so the extension names the format in those cases only
+var rawTypes = map[string]string{
+	".cr2": "image/x-canon-cr2",
+	".cr3": "image/x-canon-cr3",
+	".nef": "image/x-nikon-nef",
+	".arw": "image/x-sony-arw",
+	".dng": "image/x-adobe-dng",
+	".raf": "image/x-fuji-raf",
+	".orf": "image/x-olympus-orf",
+	".rw2": "image/x-panasonic-rw2",
+}
+
+// sniff returns the media type of a file starting with head, or false when it isn't one kept
+func sniff(head []byte, filename string) (string, bool) {
+	m := mimetype.Detect(head)
+	if raw, ok := rawTypes[strings.ToLower(path.Ext(filename))]; ok &&
+		(m.Is("image/tiff") || m.Is("application/octet-stream")) {
+		return raw, true
+	}
+	for _, t := range acceptedTypes {
+		if m.Is(t) {
+			return t, true
+		}
+	}
+	return m.String(), false
+}
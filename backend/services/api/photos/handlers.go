@@ -0,0 +1,74 @@
+package photos
+
+import (
+	"io"
+	"net/http"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/services/api/acl"
+)
+
+// Create is the handler endpoint for uploading photos
+//
+// @Summary     Upload photos
+// @Description Stores each file part of a multipart/form-data body as a photo, streaming it to the
+// @Description object store. Every file gets a result in request order: created, duplicate (the
+// @Description tenant already has the bytes; photo_id is that photo) or rejected (an unsupported
+// @Description type, over UPLOAD_MAX_SIZE or past the storage quota). Form fields without a
+// @Description filename are ignored. When the body breaks off, files before it are kept; sending
+// @Description them again reports them as duplicates.
+// @Tags        photos
+// @Accept      multipart/form-data
+// @Produce     json
+// @Security    BearerAuth
+// @Param       file  formData  file  true  "one or more files"
+// @Success     200  {object}  Results
+// @Failure     400  {string}  string          "not multipart/form-data, or no files"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Failure     422  {string}  string          "malformed or interrupted body"
+// @Router      /photos [post]
+func (h *Photos) Create(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return lumnet.ErrorR(lumErrors.NewValidationError(
+			lumErrors.ErrorCodeValidation, "the body must be multipart/form-data", "Content-Type"))
+	}
+
+	out := Results{Files: []Result{}}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lumnet.ErrorR(lumErrors.InvalidArgf("malformed multipart body: %v", err))
+		}
+		if part.FileName() == "" {
+			_ = part.Close()
+			continue
+		}
+		f := File{Field: part.FormName(), Filename: part.FileName(), Body: part}
+		if h.cfg.MaxFiles > 0 && len(out.Files) >= h.cfg.MaxFiles {
+			out.Files = append(out.Files, rejected(Result{Field: f.Field, Filename: f.Filename},
+				lumErrors.PayloadTooLargef("at most %d files are accepted per request", h.cfg.MaxFiles)))
+			_ = part.Close()
+			continue
+		}
+		res, err := h.svc.Ingest(r.Context(), p, f)
+		_ = part.Close()
+		if err != nil {
+			return lumnet.ErrorR(err)
+		}
+		out.Files = append(out.Files, res)
+	}
+	if len(out.Files) == 0 {
+		return lumnet.ErrorR(lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "no files were sent", "file"))
+	}
+	return lumnet.OKR(out)
+}
@@ -0,0 +1,89 @@
+// Package photos ingests originals sent as multipart/form-data. Each file part is streamed to the
+// object store while its SHA-256 is computed and its media type sniffed, so no file is held in
+// memory; bytes the tenant already has resolve to the existing photo instead of a second copy
+package photos
+
+import (
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+	"lumium/lib/objstore"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	objects objstore.Store
+}
+
+// Config is the configuration wrapper for photos
+type Config struct {
+	MaxSize      int64 // largest file accepted (UPLOAD_MAX_SIZE)
+	MaxFiles     int   // most file parts in one request (PHOTOS_MAX_FILES)
+	DefaultQuota int64 // bytes per tenant without its own quota; 0 is unlimited (STORAGE_QUOTA_BYTES)
+}
+
+// LoadConfig reads the upload limits from the environment
+func LoadConfig() Config {
+	return Config{
+		MaxSize:      int64(config.MayInt("UPLOAD_MAX_SIZE", 2<<30)),
+		MaxFiles:     config.MayInt("PHOTOS_MAX_FILES", 100),
+		DefaultQuota: int64(config.MayInt("STORAGE_QUOTA_BYTES", 0)),
+	}
+}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+func NewService(
+	db *pgxpool.Pool,
+	objects objstore.Store,
+	c Config,
+	o ...svckit.Opt[*pgxpool.Pool, Repo, Config],
+) Service {
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), objects: objects}
+}
+
+// Photos is the wrapper for the /photos service
+type Photos struct {
+	app     *handlers.App
+	svc     Service
+	cfg     Config
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new Photos pointer. The app must have an object store; see objstore.FromEnv
+func New(app *handlers.App, perms auth.PermissionResolver) *Photos {
+	if app.Objects == nil {
+		l := logger.Get()
+		l.Panic().Msg("photos: no object store configured")
+	}
+	cfg := LoadConfig()
+	return &Photos{
+		app:     app,
+		svc:     NewService(app.DB, app.Objects, cfg),
+		cfg:     cfg,
+		authCfg: auth.LoadConfig(),
+		perms:   perms,
+	}
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *Photos) Wire(r chi.Router) {
+	r.Route("/photos", func(r chi.Router) {
+		r.Use(auth.Authenticate(h.authCfg), auth.RequirePermission(h.perms, "photos.write"),
+			lumnet.CacheControl(lumnet.CacheNoStore))
+		r.Post("/", lumnet.Adapt(h.Create))
+	})
+	lumnet.InitValidator()
+}
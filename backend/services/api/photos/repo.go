@@ -0,0 +1,51 @@
+package photos
+
+import (
+	"context"
+
+	"lumium/lib/store"
+)
+
+// Repo is the photos data-access interface. Callers pass the tenant-scoped transaction from
+// store.WithTenantTx.
+type Repo interface {
+	// StorageUsage locks the tenant row and returns its quota (nil if it has none) and the bytes
+	// its photos and unfinished uploads take.
+	StorageUsage(ctx context.Context, q store.Queryer, tenantID string) (*int64, int64, error)
+
+	// Insert records p unless the tenant already has a photo with the same SHA-256. Returns the
+	// id of the photo holding the bytes, and whether it is p.
+	Insert(ctx context.Context, q store.Queryer, tenantID, ownerID string, p photo) (string, bool, error)
+}
+
+// StorageUsage locks the tenant row and returns its quota and the bytes it stores or has reserved.
+func (r *repo) StorageUsage(ctx context.Context, q store.Queryer, tenantID string) (*int64, int64, error) {
+	var quota *int64
+	var used int64
+	err := q.QueryRow(ctx,
+		`SELECT storage_quota_bytes, tenant_storage_used(id) FROM tenants WHERE id = $1 FOR UPDATE`,
+		tenantID,
+	).Scan(&quota, &used)
+	return quota, used, err
+}
+
+// Insert records p, or finds the tenant's photo with the same bytes.
+func (r *repo) Insert(ctx context.Context, q store.Queryer, tenantID, ownerID string, p photo) (string, bool, error) {
+	tag, err := q.Exec(ctx,
+		`INSERT INTO photos (id, tenant_id, owner_id, object_key, filename, content_type, size, sha256)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (tenant_id, sha256) DO NOTHING`,
+		p.ID, tenantID, ownerID, p.ObjectKey, p.Filename, p.ContentType, p.Size, p.SHA256,
+	)
+	if err != nil {
+		return "", false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return p.ID, true, nil
+	}
+	var id string
+	err = q.QueryRow(ctx,
+		`SELECT id::text FROM photos WHERE tenant_id = $1 AND sha256 = $2`, tenantID, p.SHA256,
+	).Scan(&id)
+	return id, false, err
+}
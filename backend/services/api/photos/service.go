@@ -0,0 +1,217 @@
+package photos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/outbox"
+	"lumium/lib/store"
+	"lumium/services/api/acl"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTenantTx = func(
+		ctx context.Context,
+		b store.Beginner,
+		s store.Scope,
+		o store.TxOptions,
+		fn func(q store.Queryer) error,
+	) error {
+		return store.WithTenantTxOptions(ctx, b, s, o, fn)
+	}
+	// commitTx retries the transaction recording a photo when it loses a deadlock or
+	// serialization conflict to a concurrent ingest in the tenant
+	commitTx = store.TxOptions{MaxRetries: 3, MaxBackoff: 250 * time.Millisecond}
+)
+
+// File is one file part of a multipart upload
+type File struct {
+	Field    string
+	Filename string
+	Body     io.Reader
+}
+
+// Service defines the photo operations exposed to HTTP handlers
+type Service interface {
+	// Ingest stores one file as a photo. A file of a type that isn't kept, over MaxSize or past
+	// the tenant's quota comes back rejected; err is set only when the request can't go on, e.g.
+	// the body broke off or the object store is down
+	Ingest(ctx context.Context, p acl.Principal, f File) (Result, error)
+}
+
+// Ingest streams f to the object store, hashing it on the way, then records it as a photo and
+// enqueues photo.ingested. The type is sniffed from the first bytes, so an unwanted file is
+// rejected before anything is stored. Duplicates are only known once every byte is hashed: their
+// copy is deleted and the result names the photo that already holds them
+func (s *svc) Ingest(ctx context.Context, p acl.Principal, f File) (Result, error) {
+	res := Result{Field: f.Field, Filename: f.Filename}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return res, lumErrors.InvalidArgf("upload interrupted in %s: %v", f.Filename, err)
+	}
+	head = head[:n]
+	contentType, ok := sniff(head, f.Filename)
+	if !ok {
+		return rejected(res, lumErrors.WithField(
+			lumErrors.InvalidArgf("%s files are not accepted", contentType), f.Field)), nil
+	}
+	res.ContentType = contentType
+
+	body, err := s.capFor(ctx, p, io.MultiReader(bytes.NewReader(head), f.Body))
+	if err != nil {
+		return res, err
+	}
+	ph := photo{ID: uuid.NewString(), Filename: f.Filename, ContentType: contentType}
+	ph.ObjectKey = fmt.Sprintf("originals/%s/%s", p.TenantID, ph.ID)
+	digest := sha256.New()
+	size, err := s.objects.PutStream(ctx, ph.ObjectKey, io.TeeReader(body, digest), contentType)
+	switch {
+	case body.exceeded:
+		return rejected(res, lumErrors.WithField(body.over, f.Field)), nil
+	case body.readErr != nil:
+		return res, lumErrors.InvalidArgf("upload interrupted in %s: %v", f.Filename, body.readErr)
+	case err != nil:
+		return res, err
+	}
+	ph.Size, ph.SHA256 = size, hex.EncodeToString(digest.Sum(nil))
+	res.Size, res.SHA256 = ph.Size, ph.SHA256
+
+	created := false
+	err = withTenantTx(ctx, s.DB, p.Scope(), commitTx, func(q store.Queryer) error {
+		used, limit, err := s.usage(ctx, q, p.TenantID)
+		if err != nil {
+			return err
+		}
+		id, ok, err := s.Repo.Insert(ctx, q, p.TenantID, p.UserID, ph)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "record photo")
+		}
+		if res.PhotoID, created = id, ok; !ok {
+			return nil
+		}
+		if limit > 0 && used+ph.Size > limit {
+			return quotaExceeded(used, limit)
+		}
+		return outbox.Enqueue(ctx, q, outbox.Event{
+			AggregateType: "photo",
+			AggregateID:   ph.ID,
+			Subject:       "events.photo.ingested",
+			Payload: map[string]any{
+				"tenant_id":    p.TenantID,
+				"photo_id":     ph.ID,
+				"owner_id":     p.UserID,
+				"object_key":   ph.ObjectKey,
+				"filename":     ph.Filename,
+				"content_type": ph.ContentType,
+				"size":         ph.Size,
+				"sha256":       ph.SHA256,
+			},
+		})
+	})
+	if err != nil || !created {
+		s.discard(ph.ObjectKey)
+	}
+	switch {
+	case lumErrors.IsErrorCode(err, lumErrors.ErrorCodePayloadTooLarge):
+		res.PhotoID = ""
+		return rejected(res, lumErrors.WithField(err, f.Field)), nil
+	case err != nil:
+		return res, err
+	case !created:
+		res.Status = StatusDuplicate
+	default:
+		res.Status = StatusCreated
+	}
+	return res, nil
+}
+
+// capFor wraps r to stop at the largest file the principal may store now: MaxSize, or what is
+// left of the tenant's quota when that is less
+func (s *svc) capFor(ctx context.Context, p acl.Principal, r io.Reader) (*capped, error) {
+	c := &capped{r: r, n: -1}
+	if s.Cfg.MaxSize > 0 {
+		c.n, c.over = s.Cfg.MaxSize, lumErrors.PayloadTooLargef("files are limited to %d bytes", s.Cfg.MaxSize)
+	}
+	err := withTenantTx(ctx, s.DB, p.Scope(), store.TxOptions{}, func(q store.Queryer) error {
+		used, limit, err := s.usage(ctx, q, p.TenantID)
+		if err != nil || limit <= 0 {
+			return err
+		}
+		if left := max(limit-used, 0); c.n < 0 || left < c.n {
+			c.n, c.over = left, quotaExceeded(used, limit)
+		}
+		return nil
+	})
+	return c, err
+}
+
+// usage locks the tenant row and returns the bytes it uses and its quota, 0 being unlimited
+func (s *svc) usage(ctx context.Context, q store.Queryer, tenantID string) (int64, int64, error) {
+	quota, used, err := s.Repo.StorageUsage(ctx, q, tenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, lumErrors.NotFoundf("tenant not found")
+	}
+	if err != nil {
+		return 0, 0, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "check storage quota")
+	}
+	if quota != nil {
+		return used, *quota, nil
+	}
+	return used, s.Cfg.DefaultQuota, nil
+}
+
+// quotaExceeded is the error for a file that doesn't fit the tenant's quota
+func quotaExceeded(used, limit int64) error {
+	return lumErrors.PayloadTooLargef("storage quota exceeded: %d of %d bytes in use", used, limit)
+}
+
+// discard deletes an object nothing references. A failure only leaks storage, so it is logged
+// rather than failing the request
+func (s *svc) discard(key string) {
+	if err := s.objects.Delete(context.Background(), key); err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Str("key", key).Msg("photos: could not delete object")
+	}
+}
+
+// capped reads r up to n bytes (any number when n < 0) and fails with over past them. It
+// remembers whether it stopped for that or because r failed, which PutStream hands back as is
+type capped struct {
+	r        io.Reader
+	n        int64
+	over     error
+	exceeded bool
+	readErr  error
+}
+
+func (c *capped) Read(p []byte) (int, error) {
+	if c.n >= 0 && int64(len(p)) > c.n+1 {
+		p = p[:c.n+1]
+	}
+	n, err := c.r.Read(p)
+	if c.n >= 0 {
+		if int64(n) > c.n {
+			c.exceeded = true
+			return int(c.n), c.over
+		}
+		c.n -= int64(n)
+	}
+	if err != nil && err != io.EOF {
+		c.readErr = err
+	}
+	return n, err
+}
@@ -0,0 +1,215 @@
+package photos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/objstore"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+	"lumium/services/api/acl"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	tenantID = "00000000-0000-4000-8000-000000000001"
+	userID   = "00000000-0000-4000-8000-000000000002"
+)
+
+// outboxQueryer records the subjects enqueued on it
+type outboxQueryer struct {
+	events []string
+}
+
+func (q *outboxQueryer) Query(context.Context, string, ...any) (pgx.Rows, error) { return nil, nil }
+
+func (q *outboxQueryer) QueryRow(context.Context, string, ...any) pgx.Row { return nil }
+
+func (q *outboxQueryer) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "INSERT INTO outbox") {
+		q.events = append(q.events, args[2].(string))
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+// fakeRepo keeps photos in memory, one per SHA-256 as the unique index does
+type fakeRepo struct {
+	quota  *int64
+	used   int64
+	photos map[string]photo // sha256 -> photo
+	// onUsage runs on every StorageUsage, to change the usage between two checks
+	onUsage func(f *fakeRepo)
+}
+
+func (f *fakeRepo) StorageUsage(context.Context, store.Queryer, string) (*int64, int64, error) {
+	if f.onUsage != nil {
+		f.onUsage(f)
+	}
+	used := f.used
+	for _, p := range f.photos {
+		used += p.Size
+	}
+	return f.quota, used, nil
+}
+
+func (f *fakeRepo) Insert(_ context.Context, _ store.Queryer, _, _ string, p photo) (string, bool, error) {
+	if have, ok := f.photos[p.SHA256]; ok {
+		return have.ID, false, nil
+	}
+	f.photos[p.SHA256] = p
+	return p.ID, true, nil
+}
+
+// jpeg is n bytes sniffed as a JPEG, varied by seed so two calls can differ
+func jpeg(n int, seed byte) []byte {
+	b := bytes.Repeat([]byte{seed}, n)
+	copy(b, "\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	return b
+}
+
+func TestIngest(t *testing.T) {
+	Convey("Given the photos service", t, func() {
+		q := &outboxQueryer{}
+		withTenantTx = func(
+			_ context.Context, _ store.Beginner, _ store.Scope, _ store.TxOptions, fn func(store.Queryer) error,
+		) error {
+			return fn(q)
+		}
+		repo := &fakeRepo{photos: map[string]photo{}}
+		objects := objstore.NewMemory()
+		s := NewService(nil, objects, Config{MaxSize: 1 << 10}, svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))
+		ctx := context.Background()
+		p := acl.Principal{TenantID: tenantID, UserID: userID}
+		ingest := func(name string, body []byte) (Result, error) {
+			return s.Ingest(ctx, p, File{Field: "file", Filename: name, Body: bytes.NewReader(body)})
+		}
+
+		Convey("an image is stored and announced", func() {
+			body := jpeg(600, 'a')
+			res, err := ingest("beach.jpg", body)
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusCreated)
+			So(res.ContentType, ShouldEqual, "image/jpeg")
+			So(res.Size, ShouldEqual, 600)
+			sum := sha256.Sum256(body)
+			So(res.SHA256, ShouldEqual, hex.EncodeToString(sum[:]))
+			So(q.events, ShouldResemble, []string{"events.photo.ingested"})
+
+			rc, err := objects.Get(ctx, repo.photos[res.SHA256].ObjectKey)
+			So(err, ShouldBeNil)
+			got, _ := io.ReadAll(rc)
+			So(got, ShouldResemble, body)
+
+			Convey("and the same bytes again resolve to that photo without a second copy", func() {
+				again, err := ingest("beach (1).jpg", body)
+				So(err, ShouldBeNil)
+				So(again.Status, ShouldEqual, StatusDuplicate)
+				So(again.PhotoID, ShouldEqual, res.PhotoID)
+				So(objects.Len(), ShouldEqual, 1)
+				So(q.events, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("a file of a type that isn't kept is rejected before it is stored", func() {
+			res, err := ingest("notes.txt", []byte("just some text"))
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusRejected)
+			So(res.Error, ShouldNotBeNil)
+			So(objects.Len(), ShouldEqual, 0)
+		})
+
+		Convey("a file over MaxSize is rejected", func() {
+			res, err := ingest("huge.jpg", jpeg(1<<10+1, 'b'))
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusRejected)
+			So(res.Error.Code, ShouldEqual, lumErrors.ErrorCodePayloadTooLarge)
+			So(objects.Len(), ShouldEqual, 0)
+			So(repo.photos, ShouldBeEmpty)
+		})
+
+		Convey("a file past the tenant's quota is rejected", func() {
+			quota := int64(1000)
+			repo.quota, repo.used = &quota, 600
+			res, err := ingest("big.jpg", jpeg(500, 'c'))
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusRejected)
+			So(objects.Len(), ShouldEqual, 0)
+
+			res, err = ingest("fits.jpg", jpeg(400, 'd'))
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusCreated)
+		})
+
+		Convey("a file that fit when it started but not once stored is rejected and deleted", func() {
+			quota := int64(1000)
+			repo.quota = &quota
+			calls := 0
+			repo.onUsage = func(f *fakeRepo) {
+				if calls++; calls == 2 {
+					f.used = 800 // another ingest committed while this one streamed
+				}
+			}
+			res, err := ingest("late.jpg", jpeg(500, 'e'))
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, StatusRejected)
+			So(res.PhotoID, ShouldBeBlank)
+			So(objects.Len(), ShouldEqual, 0)
+			So(q.events, ShouldBeEmpty)
+		})
+
+		Convey("a body that breaks off fails the request", func() {
+			body := io.MultiReader(bytes.NewReader(jpeg(100, 'f')), iotest.ErrReader(errors.New("connection reset")))
+			_, err := s.Ingest(ctx, p, File{Field: "file", Filename: "cut.jpg", Body: body})
+			So(err, ShouldNotBeNil)
+			So(repo.photos, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestCapped(t *testing.T) {
+	over := errors.New("over")
+
+	Convey("capped passes a body within its limit through", t, func() {
+		c := &capped{r: strings.NewReader("abcd"), n: 4, over: over}
+		b, err := io.ReadAll(c)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "abcd")
+		So(c.exceeded, ShouldBeFalse)
+	})
+
+	Convey("capped stops a longer one with its error", t, func() {
+		c := &capped{r: strings.NewReader("abcde"), n: 4, over: over}
+		b, err := io.ReadAll(c)
+		So(err, ShouldEqual, over)
+		So(string(b), ShouldEqual, "abcd")
+		So(c.exceeded, ShouldBeTrue)
+	})
+
+	Convey("capped without a limit reads everything", t, func() {
+		c := &capped{r: strings.NewReader("abcde"), n: -1}
+		b, err := io.ReadAll(c)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "abcde")
+	})
+
+	Convey("capped tells a failing reader from an exceeded limit", t, func() {
+		cut := errors.New("connection reset")
+		c := &capped{r: iotest.ErrReader(cut), n: 4, over: over}
+		_, err := io.ReadAll(c)
+		So(err, ShouldEqual, cut)
+		So(c.readErr, ShouldEqual, cut)
+		So(c.exceeded, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,21 @@
+package roles
+
+import (
+	"lumium/lib/config"
+)
+
+// Config is the configuration wrapper for custom roles
+type Config struct {
+	MaxRolesPerTenant int
+}
+
+// LoadConfig returns the configuration wrapper for custom roles
+func LoadConfig() Config {
+	c := Config{
+		MaxRolesPerTenant: config.MayInt("ROLES_MAX_PER_TENANT", 50),
+	}
+	if c.MaxRolesPerTenant <= 0 {
+		c.MaxRolesPerTenant = 50
+	}
+	return c
+}
@@ -0,0 +1,55 @@
+package roles
+
+import (
+	"time"
+
+	"lumium/lib/lumnet"
+)
+
+// Role is a named permission set. Built-in roles have no tenant and cannot be edited
+// swagger:model
+type Role struct {
+	ID          string    `json:"id"          db:"id"`
+	Key         string    `json:"key"         db:"key"`
+	Name        string    `json:"name"        db:"name"`
+	Description string    `json:"description" db:"description"`
+	BuiltIn     bool      `json:"built_in"    db:"is_builtin"`
+	Permissions []string  `json:"permissions" db:"permissions"`
+	CreatedAt   time.Time `json:"created_at"  db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"  db:"updated_at"`
+}
+
+// ETag is the role's version, for conditional requests
+func (r Role) ETag() string {
+	return lumnet.VersionETag(r.ID, r.UpdatedAt)
+}
+
+// Permission is one grantable permission code
+// swagger:model
+type Permission struct {
+	Code        string `json:"code"        db:"code"`
+	Description string `json:"description" db:"description"`
+}
+
+// CreateRoleDTO is the http data transfer object for creating a custom role
+// swagger:model
+type CreateRoleDTO struct {
+	Key         string   `json:"key"                   validate:"required,min=2,max=64"`
+	Name        string   `json:"name"                  validate:"required,max=120"`
+	Description string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	Permissions []string `json:"permissions"           validate:"required,min=1,dive,required"`
+}
+
+// UpdateRoleDTO is the http data transfer object for replacing a custom role's attributes
+// swagger:model
+type UpdateRoleDTO struct {
+	Name        string   `json:"name"                  validate:"required,max=120"`
+	Description string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	Permissions []string `json:"permissions"           validate:"required,min=1,dive,required"`
+}
+
+// AssignRoleDTO is the http data transfer object for assigning a role to a tenant member
+// swagger:model
+type AssignRoleDTO struct {
+	RoleID string `json:"role_id" validate:"required,uuid" format:"uuid"`
+}
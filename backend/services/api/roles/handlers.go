@@ -0,0 +1,206 @@
+package roles
+
+import (
+	"net/http"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/services/api/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// List is the handler endpoint for listing roles
+//
+// @Summary     List roles
+// @Description Lists the built-in roles and the tenant's custom roles with their permissions.
+// @Tags        roles
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200  {array}   Role
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /roles [get]
+func (h *Roles) List(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	rs, err := h.svc.ListRoles(r.Context(), claims.TenantID)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(rs)
+}
+
+// Permissions is the handler endpoint for the permission catalogue
+//
+// @Summary     List permissions
+// @Description Lists every permission code a role can be composed from.
+// @Tags        roles
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200  {array}   Permission
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /roles/permissions [get]
+func (h *Roles) Permissions(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	ps, err := h.svc.ListPermissions(r.Context())
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.OKR(ps)
+}
+
+// Get is the handler endpoint for a single role
+//
+// @Summary     Get role
+// @Tags        roles
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id   path      string  true  "role id"
+// @Param       If-None-Match  header  string  false  "ETag of the cached copy"
+// @Success     200  {object}  Role
+// @Success     304  "not modified"
+// @Failure     404  {string}  string          "role not found"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /roles/{id} [get]
+func (h *Roles) Get(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	role, err := h.svc.GetRole(r.Context(), claims.TenantID, chi.URLParam(r, "id"))
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if lumnet.NotModified(w, r, role.ETag(), role.UpdatedAt) {
+		return nil
+	}
+	return lumnet.OKR(role)
+}
+
+// Create is the handler endpoint for defining a custom role
+//
+// @Summary     Create role
+// @Description Creates a tenant role from permission codes. Callers can only grant permissions they hold.
+// @Tags        roles
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body      CreateRoleDTO  true  "role definition"
+// @Success     201    {object}  Role
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     409    {string}  string          "role key already exists"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Router      /roles [post]
+func (h *Roles) Create(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[CreateRoleDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	granted, _ := auth.PermissionsFromContext(r.Context())
+
+	role, err := h.svc.CreateRole(r.Context(), claims.TenantID, granted, RoleInput{
+		Key:         in.Key,
+		Name:        in.Name,
+		Description: in.Description,
+		Permissions: in.Permissions,
+	})
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.CreatedR(role, "/api/v1/roles/"+role.ID)
+}
+
+// Update is the handler endpoint for replacing a custom role
+//
+// @Summary     Update role
+// @Description Replaces a custom role's name, description and permissions. Built-in roles are read-only.
+// @Tags        roles
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id     path      string         true  "role id"
+// @Param       input  body      UpdateRoleDTO  true  "role definition"
+// @Param       If-Match  header  string  false  "ETag the update is based on; 412 when the role changed since"
+// @Success     200    {object}  Role
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     404    {string}  string          "role not found"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Failure     412    {object}  auth.ErrorWire  "role changed since the If-Match ETag"
+// @Failure     422    {object}  auth.ErrorWire  "built-in role"
+// @Router      /roles/{id} [put]
+func (h *Roles) Update(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[UpdateRoleDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	granted, _ := auth.PermissionsFromContext(r.Context())
+
+	role, err := h.svc.UpdateRole(r.Context(), claims.TenantID, chi.URLParam(r, "id"), granted, RoleInput{
+		Name:        in.Name,
+		Description: in.Description,
+		Permissions: in.Permissions,
+	}, func(cur *Role) error {
+		return lumnet.CheckPreconditions(r, cur.ETag(), cur.UpdatedAt)
+	})
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	w.Header().Set("ETag", role.ETag())
+	return lumnet.OKR(role)
+}
+
+// Delete is the handler endpoint for deleting a custom role
+//
+// @Summary     Delete role
+// @Description Deletes a custom role. Members holding it fall back to their built-in role.
+// @Tags        roles
+// @Security    BearerAuth
+// @Param       id  path  string  true  "role id"
+// @Success     204 "deleted; no content"
+// @Failure     404 {string}  string          "role not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Failure     422 {object}  auth.ErrorWire  "built-in role"
+// @Router      /roles/{id} [delete]
+func (h *Roles) Delete(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if err := h.svc.DeleteRole(r.Context(), claims.TenantID, chi.URLParam(r, "id")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// Assign is the handler endpoint for assigning a role to a tenant member
+//
+// @Summary     Assign role
+// @Description Assigns a built-in or custom role to a member of the caller's tenant.
+// @Description The member's access tokens carry the new role after their next refresh.
+// @Tags        roles
+// @Accept      json
+// @Security    BearerAuth
+// @Param       userID  path  string         true  "member user id"
+// @Param       input   body  AssignRoleDTO  true  "role to assign"
+// @Success     204 "assigned; no content"
+// @Failure     400 {string}  string          "bad request / validation error"
+// @Failure     404 {string}  string          "role or member not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /roles/assignments/{userID} [put]
+func (h *Roles) Assign(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[AssignRoleDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if claims.TenantID == "" {
+		return lumnet.ErrorR(lumErrors.InvalidArgf("tenant required"))
+	}
+	granted, _ := auth.PermissionsFromContext(r.Context())
+
+	if err := h.svc.AssignRole(r.Context(), claims.TenantID, chi.URLParam(r, "userID"), in.RoleID, granted); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
@@ -0,0 +1,199 @@
+package roles
+
+import (
+	"context"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Repo is the roles data-access interface. Implementations read/write auth_roles,
+// auth_role_permissions and users_tenants role assignments via a store.Queryer.
+type Repo interface {
+	// ListPermissions returns the full permission catalogue.
+	ListPermissions(ctx context.Context, q store.Queryer) ([]Permission, error)
+
+	// ListRoles returns the built-in roles followed by the tenant's custom roles.
+	ListRoles(ctx context.Context, q store.Queryer, tenantID string) ([]Role, error)
+
+	// GetRole returns a built-in role or one of the tenant's roles, or pgx.ErrNoRows.
+	GetRole(ctx context.Context, q store.Queryer, tenantID, roleID string) (*Role, error)
+
+	// CountTenantRoles returns the number of custom roles the tenant has defined.
+	CountTenantRoles(ctx context.Context, q store.Queryer, tenantID string) (int, error)
+
+	// BuiltInKeyExists reports whether key is taken by a built-in role.
+	BuiltInKeyExists(ctx context.Context, q store.Queryer, key string) (bool, error)
+
+	// InsertRole creates a custom role for the tenant and returns its ID.
+	InsertRole(ctx context.Context, q store.Queryer, tenantID, key, name, description string) (string, error)
+
+	// LockRole locks a custom role's row until the transaction ends. Returns pgx.ErrNoRows if no
+	// such role.
+	LockRole(ctx context.Context, q store.Queryer, tenantID, roleID string) error
+
+	// UpdateRole replaces a custom role's name and description.
+	UpdateRole(ctx context.Context, q store.Queryer, tenantID, roleID, name, description string) error
+
+	// SetRolePermissions replaces the role's permission set.
+	SetRolePermissions(ctx context.Context, q store.Queryer, roleID string, codes []string) error
+
+	// DeleteRole removes a custom role. Returns false if no such role.
+	DeleteRole(ctx context.Context, q store.Queryer, tenantID, roleID string) (bool, error)
+
+	// AssignRole points a membership at a role. builtinKey is set for built-in roles (clearing
+	// any custom role); otherwise roleID is stored and the base role is left unchanged.
+	// Returns false if the user is not a member of the tenant.
+	AssignRole(ctx context.Context, q store.Queryer, tenantID, userID, builtinKey string, roleID *string) (bool, error)
+}
+
+// roleColumns is the select list collected into Role
+const roleColumns = `r.id::text AS id, r.key, r.name, r.description, r.is_builtin,
+	COALESCE(ARRAY(SELECT permission_code FROM auth_role_permissions p
+	                WHERE p.role_id = r.id ORDER BY permission_code), '{}') AS permissions,
+	r.created_at, r.updated_at`
+
+// ListPermissions returns the full permission catalogue.
+func (r *repo) ListPermissions(ctx context.Context, q store.Queryer) ([]Permission, error) {
+	rows, err := q.Query(ctx, `SELECT code, description FROM auth_permissions ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Permission](rows)
+}
+
+// ListRoles returns the built-in roles followed by the tenant's custom roles.
+func (r *repo) ListRoles(ctx context.Context, q store.Queryer, tenantID string) ([]Role, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+roleColumns+`
+		   FROM auth_roles r
+		  WHERE r.tenant_id IS NULL OR r.tenant_id::text = $1
+		  ORDER BY r.is_builtin DESC, r.name`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[Role](rows)
+}
+
+// GetRole returns a built-in role or one of the tenant's roles, or pgx.ErrNoRows.
+func (r *repo) GetRole(ctx context.Context, q store.Queryer, tenantID, roleID string) (*Role, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+roleColumns+`
+		   FROM auth_roles r
+		  WHERE r.id::text = $2 AND (r.tenant_id IS NULL OR r.tenant_id::text = $1)`,
+		tenantID,
+		roleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	role, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Role])
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CountTenantRoles returns the number of custom roles the tenant has defined.
+func (r *repo) CountTenantRoles(ctx context.Context, q store.Queryer, tenantID string) (int, error) {
+	var n int
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM auth_roles WHERE tenant_id::text = $1`, tenantID).Scan(&n)
+	return n, err
+}
+
+// BuiltInKeyExists reports whether key is taken by a built-in role.
+func (r *repo) BuiltInKeyExists(ctx context.Context, q store.Queryer, key string) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM auth_roles WHERE tenant_id IS NULL AND key = $1)`,
+		key,
+	).Scan(&ok)
+	return ok, err
+}
+
+// InsertRole creates a custom role for the tenant and returns its ID.
+func (r *repo) InsertRole(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, key, name, description string,
+) (string, error) {
+	var id string
+	err := q.QueryRow(ctx,
+		`INSERT INTO auth_roles (tenant_id, key, name, description)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id::text`,
+		tenantID, key, name, description,
+	).Scan(&id)
+	return id, err
+}
+
+// LockRole locks a custom role's row until the transaction ends.
+func (r *repo) LockRole(ctx context.Context, q store.Queryer, tenantID, roleID string) error {
+	var id string
+	return q.QueryRow(ctx,
+		`SELECT id::text FROM auth_roles WHERE id::text = $2 AND tenant_id::text = $1 FOR UPDATE`,
+		tenantID, roleID,
+	).Scan(&id)
+}
+
+// UpdateRole replaces a custom role's name and description.
+func (r *repo) UpdateRole(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, roleID, name, description string,
+) error {
+	_, err := q.Exec(ctx,
+		`UPDATE auth_roles SET name = $3, description = $4, updated_at = NOW()
+		  WHERE id::text = $2 AND tenant_id::text = $1`,
+		tenantID, roleID, name, description,
+	)
+	return err
+}
+
+// SetRolePermissions replaces the role's permission set.
+func (r *repo) SetRolePermissions(ctx context.Context, q store.Queryer, roleID string, codes []string) error {
+	if _, err := q.Exec(ctx, `DELETE FROM auth_role_permissions WHERE role_id::text = $1`, roleID); err != nil {
+		return err
+	}
+	_, err := q.Exec(ctx,
+		`INSERT INTO auth_role_permissions (role_id, permission_code)
+		 SELECT $1::uuid, code FROM UNNEST($2::text[]) AS code`,
+		roleID, codes,
+	)
+	return err
+}
+
+// DeleteRole removes a custom role. Returns false if no such role.
+func (r *repo) DeleteRole(ctx context.Context, q store.Queryer, tenantID, roleID string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM auth_roles WHERE id::text = $2 AND tenant_id::text = $1`,
+		tenantID, roleID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AssignRole points a membership at a role.
+func (r *repo) AssignRole(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, userID, builtinKey string,
+	roleID *string,
+) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE users_tenants
+		    SET role = COALESCE(NULLIF($3, '')::role_enum, role),
+		        role_id = $4::uuid
+		  WHERE tenant_id::text = $1 AND user_id::text = $2`,
+		tenantID, userID, builtinKey, roleID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,71 @@
+// Package roles manages per-tenant custom roles composed from auth_permissions codes.
+// Built-in roles mirror role_enum and are shared by every tenant
+package roles
+
+import (
+	"lumium/lib/lumnet"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	perms *auth.PermissionCache
+}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+func NewService(
+	db *pgxpool.Pool,
+	perms *auth.PermissionCache,
+	c Config,
+	o ...svckit.Opt[*pgxpool.Pool, Repo, Config],
+) Service {
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), perms: perms}
+}
+
+// Roles is the wrapper for the /roles service
+type Roles struct {
+	app     *handlers.App
+	svc     Service
+	authCfg auth.Config
+	perms   *auth.PermissionCache
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new Roles pointer. perms is shared with every router that mounts
+// auth.RequirePermission so role edits take effect without waiting for the cache TTL
+func New(app *handlers.App, perms *auth.PermissionCache) *Roles {
+	return &Roles{
+		app:     app,
+		svc:     NewService(app.DB, perms, LoadConfig()),
+		authCfg: auth.LoadConfig(),
+		perms:   perms,
+	}
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *Roles) Wire(r chi.Router) {
+	r.Route("/roles", func(r chi.Router) {
+		r.Use(auth.Authenticate(h.authCfg))
+
+		r.With(auth.RequirePermission(h.perms, "roles.read")).Get("/", lumnet.Adapt(h.List))
+		r.With(auth.RequirePermission(h.perms, "roles.read")).Get("/permissions", lumnet.Adapt(h.Permissions))
+		r.With(auth.RequirePermission(h.perms, "roles.read")).Get("/{id}", lumnet.Adapt(h.Get))
+		r.With(auth.RequirePermission(h.perms, "roles.write")).Post("/", lumnet.Adapt(h.Create))
+		r.With(auth.RequirePermission(h.perms, "roles.write")).Put("/{id}", lumnet.Adapt(h.Update))
+		r.With(auth.RequirePermission(h.perms, "roles.write")).Delete("/{id}", lumnet.Adapt(h.Delete))
+
+		// assigning a role is a membership change, not a role edit
+		r.With(auth.RequirePermission(h.perms, "users.write")).Put("/assignments/{userID}", lumnet.Adapt(h.Assign))
+	})
+	lumnet.InitValidator()
+}
@@ -0,0 +1,291 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeRepo keeps roles and assignments in memory. It doubles as the store.Queryer behind the
+// permission cache, so cached sets can be checked against edits
+type fakeRepo struct {
+	seq         int
+	roles       map[string]*fakeRole
+	assignments map[string]assignment // tenant/user -> role
+}
+
+type fakeRole struct {
+	tenantID string
+	Role
+}
+
+type assignment struct {
+	builtinKey string
+	roleID     *string
+}
+
+var catalogue = []string{"albums.read", "albums.write", "photos.read", "photos.write", "roles.write"}
+
+func newFakeRepo() *fakeRepo {
+	f := &fakeRepo{roles: map[string]*fakeRole{}, assignments: map[string]assignment{}}
+	f.roles["viewer"] = &fakeRole{Role: Role{
+		ID: "viewer", Key: "viewer", BuiltIn: true, Permissions: []string{"albums.read", "photos.read"},
+	}}
+	return f
+}
+
+func (f *fakeRepo) ListPermissions(context.Context, store.Queryer) ([]Permission, error) {
+	out := make([]Permission, 0, len(catalogue))
+	for _, c := range catalogue {
+		out = append(out, Permission{Code: c})
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) ListRoles(_ context.Context, _ store.Queryer, tenantID string) ([]Role, error) {
+	var out []Role
+	for _, r := range f.roles {
+		if r.BuiltIn || r.tenantID == tenantID {
+			out = append(out, r.Role)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetRole(_ context.Context, _ store.Queryer, tenantID, roleID string) (*Role, error) {
+	r, ok := f.roles[roleID]
+	if !ok || (!r.BuiltIn && r.tenantID != tenantID) {
+		return nil, pgx.ErrNoRows
+	}
+	role := r.Role
+	role.Permissions = slices.Clone(r.Permissions)
+	return &role, nil
+}
+
+func (f *fakeRepo) CountTenantRoles(_ context.Context, _ store.Queryer, tenantID string) (int, error) {
+	n := 0
+	for _, r := range f.roles {
+		if r.tenantID == tenantID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeRepo) BuiltInKeyExists(_ context.Context, _ store.Queryer, key string) (bool, error) {
+	for _, r := range f.roles {
+		if r.BuiltIn && r.Key == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRepo) InsertRole(_ context.Context, _ store.Queryer, tenantID, key, name, desc string) (string, error) {
+	f.seq++
+	id := fmt.Sprintf("role-%d", f.seq)
+	f.roles[id] = &fakeRole{tenantID: tenantID, Role: Role{ID: id, Key: key, Name: name, Description: desc}}
+	return id, nil
+}
+
+func (f *fakeRepo) LockRole(_ context.Context, _ store.Queryer, tenantID, roleID string) error {
+	if r, ok := f.roles[roleID]; !ok || r.tenantID != tenantID {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (f *fakeRepo) UpdateRole(_ context.Context, _ store.Queryer, _, roleID, name, desc string) error {
+	f.roles[roleID].Name, f.roles[roleID].Description = name, desc
+	f.roles[roleID].UpdatedAt = time.Now()
+	return nil
+}
+
+func (f *fakeRepo) SetRolePermissions(_ context.Context, _ store.Queryer, roleID string, codes []string) error {
+	f.roles[roleID].Permissions = slices.Clone(codes)
+	return nil
+}
+
+func (f *fakeRepo) DeleteRole(_ context.Context, _ store.Queryer, tenantID, roleID string) (bool, error) {
+	if r, ok := f.roles[roleID]; !ok || r.tenantID != tenantID {
+		return false, nil
+	}
+	delete(f.roles, roleID)
+	return true, nil
+}
+
+func (f *fakeRepo) AssignRole(
+	_ context.Context,
+	_ store.Queryer,
+	tenantID, userID, builtinKey string,
+	roleID *string,
+) (bool, error) {
+	key := tenantID + "/" + userID
+	cur, ok := f.assignments[key]
+	if !ok {
+		return false, nil
+	}
+	if builtinKey != "" {
+		cur.builtinKey = builtinKey
+	}
+	cur.roleID = roleID
+	f.assignments[key] = cur
+	return true, nil
+}
+
+// Query answers the permission cache's role_id -> permission_code lookup
+func (f *fakeRepo) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	rows := &grantRows{i: -1}
+	for _, id := range args[0].([]string) {
+		if r, ok := f.roles[id]; ok {
+			for _, code := range r.Permissions {
+				rows.data = append(rows.data, [2]string{id, code})
+			}
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeRepo) QueryRow(context.Context, string, ...any) pgx.Row { return nil }
+
+func (f *fakeRepo) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+type grantRows struct {
+	data [][2]string
+	i    int
+}
+
+func (r *grantRows) Close()                                       {}
+func (r *grantRows) Err() error                                   { return nil }
+func (r *grantRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *grantRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *grantRows) Next() bool                                   { r.i++; return r.i < len(r.data) }
+func (r *grantRows) Values() ([]any, error)                       { return nil, nil }
+func (r *grantRows) RawValues() [][]byte                          { return nil }
+func (r *grantRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *grantRows) Scan(dest ...any) error {
+	*dest[0].(*string), *dest[1].(*string) = r.data[r.i][0], r.data[r.i][1]
+	return nil
+}
+
+func TestRoles(t *testing.T) {
+	Convey("Given the roles service for a tenant admin", t, func() {
+		withTx = func(_ context.Context, _ store.Beginner, fn func(q store.Queryer) error) error {
+			return fn(nil)
+		}
+		repo := newFakeRepo()
+		perms := auth.NewPermissionCacheWith(repo, time.Hour)
+		s := NewService(nil, perms, Config{MaxRolesPerTenant: 2},
+			svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))
+		ctx := context.Background()
+		admin := map[string]bool{}
+		for _, c := range catalogue {
+			admin[c] = true
+		}
+		in := RoleInput{Key: "Retoucher", Name: "Retoucher", Permissions: []string{"photos.read", "photos.write"}}
+
+		Convey("a custom role is created with its permissions", func() {
+			r, err := s.CreateRole(ctx, "t1", admin, in)
+			So(err, ShouldBeNil)
+			So(r.Key, ShouldEqual, "retoucher")
+			So(r.Permissions, ShouldResemble, in.Permissions)
+
+			p, err := perms.Permissions(ctx, []string{r.ID})
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, map[string]bool{"photos.read": true, "photos.write": true})
+
+			Convey("editing it takes effect in the permission cache at once", func() {
+				in.Permissions = []string{"photos.read"}
+				_, err := s.UpdateRole(ctx, "t1", r.ID, admin, in, nil)
+				So(err, ShouldBeNil)
+				p, _ := perms.Permissions(ctx, []string{r.ID})
+				So(p, ShouldResemble, map[string]bool{"photos.read": true})
+			})
+
+			Convey("deleting it does too", func() {
+				So(s.DeleteRole(ctx, "t1", r.ID), ShouldBeNil)
+				p, _ := perms.Permissions(ctx, []string{r.ID})
+				So(p, ShouldBeEmpty)
+			})
+
+			Convey("another tenant can't see or edit it", func() {
+				_, err := s.GetRole(ctx, "t2", r.ID)
+				So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+				_, err = s.UpdateRole(ctx, "t2", r.ID, admin, in, nil)
+				So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			})
+
+			Convey("a failed precondition leaves it unchanged", func() {
+				stale := lumErrors.PreconditionFailedf("stale")
+				_, err := s.UpdateRole(ctx, "t1", r.ID, admin, RoleInput{Permissions: []string{"albums.read"}},
+					func(*Role) error { return stale })
+				So(err, ShouldEqual, stale)
+				So(repo.roles[r.ID].Permissions, ShouldResemble, []string{"photos.read", "photos.write"})
+			})
+		})
+
+		Convey("nobody can grant a permission they don't hold", func() {
+			_, err := s.CreateRole(ctx, "t1", map[string]bool{"photos.read": true}, in)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+		})
+
+		Convey("unknown permissions and reserved keys are rejected", func() {
+			_, err := s.CreateRole(ctx, "t1", admin, RoleInput{Key: "x-1", Permissions: []string{"nope"}})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeValidation), ShouldBeTrue)
+
+			_, err = s.CreateRole(ctx, "t1", admin, RoleInput{Key: "viewer"})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeDuplicateKey), ShouldBeTrue)
+		})
+
+		Convey("the per-tenant role cap is enforced", func() {
+			for _, k := range []string{"one", "two"} {
+				_, err := s.CreateRole(ctx, "t1", admin, RoleInput{Key: k})
+				So(err, ShouldBeNil)
+			}
+			_, err := s.CreateRole(ctx, "t1", admin, RoleInput{Key: "three"})
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeInvalidArgument), ShouldBeTrue)
+		})
+
+		Convey("built-in roles can't be edited or deleted", func() {
+			_, err := s.UpdateRole(ctx, "t1", "viewer", admin, RoleInput{}, nil)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeInvalidArgument), ShouldBeTrue)
+			So(lumErrors.IsErrorCode(s.DeleteRole(ctx, "t1", "viewer"), lumErrors.ErrorCodeInvalidArgument), ShouldBeTrue)
+		})
+
+		Convey("Given a member holding a custom role", func() {
+			r, err := s.CreateRole(ctx, "t1", admin, in)
+			So(err, ShouldBeNil)
+			repo.assignments["t1/u1"] = assignment{builtinKey: "member", roleID: &r.ID}
+
+			Convey("assigning a built-in role clears the custom one", func() {
+				So(s.AssignRole(ctx, "t1", "u1", "viewer", admin), ShouldBeNil)
+				So(repo.assignments["t1/u1"].builtinKey, ShouldEqual, "viewer")
+				So(repo.assignments["t1/u1"].roleID, ShouldBeNil)
+			})
+
+			Convey("a role can't be assigned by someone lacking its permissions", func() {
+				err := s.AssignRole(ctx, "t1", "u1", "viewer", map[string]bool{"albums.read": true})
+				So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePermissionDenied), ShouldBeTrue)
+			})
+
+			Convey("non-members can't be assigned anything", func() {
+				So(lumErrors.IsErrorCode(s.AssignRole(ctx, "t1", "u2", "viewer", admin), lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,285 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTx = func(ctx context.Context, b store.Beginner, fn func(q store.Queryer) error) error {
+		return store.WithTx(ctx, b, fn)
+	}
+)
+
+// keyRe mirrors the auth_roles.key CHECK constraint
+var keyRe = regexp.MustCompile(`^[a-z0-9-]{2,64}$`)
+
+// RoleInput is the service contract for creating or replacing a custom role
+type RoleInput struct {
+	Key         string
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// Service defines the role management operations exposed to HTTP handlers.
+// granted is the caller's own permission set: nobody can hand out permissions they don't hold
+type Service interface {
+	// Config returns the runtime configuration used by the service.
+	Config() Config
+
+	// ListPermissions returns the permission catalogue
+	ListPermissions(ctx context.Context) ([]Permission, error)
+
+	// ListRoles returns the built-in roles and the tenant's custom roles
+	ListRoles(ctx context.Context, tenantID string) ([]Role, error)
+
+	// GetRole returns a built-in role or one of the tenant's custom roles
+	GetRole(ctx context.Context, tenantID, roleID string) (*Role, error)
+
+	// CreateRole defines a new custom role for the tenant
+	CreateRole(ctx context.Context, tenantID string, granted map[string]bool, in RoleInput) (*Role, error)
+
+	// UpdateRole replaces a custom role's name, description and permissions. check, when set,
+	// vets the current role first, e.g. against an If-Match precondition
+	UpdateRole(
+		ctx context.Context, tenantID, roleID string, granted map[string]bool, in RoleInput, check func(*Role) error,
+	) (*Role, error)
+
+	// DeleteRole removes a custom role; its members fall back to their built-in role
+	DeleteRole(ctx context.Context, tenantID, roleID string) error
+
+	// AssignRole gives a tenant member a role. Access tokens pick it up on the next refresh
+	AssignRole(ctx context.Context, tenantID, userID, roleID string, granted map[string]bool) error
+}
+
+// Config returns the roles config
+func (s *svc) Config() Config {
+	return s.Cfg
+}
+
+// ListPermissions returns the permission catalogue
+func (s *svc) ListPermissions(ctx context.Context) ([]Permission, error) {
+	ps, err := s.Repo.ListPermissions(ctx, s.DB)
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list permissions")
+	}
+	return ps, nil
+}
+
+// ListRoles returns the built-in roles and the tenant's custom roles
+func (s *svc) ListRoles(ctx context.Context, tenantID string) ([]Role, error) {
+	rs, err := s.Repo.ListRoles(ctx, s.DB, tenantID)
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list roles")
+	}
+	return rs, nil
+}
+
+// GetRole returns a built-in role or one of the tenant's custom roles
+func (s *svc) GetRole(ctx context.Context, tenantID, roleID string) (*Role, error) {
+	return s.getRole(ctx, s.DB, tenantID, roleID)
+}
+
+// CreateRole defines a new custom role for the tenant
+func (s *svc) CreateRole(
+	ctx context.Context,
+	tenantID string,
+	granted map[string]bool,
+	in RoleInput,
+) (*Role, error) {
+	if tenantID == "" {
+		return nil, lumErrors.InvalidArgf("tenant required")
+	}
+	in.Key = strings.ToLower(strings.TrimSpace(in.Key))
+	if !keyRe.MatchString(in.Key) {
+		return nil, lumErrors.NewValidationError(
+			lumErrors.ErrorCodeValidation, "key must be 2-64 lowercase letters, digits or dashes", "key")
+	}
+	if err := s.checkPermissions(ctx, granted, in.Permissions); err != nil {
+		return nil, err
+	}
+
+	var role *Role
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		taken, err := s.Repo.BuiltInKeyExists(ctx, q, in.Key)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "check key")
+		}
+		if taken {
+			return lumErrors.DuplicateKeyFieldf("key", "key is reserved by a built-in role")
+		}
+		n, err := s.Repo.CountTenantRoles(ctx, q, tenantID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "count roles")
+		}
+		if n >= s.Cfg.MaxRolesPerTenant {
+			return lumErrors.InvalidArgf("tenant already has %d custom roles", n)
+		}
+
+		id, err := s.Repo.InsertRole(ctx, q, tenantID, in.Key, strings.TrimSpace(in.Name), in.Description)
+		if err != nil {
+			if c := lumErrors.DBErrorCode(err); c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+				return lumErrors.DuplicateKeyFieldf("key", "role key already exists")
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create role")
+		}
+		if err := s.Repo.SetRolePermissions(ctx, q, id, in.Permissions); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "set permissions")
+		}
+		role, err = s.getRole(ctx, q, tenantID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole replaces a custom role's name, description and permissions. The row is locked
+// before check runs, so a concurrent update can't slip in between the check and the write
+func (s *svc) UpdateRole(
+	ctx context.Context,
+	tenantID, roleID string,
+	granted map[string]bool,
+	in RoleInput,
+	check func(*Role) error,
+) (*Role, error) {
+	if err := s.checkPermissions(ctx, granted, in.Permissions); err != nil {
+		return nil, err
+	}
+
+	var role *Role
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		// built-in roles have no tenant, so they aren't found to lock
+		if err := s.Repo.LockRole(ctx, q, tenantID, roleID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "lock role")
+		}
+		cur, err := s.getRole(ctx, q, tenantID, roleID)
+		if err != nil {
+			return err
+		}
+		if cur.BuiltIn {
+			return lumErrors.InvalidArgf("built-in roles cannot be modified")
+		}
+		if check != nil {
+			if err := check(cur); err != nil {
+				return err
+			}
+		}
+		if err := s.Repo.UpdateRole(ctx, q, tenantID, roleID, strings.TrimSpace(in.Name), in.Description); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update role")
+		}
+		if err := s.Repo.SetRolePermissions(ctx, q, roleID, in.Permissions); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "set permissions")
+		}
+		role, err = s.getRole(ctx, q, tenantID, roleID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(roleID)
+	return role, nil
+}
+
+// DeleteRole removes a custom role; its members fall back to their built-in role
+func (s *svc) DeleteRole(ctx context.Context, tenantID, roleID string) error {
+	cur, err := s.getRole(ctx, s.DB, tenantID, roleID)
+	if err != nil {
+		return err
+	}
+	if cur.BuiltIn {
+		return lumErrors.InvalidArgf("built-in roles cannot be deleted")
+	}
+	ok, err := s.Repo.DeleteRole(ctx, s.DB, tenantID, roleID)
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "delete role")
+	}
+	if !ok {
+		return lumErrors.NotFoundf("role not found")
+	}
+	s.invalidate(roleID)
+	return nil
+}
+
+// AssignRole gives a tenant member a role. Access tokens pick it up on the next refresh
+func (s *svc) AssignRole(
+	ctx context.Context,
+	tenantID, userID, roleID string,
+	granted map[string]bool,
+) error {
+	role, err := s.getRole(ctx, s.DB, tenantID, roleID)
+	if err != nil {
+		return err
+	}
+	// assigning a role hands out its permissions, so the same escalation rule applies
+	for _, code := range role.Permissions {
+		if !granted[code] {
+			return lumErrors.PermissionDeniedf("forbidden: cannot grant %s", code)
+		}
+	}
+
+	var (
+		builtinKey string
+		customID   *string
+	)
+	if role.BuiltIn {
+		builtinKey = role.Key
+	} else {
+		customID = &role.ID
+	}
+	ok, err := s.Repo.AssignRole(ctx, s.DB, tenantID, userID, builtinKey, customID)
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "assign role")
+	}
+	if !ok {
+		return lumErrors.NotFoundf("member not found")
+	}
+	return nil
+}
+
+// getRole maps "no such role" to a NotFound domain error
+func (s *svc) getRole(ctx context.Context, q store.Queryer, tenantID, roleID string) (*Role, error) {
+	role, err := s.Repo.GetRole(ctx, q, tenantID, roleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, lumErrors.NotFoundf("role not found")
+	}
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "get role")
+	}
+	return role, nil
+}
+
+// checkPermissions rejects unknown codes and codes the caller doesn't hold themselves
+func (s *svc) checkPermissions(ctx context.Context, granted map[string]bool, codes []string) error {
+	known, err := s.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if !slices.ContainsFunc(known, func(p Permission) bool { return p.Code == code }) {
+			return lumErrors.NewValidationError(
+				lumErrors.ErrorCodeValidation, "unknown permission: "+code, "permissions")
+		}
+		if !granted[code] {
+			return lumErrors.PermissionDeniedf("forbidden: cannot grant %s", code)
+		}
+	}
+	return nil
+}
+
+func (s *svc) invalidate(roleID string) {
+	if s.perms != nil {
+		s.perms.Invalidate(roleID)
+	}
+}
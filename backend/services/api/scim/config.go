@@ -0,0 +1,32 @@
+package scim
+
+import (
+	"strings"
+
+	"lumium/lib/config"
+)
+
+// Config is the configuration wrapper for SCIM provisioning
+type Config struct {
+	// BaseURL is the externally visible SCIM root used in meta.location, e.g.
+	// https://api.lumium.test/scim/v2. Empty renders relative locations
+	BaseURL     string
+	DefaultRole string
+	MaxResults  int
+}
+
+// LoadConfig returns the configuration wrapper for SCIM
+func LoadConfig() Config {
+	c := Config{
+		BaseURL:     strings.TrimRight(config.MayString("SCIM_BASE_URL", "/scim/v2"), "/"),
+		DefaultRole: config.MayString("SCIM_DEFAULT_ROLE", roleMember),
+		MaxResults:  config.MayInt("SCIM_MAX_RESULTS", 200),
+	}
+	if !validRole(c.DefaultRole) {
+		c.DefaultRole = roleMember
+	}
+	if c.MaxResults <= 0 {
+		c.MaxResults = 200
+	}
+	return c
+}
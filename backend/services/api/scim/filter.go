@@ -0,0 +1,75 @@
+package scim
+
+import (
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+)
+
+// Filter is the subset of SCIM filtering identity providers actually use for reconciliation:
+// equality on userName/emails and externalId, optionally joined with "and"
+type Filter struct {
+	UserName   string
+	ExternalID string
+}
+
+// parseFilter parses expressions like `userName eq "a@b.c" and externalId eq "00u1"`.
+// Anything outside that subset is rejected so we never silently return unfiltered results
+func parseFilter(raw string) (Filter, error) {
+	var f Filter
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return f, nil
+	}
+
+	for _, clause := range splitAnd(raw) {
+		attr, rest, ok := strings.Cut(strings.TrimSpace(clause), " ")
+		if !ok {
+			return f, invalidFilter(raw)
+		}
+		op, val, ok := strings.Cut(strings.TrimSpace(rest), " ")
+		if !ok || !strings.EqualFold(op, "eq") {
+			return f, invalidFilter(raw)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) < 2 || val[0] != '"' || val[len(val)-1] != '"' {
+			return f, invalidFilter(raw)
+		}
+		val = strings.ReplaceAll(val[1:len(val)-1], `\"`, `"`)
+
+		switch strings.ToLower(attr) {
+		case "username", "emails.value":
+			f.UserName = strings.ToLower(val)
+		case "externalid":
+			f.ExternalID = val
+		default:
+			return f, invalidFilter(raw)
+		}
+	}
+	return f, nil
+}
+
+// splitAnd splits on " and " outside of quoted values
+func splitAnd(s string) []string {
+	var (
+		out     []string
+		inQuote bool
+		start   int
+	)
+	lower := strings.ToLower(s)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"' && (i == 0 || s[i-1] != '\\'):
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(lower[i:], " and "):
+			out = append(out, s[start:i])
+			start = i + len(" and ")
+			i += len(" and ") - 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+func invalidFilter(raw string) error {
+	return lumErrors.WithField(lumErrors.InvalidArgf("unsupported filter: %s", raw), "invalidFilter")
+}
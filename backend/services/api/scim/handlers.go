@@ -0,0 +1,343 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+// ctx key for the tenant resolved from the API token
+type ctxKey uint8
+
+const (
+	tenantKey ctxKey = iota
+)
+
+// maxBody caps SCIM request bodies; group PUTs with thousands of members stay well under this
+const maxBody = 4 << 20
+
+// requireTenantToken authenticates `Authorization: Bearer <tenant api token>`
+func (h *SCIM) requireTenantToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authz := strings.TrimSpace(r.Header.Get("Authorization"))
+		if !strings.HasPrefix(strings.ToLower(authz), "bearer ") {
+			writeError(w, http.StatusUnauthorized, "", "unauthorized")
+			return
+		}
+		tenantID, err := h.svc.AuthenticateToken(r.Context(), authz[7:])
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "", "unauthorized")
+			return
+		}
+		logger.Update(r.Context(), func(c zerolog.Context) zerolog.Context { return c.Str("tenant_id", tenantID) })
+		ctx := context.WithValue(r.Context(), tenantKey, tenantID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func tenantFrom(r *http.Request) string {
+	t, _ := r.Context().Value(tenantKey).(string)
+	return t
+}
+
+// ServiceProviderConfig advertises what this SCIM server supports
+func (h *SCIM) ServiceProviderConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaSPConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": h.svc.Config().MaxResults},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Tenant API token",
+			"description": "Bearer token minted at /api/v1/scim/tokens",
+			"primary":     true,
+		}},
+	})
+}
+
+// ResourceTypes lists the resource types we serve
+func (h *SCIM) ResourceTypes(w http.ResponseWriter, _ *http.Request) {
+	base := h.svc.Config().BaseURL
+	types := []map[string]any{
+		{
+			"schemas": []string{schemaResourceType}, "id": "User", "name": "User",
+			"endpoint": "/Users", "schema": schemaUser,
+			"meta": Meta{ResourceType: "ResourceType", Location: base + "/ResourceTypes/User"},
+		},
+		{
+			"schemas": []string{schemaResourceType}, "id": "Group", "name": "Group",
+			"endpoint": "/Groups", "schema": schemaGroup,
+			"meta": Meta{ResourceType: "ResourceType", Location: base + "/ResourceTypes/Group"},
+		},
+	}
+	writeJSON(w, http.StatusOK, ListResponse[map[string]any]{
+		Schemas: []string{schemaListResponse}, TotalResults: len(types),
+		StartIndex: 1, ItemsPerPage: len(types), Resources: types,
+	})
+}
+
+// Schemas lists the schema URNs we implement (attribute definitions are the RFC 7643 core)
+func (h *SCIM) Schemas(w http.ResponseWriter, _ *http.Request) {
+	schemas := []map[string]any{
+		{"id": schemaUser, "name": "User"},
+		{"id": schemaGroup, "name": "Group"},
+	}
+	writeJSON(w, http.StatusOK, ListResponse[map[string]any]{
+		Schemas: []string{schemaListResponse}, TotalResults: len(schemas),
+		StartIndex: 1, ItemsPerPage: len(schemas), Resources: schemas,
+	})
+}
+
+// ListUsers handles GET /Users with filter, startIndex and count
+func (h *SCIM) ListUsers(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	start := queryInt(r, "startIndex", 1)
+	count := queryInt(r, "count", h.svc.Config().MaxResults)
+
+	users, total, err := h.svc.ListUsers(r.Context(), tenantFrom(r), f, start, count)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	if start < 1 {
+		start = 1
+	}
+	writeJSON(w, http.StatusOK, ListResponse[User]{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	})
+}
+
+// GetUser handles GET /Users/{id}
+func (h *SCIM) GetUser(w http.ResponseWriter, r *http.Request) {
+	u, err := h.svc.GetUser(r.Context(), tenantFrom(r), chi.URLParam(r, "id"))
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// CreateUser handles POST /Users
+func (h *SCIM) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in User
+	if err := decode(r, &in); err != nil {
+		renderError(w, err)
+		return
+	}
+	u, err := h.svc.CreateUser(r.Context(), tenantFrom(r), in)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	w.Header().Set("Location", u.Meta.Location)
+	writeJSON(w, http.StatusCreated, u)
+}
+
+// ReplaceUser handles PUT /Users/{id}
+func (h *SCIM) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var in User
+	if err := decode(r, &in); err != nil {
+		renderError(w, err)
+		return
+	}
+	u, err := h.svc.ReplaceUser(r.Context(), tenantFrom(r), chi.URLParam(r, "id"), in)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// PatchUser handles PATCH /Users/{id}
+func (h *SCIM) PatchUser(w http.ResponseWriter, r *http.Request) {
+	var in PatchRequest
+	if err := decode(r, &in); err != nil {
+		renderError(w, err)
+		return
+	}
+	u, err := h.svc.PatchUser(r.Context(), tenantFrom(r), chi.URLParam(r, "id"), in.Operations)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// DeleteUser handles DELETE /Users/{id}
+func (h *SCIM) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteUser(r.Context(), tenantFrom(r), chi.URLParam(r, "id")); err != nil {
+		renderError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListGroups handles GET /Groups. Filters are accepted on displayName only
+func (h *SCIM) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.svc.ListGroups(r.Context(), tenantFrom(r))
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	if raw := strings.TrimSpace(r.URL.Query().Get("filter")); raw != "" {
+		name, ok := displayNameFilter(raw)
+		if !ok {
+			renderError(w, invalidFilter(raw))
+			return
+		}
+		kept := groups[:0]
+		for _, g := range groups {
+			if strings.EqualFold(g.DisplayName, name) {
+				kept = append(kept, g)
+			}
+		}
+		groups = kept
+	}
+	writeJSON(w, http.StatusOK, ListResponse[Group]{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: len(groups),
+		StartIndex:   1,
+		ItemsPerPage: len(groups),
+		Resources:    groups,
+	})
+}
+
+// GetGroup handles GET /Groups/{id}
+func (h *SCIM) GetGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.svc.GetGroup(r.Context(), tenantFrom(r), chi.URLParam(r, "id"))
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// ReplaceGroup handles PUT /Groups/{id}
+func (h *SCIM) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var in Group
+	if err := decode(r, &in); err != nil {
+		renderError(w, err)
+		return
+	}
+	g, err := h.svc.ReplaceGroup(r.Context(), tenantFrom(r), chi.URLParam(r, "id"), in)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// PatchGroup handles PATCH /Groups/{id}
+func (h *SCIM) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var in PatchRequest
+	if err := decode(r, &in); err != nil {
+		renderError(w, err)
+		return
+	}
+	g, err := h.svc.PatchGroup(r.Context(), tenantFrom(r), chi.URLParam(r, "id"), in.Operations)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// displayNameFilter parses `displayName eq "admin"`
+func displayNameFilter(raw string) (string, bool) {
+	attr, rest, ok := strings.Cut(raw, " ")
+	if !ok || !strings.EqualFold(attr, "displayName") {
+		return "", false
+	}
+	op, val, ok := strings.Cut(strings.TrimSpace(rest), " ")
+	val = strings.TrimSpace(val)
+	if !ok || !strings.EqualFold(op, "eq") || len(val) < 2 || val[0] != '"' || val[len(val)-1] != '"' {
+		return "", false
+	}
+	return val[1 : len(val)-1], true
+}
+
+// decode reads a SCIM JSON body. Unknown attributes are allowed: IdPs send extension schemas
+func decode(r *http.Request, dst any) error {
+	defer r.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(dst); err != nil {
+		return lumErrors.WithField(lumErrors.JSONErrf("invalid JSON: %v", err), "invalidSyntax")
+	}
+	return nil
+}
+
+func queryInt(r *http.Request, key string, def int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get(key)))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// renderError maps domain errors onto SCIM error messages (RFC 7644 §3.12)
+func renderError(w http.ResponseWriter, err error) {
+	var e *lumErrors.Error
+	if !lumnet.As(err, &e) {
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+		return
+	}
+
+	switch e.Code() {
+	case lumErrors.ErrorCodeNotFound:
+		writeError(w, http.StatusNotFound, "", e.Message())
+	case lumErrors.ErrorCodeDuplicateKey:
+		writeError(w, http.StatusConflict, "uniqueness", e.Message())
+	case lumErrors.ErrorCodeValidation:
+		writeError(w, http.StatusBadRequest, "invalidValue", e.Message())
+	case lumErrors.ErrorCodeJSON:
+		writeError(w, http.StatusBadRequest, "invalidSyntax", e.Message())
+	case lumErrors.ErrorCodeInvalidArgument:
+		scimType := ""
+		if f := e.Field(); f == "invalidFilter" || f == "mutability" {
+			scimType = f
+		}
+		writeError(w, http.StatusBadRequest, scimType, e.Message())
+	case lumErrors.ErrorCodeUnauthenticated, lumErrors.ErrorCodePermissionDenied,
+		lumErrors.ErrorCodePayloadTooLarge, lumErrors.ErrorCodePreconditionFailed:
+		writeError(w, lumErrors.HTTPStatusCode(e.Code()), "", e.Message())
+	default:
+		// don't leak SQL details to the IdP
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(w, status, ErrorWire{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
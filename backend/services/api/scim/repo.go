@@ -0,0 +1,441 @@
+package scim
+
+import (
+	"context"
+
+	"lumium/lib/store"
+)
+
+// Repo is the SCIM data-access interface. Implementations read/write tenant memberships, users
+// and tenant API tokens via a store.Queryer.
+type Repo interface {
+	// FindAPIToken returns (tokenID, tenantID) for an unrevoked token hash carrying scope.
+	FindAPIToken(ctx context.Context, q store.Queryer, tokenHash, scope string) (
+		tokenID, tenantID string, err error)
+
+	// TouchAPIToken bumps last_used_at for a token.
+	TouchAPIToken(ctx context.Context, q store.Queryer, tokenID string) error
+
+	// InsertAPIToken stores a hashed token for the tenant and returns it.
+	InsertAPIToken(
+		ctx context.Context,
+		q store.Queryer,
+		tenantID, name, tokenHash, createdBy string,
+	) (*APIToken, error)
+
+	// ListAPITokens returns the tenant's unrevoked tokens, newest first.
+	ListAPITokens(ctx context.Context, q store.Queryer, tenantID string) ([]APIToken, error)
+
+	// RevokeAPIToken revokes a tenant token (idempotent). Returns false if no such token.
+	RevokeAPIToken(ctx context.Context, q store.Queryer, tenantID, tokenID string) (bool, error)
+
+	// ListMembers returns a page of tenant members matching f, plus the total match count.
+	ListMembers(
+		ctx context.Context,
+		q store.Queryer,
+		tenantID string,
+		f Filter,
+		offset, limit int,
+	) ([]member, int, error)
+
+	// ListRoleMembers returns all tenant members holding role.
+	ListRoleMembers(ctx context.Context, q store.Queryer, tenantID, role string) ([]member, error)
+
+	// GetMember returns one tenant member, or pgx.ErrNoRows.
+	GetMember(ctx context.Context, q store.Queryer, tenantID, userID string) (*member, error)
+
+	// FindUserIDByEmail returns the user ID for a normalized email, or pgx.ErrNoRows.
+	FindUserIDByEmail(ctx context.Context, q store.Queryer, email string) (string, error)
+
+	// InsertUser creates a user without a usable password and returns its ID.
+	InsertUser(ctx context.Context, q store.Queryer, email, name string) (string, error)
+
+	// InOtherTenants reports whether the user belongs to any tenant besides tenantID.
+	InOtherTenants(ctx context.Context, q store.Queryer, tenantID, userID string) (bool, error)
+
+	// UpdateUser replaces the user's email and display name.
+	UpdateUser(ctx context.Context, q store.Queryer, userID, email, name string) error
+
+	// SetMemberActive toggles the user's membership of the tenant (users_tenants.is_active).
+	SetMemberActive(ctx context.Context, q store.Queryer, tenantID, userID string, active bool) error
+
+	// InsertMembership adds the user to the tenant with role and external ID.
+	InsertMembership(
+		ctx context.Context,
+		q store.Queryer,
+		tenantID, userID, role, externalID string,
+	) error
+
+	// SetExternalID sets (or clears, when empty) the member's external ID.
+	SetExternalID(ctx context.Context, q store.Queryer, tenantID, userID, externalID string) error
+
+	// SetMemberRole changes the member's built-in role within the tenant, dropping any custom
+	// role so the new one takes effect.
+	SetMemberRole(ctx context.Context, q store.Queryer, tenantID, userID, role string) error
+
+	// DeleteMembership removes the user from the tenant.
+	DeleteMembership(ctx context.Context, q store.Queryer, tenantID, userID string) error
+
+	// RevokeSessions revokes the user's active sessions in the tenant.
+	RevokeSessions(ctx context.Context, q store.Queryer, userID, tenantID string) error
+}
+
+// memberColumns is the select list scanned by scanMember
+const memberColumns = `u.id::text, u.email, COALESCE(u.name,''), COALESCE(ut.external_id,''),
+	ut.is_active, ut.role::text, u.created_at, u.updated_at`
+
+type rowScanner interface{ Scan(dest ...any) error }
+
+func scanMember(row rowScanner) (*member, error) {
+	var m member
+	err := row.Scan(
+		&m.UserID, &m.Email, &m.Name, &m.ExternalID,
+		&m.Active, &m.Role, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// FindAPIToken returns (tokenID, tenantID) for an unrevoked token hash carrying scope.
+func (r *repo) FindAPIToken(
+	ctx context.Context,
+	q store.Queryer,
+	tokenHash string,
+	scope string,
+) (string, string, error) {
+	var id, tid string
+	err := q.QueryRow(
+		ctx,
+		`SELECT id::text, tenant_id::text FROM tenant_api_tokens
+		  WHERE token_hash=$1 AND revoked_at IS NULL AND $2 = ANY(scopes)`,
+		tokenHash,
+		scope,
+	).Scan(&id, &tid)
+	return id, tid, err
+}
+
+// TouchAPIToken bumps last_used_at for a token.
+func (r *repo) TouchAPIToken(ctx context.Context, q store.Queryer, tokenID string) error {
+	_, err := q.Exec(ctx, `UPDATE tenant_api_tokens SET last_used_at=NOW() WHERE id=$1`, tokenID)
+	return err
+}
+
+// InsertAPIToken stores a hashed token for the tenant and returns it.
+func (r *repo) InsertAPIToken(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	name string,
+	tokenHash string,
+	createdBy string,
+) (*APIToken, error) {
+	t := APIToken{TenantID: tenantID, Name: name}
+	err := q.QueryRow(
+		ctx,
+		`INSERT INTO tenant_api_tokens (tenant_id, name, token_hash, created_by)
+		 VALUES ($1, $2, $3, NULLIF($4,'')::uuid)
+		 RETURNING id::text, created_at`,
+		tenantID,
+		name,
+		tokenHash,
+		createdBy,
+	).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListAPITokens returns the tenant's unrevoked tokens, newest first.
+func (r *repo) ListAPITokens(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+) ([]APIToken, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT id::text, tenant_id::text, name, created_at, last_used_at
+		   FROM tenant_api_tokens
+		  WHERE tenant_id=$1 AND revoked_at IS NULL
+		  ORDER BY created_at DESC`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.TenantID, &t.Name, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIToken revokes a tenant token (idempotent).
+func (r *repo) RevokeAPIToken(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	tokenID string,
+) (bool, error) {
+	tag, err := q.Exec(
+		ctx,
+		`UPDATE tenant_api_tokens SET revoked_at=COALESCE(revoked_at, NOW())
+		  WHERE id::text=$2 AND tenant_id=$1`,
+		tenantID,
+		tokenID,
+	)
+	return tag.RowsAffected() > 0, err
+}
+
+// ListMembers returns a page of tenant members matching f, plus the total match count.
+func (r *repo) ListMembers(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	f Filter,
+	offset int,
+	limit int,
+) ([]member, int, error) {
+	const where = `
+		  FROM users_tenants ut JOIN users u ON u.id = ut.user_id
+		 WHERE ut.tenant_id=$1
+		   AND ($2='' OR u.email=LOWER($2))
+		   AND ($3='' OR ut.external_id=$3)`
+
+	var total int
+	if err := q.QueryRow(
+		ctx, `SELECT COUNT(*)`+where, tenantID, f.UserName, f.ExternalID,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit == 0 || total == 0 {
+		return nil, total, nil
+	}
+
+	rows, err := q.Query(
+		ctx,
+		`SELECT `+memberColumns+where+` ORDER BY u.created_at, u.id OFFSET $4 LIMIT $5`,
+		tenantID,
+		f.UserName,
+		f.ExternalID,
+		offset,
+		limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var out []member
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, *m)
+	}
+	return out, total, rows.Err()
+}
+
+// ListRoleMembers returns all tenant members holding role.
+func (r *repo) ListRoleMembers(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	role string,
+) ([]member, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT `+memberColumns+`
+		   FROM users_tenants ut JOIN users u ON u.id = ut.user_id
+		  WHERE ut.tenant_id=$1 AND ut.role::text=$2
+		  ORDER BY u.created_at, u.id`,
+		tenantID,
+		role,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []member
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
+
+// GetMember returns one tenant member, or pgx.ErrNoRows.
+func (r *repo) GetMember(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	userID string,
+) (*member, error) {
+	return scanMember(q.QueryRow(
+		ctx,
+		`SELECT `+memberColumns+`
+		   FROM users_tenants ut JOIN users u ON u.id = ut.user_id
+		  WHERE ut.tenant_id=$1 AND ut.user_id::text=$2`,
+		tenantID,
+		userID,
+	))
+}
+
+// FindUserIDByEmail returns the user ID for a normalized email.
+func (r *repo) FindUserIDByEmail(ctx context.Context, q store.Queryer, email string) (string, error) {
+	var id string
+	err := q.QueryRow(ctx, `SELECT id::text FROM users WHERE email = LOWER($1)`, email).Scan(&id)
+	return id, err
+}
+
+// InsertUser creates a user without a usable password ('!' never parses as a PHC hash);
+// provisioned users sign in through SSO or set a password via the reset flow.
+func (r *repo) InsertUser(ctx context.Context, q store.Queryer, email, name string) (string, error) {
+	var id string
+	err := q.QueryRow(
+		ctx,
+		`INSERT INTO users (email, password_hash, name)
+		 VALUES (LOWER($1), '!', NULLIF($2,''))
+		 RETURNING id::text`,
+		email,
+		name,
+	).Scan(&id)
+	return id, err
+}
+
+// InOtherTenants reports whether the user belongs to any tenant besides tenantID.
+func (r *repo) InOtherTenants(ctx context.Context, q store.Queryer, tenantID, userID string) (bool, error) {
+	var ok bool
+	err := q.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM users_tenants WHERE user_id=$2 AND tenant_id<>$1)`,
+		tenantID,
+		userID,
+	).Scan(&ok)
+	return ok, err
+}
+
+// UpdateUser replaces the user's email and display name.
+func (r *repo) UpdateUser(ctx context.Context, q store.Queryer, userID, email, name string) error {
+	_, err := q.Exec(
+		ctx,
+		`UPDATE users SET email=LOWER($2), name=NULLIF($3,''), updated_at=NOW() WHERE id=$1`,
+		userID,
+		email,
+		name,
+	)
+	return err
+}
+
+// SetMemberActive toggles the user's membership of the tenant. The account itself, and its
+// memberships elsewhere, are left alone.
+func (r *repo) SetMemberActive(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	userID string,
+	active bool,
+) error {
+	_, err := q.Exec(
+		ctx,
+		`UPDATE users_tenants SET is_active=$3 WHERE tenant_id=$1 AND user_id=$2 AND is_active<>$3`,
+		tenantID,
+		userID,
+		active,
+	)
+	return err
+}
+
+// InsertMembership adds the user to the tenant with role and external ID.
+func (r *repo) InsertMembership(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	userID string,
+	role string,
+	externalID string,
+) error {
+	_, err := q.Exec(
+		ctx,
+		`INSERT INTO users_tenants (user_id, tenant_id, role, external_id)
+		 VALUES ($1, $2, $3::role_enum, NULLIF($4,''))`,
+		userID,
+		tenantID,
+		role,
+		externalID,
+	)
+	return err
+}
+
+// SetExternalID sets (or clears, when empty) the member's external ID.
+func (r *repo) SetExternalID(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	userID string,
+	externalID string,
+) error {
+	_, err := q.Exec(
+		ctx,
+		`UPDATE users_tenants SET external_id=NULLIF($3,'') WHERE tenant_id=$1 AND user_id=$2`,
+		tenantID,
+		userID,
+		externalID,
+	)
+	return err
+}
+
+// SetMemberRole changes the member's built-in role within the tenant. A custom role would
+// otherwise keep granting its permissions, so it's cleared in the same statement.
+func (r *repo) SetMemberRole(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID string,
+	userID string,
+	role string,
+) error {
+	_, err := q.Exec(
+		ctx,
+		`UPDATE users_tenants SET role=$3::role_enum, role_id=NULL WHERE tenant_id=$1 AND user_id::text=$2`,
+		tenantID,
+		userID,
+		role,
+	)
+	return err
+}
+
+// DeleteMembership removes the user from the tenant.
+func (r *repo) DeleteMembership(ctx context.Context, q store.Queryer, tenantID, userID string) error {
+	_, err := q.Exec(
+		ctx,
+		`DELETE FROM users_tenants WHERE tenant_id=$1 AND user_id=$2`,
+		tenantID,
+		userID,
+	)
+	return err
+}
+
+// RevokeSessions revokes the user's active sessions in the tenant.
+func (r *repo) RevokeSessions(ctx context.Context, q store.Queryer, userID, tenantID string) error {
+	_, err := q.Exec(
+		ctx,
+		`UPDATE auth_sessions SET revoked_at=NOW()
+		  WHERE user_id=$1 AND revoked_at IS NULL AND tenant_id=$2`,
+		userID,
+		tenantID,
+	)
+	return err
+}
@@ -0,0 +1,85 @@
+// Package scim implements SCIM 2.0 (RFC 7643/7644) user & group provisioning for tenants.
+// Identity providers authenticate with a tenant API token; groups map onto role_enum
+package scim
+
+import (
+	"lumium/lib/lumnet"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+func NewService(db *pgxpool.Pool, c Config, o ...svckit.Opt[*pgxpool.Pool, Repo, Config]) Service {
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...)}
+}
+
+// SCIM is the wrapper for the /scim/v2 protocol endpoints
+type SCIM struct {
+	app *handlers.App
+	svc Service
+}
+
+// Tokens is the wrapper for the /scim/tokens management endpoints (tenant admins only)
+type Tokens struct {
+	svc     Service
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new SCIM pointer
+func New(app *handlers.App) *SCIM {
+	return &SCIM{app: app, svc: NewService(app.DB, LoadConfig())}
+}
+
+// NewTokens creates the token management resource
+func NewTokens(app *handlers.App, perms auth.PermissionResolver) *Tokens {
+	return &Tokens{svc: NewService(app.DB, LoadConfig()), authCfg: auth.LoadConfig(), perms: perms}
+}
+
+// Wire defines the SCIM endpoint structure. Mount it at /scim/v2
+func (h *SCIM) Wire(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(h.requireTenantToken)
+
+		r.Get("/ServiceProviderConfig", h.ServiceProviderConfig)
+		r.Get("/ResourceTypes", h.ResourceTypes)
+		r.Get("/Schemas", h.Schemas)
+
+		r.Get("/Users", h.ListUsers)
+		r.Post("/Users", h.CreateUser)
+		r.Get("/Users/{id}", h.GetUser)
+		r.Put("/Users/{id}", h.ReplaceUser)
+		r.Patch("/Users/{id}", h.PatchUser)
+		r.Delete("/Users/{id}", h.DeleteUser)
+
+		r.Get("/Groups", h.ListGroups)
+		r.Get("/Groups/{id}", h.GetGroup)
+		r.Put("/Groups/{id}", h.ReplaceGroup)
+		r.Patch("/Groups/{id}", h.PatchGroup)
+	})
+}
+
+// Wire defines the token management endpoints. Mount it under /api/v1
+func (h *Tokens) Wire(r chi.Router) {
+	r.Route("/scim/tokens", func(r chi.Router) {
+		r.Use(auth.Authenticate(h.authCfg), auth.RequirePermission(h.perms, "scim.manage"))
+		r.Get("/", lumnet.Adapt(h.List))
+		r.Post("/", lumnet.Adapt(h.Create))
+		r.Delete("/{id}", lumnet.Adapt(h.Revoke))
+	})
+	lumnet.InitValidator()
+}
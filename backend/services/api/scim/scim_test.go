@@ -0,0 +1,465 @@
+package scim
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeRepo is an in-memory Repo good enough to drive the protocol end to end
+type fakeRepo struct {
+	seq      int
+	users    map[string]*fakeUser
+	members  map[string]map[string]*fakeMember // tenant -> user -> membership
+	tokens   map[string][2]string              // hash -> (tokenID, tenantID)
+	sessions map[string][]string               // userID -> tenants whose sessions were revoked
+}
+
+type fakeUser struct {
+	email, name string
+	active      bool
+}
+
+type fakeMember struct {
+	role, externalID string
+	active           bool
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		users:    map[string]*fakeUser{},
+		members:  map[string]map[string]*fakeMember{},
+		tokens:   map[string][2]string{},
+		sessions: map[string][]string{},
+	}
+}
+
+func (f *fakeRepo) nextID() string {
+	f.seq++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", f.seq)
+}
+
+func (f *fakeRepo) addToken(raw, tenantID string) {
+	sum := sha256.Sum256([]byte(raw))
+	f.tokens[hex.EncodeToString(sum[:])] = [2]string{f.nextID(), tenantID}
+}
+
+func (f *fakeRepo) FindAPIToken(_ context.Context, _ store.Queryer, hash, _ string) (string, string, error) {
+	t, ok := f.tokens[hash]
+	if !ok {
+		return "", "", pgx.ErrNoRows
+	}
+	return t[0], t[1], nil
+}
+
+func (f *fakeRepo) TouchAPIToken(context.Context, store.Queryer, string) error { return nil }
+
+func (f *fakeRepo) InsertAPIToken(
+	_ context.Context,
+	_ store.Queryer,
+	tenantID, name, hash, _ string,
+) (*APIToken, error) {
+	id := f.nextID()
+	f.tokens[hash] = [2]string{id, tenantID}
+	return &APIToken{ID: id, TenantID: tenantID, Name: name, CreatedAt: time.Now()}, nil
+}
+
+func (f *fakeRepo) ListAPITokens(context.Context, store.Queryer, string) ([]APIToken, error) {
+	return nil, nil
+}
+
+func (f *fakeRepo) RevokeAPIToken(context.Context, store.Queryer, string, string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeRepo) member(tenantID, userID string) *member {
+	ms, ok := f.members[tenantID][userID]
+	u, uok := f.users[userID]
+	if !ok || !uok {
+		return nil
+	}
+	return &member{
+		UserID: userID, Email: u.email, Name: u.name, ExternalID: ms.externalID,
+		Active: ms.active, Role: ms.role,
+	}
+}
+
+func (f *fakeRepo) sortedMembers(tenantID string) []member {
+	ids := make([]string, 0, len(f.members[tenantID]))
+	for id := range f.members[tenantID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]member, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, *f.member(tenantID, id))
+	}
+	return out
+}
+
+func (f *fakeRepo) ListMembers(
+	_ context.Context,
+	_ store.Queryer,
+	tenantID string,
+	flt Filter,
+	offset, limit int,
+) ([]member, int, error) {
+	var all []member
+	for _, m := range f.sortedMembers(tenantID) {
+		if flt.UserName != "" && m.Email != flt.UserName {
+			continue
+		}
+		if flt.ExternalID != "" && m.ExternalID != flt.ExternalID {
+			continue
+		}
+		all = append(all, m)
+	}
+	total := len(all)
+	if offset > total {
+		offset = total
+	}
+	end := min(offset+limit, total)
+	return all[offset:end], total, nil
+}
+
+func (f *fakeRepo) ListRoleMembers(_ context.Context, _ store.Queryer, tenantID, role string) ([]member, error) {
+	var out []member
+	for _, m := range f.sortedMembers(tenantID) {
+		if m.Role == role {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetMember(_ context.Context, _ store.Queryer, tenantID, userID string) (*member, error) {
+	if m := f.member(tenantID, userID); m != nil {
+		return m, nil
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeRepo) FindUserIDByEmail(_ context.Context, _ store.Queryer, email string) (string, error) {
+	for id, u := range f.users {
+		if u.email == email {
+			return id, nil
+		}
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (f *fakeRepo) InsertUser(_ context.Context, _ store.Queryer, email, name string) (string, error) {
+	id := f.nextID()
+	f.users[id] = &fakeUser{email: email, name: name, active: true}
+	return id, nil
+}
+
+func (f *fakeRepo) InOtherTenants(_ context.Context, _ store.Queryer, tenantID, userID string) (bool, error) {
+	for tid, ms := range f.members {
+		if _, ok := ms[userID]; ok && tid != tenantID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRepo) UpdateUser(_ context.Context, _ store.Queryer, userID, email, name string) error {
+	f.users[userID].email, f.users[userID].name = email, name
+	return nil
+}
+
+func (f *fakeRepo) SetMemberActive(_ context.Context, _ store.Queryer, tenantID, userID string, active bool) error {
+	f.members[tenantID][userID].active = active
+	return nil
+}
+
+func (f *fakeRepo) InsertMembership(
+	_ context.Context,
+	_ store.Queryer,
+	tenantID, userID, role, externalID string,
+) error {
+	if externalID != "" {
+		for _, ms := range f.members[tenantID] {
+			if ms.externalID == externalID {
+				return &pgconn.PgError{Code: "23505"}
+			}
+		}
+	}
+	if f.members[tenantID] == nil {
+		f.members[tenantID] = map[string]*fakeMember{}
+	}
+	f.members[tenantID][userID] = &fakeMember{role: role, externalID: externalID, active: true}
+	return nil
+}
+
+func (f *fakeRepo) SetExternalID(_ context.Context, _ store.Queryer, tenantID, userID, externalID string) error {
+	f.members[tenantID][userID].externalID = externalID
+	return nil
+}
+
+func (f *fakeRepo) SetMemberRole(_ context.Context, _ store.Queryer, tenantID, userID, role string) error {
+	f.members[tenantID][userID].role = role
+	return nil
+}
+
+func (f *fakeRepo) DeleteMembership(_ context.Context, _ store.Queryer, tenantID, userID string) error {
+	delete(f.members[tenantID], userID)
+	return nil
+}
+
+func (f *fakeRepo) RevokeSessions(_ context.Context, _ store.Queryer, userID, tenantID string) error {
+	f.sessions[userID] = append(f.sessions[userID], tenantID)
+	return nil
+}
+
+const (
+	tokenA  = "token-tenant-a"
+	tokenB  = "token-tenant-b"
+	tenantA = "aaaaaaaa-0000-0000-0000-000000000000"
+	tenantB = "bbbbbbbb-0000-0000-0000-000000000000"
+)
+
+func newTestServer(repo *fakeRepo) http.Handler {
+	withTx = func(_ context.Context, _ store.Beginner, fn func(q store.Queryer) error) error {
+		return fn(nil)
+	}
+	cfg := Config{BaseURL: "/scim/v2", DefaultRole: roleMember, MaxResults: 2}
+	h := &SCIM{svc: NewService(nil, cfg, svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))}
+
+	r := chi.NewRouter()
+	r.Route("/scim/v2", h.Wire)
+	return r
+}
+
+func do(h http.Handler, method, path, token, body string) (*httptest.ResponseRecorder, map[string]any) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec, out
+}
+
+const deactivate = `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],` +
+	`"Operations":[{"op":"replace","value":{"active":false}}]}`
+
+func userBody(email, externalID string) string {
+	return fmt.Sprintf(`{"schemas":[%q],"userName":%q,"externalId":%q,"name":{"formatted":"Test User"},"active":true}`,
+		schemaUser, email, externalID)
+}
+
+// TestSCIM_Conformance walks the RFC 7644 flows identity providers rely on
+func TestSCIM_Conformance(t *testing.T) {
+	Convey("Given a SCIM server with two tenants", t, func() {
+		repo := newFakeRepo()
+		repo.addToken(tokenA, tenantA)
+		repo.addToken(tokenB, tenantB)
+		srv := newTestServer(repo)
+
+		Convey("Requests without a valid tenant token are rejected with a SCIM error", func() {
+			rec, body := do(srv, http.MethodGet, "/scim/v2/Users", "", "")
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			So(body["schemas"], ShouldResemble, []any{schemaError})
+			So(body["status"], ShouldEqual, "401")
+
+			rec, _ = do(srv, http.MethodGet, "/scim/v2/Users", "nope", "")
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("Discovery endpoints describe the server", func() {
+			rec, body := do(srv, http.MethodGet, "/scim/v2/ServiceProviderConfig", tokenA, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Content-Type"), ShouldEqual, contentType)
+			So(body["patch"], ShouldResemble, map[string]any{"supported": true})
+
+			rec, body = do(srv, http.MethodGet, "/scim/v2/ResourceTypes", tokenA, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(body["totalResults"], ShouldEqual, 2)
+		})
+
+		Convey("POST /Users creates a user", func() {
+			rec, body := do(srv, http.MethodPost, "/scim/v2/Users", tokenA, userBody("Alice@Example.com", "ext-1"))
+			So(rec.Code, ShouldEqual, http.StatusCreated)
+			id, _ := body["id"].(string)
+			So(id, ShouldNotBeBlank)
+			So(rec.Header().Get("Location"), ShouldEqual, "/scim/v2/Users/"+id)
+			So(body["userName"], ShouldEqual, "alice@example.com")
+			So(body["externalId"], ShouldEqual, "ext-1")
+			So(body["active"], ShouldEqual, true)
+
+			Convey("a second POST for the same user is a uniqueness conflict", func() {
+				rec, body := do(srv, http.MethodPost, "/scim/v2/Users", tokenA, userBody("alice@example.com", ""))
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				So(body["scimType"], ShouldEqual, "uniqueness")
+			})
+
+			Convey("GET /Users/{id} returns it, but not to another tenant", func() {
+				rec, body := do(srv, http.MethodGet, "/scim/v2/Users/"+id, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["id"], ShouldEqual, id)
+
+				rec, _ = do(srv, http.MethodGet, "/scim/v2/Users/"+id, tokenB, "")
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("filtering by userName and externalId finds it", func() {
+				rec, body := do(srv, http.MethodGet, `/scim/v2/Users?filter=userName+eq+"alice@example.com"`, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["totalResults"], ShouldEqual, 1)
+
+				rec, body = do(srv, http.MethodGet, `/scim/v2/Users?filter=externalId+eq+"missing"`, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["totalResults"], ShouldEqual, 0)
+			})
+
+			Convey("unsupported filters are rejected", func() {
+				rec, body := do(srv, http.MethodGet, `/scim/v2/Users?filter=title+co+"x"`, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(body["scimType"], ShouldEqual, "invalidFilter")
+			})
+
+			Convey("PATCH active=false suspends the membership and revokes its sessions", func() {
+				rec, body := do(srv, http.MethodPatch, "/scim/v2/Users/"+id, tokenA, deactivate)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["active"], ShouldEqual, false)
+				So(repo.members[tenantA][id].active, ShouldBeFalse)
+				So(repo.users[id].active, ShouldBeTrue)
+				So(repo.sessions[id], ShouldResemble, []string{tenantA})
+			})
+
+			Convey("PUT replaces mutable attributes", func() {
+				rec, body := do(srv, http.MethodPut, "/scim/v2/Users/"+id, tokenA, userBody("alice@corp.example", "ext-2"))
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["userName"], ShouldEqual, "alice@corp.example")
+				So(body["externalId"], ShouldEqual, "ext-2")
+			})
+
+			Convey("DELETE removes the membership and revokes tenant sessions", func() {
+				rec, _ := do(srv, http.MethodDelete, "/scim/v2/Users/"+id, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusNoContent)
+				So(repo.sessions[id], ShouldResemble, []string{tenantA})
+
+				rec, _ = do(srv, http.MethodGet, "/scim/v2/Users/"+id, tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("group membership maps onto the tenant role", func() {
+				rec, body := do(srv, http.MethodGet, "/scim/v2/Groups/member", tokenA, "")
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["members"], ShouldHaveLength, 1)
+
+				add := fmt.Sprintf(`{"Operations":[{"op":"add","path":"members","value":[{"value":%q}]}]}`, id)
+				rec, body = do(srv, http.MethodPatch, "/scim/v2/Groups/admin", tokenA, add)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(body["members"], ShouldHaveLength, 1)
+				So(repo.members[tenantA][id].role, ShouldEqual, roleAdmin)
+
+				remove := fmt.Sprintf(`{"Operations":[{"op":"remove","path":"members[value eq \"%s\"]"}]}`, id)
+				rec, _ = do(srv, http.MethodPatch, "/scim/v2/Groups/admin", tokenA, remove)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(repo.members[tenantA][id].role, ShouldEqual, roleViewer)
+			})
+
+			Convey("groups only see members of the caller's tenant", func() {
+				add := fmt.Sprintf(`{"Operations":[{"op":"add","path":"members","value":[{"value":%q}]}]}`, id)
+				rec, _ := do(srv, http.MethodPatch, "/scim/v2/Groups/admin", tokenB, add)
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+				So(repo.members[tenantA][id].role, ShouldEqual, roleMember)
+			})
+		})
+
+		Convey("Given an account that already belongs to tenant B", func() {
+			rec, body := do(srv, http.MethodPost, "/scim/v2/Users", tokenB, userBody("bob@example.com", ""))
+			So(rec.Code, ShouldEqual, http.StatusCreated)
+			id, _ := body["id"].(string)
+
+			Convey("tenant A can't provision it: it has to be invited", func() {
+				rec, body := do(srv, http.MethodPost, "/scim/v2/Users", tokenA, userBody("bob@example.com", ""))
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				So(body["scimType"], ShouldEqual, "uniqueness")
+				So(repo.members[tenantA][id], ShouldBeNil)
+			})
+
+			Convey("once it is also a member of tenant A", func() {
+				So(repo.InsertMembership(context.Background(), nil, tenantA, id, roleMember, ""), ShouldBeNil)
+
+				Convey("tenant A can't change its email or name", func() {
+					rec, body := do(srv, http.MethodPut, "/scim/v2/Users/"+id, tokenA, userBody("mallory@example.com", ""))
+					So(rec.Code, ShouldEqual, http.StatusBadRequest)
+					So(body["scimType"], ShouldEqual, "mutability")
+					So(repo.users[id].email, ShouldEqual, "bob@example.com")
+
+					rename := `{"Operations":[{"op":"replace","path":"displayName","value":"Mallory"}]}`
+					rec, body = do(srv, http.MethodPatch, "/scim/v2/Users/"+id, tokenA, rename)
+					So(rec.Code, ShouldEqual, http.StatusOK)
+					So(body["displayName"], ShouldEqual, "Test User")
+				})
+
+				Convey("deactivating it in tenant A leaves the account and tenant B alone", func() {
+					rec, _ := do(srv, http.MethodPatch, "/scim/v2/Users/"+id, tokenA, deactivate)
+					So(rec.Code, ShouldEqual, http.StatusOK)
+					So(repo.members[tenantA][id].active, ShouldBeFalse)
+					So(repo.members[tenantB][id].active, ShouldBeTrue)
+					So(repo.users[id].active, ShouldBeTrue)
+					So(repo.sessions[id], ShouldResemble, []string{tenantA})
+				})
+			})
+		})
+
+		Convey("an account with no tenant is adopted", func() {
+			uid, _ := repo.InsertUser(context.Background(), nil, "carol@example.com", "Carol")
+			rec, body := do(srv, http.MethodPost, "/scim/v2/Users", tokenA, userBody("carol@example.com", ""))
+			So(rec.Code, ShouldEqual, http.StatusCreated)
+			So(body["id"], ShouldEqual, uid)
+		})
+
+		Convey("startIndex and count paginate the list", func() {
+			for i := range 3 {
+				rec, _ := do(srv, http.MethodPost, "/scim/v2/Users", tokenA,
+					userBody(fmt.Sprintf("user%d@example.com", i), ""))
+				So(rec.Code, ShouldEqual, http.StatusCreated)
+			}
+
+			rec, body := do(srv, http.MethodGet, "/scim/v2/Users?startIndex=1&count=10", tokenA, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(body["totalResults"], ShouldEqual, 3)
+			So(body["itemsPerPage"], ShouldEqual, 2) // capped at MaxResults
+
+			rec, body = do(srv, http.MethodGet, "/scim/v2/Users?startIndex=3&count=2", tokenA, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(body["startIndex"], ShouldEqual, 3)
+			So(body["Resources"], ShouldHaveLength, 1)
+
+			rec, body = do(srv, http.MethodGet, "/scim/v2/Users", tokenB, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(body["totalResults"], ShouldEqual, 0)
+		})
+
+		Convey("unknown groups are 404", func() {
+			rec, _ := do(srv, http.MethodGet, "/scim/v2/Groups/superuser", tokenA, "")
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
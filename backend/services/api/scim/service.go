@@ -0,0 +1,640 @@
+package scim
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/store"
+	"lumium/services/api/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// scopeSCIM is the tenant_api_tokens scope required for the SCIM endpoints
+const scopeSCIM = "scim"
+
+// seams, which are overwritten in tests
+var (
+	withTx = func(ctx context.Context, b store.Beginner, fn func(q store.Queryer) error) error {
+		return store.WithTx(ctx, b, fn)
+	}
+)
+
+// membersPathRe matches `members[value eq "<id>"]` as sent by Azure AD on group removal
+var membersPathRe = regexp.MustCompile(`(?i)^members\[value eq "([^"]+)"\]$`)
+
+// Service defines the SCIM business operations exposed to HTTP handlers.
+// Every operation is scoped to the tenant resolved from the caller's API token.
+type Service interface {
+	// Config returns the runtime configuration used by the service.
+	Config() Config
+
+	// AuthenticateToken resolves a raw tenant API token to its tenant ID
+	AuthenticateToken(ctx context.Context, raw string) (tenantID string, err error)
+
+	// ListUsers returns a page of users (1-based startIndex) and the total match count
+	ListUsers(ctx context.Context, tenantID string, f Filter, startIndex, count int) ([]User, int, error)
+
+	// GetUser returns one user of the tenant
+	GetUser(ctx context.Context, tenantID, id string) (*User, error)
+
+	// CreateUser provisions a user into the tenant, adopting an existing account with the same
+	// email only when no other tenant uses it
+	CreateUser(ctx context.Context, tenantID string, in User) (*User, error)
+
+	// ReplaceUser overwrites the user's mutable attributes (PUT)
+	ReplaceUser(ctx context.Context, tenantID, id string, in User) (*User, error)
+
+	// PatchUser applies PatchOp operations to a user
+	PatchUser(ctx context.Context, tenantID, id string, ops []PatchOp) (*User, error)
+
+	// DeleteUser removes the user from the tenant and revokes their tenant sessions
+	DeleteUser(ctx context.Context, tenantID, id string) error
+
+	// ListGroups returns every role-group with its members
+	ListGroups(ctx context.Context, tenantID string) ([]Group, error)
+
+	// GetGroup returns one role-group with its members
+	GetGroup(ctx context.Context, tenantID, id string) (*Group, error)
+
+	// ReplaceGroup sets the exact member list of a role-group (PUT)
+	ReplaceGroup(ctx context.Context, tenantID, id string, in Group) (*Group, error)
+
+	// PatchGroup adds/removes role-group members
+	PatchGroup(ctx context.Context, tenantID, id string, ops []PatchOp) (*Group, error)
+
+	// CreateToken mints a SCIM API token for the tenant; the raw token is only returned here
+	CreateToken(ctx context.Context, tenantID, name, createdBy string) (raw string, t *APIToken, err error)
+
+	// ListTokens lists the tenant's active API tokens
+	ListTokens(ctx context.Context, tenantID string) ([]APIToken, error)
+
+	// RevokeToken revokes one of the tenant's API tokens
+	RevokeToken(ctx context.Context, tenantID, id string) error
+}
+
+// Config returns the SCIM config
+func (s *svc) Config() Config {
+	return s.Cfg
+}
+
+// AuthenticateToken resolves a raw tenant API token to its tenant ID
+func (s *svc) AuthenticateToken(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", lumErrors.Unauthenticatedf("unauthorized")
+	}
+	sum := sha256.Sum256([]byte(raw))
+	id, tenantID, err := s.Repo.FindAPIToken(ctx, s.DB, hex.EncodeToString(sum[:]), scopeSCIM)
+	if err != nil {
+		return "", lumErrors.Unauthenticatedf("unauthorized")
+	}
+	_ = s.Repo.TouchAPIToken(ctx, s.DB, id)
+	return tenantID, nil
+}
+
+// ListUsers returns a page of users (1-based startIndex) and the total match count
+func (s *svc) ListUsers(
+	ctx context.Context,
+	tenantID string,
+	f Filter,
+	startIndex, count int,
+) ([]User, int, error) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > s.Cfg.MaxResults {
+		count = s.Cfg.MaxResults
+	}
+
+	ms, total, err := s.Repo.ListMembers(ctx, s.DB, tenantID, f, startIndex-1, count)
+	if err != nil {
+		return nil, 0, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list users")
+	}
+	out := make([]User, 0, len(ms))
+	for i := range ms {
+		out = append(out, s.Cfg.toUser(&ms[i]))
+	}
+	return out, total, nil
+}
+
+// GetUser returns one user of the tenant
+func (s *svc) GetUser(ctx context.Context, tenantID, id string) (*User, error) {
+	m, err := s.getMember(ctx, s.DB, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	u := s.Cfg.toUser(m)
+	return &u, nil
+}
+
+// CreateUser provisions a user into the tenant, adopting an existing account with the same
+// email only when no other tenant uses it
+func (s *svc) CreateUser(ctx context.Context, tenantID string, in User) (*User, error) {
+	f := in.fields()
+	if err := validateEmail(f.Email); err != nil {
+		return nil, err
+	}
+	role := f.Role
+	if role == "" {
+		role = s.Cfg.DefaultRole
+	}
+
+	var m *member
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		uid, err := s.Repo.FindUserIDByEmail(ctx, q, f.Email)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			if uid, err = s.Repo.InsertUser(ctx, q, f.Email, f.Name); err != nil {
+				return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create user")
+			}
+		case err != nil:
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "find user")
+		default:
+			if _, err := s.Repo.GetMember(ctx, q, tenantID, uid); err == nil {
+				return lumErrors.DuplicateKeyFieldf("userName", "user already exists in tenant")
+			}
+			// an account another tenant already uses is its owner's to join, not ours to claim
+			shared, err := s.Repo.InOtherTenants(ctx, q, tenantID, uid)
+			if err != nil {
+				return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "find user")
+			}
+			if shared {
+				return lumErrors.DuplicateKeyFieldf("userName", "userName belongs to another tenant's account; invite it instead")
+			}
+		}
+
+		if err := s.Repo.InsertMembership(ctx, q, tenantID, uid, role, f.ExternalID); err != nil {
+			if c := lumErrors.DBErrorCode(err); c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+				return lumErrors.DuplicateKeyFieldf("externalId", "externalId already in use")
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "add membership")
+		}
+		if f.Active != nil && !*f.Active {
+			if err := s.deactivate(ctx, q, tenantID, uid); err != nil {
+				return err
+			}
+		}
+
+		m, err = s.getMember(ctx, q, tenantID, uid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := s.Cfg.toUser(m)
+	return &u, nil
+}
+
+// ReplaceUser overwrites the user's mutable attributes (PUT)
+func (s *svc) ReplaceUser(ctx context.Context, tenantID, id string, in User) (*User, error) {
+	f := in.fields()
+	if err := validateEmail(f.Email); err != nil {
+		return nil, err
+	}
+
+	var m *member
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		cur, err := s.getMember(ctx, q, tenantID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.applyUser(ctx, q, tenantID, cur, f); err != nil {
+			return err
+		}
+		m, err = s.getMember(ctx, q, tenantID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := s.Cfg.toUser(m)
+	return &u, nil
+}
+
+// PatchUser applies PatchOp operations to a user
+func (s *svc) PatchUser(ctx context.Context, tenantID, id string, ops []PatchOp) (*User, error) {
+	var m *member
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		cur, err := s.getMember(ctx, q, tenantID, id)
+		if err != nil {
+			return err
+		}
+		f := userFields{Email: cur.Email, Name: cur.Name, ExternalID: cur.ExternalID, Role: cur.Role}
+		for _, op := range ops {
+			if err := patchUserFields(&f, op); err != nil {
+				return err
+			}
+		}
+		if err := validateEmail(f.Email); err != nil {
+			return err
+		}
+		if err := s.applyUser(ctx, q, tenantID, cur, f); err != nil {
+			return err
+		}
+		m, err = s.getMember(ctx, q, tenantID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := s.Cfg.toUser(m)
+	return &u, nil
+}
+
+// DeleteUser removes the user from the tenant and revokes their tenant sessions. The account
+// itself survives since it may belong to other tenants
+func (s *svc) DeleteUser(ctx context.Context, tenantID, id string) error {
+	return withTx(ctx, s.DB, func(q store.Queryer) error {
+		m, err := s.getMember(ctx, q, tenantID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.Repo.DeleteMembership(ctx, q, tenantID, m.UserID); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "remove membership")
+		}
+		if err := s.Repo.RevokeSessions(ctx, q, m.UserID, tenantID); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "revoke sessions")
+		}
+		return nil
+	})
+}
+
+// ListGroups returns every role-group with its members
+func (s *svc) ListGroups(ctx context.Context, tenantID string) ([]Group, error) {
+	out := make([]Group, 0, len(groupRoles))
+	for _, role := range groupRoles {
+		g, err := s.GetGroup(ctx, tenantID, role)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *g)
+	}
+	return out, nil
+}
+
+// GetGroup returns one role-group with its members
+func (s *svc) GetGroup(ctx context.Context, tenantID, id string) (*Group, error) {
+	if !validRole(id) {
+		return nil, lumErrors.NotFoundf("group not found")
+	}
+	ms, err := s.Repo.ListRoleMembers(ctx, s.DB, tenantID, id)
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list group members")
+	}
+	g := s.Cfg.toGroup(id, ms)
+	return &g, nil
+}
+
+// ReplaceGroup sets the exact member list of a role-group (PUT). Members dropped from the
+// group fall back to viewer, the least privileged role, rather than leaving the tenant
+func (s *svc) ReplaceGroup(ctx context.Context, tenantID, id string, in Group) (*Group, error) {
+	if !validRole(id) {
+		return nil, lumErrors.NotFoundf("group not found")
+	}
+	want := map[string]bool{}
+	for _, mv := range in.Members {
+		want[mv.Value] = true
+	}
+
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		cur, err := s.Repo.ListRoleMembers(ctx, q, tenantID, id)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list group members")
+		}
+		for _, m := range cur {
+			if !want[m.UserID] {
+				if err := s.removeFromGroup(ctx, q, tenantID, id, m.UserID); err != nil {
+					return err
+				}
+			}
+			delete(want, m.UserID)
+		}
+		for uid := range want {
+			if err := s.addToGroup(ctx, q, tenantID, id, uid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, tenantID, id)
+}
+
+// PatchGroup adds/removes role-group members
+func (s *svc) PatchGroup(ctx context.Context, tenantID, id string, ops []PatchOp) (*Group, error) {
+	if !validRole(id) {
+		return nil, lumErrors.NotFoundf("group not found")
+	}
+
+	err := withTx(ctx, s.DB, func(q store.Queryer) error {
+		for _, op := range ops {
+			kind := strings.ToLower(op.Op)
+			path := strings.TrimSpace(op.Path)
+
+			// remove with a value filter in the path: members[value eq "id"]
+			if kind == "remove" {
+				if mm := membersPathRe.FindStringSubmatch(path); mm != nil {
+					if err := s.removeFromGroup(ctx, q, tenantID, id, mm[1]); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if !strings.EqualFold(path, "members") {
+				// displayName etc. are fixed for role-groups; ignore rather than fail the IdP sync
+				continue
+			}
+			var members []MultiValue
+			if len(op.Value) > 0 {
+				if err := json.Unmarshal(op.Value, &members); err != nil {
+					return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid members", "members")
+				}
+			}
+
+			switch kind {
+			case "add":
+				for _, mv := range members {
+					if err := s.addToGroup(ctx, q, tenantID, id, mv.Value); err != nil {
+						return err
+					}
+				}
+			case "remove":
+				if len(members) == 0 {
+					cur, err := s.Repo.ListRoleMembers(ctx, q, tenantID, id)
+					if err != nil {
+						return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list group members")
+					}
+					for _, m := range cur {
+						members = append(members, MultiValue{Value: m.UserID})
+					}
+				}
+				for _, mv := range members {
+					if err := s.removeFromGroup(ctx, q, tenantID, id, mv.Value); err != nil {
+						return err
+					}
+				}
+			case "replace":
+				cur, err := s.Repo.ListRoleMembers(ctx, q, tenantID, id)
+				if err != nil {
+					return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list group members")
+				}
+				keep := map[string]bool{}
+				for _, mv := range members {
+					keep[mv.Value] = true
+				}
+				for _, m := range cur {
+					if !keep[m.UserID] {
+						if err := s.removeFromGroup(ctx, q, tenantID, id, m.UserID); err != nil {
+							return err
+						}
+					}
+				}
+				for _, mv := range members {
+					if err := s.addToGroup(ctx, q, tenantID, id, mv.Value); err != nil {
+						return err
+					}
+				}
+			default:
+				return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "unsupported op", "op")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, tenantID, id)
+}
+
+// CreateToken mints a SCIM API token for the tenant
+func (s *svc) CreateToken(ctx context.Context, tenantID, name, createdBy string) (string, *APIToken, error) {
+	if tenantID == "" {
+		return "", nil, lumErrors.InvalidArgf("tenant required")
+	}
+	opaque, hash, err := auth.NewOpaque(32)
+	if err != nil {
+		return "", nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "token")
+	}
+	t, err := s.Repo.InsertAPIToken(ctx, s.DB, tenantID, strings.TrimSpace(name), hash, createdBy)
+	if err != nil {
+		return "", nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create token")
+	}
+	return opaque, t, nil
+}
+
+// ListTokens lists the tenant's active API tokens
+func (s *svc) ListTokens(ctx context.Context, tenantID string) ([]APIToken, error) {
+	ts, err := s.Repo.ListAPITokens(ctx, s.DB, tenantID)
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list tokens")
+	}
+	return ts, nil
+}
+
+// RevokeToken revokes one of the tenant's API tokens
+func (s *svc) RevokeToken(ctx context.Context, tenantID, id string) error {
+	ok, err := s.Repo.RevokeAPIToken(ctx, s.DB, tenantID, id)
+	if err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "revoke token")
+	}
+	if !ok {
+		return lumErrors.NotFoundf("token not found")
+	}
+	return nil
+}
+
+// getMember maps "no such membership" to a NotFound domain error
+func (s *svc) getMember(ctx context.Context, q store.Queryer, tenantID, id string) (*member, error) {
+	m, err := s.Repo.GetMember(ctx, q, tenantID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, lumErrors.NotFoundf("user not found")
+	}
+	if err != nil {
+		return nil, lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "get user")
+	}
+	return m, nil
+}
+
+// applyUser persists the difference between cur and f. Email and name live on the account,
+// so they're only changed for accounts no other tenant shares: the email can't be changed from
+// here at all and a differing name is left as the account owner set it
+func (s *svc) applyUser(ctx context.Context, q store.Queryer, tenantID string, cur *member, f userFields) error {
+	if f.Email != cur.Email || f.Name != cur.Name {
+		shared, err := s.Repo.InOtherTenants(ctx, q, tenantID, cur.UserID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update user")
+		}
+		if shared && f.Email != cur.Email {
+			return mutability("userName belongs to an account shared with another tenant")
+		}
+		if shared {
+			f.Name = cur.Name
+		}
+	}
+	if f.Email != cur.Email || f.Name != cur.Name {
+		if err := s.Repo.UpdateUser(ctx, q, cur.UserID, f.Email, f.Name); err != nil {
+			if c := lumErrors.DBErrorCode(err); c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+				return lumErrors.DuplicateKeyFieldf("userName", "userName already in use")
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update user")
+		}
+	}
+	if f.ExternalID != cur.ExternalID {
+		if err := s.Repo.SetExternalID(ctx, q, tenantID, cur.UserID, f.ExternalID); err != nil {
+			if c := lumErrors.DBErrorCode(err); c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+				return lumErrors.DuplicateKeyFieldf("externalId", "externalId already in use")
+			}
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update externalId")
+		}
+	}
+	if f.Role != "" && f.Role != cur.Role {
+		if err := s.Repo.SetMemberRole(ctx, q, tenantID, cur.UserID, f.Role); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update role")
+		}
+	}
+	if f.Active != nil && *f.Active != cur.Active {
+		if !*f.Active {
+			return s.deactivate(ctx, q, tenantID, cur.UserID)
+		}
+		if err := s.Repo.SetMemberActive(ctx, q, tenantID, cur.UserID, true); err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "activate user")
+		}
+	}
+	return nil
+}
+
+// deactivate suspends the user's membership of the tenant and revokes their sessions in it so
+// existing refresh tokens die now. The account and its other tenants are untouched
+func (s *svc) deactivate(ctx context.Context, q store.Queryer, tenantID, userID string) error {
+	if err := s.Repo.SetMemberActive(ctx, q, tenantID, userID, false); err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "deactivate user")
+	}
+	if err := s.Repo.RevokeSessions(ctx, q, userID, tenantID); err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "revoke sessions")
+	}
+	return nil
+}
+
+func (s *svc) addToGroup(ctx context.Context, q store.Queryer, tenantID, role, userID string) error {
+	if _, err := s.getMember(ctx, q, tenantID, userID); err != nil {
+		return err
+	}
+	if err := s.Repo.SetMemberRole(ctx, q, tenantID, userID, role); err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update role")
+	}
+	return nil
+}
+
+func (s *svc) removeFromGroup(ctx context.Context, q store.Queryer, tenantID, role, userID string) error {
+	m, err := s.getMember(ctx, q, tenantID, userID)
+	if err != nil {
+		return err
+	}
+	if m.Role != role || role == roleViewer {
+		return nil
+	}
+	if err := s.Repo.SetMemberRole(ctx, q, tenantID, userID, roleViewer); err != nil {
+		return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "update role")
+	}
+	return nil
+}
+
+// patchUserFields applies one PatchOp to f
+func patchUserFields(f *userFields, op PatchOp) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "unsupported op", "op")
+	}
+
+	// No path: value is a partial User object
+	if op.Path == "" {
+		if kind == "remove" {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "remove requires a path", "path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid value", "value")
+		}
+		for k, v := range attrs {
+			if err := patchUserFields(f, PatchOp{Op: kind, Path: k, Value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+	if kind == "remove" {
+		switch path {
+		case "externalid":
+			f.ExternalID = ""
+		case "displayname", "name.formatted", "name":
+			f.Name = ""
+		}
+		return nil
+	}
+
+	switch path {
+	case "active":
+		v, ok := parseBool(op.Value)
+		if !ok {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "active must be a boolean", "active")
+		}
+		f.Active = &v
+	case "username", "emails[type eq \"work\"].value", "emails.value":
+		v, ok := parseString(op.Value)
+		if !ok {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid userName", "userName")
+		}
+		f.Email = strings.ToLower(v)
+	case "displayname", "name.formatted":
+		v, ok := parseString(op.Value)
+		if !ok {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid name", "displayName")
+		}
+		f.Name = v
+	case "externalid":
+		v, ok := parseString(op.Value)
+		if !ok {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid externalId", "externalId")
+		}
+		f.ExternalID = v
+	case "roles":
+		var roles []MultiValue
+		if err := json.Unmarshal(op.Value, &roles); err != nil {
+			return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "invalid roles", "roles")
+		}
+		for _, r := range roles {
+			if validRole(r.Value) {
+				f.Role = r.Value
+			}
+		}
+	}
+	// Unknown attributes (title, phoneNumbers, enterprise extension, ...) are accepted and ignored
+	return nil
+}
+
+// mutability rejects a change to an attribute the tenant may not modify (RFC 7644 §3.12)
+func mutability(format string, a ...any) error {
+	return lumErrors.WithField(lumErrors.InvalidArgf(format, a...), "mutability")
+}
+
+func validateEmail(email string) error {
+	if email == "" || !strings.Contains(email, "@") {
+		return lumErrors.NewValidationError(lumErrors.ErrorCodeValidation, "userName must be an email", "userName")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package scim
+
+import (
+	"net/http"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/services/api/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// List is the handler endpoint for listing the tenant's SCIM tokens
+//
+// @Summary     List SCIM tokens
+// @Description Lists active SCIM API tokens for the caller's tenant. Secrets are never returned.
+// @Tags        scim
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200  {array}   TokenWire
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Router      /scim/tokens [get]
+func (h *Tokens) List(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	ts, err := h.svc.ListTokens(r.Context(), claims.TenantID)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	out := make([]TokenWire, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, TokenWire{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt, LastUsedAt: t.LastUsedAt})
+	}
+	return lumnet.OKR(out)
+}
+
+// Create is the handler endpoint for minting a SCIM token
+//
+// @Summary     Create SCIM token
+// @Description Mints a tenant API token for an identity provider. The token is shown exactly once.
+// @Tags        scim
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       input  body  CreateTokenDTO  true  "token label"
+// @Success     201    {object}  TokenWire
+// @Failure     400    {string}  string          "bad request / validation error"
+// @Failure     401    {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403    {object}  auth.ErrorWire  "forbidden"
+// @Router      /scim/tokens [post]
+func (h *Tokens) Create(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseJSON[CreateTokenDTO](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if claims.TenantID == "" {
+		return lumnet.ErrorR(lumErrors.InvalidArgf("tenant required"))
+	}
+
+	raw, t, err := h.svc.CreateToken(r.Context(), claims.TenantID, in.Name, claims.Sub)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.CreatedR(TokenWire{ID: t.ID, Name: t.Name, Token: raw, CreatedAt: t.CreatedAt}, "")
+}
+
+// Revoke is the handler endpoint for revoking a SCIM token
+//
+// @Summary     Revoke SCIM token
+// @Tags        scim
+// @Security    BearerAuth
+// @Param       id  path  string  true  "token id"
+// @Success     204 "revoked; no content"
+// @Failure     404 {string}  string          "token not found"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403 {object}  auth.ErrorWire  "forbidden"
+// @Router      /scim/tokens/{id} [delete]
+func (h *Tokens) Revoke(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if err := h.svc.RevokeToken(r.Context(), claims.TenantID, chi.URLParam(r, "id")); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
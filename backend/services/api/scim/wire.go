@@ -0,0 +1,260 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM schema URNs
+const (
+	schemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	contentType = "application/scim+json"
+)
+
+// Roles double as the fixed set of SCIM groups
+const (
+	roleAdmin  = "admin"
+	roleMember = "member"
+	roleViewer = "viewer"
+)
+
+// groupRoles is ordered the way groups are listed
+var groupRoles = []string{roleAdmin, roleMember, roleViewer}
+
+func validRole(s string) bool {
+	switch s {
+	case roleAdmin, roleMember, roleViewer:
+		return true
+	}
+	return false
+}
+
+// Meta is the SCIM resource metadata block
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// Name is the SCIM complex name attribute
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is a SCIM multi-valued attribute entry (emails, roles, members, groups)
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is the SCIM core User resource as we expose it
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Roles       []MultiValue `json:"roles,omitempty"`
+	Groups      []MultiValue `json:"groups,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// Group is the SCIM core Group resource; each group is one role
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// ListResponse is the SCIM list envelope
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+// PatchRequest is the SCIM PatchOp message
+type PatchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []PatchOp `json:"Operations"`
+}
+
+// PatchOp is a single PATCH operation. Value is kept raw since its shape depends on path
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ErrorWire is the SCIM error message
+type ErrorWire struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// TokenWire is the API shape of a tenant API token. Token is only set on creation
+type TokenWire struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateTokenDTO is the http data transfer object for minting a tenant API token
+// swagger:model
+type CreateTokenDTO struct {
+	Name string `json:"name" validate:"required,max=120"`
+}
+
+// member is the domain view of a user's membership in a tenant
+type member struct {
+	UserID     string
+	Email      string
+	Name       string
+	ExternalID string
+	Active     bool
+	Role       string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// APIToken is a stored tenant API token (without its secret)
+type APIToken struct {
+	ID         string
+	TenantID   string
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// toUser renders a member as a SCIM User
+func (c Config) toUser(m *member) User {
+	active := m.Active
+	u := User{
+		Schemas:     []string{schemaUser},
+		ID:          m.UserID,
+		ExternalID:  m.ExternalID,
+		UserName:    m.Email,
+		DisplayName: m.Name,
+		Emails:      []MultiValue{{Value: m.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []MultiValue{{Value: m.Role, Primary: true}},
+		Groups:      []MultiValue{{Value: m.Role, Display: m.Role, Ref: c.BaseURL + "/Groups/" + m.Role}},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      m.CreatedAt.UTC().Format(time.RFC3339),
+			LastModified: m.UpdatedAt.UTC().Format(time.RFC3339),
+			Location:     c.BaseURL + "/Users/" + m.UserID,
+		},
+	}
+	if m.Name != "" {
+		u.Name = &Name{Formatted: m.Name}
+	}
+	return u
+}
+
+// toGroup renders a role and its members as a SCIM Group
+func (c Config) toGroup(role string, members []member) Group {
+	g := Group{
+		Schemas:     []string{schemaGroup},
+		ID:          role,
+		DisplayName: role,
+		Meta:        &Meta{ResourceType: "Group", Location: c.BaseURL + "/Groups/" + role},
+	}
+	for _, m := range members {
+		g.Members = append(g.Members, MultiValue{
+			Value:   m.UserID,
+			Display: m.Email,
+			Ref:     c.BaseURL + "/Users/" + m.UserID,
+		})
+	}
+	return g
+}
+
+// userFields is what a SCIM User payload contributes to our model
+type userFields struct {
+	Email      string
+	Name       string
+	ExternalID string
+	Active     *bool
+	Role       string
+}
+
+// fields extracts the attributes we persist from an inbound User
+func (u User) fields() userFields {
+	f := userFields{
+		Email:      strings.ToLower(strings.TrimSpace(u.UserName)),
+		Name:       strings.TrimSpace(u.DisplayName),
+		ExternalID: strings.TrimSpace(u.ExternalID),
+		Active:     u.Active,
+	}
+	if f.Name == "" && u.Name != nil {
+		f.Name = strings.TrimSpace(u.Name.Formatted)
+		if f.Name == "" {
+			f.Name = strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+		}
+	}
+	// userName is usually the email, but some IdPs send a login name plus emails[]
+	if !strings.Contains(f.Email, "@") {
+		for _, e := range u.Emails {
+			if e.Primary || len(u.Emails) == 1 {
+				f.Email = strings.ToLower(strings.TrimSpace(e.Value))
+			}
+		}
+	}
+	for _, r := range u.Roles {
+		if validRole(r.Value) {
+			f.Role = r.Value
+		}
+	}
+	return f
+}
+
+// parseBool accepts JSON booleans and the "True"/"False" strings some IdPs send
+func parseBool(raw json.RawMessage) (bool, bool) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, true
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if v, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			return v, true
+		}
+	}
+	return false, false
+}
+
+// parseString accepts a JSON string value
+func parseString(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(s), true
+}
@@ -0,0 +1,209 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+
+	"github.com/google/uuid"
+)
+
+// TusVersion is the protocol version served
+const TusVersion = "1.0.0"
+
+// tusExtensions are the tus extensions served
+const tusExtensions = "creation,termination,checksum,expiration"
+
+// Upload is a resumable upload
+// swagger:model
+type Upload struct {
+	ID          string            `json:"id"           db:"id"`
+	UserID      string            `json:"user_id"      db:"user_id"`
+	Length      int64             `json:"length"       db:"length"`
+	Offset      int64             `json:"offset"       db:"upload_offset"`
+	Metadata    map[string]string `json:"metadata"     db:"metadata"`
+	PhotoID     *string           `json:"photo_id"     db:"photo_id"` // set once complete
+	CompletedAt *time.Time        `json:"completed_at" db:"completed_at"`
+	CreatedAt   time.Time         `json:"created_at"   db:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"   db:"updated_at"`
+}
+
+// Complete reports whether the upload has been assembled into a photo
+func (u Upload) Complete() bool { return u.CompletedAt != nil }
+
+// ExpiresAt is when an unfinished upload expires, expiry after its last PATCH. ok is false for a
+// finished upload, or when uploads don't expire
+func (u Upload) ExpiresAt(expiry time.Duration) (time.Time, bool) {
+	if u.Complete() || expiry <= 0 {
+		return time.Time{}, false
+	}
+	return u.UpdatedAt.Add(expiry), true
+}
+
+// Filename is the client's name for the file, from the filename (tus-js-client) or name (Uppy)
+// metadata
+func (u Upload) Filename() string {
+	if v := u.Metadata["filename"]; v != "" {
+		return v
+	}
+	return u.Metadata["name"]
+}
+
+// ContentType is the client's media type for the file, from the filetype or type metadata
+func (u Upload) ContentType() string {
+	if v := u.Metadata["filetype"]; v != "" {
+		return v
+	}
+	if v := u.Metadata["type"]; v != "" {
+		return v
+	}
+	return "application/octet-stream"
+}
+
+// chunk is one PATCH's worth of bytes in the object store
+type chunk struct {
+	Start     int64  `db:"start_offset"`
+	Size      int64  `db:"size"`
+	ObjectKey string `db:"object_key"`
+}
+
+// photo is the original an upload becomes
+type photo struct {
+	ID          string
+	ObjectKey   string
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// uploadPath is the /uploads/{id} route param
+type uploadPath struct {
+	ID uuid.UUID `path:"id"`
+}
+
+// createHeaders are the tus creation request headers. Deferred lengths aren't supported, so
+// Upload-Length is required
+type createHeaders struct {
+	Length   *int64 `header:"Upload-Length"   validate:"required,gte=0"`
+	Metadata string `header:"Upload-Metadata"`
+}
+
+// patchHeaders are the tus PATCH request headers
+type patchHeaders struct {
+	Offset   *int64 `header:"Upload-Offset"   validate:"required,gte=0"`
+	Checksum string `header:"Upload-Checksum"`
+}
+
+// ParseMetadata decodes Upload-Metadata: comma-separated "key base64value" pairs, where the
+// value may be omitted
+func ParseMetadata(header string) (map[string]string, error) {
+	out := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+				"Upload-Metadata has an empty key", "Upload-Metadata")
+		}
+		if _, dup := out[key]; dup {
+			return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+				"Upload-Metadata repeats "+key, "Upload-Metadata")
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+				"Upload-Metadata value of "+key+" is not base64", "Upload-Metadata")
+		}
+		out[key] = string(b)
+	}
+	return out, nil
+}
+
+// EncodeMetadata is the Upload-Metadata header for m, keys sorted
+func EncodeMetadata(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if m[k] == "" {
+			pairs = append(pairs, k)
+			continue
+		}
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(m[k])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// checksumAlgorithms are the Upload-Checksum algorithms accepted, as listed in
+// Tus-Checksum-Algorithm. They guard against corruption in transit, not tampering, so md5 and
+// sha1 (which tus requires) are fine
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// Checksum is a parsed Upload-Checksum: the digest the client expects of a PATCH body
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum parses "algorithm base64digest"; an empty header is a nil Checksum
+func ParseChecksum(header string) (*Checksum, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	alg, digest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if _, ok := checksumAlgorithms[alg]; !ok {
+		return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+			"unsupported checksum algorithm "+alg, "Upload-Checksum")
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(digest))
+	if err != nil || len(sum) == 0 {
+		return nil, lumErrors.NewValidationError(lumErrors.ErrorCodeValidation,
+			"Upload-Checksum digest is not base64", "Upload-Checksum")
+	}
+	return &Checksum{Algorithm: alg, Sum: sum}, nil
+}
+
+func (c *Checksum) hash() hash.Hash { return checksumAlgorithms[c.Algorithm]() }
+
+func (c *Checksum) matches(h hash.Hash) bool { return bytes.Equal(h.Sum(nil), c.Sum) }
+
+// errChecksumMismatch is tus' 460: the PATCH body doesn't match its Upload-Checksum, and was
+// discarded
+func errChecksumMismatch() error {
+	return &lumnet.Problem{
+		Status: 460,
+		Code:   "checksum-mismatch",
+		Title:  "Checksum mismatch",
+		Detail: "the chunk doesn't match Upload-Checksum and was discarded; send it again",
+	}
+}
+
+// errUnsupportedMediaType rejects a PATCH whose body isn't application/offset+octet-stream
+func errUnsupportedMediaType() error {
+	return &lumnet.Problem{
+		Status: http.StatusUnsupportedMediaType,
+		Code:   "unsupported-media-type",
+		Title:  "Unsupported media type",
+		Detail: "PATCH bodies must be application/offset+octet-stream",
+	}
+}
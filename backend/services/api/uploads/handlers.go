@@ -0,0 +1,208 @@
+package uploads
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/services/api/acl"
+)
+
+// tusResumable answers every request with the protocol version, and refuses requests other than
+// OPTIONS that speak another one, as tus requires
+func tusResumable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", TusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != TusVersion {
+			w.Header().Set("Tus-Version", TusVersion)
+			lumnet.RenderError(w, r, lumErrors.WithField(
+				lumErrors.PreconditionFailedf("Tus-Resumable must be %s", TusVersion), "Tus-Resumable"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Options is the handler endpoint for tus capability discovery
+//
+// @Summary     Upload capabilities
+// @Description Lists the tus version, extensions, checksum algorithms and largest upload served.
+// @Tags        uploads
+// @Success     204  "capabilities in Tus-* headers"
+// @Router      /uploads [options]
+func (h *Uploads) Options(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	if h.cfg.MaxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+	}
+	return lumnet.NoContentR()
+}
+
+// Create is the handler endpoint for starting an upload
+//
+// @Summary     Create upload
+// @Description Starts a tus upload of Upload-Length bytes; send them with PATCH to the Location
+// @Description returned before Upload-Expires. Unfinished uploads count against the tenant's
+// @Description storage quota until they finish or expire.
+// @Tags        uploads
+// @Produce     json
+// @Security    BearerAuth
+// @Param       Tus-Resumable    header    string  true   "1.0.0"
+// @Param       Upload-Length    header    int     true   "size of the file in bytes"
+// @Param       Upload-Metadata  header    string  false  "comma-separated key base64(value) pairs, e.g. filename"
+// @Success     201  {object}  Upload
+// @Failure     400  {string}  string          "missing Upload-Length or malformed Upload-Metadata"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     403  {object}  auth.ErrorWire  "forbidden"
+// @Failure     412  {string}  string          "unsupported tus version"
+// @Failure     413  {string}  string          "over Tus-Max-Size or the storage quota"
+// @Router      /uploads [post]
+func (h *Uploads) Create(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParseHeader[createHeaders](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	meta, err := ParseMetadata(in.Metadata)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	u, err := h.svc.Create(r.Context(), p, *in.Length, meta)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	setUploadHeaders(w, u, h.cfg.Expiry)
+	return lumnet.CreatedR(u, "/api/v1/uploads/"+u.ID)
+}
+
+// Head is the handler endpoint for an upload's offset
+//
+// @Summary     Upload offset
+// @Description Reports how many bytes have been received, to resume from after an interruption.
+// @Tags        uploads
+// @Security    BearerAuth
+// @Param       id             path      string  true  "upload id"
+// @Param       Tus-Resumable  header    string  true  "1.0.0"
+// @Success     200  "Upload-Offset, Upload-Length, Upload-Expires and Upload-Metadata headers"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     404  {string}  string          "upload not found"
+// @Failure     410  {string}  string          "upload expired"
+// @Router      /uploads/{id} [head]
+func (h *Uploads) Head(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParsePath[uploadPath](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	u, err := h.svc.Get(r.Context(), p, in.ID.String())
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	setUploadHeaders(w, u, h.cfg.Expiry)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// Patch is the handler endpoint for sending an upload's bytes
+//
+// @Summary     Append to upload
+// @Description Appends the body at Upload-Offset, which must be the upload's current offset. With
+// @Description Upload-Checksum the chunk is kept only if it matches (460 otherwise). Once the last
+// @Description byte arrives the upload becomes a photo, named in the Photo-Id header.
+// @Tags        uploads
+// @Accept      application/offset+octet-stream
+// @Security    BearerAuth
+// @Param       id               path      string  true   "upload id"
+// @Param       Tus-Resumable    header    string  true   "1.0.0"
+// @Param       Upload-Offset    header    int     true   "offset the body starts at"
+// @Param       Upload-Checksum  header    string  false  "algorithm and base64 digest of the body, e.g. sha1 ..."
+// @Success     204  "received; the new offset is in Upload-Offset"
+// @Failure     400  {string}  string          "missing Upload-Offset or bad Upload-Checksum"
+// @Failure     401  {object}  auth.ErrorWire  "unauthorized"
+// @Failure     404  {string}  string          "upload not found"
+// @Failure     409  {string}  string          "Upload-Offset doesn't match the upload"
+// @Failure     410  {string}  string          "upload expired"
+// @Failure     413  {string}  string          "the body runs past Upload-Length"
+// @Failure     415  {string}  string          "not application/offset+octet-stream"
+// @Failure     460  {string}  string          "checksum mismatch"
+// @Router      /uploads/{id} [patch]
+func (h *Uploads) Patch(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/offset+octet-stream" {
+		return lumnet.ErrorR(errUnsupportedMediaType())
+	}
+	in, err := lumnet.ParsePath[uploadPath](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	hdr, err := lumnet.ParseHeader[patchHeaders](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	sum, err := ParseChecksum(hdr.Checksum)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	u, err := h.svc.Append(r.Context(), p, in.ID.String(), *hdr.Offset, r.Body, sum)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	setUploadHeaders(w, u, h.cfg.Expiry)
+	return lumnet.NoContentR()
+}
+
+// Delete is the handler endpoint for terminating an upload
+//
+// @Summary     Terminate upload
+// @Description Stops an upload and discards the bytes received. A finished upload's photo stays.
+// @Tags        uploads
+// @Security    BearerAuth
+// @Param       id             path    string  true  "upload id"
+// @Param       Tus-Resumable  header  string  true  "1.0.0"
+// @Success     204 "terminated; no content"
+// @Failure     401 {object}  auth.ErrorWire  "unauthorized"
+// @Failure     404 {string}  string          "upload not found"
+// @Router      /uploads/{id} [delete]
+func (h *Uploads) Delete(w http.ResponseWriter, r *http.Request) lumnet.Reply {
+	in, err := lumnet.ParsePath[uploadPath](r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	p, err := acl.PrincipalFrom(r)
+	if err != nil {
+		return lumnet.ErrorR(err)
+	}
+	if err := h.svc.Delete(r.Context(), p, in.ID.String()); err != nil {
+		return lumnet.ErrorR(err)
+	}
+	return lumnet.NoContentR()
+}
+
+// setUploadHeaders describes u in tus headers
+func setUploadHeaders(w http.ResponseWriter, u *Upload, expiry time.Duration) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if exp, ok := u.ExpiresAt(expiry); ok {
+		w.Header().Set("Upload-Expires", exp.UTC().Format(http.TimeFormat))
+	}
+	if len(u.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", EncodeMetadata(u.Metadata))
+	}
+	if u.PhotoID != nil {
+		w.Header().Set("Photo-Id", *u.PhotoID)
+	}
+}
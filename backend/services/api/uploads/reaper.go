@@ -0,0 +1,65 @@
+package uploads
+
+import (
+	"context"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/store"
+)
+
+// reapBatch is how many expired uploads one reaper transaction deletes
+const reapBatch = 100
+
+// Reap deletes unfinished uploads that haven't moved for Cfg.Expiry, in every tenant, and then
+// their chunk objects. It runs outside any tenant scope, so it sees every user's uploads
+func (s *svc) Reap(ctx context.Context) (int, error) {
+	if s.Cfg.Expiry <= 0 {
+		return 0, nil
+	}
+	before := now().Add(-s.Cfg.Expiry)
+	total := 0
+	for {
+		var keys []string
+		var n int
+		err := withTx(ctx, s.DB, func(q store.Queryer) error {
+			ks, c, err := s.Repo.Expire(ctx, q, before, reapBatch)
+			if err != nil {
+				return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "expire uploads")
+			}
+			keys, n = ks, c
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		for _, k := range keys {
+			s.discard(k)
+		}
+		if total += n; n < reapBatch {
+			return total, nil
+		}
+	}
+}
+
+// reap runs Reap every interval until ctx ends. Replicas reaping at once skip each other's rows
+func reap(ctx context.Context, s Service, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := s.Reap(ctx)
+			l := logger.Get()
+			if err != nil {
+				l.Warn().Err(err).Msg("uploads: reap expired uploads")
+			}
+			if n > 0 {
+				l.Info().Int("uploads", n).Msg("uploads: reaped expired uploads")
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package uploads
+
+import (
+	"context"
+	"time"
+
+	"lumium/lib/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Repo is the uploads data-access interface. Callers pass the tenant-scoped transaction from
+// store.WithTenantTx; RLS keeps each user's uploads to themselves.
+type Repo interface {
+	// StorageUsage locks the tenant row, serializing quota checks, and returns its quota (nil
+	// when unset) and the bytes it stores or has reserved.
+	StorageUsage(ctx context.Context, q store.Queryer, tenantID string) (*int64, int64, error)
+
+	// Insert creates an upload of length bytes.
+	Insert(
+		ctx context.Context, q store.Queryer, tenantID, userID string, length int64, meta map[string]string,
+	) (*Upload, error)
+
+	// Get returns one of userID's uploads, or pgx.ErrNoRows.
+	Get(ctx context.Context, q store.Queryer, tenantID, userID, uploadID string) (*Upload, error)
+
+	// Advance records a chunk of size bytes stored under key at offset from, and moves the upload
+	// past it. Returns pgx.ErrNoRows if the upload is no longer at from.
+	Advance(ctx context.Context, q store.Queryer, tenantID, uploadID string, from, size int64, key string) (*Upload, error)
+
+	// Chunks returns the upload's chunks in offset order.
+	Chunks(ctx context.Context, q store.Queryer, uploadID string) ([]chunk, error)
+
+	// Complete records the photo the upload became and drops its chunk rows. When the tenant
+	// already has a photo with the same SHA-256 the upload points at that one instead. Returns
+	// the upload's photo id, or "" if the upload was already complete.
+	Complete(ctx context.Context, q store.Queryer, tenantID, userID, uploadID string, p photo) (string, error)
+
+	// Delete removes an upload and returns the object keys of its chunks.
+	Delete(ctx context.Context, q store.Queryer, tenantID, userID, uploadID string) ([]string, bool, error)
+
+	// Expire removes up to limit unfinished uploads last updated before the cutoff, in any
+	// tenant, and returns the object keys of their chunks and how many uploads it removed.
+	Expire(ctx context.Context, q store.Queryer, before time.Time, limit int) ([]string, int, error)
+}
+
+const uploadColumns = `u.id::text AS id, u.user_id::text AS user_id, u.length, u.upload_offset, u.metadata,
+	u.photo_id::text AS photo_id, u.completed_at, u.created_at, u.updated_at`
+
+// StorageUsage locks the tenant row and returns its quota and the bytes it stores or has reserved.
+func (r *repo) StorageUsage(ctx context.Context, q store.Queryer, tenantID string) (*int64, int64, error) {
+	var quota *int64
+	var used int64
+	err := q.QueryRow(ctx,
+		`SELECT storage_quota_bytes, tenant_storage_used(id) FROM tenants WHERE id = $1 FOR UPDATE`,
+		tenantID,
+	).Scan(&quota, &used)
+	return quota, used, err
+}
+
+// Insert creates an upload of length bytes.
+func (r *repo) Insert(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, userID string,
+	length int64,
+	meta map[string]string,
+) (*Upload, error) {
+	rows, err := q.Query(ctx,
+		`INSERT INTO uploads AS u (tenant_id, user_id, length, metadata)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+uploadColumns,
+		tenantID, userID, length, meta,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectUpload(rows)
+}
+
+// Get returns one of userID's uploads, or pgx.ErrNoRows.
+func (r *repo) Get(ctx context.Context, q store.Queryer, tenantID, userID, uploadID string) (*Upload, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+uploadColumns+` FROM uploads u WHERE u.tenant_id = $1 AND u.user_id = $2 AND u.id = $3`,
+		tenantID, userID, uploadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectUpload(rows)
+}
+
+// Advance records a chunk and moves the upload past it, or returns pgx.ErrNoRows.
+func (r *repo) Advance(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, uploadID string,
+	from, size int64,
+	key string,
+) (*Upload, error) {
+	rows, err := q.Query(ctx,
+		`UPDATE uploads AS u SET upload_offset = upload_offset + $4, updated_at = NOW()
+		  WHERE u.tenant_id = $1 AND u.id = $2 AND u.upload_offset = $3 AND u.completed_at IS NULL
+		 RETURNING `+uploadColumns,
+		tenantID, uploadID, from, size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	u, err := collectUpload(rows)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(ctx,
+		`INSERT INTO upload_chunks (upload_id, tenant_id, start_offset, size, object_key)
+		 VALUES ($2, $1, $3, $4, $5)`,
+		tenantID, uploadID, from, size, key,
+	); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Chunks returns the upload's chunks in offset order.
+func (r *repo) Chunks(ctx context.Context, q store.Queryer, uploadID string) ([]chunk, error) {
+	rows, err := q.Query(ctx,
+		`SELECT start_offset, size, object_key FROM upload_chunks WHERE upload_id = $1 ORDER BY start_offset`,
+		uploadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return store.CollectStructsByName[chunk](rows)
+}
+
+// Complete records the photo the upload became, or finds the tenant's copy of the same bytes.
+func (r *repo) Complete(
+	ctx context.Context,
+	q store.Queryer,
+	tenantID, userID, uploadID string,
+	p photo,
+) (string, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE uploads SET completed_at = NOW(), updated_at = NOW()
+		  WHERE tenant_id = $1 AND user_id = $2 AND id = $3 AND completed_at IS NULL`,
+		tenantID, userID, uploadID,
+	)
+	if err != nil || tag.RowsAffected() == 0 {
+		return "", err
+	}
+	photoID := p.ID
+	tag, err = q.Exec(ctx,
+		`INSERT INTO photos (id, tenant_id, owner_id, object_key, filename, content_type, size, sha256)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (tenant_id, sha256) DO NOTHING`,
+		p.ID, tenantID, userID, p.ObjectKey, p.Filename, p.ContentType, p.Size, p.SHA256,
+	)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		if err := q.QueryRow(ctx,
+			`SELECT id::text FROM photos WHERE tenant_id = $1 AND sha256 = $2`, tenantID, p.SHA256,
+		).Scan(&photoID); err != nil {
+			return "", err
+		}
+	}
+	if _, err := q.Exec(ctx, `UPDATE uploads SET photo_id = $2 WHERE id = $1`, uploadID, photoID); err != nil {
+		return "", err
+	}
+	if _, err := q.Exec(ctx, `DELETE FROM upload_chunks WHERE upload_id = $1`, uploadID); err != nil {
+		return "", err
+	}
+	return photoID, nil
+}
+
+// Delete removes an upload and returns the object keys of its chunks.
+func (r *repo) Delete(ctx context.Context, q store.Queryer, tenantID, userID, uploadID string) ([]string, bool, error) {
+	rows, err := q.Query(ctx,
+		`DELETE FROM upload_chunks c USING uploads u
+		  WHERE c.upload_id = u.id AND u.tenant_id = $1 AND u.user_id = $2 AND u.id = $3
+		 RETURNING c.object_key`,
+		tenantID, userID, uploadID,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, false, err
+	}
+	tag, err := q.Exec(ctx,
+		`DELETE FROM uploads WHERE tenant_id = $1 AND user_id = $2 AND id = $3`,
+		tenantID, userID, uploadID,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return keys, tag.RowsAffected() > 0, nil
+}
+
+// Expire removes unfinished uploads idle since before the cutoff and returns their chunks' keys.
+// The chunks are read from the statement's snapshot, before the cascade removes them.
+func (r *repo) Expire(ctx context.Context, q store.Queryer, before time.Time, limit int) ([]string, int, error) {
+	rows, err := q.Query(ctx,
+		`WITH stale AS (
+		   DELETE FROM uploads WHERE id IN (
+		     SELECT id FROM uploads WHERE completed_at IS NULL AND updated_at < $1
+		      ORDER BY updated_at LIMIT $2 FOR UPDATE SKIP LOCKED)
+		   RETURNING id)
+		 SELECT s.id::text, c.object_key FROM stale s LEFT JOIN upload_chunks c ON c.upload_id = s.id`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var keys []string
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		var key *string
+		if err := rows.Scan(&id, &key); err != nil {
+			return nil, 0, err
+		}
+		ids[id] = true
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, len(ids), rows.Err()
+}
+
+func collectUpload(rows pgx.Rows) (*Upload, error) {
+	u, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Upload])
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
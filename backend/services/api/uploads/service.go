@@ -0,0 +1,400 @@
+package uploads
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/logger"
+	"lumium/lib/objstore"
+	"lumium/lib/outbox"
+	"lumium/lib/store"
+	"lumium/services/api/acl"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// seams, which are overwritten in tests
+var (
+	withTenantTx = func(
+		ctx context.Context,
+		b store.Beginner,
+		s store.Scope,
+		o store.TxOptions,
+		fn func(q store.Queryer) error,
+	) error {
+		return store.WithTenantTxOptions(ctx, b, s, o, fn)
+	}
+	withTx = func(ctx context.Context, b store.Beginner, fn func(q store.Queryer) error) error {
+		return store.WithTx(ctx, b, fn)
+	}
+	now = time.Now
+	// commitTx retries the transactions that record an upload's progress when they lose a
+	// deadlock or serialization conflict to a concurrent ingest in the tenant
+	commitTx = store.TxOptions{MaxRetries: 3, MaxBackoff: 250 * time.Millisecond}
+	// spoolDir is where PATCH bodies are held while they're checked; "" is os.TempDir
+	spoolDir = ""
+)
+
+// Service defines the upload operations exposed to HTTP handlers. Uploads belong to the user who
+// created them; anyone else gets NotFound
+type Service interface {
+	// Create starts an upload of length bytes, if the tenant's quota has room for it
+	Create(ctx context.Context, p acl.Principal, length int64, meta map[string]string) (*Upload, error)
+
+	// Get returns one of the principal's uploads
+	Get(ctx context.Context, p acl.Principal, uploadID string) (*Upload, error)
+
+	// Append stores body at offset, which must be the upload's current offset. A body sent with
+	// a Checksum is kept only if it matches; one without is kept up to where it broke off. The
+	// upload is assembled into a photo once its last byte arrives
+	Append(
+		ctx context.Context, p acl.Principal, uploadID string, offset int64, body io.Reader, sum *Checksum,
+	) (*Upload, error)
+
+	// Delete terminates an upload, discarding the chunks received so far
+	Delete(ctx context.Context, p acl.Principal, uploadID string) error
+
+	// Reap deletes unfinished uploads of every tenant that expired, with their chunks, and
+	// returns how many it deleted
+	Reap(ctx context.Context) (int, error)
+}
+
+// Create starts an upload of length bytes, if the tenant's quota has room for it. Unfinished
+// uploads count against the quota at their full length, so parallel uploads can't overshoot it
+func (s *svc) Create(ctx context.Context, p acl.Principal, length int64, meta map[string]string) (*Upload, error) {
+	if s.Cfg.MaxSize > 0 && length > s.Cfg.MaxSize {
+		return nil, lumErrors.PayloadTooLargef("uploads are limited to %d bytes", s.Cfg.MaxSize)
+	}
+
+	var out *Upload
+	err := withTenantTx(ctx, s.DB, p.Scope(), commitTx, func(q store.Queryer) error {
+		quota, used, err := s.Repo.StorageUsage(ctx, q, p.TenantID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lumErrors.NotFoundf("tenant not found")
+		}
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "check storage quota")
+		}
+		limit := s.Cfg.DefaultQuota
+		if quota != nil {
+			limit = *quota
+		}
+		if limit > 0 && used+length > limit {
+			return lumErrors.PayloadTooLargef("storage quota exceeded: %d of %d bytes in use", used, limit)
+		}
+		u, err := s.Repo.Insert(ctx, q, p.TenantID, p.UserID, length, meta)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "create upload")
+		}
+		out = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return s.finish(ctx, p, out)
+	}
+	return out, nil
+}
+
+// Get returns one of the principal's uploads. One that expired is Gone, even before the reaper
+// has deleted it
+func (s *svc) Get(ctx context.Context, p acl.Principal, uploadID string) (*Upload, error) {
+	var out *Upload
+	err := withTenantTx(ctx, s.DB, p.Scope(), store.TxOptions{}, func(q store.Queryer) error {
+		u, err := s.Repo.Get(ctx, q, p.TenantID, p.UserID, uploadID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lumErrors.NotFoundf("upload not found")
+		}
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "get upload")
+		}
+		out = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if exp, ok := out.ExpiresAt(s.Cfg.Expiry); ok && !now().Before(exp) {
+		return nil, lumErrors.Gonef("upload expired")
+	}
+	return out, nil
+}
+
+// Append stores body at offset and assembles the upload once its last byte arrives. The body is
+// spooled to disk first, so a checksum can be verified before anything is stored and a broken
+// connection still leaves the bytes that did arrive
+func (s *svc) Append(
+	ctx context.Context,
+	p acl.Principal,
+	uploadID string,
+	offset int64,
+	body io.Reader,
+	sum *Checksum,
+) (*Upload, error) {
+	u, err := s.Get(ctx, p, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Offset {
+		return nil, lumErrors.WithField(
+			lumErrors.Conflictf("Upload-Offset is %d but the upload is at %d", offset, u.Offset), "Upload-Offset")
+	}
+	if u.Complete() {
+		return u, nil
+	}
+
+	spool, n, readErr := spoolChunk(body, u.Length-u.Offset, sum)
+	if spool != nil {
+		defer func() { _ = spool.Close(); _ = os.Remove(spool.Name()) }()
+	}
+	switch {
+	case n > u.Length-u.Offset:
+		return nil, lumErrors.PayloadTooLargef("the chunk runs past Upload-Length (%d bytes)", u.Length)
+	case readErr != nil && (sum != nil || n == 0):
+		return nil, readErr
+	case readErr == nil && sum != nil && !sum.matches(spool.hash):
+		return nil, errChecksumMismatch()
+	}
+
+	if n > 0 {
+		if u, err = s.store(ctx, p, u, spool.File, n); err != nil {
+			return nil, err
+		}
+	}
+	if readErr != nil {
+		// the client is gone; what arrived is kept for it to resume from
+		return u, nil
+	}
+	if u.Offset == u.Length {
+		// also retries an assembly that failed earlier, on a PATCH with an empty body
+		return s.finish(ctx, p, u)
+	}
+	return u, nil
+}
+
+// store puts one spooled chunk in the object store and advances the upload past it. The chunk
+// key is unique, so of two racing PATCHes at the same offset only the one that advances the
+// upload first keeps its object
+func (s *svc) store(ctx context.Context, p acl.Principal, u *Upload, f *os.File, n int64) (*Upload, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "rewind chunk: %v", err)
+	}
+	key := fmt.Sprintf("uploads/%s/%s/%020d-%s", p.TenantID, u.ID, u.Offset, uuid.NewString())
+	if err := s.objects.Put(ctx, key, f, n, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	var out *Upload
+	err := withTenantTx(ctx, s.DB, p.Scope(), commitTx, func(q store.Queryer) error {
+		next, err := s.Repo.Advance(ctx, q, p.TenantID, u.ID, u.Offset, n, key)
+		c := lumErrors.DBErrorCode(err)
+		if errors.Is(err, pgx.ErrNoRows) || c != nil && *c == lumErrors.ErrorCodeDuplicateKey {
+			return lumErrors.WithField(
+				lumErrors.Conflictf("the upload moved on while this chunk was sent"), "Upload-Offset")
+		}
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "advance upload")
+		}
+		out = next
+		return nil
+	})
+	if err != nil {
+		s.discard(key)
+		return nil, err
+	}
+	return out, nil
+}
+
+// finish assembles the chunks into the original, records it as a photo and enqueues
+// photo.ingested. The original's SHA-256 is computed as it is streamed, without holding the file
+func (s *svc) finish(ctx context.Context, p acl.Principal, u *Upload) (*Upload, error) {
+	var chunks []chunk
+	err := withTenantTx(ctx, s.DB, p.Scope(), store.TxOptions{}, func(q store.Queryer) error {
+		cs, err := s.Repo.Chunks(ctx, q, u.ID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "list upload chunks")
+		}
+		chunks = cs
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var at int64
+	for _, c := range chunks {
+		if c.Start != at {
+			return nil, lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "upload %s has a gap at byte %d", u.ID, at)
+		}
+		at += c.Size
+	}
+	if at != u.Length {
+		return nil, lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "upload %s has %d of %d bytes", u.ID, at, u.Length)
+	}
+
+	ph := photo{
+		ID:          uuid.NewString(),
+		Filename:    u.Filename(),
+		ContentType: u.ContentType(),
+		Size:        u.Length,
+	}
+	ph.ObjectKey = fmt.Sprintf("originals/%s/%s", p.TenantID, ph.ID)
+	digest := sha256.New()
+	src := &chunkReader{ctx: ctx, objects: s.objects, chunks: chunks}
+	err = s.objects.Put(ctx, ph.ObjectKey, io.TeeReader(src, digest), u.Length, ph.ContentType)
+	_ = src.Close()
+	if err != nil {
+		return nil, err
+	}
+	ph.SHA256 = hex.EncodeToString(digest.Sum(nil))
+
+	var photoID string
+	err = withTenantTx(ctx, s.DB, p.Scope(), commitTx, func(q store.Queryer) error {
+		id, err := s.Repo.Complete(ctx, q, p.TenantID, p.UserID, u.ID, ph)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "complete upload")
+		}
+		if photoID = id; id != ph.ID {
+			return nil
+		}
+		return outbox.Enqueue(ctx, q, outbox.Event{
+			AggregateType: "photo",
+			AggregateID:   ph.ID,
+			Subject:       "events.photo.ingested",
+			Payload: map[string]any{
+				"tenant_id":    p.TenantID,
+				"photo_id":     ph.ID,
+				"owner_id":     p.UserID,
+				"upload_id":    u.ID,
+				"object_key":   ph.ObjectKey,
+				"filename":     ph.Filename,
+				"content_type": ph.ContentType,
+				"size":         ph.Size,
+				"sha256":       ph.SHA256,
+			},
+		})
+	})
+	if err != nil || photoID != ph.ID {
+		// a failed commit, a racing PATCH that finished first, or bytes the tenant already has:
+		// this copy isn't referenced
+		s.discard(ph.ObjectKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if photoID != "" {
+		for _, c := range chunks {
+			s.discard(c.ObjectKey)
+		}
+	}
+	return s.Get(ctx, p, u.ID)
+}
+
+// Delete terminates an upload, discarding the chunks received so far. The photo of a finished
+// upload stays
+func (s *svc) Delete(ctx context.Context, p acl.Principal, uploadID string) error {
+	var keys []string
+	err := withTenantTx(ctx, s.DB, p.Scope(), store.TxOptions{}, func(q store.Queryer) error {
+		ks, ok, err := s.Repo.Delete(ctx, q, p.TenantID, p.UserID, uploadID)
+		if err != nil {
+			return lumErrors.WrapErrorf(err, lumErrors.ErrorCodeDB, "delete upload")
+		}
+		if !ok {
+			return lumErrors.NotFoundf("upload not found")
+		}
+		keys = ks
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s.discard(k)
+	}
+	return nil
+}
+
+// discard deletes an object nothing references any more. A failure only leaks storage, so it is
+// logged rather than failing the request
+func (s *svc) discard(key string) {
+	if err := s.objects.Delete(context.Background(), key); err != nil {
+		l := logger.Get()
+		l.Warn().Err(err).Str("key", key).Msg("uploads: could not delete object")
+	}
+}
+
+// spooled is a PATCH body on disk, with its running checksum
+type spooled struct {
+	*os.File
+	hash hash.Hash
+}
+
+// spoolChunk copies up to max bytes of body (and one more, to notice an overlong body) to a
+// temporary file, hashing it when sum is set. readErr is set when the body broke off
+func spoolChunk(body io.Reader, max int64, sum *Checksum) (*spooled, int64, error) {
+	f, err := os.CreateTemp(spoolDir, "lumium-upload-*")
+	if err != nil {
+		return nil, 0, lumErrors.NewErrorf(lumErrors.ErrorCodeUnknown, "spool chunk: %v", err)
+	}
+	sp := &spooled{File: f}
+	var w io.Writer = f
+	if sum != nil {
+		sp.hash = sum.hash()
+		w = io.MultiWriter(f, sp.hash)
+	}
+	n, err := io.Copy(w, io.LimitReader(body, max+1))
+	if err != nil {
+		return sp, n, lumErrors.InvalidArgf("upload interrupted after %d bytes: %v", n, err)
+	}
+	return sp, n, nil
+}
+
+// chunkReader reads an upload's chunks back to back, opening each as it is reached
+type chunkReader struct {
+	ctx     context.Context
+	objects objstore.Store
+	chunks  []chunk
+	cur     io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := c.objects.Get(c.ctx, c.chunks[0].ObjectKey)
+			if err != nil {
+				return 0, err
+			}
+			c.cur, c.chunks = rc, c.chunks[1:]
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			_ = c.cur.Close()
+			c.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	return c.cur.Close()
+}
@@ -0,0 +1,338 @@
+package uploads
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	lumErrors "lumium/lib/errors"
+	"lumium/lib/lumnet"
+	"lumium/lib/objstore"
+	"lumium/lib/store"
+	"lumium/lib/svckit"
+	"lumium/services/api/acl"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	tenantID = "00000000-0000-4000-8000-000000000001"
+	userID   = "00000000-0000-4000-8000-000000000002"
+	otherID  = "00000000-0000-4000-8000-000000000003"
+)
+
+// outboxQueryer records the subjects enqueued on it
+type outboxQueryer struct {
+	events []string
+}
+
+func (q *outboxQueryer) Query(context.Context, string, ...any) (pgx.Rows, error) { return nil, nil }
+
+func (q *outboxQueryer) QueryRow(context.Context, string, ...any) pgx.Row { return nil }
+
+func (q *outboxQueryer) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "INSERT INTO outbox") {
+		q.events = append(q.events, args[2].(string))
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+// fakeRepo keeps uploads, chunks and photos in memory
+type fakeRepo struct {
+	quota   *int64
+	uploads map[string]*Upload
+	chunks  map[string][]chunk
+	photos  map[string]photo // sha256 -> photo
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{uploads: map[string]*Upload{}, chunks: map[string][]chunk{}, photos: map[string]photo{}}
+}
+
+func (f *fakeRepo) StorageUsage(context.Context, store.Queryer, string) (*int64, int64, error) {
+	var used int64
+	for _, p := range f.photos {
+		used += p.Size
+	}
+	for _, u := range f.uploads {
+		if !u.Complete() {
+			used += u.Length
+		}
+	}
+	return f.quota, used, nil
+}
+
+func (f *fakeRepo) Insert(
+	_ context.Context, _ store.Queryer, _, userID string, length int64, meta map[string]string,
+) (*Upload, error) {
+	u := &Upload{ID: uuid.NewString(), UserID: userID, Length: length, Metadata: meta, CreatedAt: now(), UpdatedAt: now()}
+	f.uploads[u.ID] = u
+	c := *u
+	return &c, nil
+}
+
+func (f *fakeRepo) Get(_ context.Context, _ store.Queryer, _, userID, uploadID string) (*Upload, error) {
+	u, ok := f.uploads[uploadID]
+	if !ok || u.UserID != userID {
+		return nil, pgx.ErrNoRows
+	}
+	c := *u
+	return &c, nil
+}
+
+func (f *fakeRepo) Advance(
+	_ context.Context, _ store.Queryer, _, uploadID string, from, size int64, key string,
+) (*Upload, error) {
+	u, ok := f.uploads[uploadID]
+	if !ok || u.Offset != from || u.Complete() {
+		return nil, pgx.ErrNoRows
+	}
+	u.Offset += size
+	u.UpdatedAt = now()
+	f.chunks[uploadID] = append(f.chunks[uploadID], chunk{Start: from, Size: size, ObjectKey: key})
+	c := *u
+	return &c, nil
+}
+
+func (f *fakeRepo) Chunks(_ context.Context, _ store.Queryer, uploadID string) ([]chunk, error) {
+	cs := append([]chunk(nil), f.chunks[uploadID]...)
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Start < cs[j].Start })
+	return cs, nil
+}
+
+func (f *fakeRepo) Complete(_ context.Context, _ store.Queryer, _, _, uploadID string, p photo) (string, error) {
+	u := f.uploads[uploadID]
+	if u.Complete() {
+		return "", nil
+	}
+	at := now()
+	u.CompletedAt = &at
+	if have, ok := f.photos[p.SHA256]; ok {
+		p = have
+	}
+	f.photos[p.SHA256] = p
+	u.PhotoID = &p.ID
+	delete(f.chunks, uploadID)
+	return p.ID, nil
+}
+
+func (f *fakeRepo) Delete(_ context.Context, _ store.Queryer, _, userID, uploadID string) ([]string, bool, error) {
+	u, ok := f.uploads[uploadID]
+	if !ok || u.UserID != userID {
+		return nil, false, nil
+	}
+	var keys []string
+	for _, c := range f.chunks[uploadID] {
+		keys = append(keys, c.ObjectKey)
+	}
+	delete(f.uploads, uploadID)
+	delete(f.chunks, uploadID)
+	return keys, true, nil
+}
+
+func (f *fakeRepo) Expire(_ context.Context, _ store.Queryer, before time.Time, limit int) ([]string, int, error) {
+	var keys []string
+	n := 0
+	for id, u := range f.uploads {
+		if u.Complete() || !u.UpdatedAt.Before(before) || n == limit {
+			continue
+		}
+		for _, c := range f.chunks[id] {
+			keys = append(keys, c.ObjectKey)
+		}
+		delete(f.uploads, id)
+		delete(f.chunks, id)
+		n++
+	}
+	return keys, n, nil
+}
+
+func sha1Checksum(b string) *Checksum {
+	sum := sha1.Sum([]byte(b))
+	return &Checksum{Algorithm: "sha1", Sum: sum[:]}
+}
+
+func TestUploads(t *testing.T) {
+	Convey("Given the uploads service", t, func() {
+		q := &outboxQueryer{}
+		withTenantTx = func(
+			_ context.Context, _ store.Beginner, _ store.Scope, _ store.TxOptions, fn func(store.Queryer) error,
+		) error {
+			return fn(q)
+		}
+		withTx = func(_ context.Context, _ store.Beginner, fn func(store.Queryer) error) error { return fn(q) }
+		clock := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+		now = func() time.Time { return clock }
+		spoolDir = t.TempDir()
+		Reset(func() { now = time.Now; spoolDir = "" })
+
+		repo := newFakeRepo()
+		objects := objstore.NewMemory()
+		cfg := Config{MaxSize: 1 << 20, Expiry: time.Hour}
+		s := NewService(nil, objects, cfg, svckit.WithRepo[*pgxpool.Pool, Repo, Config](repo))
+		ctx := context.Background()
+		p := acl.Principal{TenantID: tenantID, UserID: userID}
+		meta := map[string]string{"filename": "beach.jpg", "filetype": "image/jpeg"}
+
+		Convey("chunks sent in order are assembled into a photo", func() {
+			u, err := s.Create(ctx, p, 11, meta)
+			So(err, ShouldBeNil)
+			u, err = s.Append(ctx, p, u.ID, 0, strings.NewReader("hello "), sha1Checksum("hello "))
+			So(err, ShouldBeNil)
+			So(u.Offset, ShouldEqual, 6)
+			So(u.Complete(), ShouldBeFalse)
+
+			u, err = s.Append(ctx, p, u.ID, 6, strings.NewReader("world"), nil)
+			So(err, ShouldBeNil)
+			So(u.Complete(), ShouldBeTrue)
+			So(u.PhotoID, ShouldNotBeNil)
+			So(q.events, ShouldResemble, []string{"events.photo.ingested"})
+
+			sum := sha256.Sum256([]byte("hello world"))
+			ph := repo.photos[hex.EncodeToString(sum[:])]
+			So(ph.ID, ShouldEqual, *u.PhotoID)
+			So(ph.Filename, ShouldEqual, "beach.jpg")
+			rc, err := objects.Get(ctx, ph.ObjectKey)
+			So(err, ShouldBeNil)
+			b, _ := io.ReadAll(rc)
+			So(string(b), ShouldEqual, "hello world")
+			So(objects.Len(), ShouldEqual, 1) // the chunks are gone
+
+			Convey("and the same bytes uploaded again point at that photo", func() {
+				again, err := s.Create(ctx, p, 11, meta)
+				So(err, ShouldBeNil)
+				again, err = s.Append(ctx, p, again.ID, 0, strings.NewReader("hello world"), nil)
+				So(err, ShouldBeNil)
+				So(*again.PhotoID, ShouldEqual, *u.PhotoID)
+				So(objects.Len(), ShouldEqual, 1)
+				So(q.events, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("a chunk at the wrong offset is a conflict", func() {
+			u, _ := s.Create(ctx, p, 10, meta)
+			_, err := s.Append(ctx, p, u.ID, 4, strings.NewReader("abcdef"), nil)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeConflict), ShouldBeTrue)
+			So(objects.Len(), ShouldEqual, 0)
+		})
+
+		Convey("a chunk running past Upload-Length is refused", func() {
+			u, _ := s.Create(ctx, p, 4, meta)
+			_, err := s.Append(ctx, p, u.ID, 0, strings.NewReader("abcdef"), nil)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePayloadTooLarge), ShouldBeTrue)
+		})
+
+		Convey("a chunk that doesn't match its checksum is discarded", func() {
+			u, _ := s.Create(ctx, p, 10, meta)
+			_, err := s.Append(ctx, p, u.ID, 0, strings.NewReader("abcde"), sha1Checksum("abcdX"))
+			var prob *lumnet.Problem
+			So(errors.As(err, &prob), ShouldBeTrue)
+			So(prob.Status, ShouldEqual, 460)
+			So(objects.Len(), ShouldEqual, 0)
+			got, err := s.Get(ctx, p, u.ID)
+			So(err, ShouldBeNil)
+			So(got.Offset, ShouldEqual, 0)
+		})
+
+		Convey("a body that breaks off is kept up to where it stopped", func() {
+			u, _ := s.Create(ctx, p, 10, meta)
+			body := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errors.New("connection reset")))
+			u, err := s.Append(ctx, p, u.ID, 0, body, nil)
+			So(err, ShouldBeNil)
+			So(u.Offset, ShouldEqual, 3)
+
+			Convey("unless it carried a checksum", func() {
+				body := io.MultiReader(strings.NewReader("def"), iotest.ErrReader(errors.New("connection reset")))
+				_, err := s.Append(ctx, p, u.ID, 3, body, sha1Checksum("defghij"))
+				So(err, ShouldNotBeNil)
+				got, _ := s.Get(ctx, p, u.ID)
+				So(got.Offset, ShouldEqual, 3)
+			})
+		})
+
+		Convey("another user's upload isn't found", func() {
+			u, _ := s.Create(ctx, p, 10, meta)
+			_, err := s.Get(ctx, acl.Principal{TenantID: tenantID, UserID: otherID}, u.ID)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeNotFound), ShouldBeTrue)
+		})
+
+		Convey("the storage quota counts unfinished uploads at their full length", func() {
+			quota := int64(100)
+			repo.quota = &quota
+			_, err := s.Create(ctx, p, 60, meta)
+			So(err, ShouldBeNil)
+			_, err = s.Create(ctx, p, 50, meta)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePayloadTooLarge), ShouldBeTrue)
+			_, err = s.Create(ctx, p, 40, meta)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("an upload over the size limit is refused up front", func() {
+			_, err := s.Create(ctx, p, cfg.MaxSize+1, meta)
+			So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodePayloadTooLarge), ShouldBeTrue)
+			So(repo.uploads, ShouldBeEmpty)
+		})
+
+		Convey("an upload left idle past the expiry", func() {
+			stale, _ := s.Create(ctx, p, 10, meta)
+			stale, err := s.Append(ctx, p, stale.ID, 0, strings.NewReader("abc"), nil)
+			So(err, ShouldBeNil)
+			done, _ := s.Create(ctx, p, 2, meta)
+			_, err = s.Append(ctx, p, done.ID, 0, strings.NewReader("ok"), nil)
+			So(err, ShouldBeNil)
+			So(objects.Len(), ShouldEqual, 2) // stale's chunk and done's photo
+
+			clock = clock.Add(30 * time.Minute)
+			fresh, _ := s.Create(ctx, p, 10, meta)
+			clock = clock.Add(45 * time.Minute)
+
+			Convey("is gone", func() {
+				_, err := s.Get(ctx, p, stale.ID)
+				So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeGone), ShouldBeTrue)
+				_, err = s.Append(ctx, p, stale.ID, 3, strings.NewReader("def"), nil)
+				So(lumErrors.IsErrorCode(err, lumErrors.ErrorCodeGone), ShouldBeTrue)
+			})
+
+			Convey("and is reaped with its chunks, leaving newer and finished uploads", func() {
+				n, err := s.Reap(ctx)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				So(repo.uploads, ShouldNotContainKey, stale.ID)
+				So(repo.uploads, ShouldContainKey, fresh.ID)
+				So(repo.uploads, ShouldContainKey, done.ID)
+				So(objects.Len(), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestUploadHeaders(t *testing.T) {
+	Convey("An unfinished upload advertises when it expires", t, func() {
+		u := &Upload{Length: 10, Offset: 4, UpdatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+		rec := httptest.NewRecorder()
+		setUploadHeaders(rec, u, time.Hour)
+		So(rec.Header().Get("Upload-Offset"), ShouldEqual, "4")
+		So(rec.Header().Get("Upload-Expires"), ShouldEqual, "Thu, 01 Oct 2026 13:00:00 GMT")
+
+		Convey("and a finished one doesn't", func() {
+			done := time.Now()
+			u.CompletedAt = &done
+			rec := httptest.NewRecorder()
+			setUploadHeaders(rec, u, time.Hour)
+			So(rec.Header().Get("Upload-Expires"), ShouldBeBlank)
+		})
+	})
+}
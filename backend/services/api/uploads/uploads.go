@@ -0,0 +1,110 @@
+// Package uploads serves resumable uploads over the tus 1.0 protocol (https://tus.io): creation,
+// termination and checksum extensions. Each PATCH is kept as a chunk object; once every byte has
+// arrived the chunks are assembled into the original, recorded as a photo and announced with a
+// photo.ingested event. Uploads left unfinished expire, and a reaper deletes them and their chunks
+package uploads
+
+import (
+	"context"
+	"time"
+
+	"lumium/lib/config"
+	"lumium/lib/logger"
+	"lumium/lib/lumnet"
+	"lumium/lib/objstore"
+	"lumium/lib/svckit"
+	"lumium/services/api/auth"
+	"lumium/services/api/handlers"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// svc embeds the shared Kit so we get DB/Repo/Cfg without redefining fields
+type svc struct {
+	*svckit.Kit[*pgxpool.Pool, Repo, Config]
+	objects objstore.Store
+}
+
+// Config is the configuration wrapper for uploads
+type Config struct {
+	MaxSize      int64         // largest Upload-Length accepted (UPLOAD_MAX_SIZE)
+	DefaultQuota int64         // bytes per tenant without its own quota; 0 is unlimited (STORAGE_QUOTA_BYTES)
+	Expiry       time.Duration // how long an unfinished upload lives after its last PATCH (UPLOAD_EXPIRY)
+	ReapInterval time.Duration // how often expired uploads are deleted; 0 disables it (UPLOAD_REAP_INTERVAL)
+}
+
+// LoadConfig reads the upload limits from the environment
+func LoadConfig() Config {
+	return Config{
+		MaxSize:      int64(config.MayInt("UPLOAD_MAX_SIZE", 2<<30)),
+		DefaultQuota: int64(config.MayInt("STORAGE_QUOTA_BYTES", 0)),
+		Expiry:       config.MayDuration("UPLOAD_EXPIRY", 24*time.Hour),
+		ReapInterval: config.MayDuration("UPLOAD_REAP_INTERVAL", 10*time.Minute),
+	}
+}
+
+// NewService defaults to NewRepo(), but can be overridden with WithRepo(...)
+func NewService(
+	db *pgxpool.Pool,
+	objects objstore.Store,
+	c Config,
+	o ...svckit.Opt[*pgxpool.Pool, Repo, Config],
+) Service {
+	return &svc{Kit: svckit.New(db, NewRepo, c, o...), objects: objects}
+}
+
+// Uploads is the wrapper for the /uploads service
+type Uploads struct {
+	app     *handlers.App
+	svc     Service
+	cfg     Config
+	authCfg auth.Config
+	perms   auth.PermissionResolver
+}
+
+type repo struct{}
+
+// NewRepo creates a repo pointer
+func NewRepo() Repo { return &repo{} }
+
+// New creates a new Uploads pointer and starts reaping expired uploads. The app must have an
+// object store; see objstore.FromEnv
+func New(app *handlers.App, perms auth.PermissionResolver) *Uploads {
+	if app.Objects == nil {
+		l := logger.Get()
+		l.Panic().Msg("uploads: no object store configured")
+	}
+	cfg := LoadConfig()
+	h := &Uploads{
+		app:     app,
+		svc:     NewService(app.DB, app.Objects, cfg),
+		cfg:     cfg,
+		authCfg: auth.LoadConfig(),
+		perms:   perms,
+	}
+	if cfg.Expiry > 0 && cfg.ReapInterval > 0 {
+		go reap(context.Background(), h.svc, cfg.ReapInterval)
+	}
+	return h
+}
+
+// Wire defines the HTTP endpoint structure
+func (h *Uploads) Wire(r chi.Router) {
+	r.Route("/uploads", func(r chi.Router) {
+		r.Use(tusResumable)
+
+		// capability discovery is public, as tus clients probe it before authenticating
+		r.Options("/", lumnet.Adapt(h.Options))
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.Authenticate(h.authCfg), auth.RequirePermission(h.perms, "photos.write"),
+				lumnet.CacheControl(lumnet.CacheNoStore))
+			r.Post("/", lumnet.Adapt(h.Create))
+			r.Head("/{id}", lumnet.Adapt(h.Head))
+			r.Patch("/{id}", lumnet.Adapt(h.Patch))
+			r.Delete("/{id}", lumnet.Adapt(h.Delete))
+		})
+	})
+	lumnet.InitValidator()
+}
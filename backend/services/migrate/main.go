@@ -0,0 +1,92 @@
+// Command migrate applies, reverts or reports on the embedded schema migrations.
+//
+//	go run ./services/migrate [-dry-run] up
+//	go run ./services/migrate [-dry-run] -steps 1 down
+//	go run ./services/migrate status
+//
+// The API also runs `up` on start unless SERVICE_PGSQL_MIGRATE_ON_START=false
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"lumium/lib/logger"
+	"lumium/lib/store"
+	"lumium/lib/store/migrate"
+	"lumium/migrations"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would change without changing it")
+	steps := flag.Int("steps", 1, "number of migrations to revert with down")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: migrate [-dry-run] [-steps n] up|down|status\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd := flag.Arg(0)
+	if cmd == "" {
+		cmd = "status"
+	}
+
+	l := logger.Get()
+	opts := migrations.Options()
+	opts.DryRun = *dryRun
+	m, err := migrate.New(migrations.FS, opts)
+	if err != nil {
+		l.Fatal().Err(err).Msg("migrate: load")
+	}
+
+	h := store.NewHandler(true)
+	defer h.Close()
+
+	ctx := context.Background()
+	conn, err := h.PgxPool.Acquire(ctx)
+	if err != nil {
+		l.Fatal().Err(err).Msg("migrate: acquire connection")
+	}
+	defer conn.Release()
+
+	switch cmd {
+	case "up":
+		_, err = m.Up(ctx, conn)
+	case "down":
+		_, err = m.Down(ctx, conn, *steps)
+	case "status":
+		var st []migrate.Status
+		if st, err = m.Status(ctx, conn); err == nil {
+			printStatus(os.Stdout, st)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		l.Fatal().Err(err).Str("cmd", cmd).Msg("migrate")
+	}
+}
+
+func printStatus(w io.Writer, st []migrate.Status) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range st {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Missing:
+			state = "applied, file missing"
+		case s.Modified:
+			state = "applied, file modified"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,27 @@
+// Command relay publishes committed outbox records to NATS JetStream. Several replicas may run;
+// an advisory lock makes exactly one of them publish at a time
+package main
+
+import (
+	"context"
+
+	"lumium/lib/outbox"
+	"lumium/lib/svckit"
+)
+
+func main() {
+	svckit.Run(svckit.Service{
+		Name:    "lumium_relay",
+		UseDB:   true,
+		UseNATS: true,
+		Setup: func(ctx context.Context, rt *svckit.Runtime) error {
+			if err := outbox.EnsureStream(ctx, rt.JS, outbox.LoadStreamConfig()); err != nil {
+				return err
+			}
+			r := outbox.NewRelay(outbox.NewPGStore(rt.DB.PgxPool), outbox.NewJetStreamPublisher(rt.JS),
+				outbox.LoadOptions())
+			rt.Go("relay", r.Run)
+			return nil
+		},
+	})
+}
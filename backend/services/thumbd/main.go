@@ -1,12 +1,26 @@
+// Command thumbd is the thumbnail worker. It has no consumers yet; they are registered in Setup as
+// the events they handle come online
 package main
 
 import (
-	"fmt"
-	"net/http"
+	"context"
+
+	"lumium/lib/config"
+	"lumium/lib/health"
+	"lumium/lib/svckit"
 )
 
 func main() {
-	http.ListenAndServe(":8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "Hello, world!")
-	}))
+	svckit.Run(svckit.Service{
+		Name:    "lumium_thumbd",
+		UseDB:   true,
+		UseNATS: true,
+		Setup: func(_ context.Context, rt *svckit.Runtime) error {
+			rt.Health.Register(health.Check{
+				Name: "minio",
+				Fn:   health.MinIO(config.MustString("SERVICE_S3_ENDPOINT")),
+			})
+			return nil
+		},
+	})
 }
@@ -0,0 +1,14 @@
+"use server"
+
+import { AuthAPI } from "@/lib/api/auth"
+
+export async function notMe(_prev: { error?: string; ok?: boolean } | null, formData: FormData) {
+  const token = formData.get("token") as string
+
+  try {
+    await AuthAPI.notMe(token)
+    return { ok: true }
+  } catch {
+    return { error: "This link is invalid or has expired" }
+  }
+}
@@ -0,0 +1,61 @@
+"use client"
+
+import { Button, CardBody, CardHeader } from "@heroui/react"
+import { use, useActionState } from "react"
+import { notMe } from "./actions"
+
+// Landing page for the "this wasn't me" link in new-device emails. Revoking takes a click so
+// link scanners that prefetch the URL can't sign the device out on their own
+export default function NotMePage({
+  searchParams,
+}: {
+  searchParams: Promise<{ token?: string }>
+}) {
+  const { token = "" } = use(searchParams)
+  const [state, formAction, pending] = useActionState(notMe, null)
+
+  return (
+    <>
+      <CardHeader className="flex items-center justify-between px-6 py-6">
+        <div>
+          <h1 className="text-xl font-semibold">Wasn&apos;t you?</h1>
+          <p className="mt-1 text-sm text-[hsl(var(--text-2))]">
+            Sign the new device out of your account
+          </p>
+        </div>
+        <div className="rounded-xl border border-white/10 bg-white/10 px-3 py-1 text-xs text-white/80">
+          <a href="/" className="text-sm text-[hsl(var(--text-2))] hover:text-white">
+            Lumium
+          </a>
+        </div>
+      </CardHeader>
+      <CardBody className="px-6 pt-2 pb-8">
+        {(state as any)?.ok ? (
+          <p className="text-sm text-green-400">
+            That device has been signed out. Change your password to keep it out.{" "}
+            <a className="underline hover:text-white" href="/auth/forgot-password">
+              Reset password
+            </a>
+          </p>
+        ) : (
+          <form action={formAction} className="grid gap-5">
+            <input type="hidden" name="token" value={token} />
+
+            {(state as any)?.error && (
+              <p className="text-sm text-red-400">{(state as any).error}</p>
+            )}
+
+            <Button
+              type="submit"
+              isLoading={pending}
+              isDisabled={!token}
+              className="btn-primary mt-1 h-11 rounded-md"
+            >
+              Sign that device out
+            </Button>
+          </form>
+        )}
+      </CardBody>
+    </>
+  )
+}
@@ -28,6 +28,7 @@ export const AuthAPI = {
     api.post<AuthResult>("/auth/mfa/verify", { challenge_id, code }),
   forgot: (email: string) => api.post<void>("/auth/forgot", { email }),
   reset: (token: string, password: string) => api.post<void>("/auth/reset", { token, password }),
+  notMe: (token: string) => api.post<void>("/auth/not-me", { token }),
   me: () => api.get<AuthResult["user"]>("/auth/me"),
   logout: () => api.post<void>("/auth/logout"),
 }